@@ -381,6 +381,9 @@ var depsRules = `
 	NET, log
 	< net/mail;
 
+	NET
+	< net/dnstest;
+
 	NONE < crypto/internal/boring/sig, crypto/internal/boring/syso;
 	sync/atomic < crypto/internal/boring/bcache, crypto/internal/boring/fipstls;
 	crypto/internal/boring/sig, crypto/internal/boring/fipstls < crypto/tls/fipsonly;
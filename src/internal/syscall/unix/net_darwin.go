@@ -159,3 +159,114 @@ func ResNsearch(state *ResState, dname *byte, class, typ int, ans *byte, anslen
 	}
 	return int(int32(r1)), nil
 }
+
+// A DNSResolver is a resolver configuration of the system, as
+// returned by DNSConfiguration.
+type DNSResolver struct {
+	Domain      string // empty for the default resolver
+	Nameservers []DNSNameserver
+	Port        uint16 // in host byte order; 0 means the default port
+	Search      []string
+	Options     string
+}
+
+// A DNSNameserver is the address of a name server of a DNSResolver.
+type DNSNameserver struct {
+	IP      []byte // 4 or 16 bytes
+	ScopeID uint32
+}
+
+//go:cgo_import_dynamic libc_dns_configuration_copy dns_configuration_copy "/usr/lib/libSystem.B.dylib"
+func libc_dns_configuration_copy_trampoline()
+
+//go:cgo_import_dynamic libc_dns_configuration_free dns_configuration_free "/usr/lib/libSystem.B.dylib"
+func libc_dns_configuration_free_trampoline()
+
+// Offsets in the dns_config_t and dns_resolver_t structures of
+// dnsinfo.h. The structures are packed to 4 bytes, and their pointers
+// take 8 bytes on all architectures, so pointers may be misaligned.
+const (
+	dnsConfigNResolver = 0
+	dnsConfigResolver  = 4
+
+	dnsResolverDomain      = 0
+	dnsResolverNNameserver = 8
+	dnsResolverNameserver  = 12
+	dnsResolverPort        = 20
+	dnsResolverNSearch     = 24
+	dnsResolverSearch      = 28
+	dnsResolverOptions     = 48
+)
+
+// DNSConfiguration returns the resolver configurations that configd
+// publishes from the SystemConfiguration dynamic store, the first of
+// which is the default one. Scoped resolvers are not returned. It
+// returns nil if the configuration is not available.
+func DNSConfiguration() []DNSResolver {
+	r1, _, _ := syscall_syscall(abi.FuncPCABI0(libc_dns_configuration_copy_trampoline), 0, 0, 0)
+	config := unsafe.Pointer(r1)
+	if config == nil {
+		return nil
+	}
+	defer syscall_syscall(abi.FuncPCABI0(libc_dns_configuration_free_trampoline), uintptr(config), 0, 0)
+
+	n := dnsinfoInt(config, dnsConfigNResolver)
+	list := dnsinfoPtr(config, dnsConfigResolver)
+	resolvers := make([]DNSResolver, 0, n)
+	for i := 0; i < n; i++ {
+		r := dnsinfoPtr(list, uintptr(i)*8)
+		if r == nil {
+			continue
+		}
+		res := DNSResolver{
+			Domain:  dnsinfoString(r, dnsResolverDomain),
+			Port:    *(*uint16)(unsafe.Add(r, dnsResolverPort)),
+			Options: dnsinfoString(r, dnsResolverOptions),
+		}
+		addrs := dnsinfoPtr(r, dnsResolverNameserver)
+		for j := 0; j < dnsinfoInt(r, dnsResolverNNameserver); j++ {
+			sa := dnsinfoPtr(addrs, uintptr(j)*8)
+			if sa == nil {
+				continue
+			}
+			switch (*syscall.RawSockaddr)(sa).Family {
+			case syscall.AF_INET:
+				a := (*syscall.RawSockaddrInet4)(sa)
+				res.Nameservers = append(res.Nameservers, DNSNameserver{IP: append([]byte(nil), a.Addr[:]...)})
+			case syscall.AF_INET6:
+				a := (*syscall.RawSockaddrInet6)(sa)
+				res.Nameservers = append(res.Nameservers, DNSNameserver{IP: append([]byte(nil), a.Addr[:]...), ScopeID: a.Scope_id})
+			}
+		}
+		search := dnsinfoPtr(r, dnsResolverSearch)
+		for j := 0; j < dnsinfoInt(r, dnsResolverNSearch); j++ {
+			if s := dnsinfoString(search, uintptr(j)*8); s != "" {
+				res.Search = append(res.Search, s)
+			}
+		}
+		resolvers = append(resolvers, res)
+	}
+	return resolvers
+}
+
+// dnsinfoPtr returns the pointer at offset off of p, which need not be
+// aligned.
+func dnsinfoPtr(p unsafe.Pointer, off uintptr) unsafe.Pointer {
+	var v unsafe.Pointer
+	copy((*[8]byte)(unsafe.Pointer(&v))[:], unsafe.Slice((*byte)(unsafe.Add(p, off)), 8))
+	return v
+}
+
+// dnsinfoInt returns the int32 at offset off of p.
+func dnsinfoInt(p unsafe.Pointer, off uintptr) int {
+	return int(*(*int32)(unsafe.Add(p, off)))
+}
+
+// dnsinfoString returns the C string pointed to at offset off of p.
+func dnsinfoString(p unsafe.Pointer, off uintptr) string {
+	s := (*byte)(dnsinfoPtr(p, off))
+	if s == nil {
+		return ""
+	}
+	return GoString(s)
+}
@@ -367,3 +367,75 @@ func LoadGetFinalPathNameByHandle() error {
 //sys	DestroyEnvironmentBlock(block *uint16) (err error) = userenv.DestroyEnvironmentBlock
 
 //sys	RtlGenRandom(buf []byte) (err error) = advapi32.SystemFunction036
+
+const (
+	NS_ALL = 0
+
+	WSA_E_CANCELLED = syscall.Errno(10111)
+)
+
+type AddrinfoExW struct {
+	Flags     int32
+	Family    int32
+	Socktype  int32
+	Protocol  int32
+	Addrlen   uintptr
+	Canonname *uint16
+	Addr      syscall.Pointer
+	Blob      uintptr
+	Bloblen   uintptr
+	Provider  *syscall.GUID
+	Next      *AddrinfoExW
+}
+
+//sys	GetAddrInfoExW(name *uint16, service *uint16, namespace uint32, nspid *syscall.GUID, hints *AddrinfoExW, result **AddrinfoExW, timeout *syscall.Timeval, overlapped *syscall.Overlapped, completionRoutine uintptr, handle *syscall.Handle) (sockerr error) = ws2_32.GetAddrInfoExW
+//sys	GetAddrInfoExCancel(handle *syscall.Handle) (sockerr error) = ws2_32.GetAddrInfoExCancel
+//sys	FreeAddrInfoExW(addrinfo *AddrinfoExW) = ws2_32.FreeAddrInfoExW
+
+// LoadGetAddrInfoExCancel reports whether GetAddrInfoExW can run
+// asynchronously and be cancelled, which requires Windows 8 or newer.
+func LoadGetAddrInfoExCancel() error {
+	return procGetAddrInfoExCancel.Find()
+}
+
+const (
+	DNS_QUERY_REQUEST_VERSION1 = 1
+	DNS_QUERY_RESULTS_VERSION1 = 1
+
+	DNS_REQUEST_PENDING = syscall.Errno(9506)
+)
+
+type DNSQueryRequest struct {
+	Version   uint32
+	QueryName *uint16
+	QueryType uint16
+	// Pad QueryOptions to its 8-byte C alignment, which Go does not
+	// guarantee for uint64 fields on 32-bit systems.
+	_                       [6]byte
+	QueryOptions            uint64
+	DnsServerList           uintptr
+	InterfaceIndex          uint32
+	QueryCompletionCallback uintptr
+	QueryContext            uintptr
+}
+
+type DNSQueryResult struct {
+	Version      uint32
+	QueryStatus  int32
+	QueryOptions uint64
+	QueryRecords *syscall.DNSRecord
+	Reserved     uintptr
+}
+
+type DNSQueryCancel struct {
+	Reserved [32]byte
+}
+
+//sys	DnsQueryEx(request *DNSQueryRequest, result *DNSQueryResult, cancel *DNSQueryCancel) (status error) = dnsapi.DnsQueryEx
+//sys	DnsCancelQuery(cancel *DNSQueryCancel) (status error) = dnsapi.DnsCancelQuery
+
+// LoadDnsQueryEx reports whether DnsQueryEx is available, which
+// requires Windows 8 or newer.
+func LoadDnsQueryEx() error {
+	return procDnsQueryEx.Find()
+}
@@ -38,6 +38,7 @@ func errnoErr(e syscall.Errno) error {
 
 var (
 	modadvapi32 = syscall.NewLazyDLL(sysdll.Add("advapi32.dll"))
+	moddnsapi   = syscall.NewLazyDLL(sysdll.Add("dnsapi.dll"))
 	modiphlpapi = syscall.NewLazyDLL(sysdll.Add("iphlpapi.dll"))
 	modkernel32 = syscall.NewLazyDLL(sysdll.Add("kernel32.dll"))
 	modnetapi32 = syscall.NewLazyDLL(sysdll.Add("netapi32.dll"))
@@ -53,6 +54,8 @@ var (
 	procRevertToSelf                 = modadvapi32.NewProc("RevertToSelf")
 	procSetTokenInformation          = modadvapi32.NewProc("SetTokenInformation")
 	procSystemFunction036            = modadvapi32.NewProc("SystemFunction036")
+	procDnsCancelQuery               = moddnsapi.NewProc("DnsCancelQuery")
+	procDnsQueryEx                   = moddnsapi.NewProc("DnsQueryEx")
 	procGetAdaptersAddresses         = modiphlpapi.NewProc("GetAdaptersAddresses")
 	procGetACP                       = modkernel32.NewProc("GetACP")
 	procGetComputerNameExW           = modkernel32.NewProc("GetComputerNameExW")
@@ -76,6 +79,9 @@ var (
 	procCreateEnvironmentBlock       = moduserenv.NewProc("CreateEnvironmentBlock")
 	procDestroyEnvironmentBlock      = moduserenv.NewProc("DestroyEnvironmentBlock")
 	procGetProfilesDirectoryW        = moduserenv.NewProc("GetProfilesDirectoryW")
+	procFreeAddrInfoExW              = modws2_32.NewProc("FreeAddrInfoExW")
+	procGetAddrInfoExCancel          = modws2_32.NewProc("GetAddrInfoExCancel")
+	procGetAddrInfoExW               = modws2_32.NewProc("GetAddrInfoExW")
 	procWSASocketW                   = modws2_32.NewProc("WSASocketW")
 )
 
@@ -156,6 +162,22 @@ func RtlGenRandom(buf []byte) (err error) {
 	return
 }
 
+func DnsCancelQuery(cancel *DNSQueryCancel) (status error) {
+	r0, _, _ := syscall.Syscall(procDnsCancelQuery.Addr(), 1, uintptr(unsafe.Pointer(cancel)), 0, 0)
+	if r0 != 0 {
+		status = syscall.Errno(r0)
+	}
+	return
+}
+
+func DnsQueryEx(request *DNSQueryRequest, result *DNSQueryResult, cancel *DNSQueryCancel) (status error) {
+	r0, _, _ := syscall.Syscall(procDnsQueryEx.Addr(), 3, uintptr(unsafe.Pointer(request)), uintptr(unsafe.Pointer(result)), uintptr(unsafe.Pointer(cancel)))
+	if r0 != 0 {
+		status = syscall.Errno(r0)
+	}
+	return
+}
+
 func GetAdaptersAddresses(family uint32, flags uint32, reserved uintptr, adapterAddresses *IpAdapterAddresses, sizePointer *uint32) (errcode error) {
 	r0, _, _ := syscall.Syscall6(procGetAdaptersAddresses.Addr(), 5, uintptr(family), uintptr(flags), uintptr(reserved), uintptr(unsafe.Pointer(adapterAddresses)), uintptr(unsafe.Pointer(sizePointer)), 0)
 	if r0 != 0 {
@@ -344,6 +366,27 @@ func GetProfilesDirectory(dir *uint16, dirLen *uint32) (err error) {
 	return
 }
 
+func FreeAddrInfoExW(addrinfo *AddrinfoExW) {
+	syscall.Syscall(procFreeAddrInfoExW.Addr(), 1, uintptr(unsafe.Pointer(addrinfo)), 0, 0)
+	return
+}
+
+func GetAddrInfoExCancel(handle *syscall.Handle) (sockerr error) {
+	r0, _, _ := syscall.Syscall(procGetAddrInfoExCancel.Addr(), 1, uintptr(unsafe.Pointer(handle)), 0, 0)
+	if r0 != 0 {
+		sockerr = syscall.Errno(r0)
+	}
+	return
+}
+
+func GetAddrInfoExW(name *uint16, service *uint16, namespace uint32, nspid *syscall.GUID, hints *AddrinfoExW, result **AddrinfoExW, timeout *syscall.Timeval, overlapped *syscall.Overlapped, completionRoutine uintptr, handle *syscall.Handle) (sockerr error) {
+	r0, _, _ := syscall.Syscall12(procGetAddrInfoExW.Addr(), 10, uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(service)), uintptr(namespace), uintptr(unsafe.Pointer(nspid)), uintptr(unsafe.Pointer(hints)), uintptr(unsafe.Pointer(result)), uintptr(unsafe.Pointer(timeout)), uintptr(unsafe.Pointer(overlapped)), uintptr(completionRoutine), uintptr(unsafe.Pointer(handle)), 0, 0)
+	if r0 != 0 {
+		sockerr = syscall.Errno(r0)
+	}
+	return
+}
+
 func WSASocket(af int32, typ int32, protocol int32, protinfo *syscall.WSAProtocolInfo, group uint32, flags uint32) (handle syscall.Handle, err error) {
 	r0, _, e1 := syscall.Syscall6(procWSASocketW.Addr(), 6, uintptr(af), uintptr(typ), uintptr(protocol), uintptr(unsafe.Pointer(protinfo)), uintptr(group), uintptr(flags))
 	handle = syscall.Handle(r0)
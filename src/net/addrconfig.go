@@ -0,0 +1,70 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/godebug"
+	"sync"
+	"time"
+)
+
+var addrFamilies struct {
+	sync.Mutex
+	expires    time.Time
+	has4, has6 bool
+}
+
+// hostAddrFamilies reports whether the host has IPv4 addresses other
+// than loopback ones, and IPv6 addresses other than loopback and
+// link-local ones. The answer is kept for a few seconds, as interfaces
+// rarely change.
+func hostAddrFamilies() (has4, has6 bool) {
+	addrFamilies.Lock()
+	defer addrFamilies.Unlock()
+	now := clockNow()
+	if now.Before(addrFamilies.expires) {
+		return addrFamilies.has4, addrFamilies.has6
+	}
+	ifat, err := interfaceAddrTable(nil)
+	if err != nil {
+		has4, has6 = true, true
+	}
+	for _, ifa := range ifat {
+		var ip IP
+		switch ifa := ifa.(type) {
+		case *IPNet:
+			ip = ifa.IP
+		case *IPAddr:
+			ip = ifa.IP
+		}
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		if ip.To4() != nil {
+			has4 = true
+		} else if !ip.IsLinkLocalUnicast() {
+			has6 = true
+		}
+	}
+	addrFamilies.has4, addrFamilies.has6 = has4, has6
+	addrFamilies.expires = now.Add(5 * time.Second)
+	return has4, has6
+}
+
+// addrConfig reports whether a lookup of the addresses of any family
+// should ask for IPv4 and IPv6 addresses. As with the AI_ADDRCONFIG flag
+// of getaddrinfo, a family is only asked for if the host has addresses
+// of it, unless it has none of either. GODEBUG=netdnsaddrconfig=0 asks
+// for both.
+func addrConfig() (want4, want6 bool) {
+	if godebug.Get("netdnsaddrconfig") == "0" {
+		return true, true
+	}
+	has4, has6 := testHookHostAddrFamilies()
+	if !has4 && !has6 {
+		return true, true
+	}
+	return has4, has6
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import "testing"
+
+func TestAddrConfig(t *testing.T) {
+	defer func(orig func() (bool, bool)) { testHookHostAddrFamilies = orig }(testHookHostAddrFamilies)
+	t.Setenv("GODEBUG", "")
+	for _, tt := range []struct {
+		has4, has6   bool
+		want4, want6 bool
+	}{
+		{true, true, true, true},
+		{true, false, true, false},
+		{false, true, false, true},
+		{false, false, true, true},
+	} {
+		testHookHostAddrFamilies = func() (bool, bool) { return tt.has4, tt.has6 }
+		if want4, want6 := addrConfig(); want4 != tt.want4 || want6 != tt.want6 {
+			t.Errorf("with addresses %v, %v: addrConfig() = %v, %v; want %v, %v", tt.has4, tt.has6, want4, want6, tt.want4, tt.want6)
+		}
+	}
+
+	t.Setenv("GODEBUG", "netdnsaddrconfig=0")
+	testHookHostAddrFamilies = func() (bool, bool) { return true, false }
+	if want4, want6 := addrConfig(); !want4 || !want6 {
+		t.Errorf("with netdnsaddrconfig=0: addrConfig() = %v, %v; want true, true", want4, want6)
+	}
+}
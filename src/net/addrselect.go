@@ -15,10 +15,12 @@ func sortByRFC6724(addrs []IPAddr) {
 	if len(addrs) < 2 {
 		return
 	}
-	sortByRFC6724withSrcs(addrs, srcAddrs(addrs))
+	sortByRFC6724withSrcs(addrs, srcAddrs(addrs), systemGAIConf())
 }
 
-func sortByRFC6724withSrcs(addrs []IPAddr, srcs []netip.Addr) {
+// sortByRFC6724withSrcs sorts addrs, reached from srcs, with the policy
+// table changed by gai, which may be nil.
+func sortByRFC6724withSrcs(addrs []IPAddr, srcs []netip.Addr, gai *gaiConf) {
 	if len(addrs) != len(srcs) {
 		panic("internal error")
 	}
@@ -26,8 +28,8 @@ func sortByRFC6724withSrcs(addrs []IPAddr, srcs []netip.Addr) {
 	srcAttr := make([]ipAttr, len(srcs))
 	for i, v := range addrs {
 		addrAttrIP, _ := netip.AddrFromSlice(v.IP)
-		addrAttr[i] = ipAttrOf(addrAttrIP)
-		srcAttr[i] = ipAttrOf(srcs[i])
+		addrAttr[i] = gai.attrOf(addrAttrIP)
+		srcAttr[i] = gai.attrOf(srcs[i])
 	}
 	sort.Stable(&byRFC6724{
 		addrs:    addrs,
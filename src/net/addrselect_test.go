@@ -124,7 +124,7 @@ func TestSortByRFC6724(t *testing.T) {
 		copy(inCopy, tt.in)
 		srcCopy := make([]netip.Addr, len(tt.in))
 		copy(srcCopy, tt.srcs)
-		sortByRFC6724withSrcs(inCopy, srcCopy)
+		sortByRFC6724withSrcs(inCopy, srcCopy, nil)
 		if !reflect.DeepEqual(inCopy, tt.want) {
 			t.Errorf("test %d:\nin = %s\ngot: %s\nwant: %s\n", i, tt.in, inCopy, tt.want)
 		}
@@ -136,7 +136,7 @@ func TestSortByRFC6724(t *testing.T) {
 				inCopy[j], inCopy[k] = inCopy[k], inCopy[j]
 				srcCopy[j], srcCopy[k] = srcCopy[k], srcCopy[j]
 			}
-			sortByRFC6724withSrcs(inCopy, srcCopy)
+			sortByRFC6724withSrcs(inCopy, srcCopy, nil)
 			if !reflect.DeepEqual(inCopy, tt.want) {
 				t.Errorf("test %d, starting backwards:\nin = %s\ngot: %s\nwant: %s\n", i, tt.in, inCopy, tt.want)
 			}
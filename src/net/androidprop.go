@@ -0,0 +1,139 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+// Reading Android system properties without libc: see
+// system_properties/prop_area.cpp in bionic.
+
+package net
+
+import "os"
+
+const (
+	propAreaMagic   = 0x504f5250 // "PROP"
+	propAreaVersion = 0xfc6ed0ab
+	propAreaHeader  = 128 // size of the header before the trie
+	propValueMax    = 92
+
+	// Offsets in the prop_bt trie nodes and prop_info values.
+	propBTNameLen  = 0
+	propBTProp     = 4
+	propBTLeft     = 8
+	propBTRight    = 12
+	propBTChildren = 16
+	propBTName     = 20
+	propInfoValue  = 4
+)
+
+// readAndroidProperties returns the values of the system properties
+// in names found in the property areas at path. Since Android 8, path
+// is a directory holding one property area per SELinux context, most
+// of which are not readable by apps; before, it is a single file.
+func readAndroidProperties(path string, names []string) map[string]string {
+	files := []string{path}
+	if entries, err := os.ReadDir(path); err == nil {
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() && e.Name() != "properties_serial" && e.Name() != "property_info" {
+				files = append(files, path+"/"+e.Name())
+			}
+		}
+	}
+	props := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if _, ok := props[name]; ok {
+				continue
+			}
+			if v, ok := findAndroidProperty(data, name); ok {
+				props[name] = v
+			}
+		}
+	}
+	return props
+}
+
+// findAndroidProperty returns the value of the property name in the
+// property area data. The property names are stored in a trie with a
+// level per dot-separated label, each level being a binary tree.
+func findAndroidProperty(data []byte, name string) (string, bool) {
+	if len(data) < propAreaHeader || propUint32(data, 8) != propAreaMagic || propUint32(data, 12) != propAreaVersion {
+		return "", false
+	}
+	area := data[propAreaHeader:]
+	node := uint32(0) // the root, whose name is empty
+	for name != "" {
+		label := name
+		name = ""
+		for i := 0; i < len(label); i++ {
+			if label[i] == '.' {
+				label, name = label[:i], label[i+1:]
+				break
+			}
+		}
+		children := propUint32(area, node+propBTChildren)
+		if children == 0 {
+			return "", false
+		}
+		var ok bool
+		if node, ok = findPropBT(area, children, label); !ok {
+			return "", false
+		}
+	}
+	prop := propUint32(area, node+propBTProp)
+	if prop == 0 || uint64(prop)+propInfoValue+propValueMax > uint64(len(area)) {
+		return "", false
+	}
+	value := area[prop+propInfoValue : prop+propInfoValue+propValueMax]
+	for i, b := range value {
+		if b == 0 {
+			return string(value[:i]), true
+		}
+	}
+	return "", false
+}
+
+// findPropBT returns the offset of the node named label in the binary
+// tree of the trie at offset node. Names are ordered by length first.
+func findPropBT(area []byte, node uint32, label string) (uint32, bool) {
+	// Bound the walk, in case of a corrupt area with cycles.
+	for n := 0; n < len(area)/propBTName; n++ {
+		if uint64(node)+propBTName > uint64(len(area)) {
+			return 0, false
+		}
+		nameLen := propUint32(area, node+propBTNameLen)
+		if uint64(node)+propBTName+uint64(nameLen) > uint64(len(area)) {
+			return 0, false
+		}
+		name := string(area[node+propBTName : node+propBTName+nameLen])
+		var next uint32
+		switch {
+		case len(label) == len(name) && label == name:
+			return node, true
+		case len(label) < len(name) || len(label) == len(name) && label < name:
+			next = propUint32(area, node+propBTLeft)
+		default:
+			next = propUint32(area, node+propBTRight)
+		}
+		if next == 0 {
+			return 0, false
+		}
+		node = next
+	}
+	return 0, false
+}
+
+// propUint32 returns the little-endian uint32 at offset off of b, or 0
+// if b is too short.
+func propUint32(b []byte, off uint32) uint32 {
+	if uint64(off)+4 > uint64(len(b)) {
+		return 0
+	}
+	return uint32(b[off]) | uint32(b[off+1])<<8 | uint32(b[off+2])<<16 | uint32(b[off+3])<<24
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// propAreaBuilder builds property areas for tests, with the layout of
+// bionic's prop_area.
+type propAreaBuilder struct {
+	data []byte // the trie, after the header
+}
+
+func (b *propAreaBuilder) put32(off, v uint32) {
+	b.data[off], b.data[off+1], b.data[off+2], b.data[off+3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+}
+
+func (b *propAreaBuilder) alloc(n int) uint32 {
+	off := uint32(len(b.data))
+	b.data = append(b.data, make([]byte, (n+3)&^3)...)
+	return off
+}
+
+func (b *propAreaBuilder) newNode(name string) uint32 {
+	off := b.alloc(propBTName + len(name) + 1)
+	b.put32(off+propBTNameLen, uint32(len(name)))
+	copy(b.data[off+propBTName:], name)
+	return off
+}
+
+// child returns the node named label below node, inserting it into the
+// binary tree of the children of node if needed.
+func (b *propAreaBuilder) child(node uint32, label string) uint32 {
+	link := node + propBTChildren
+	for {
+		cur := propUint32(b.data, link)
+		if cur == 0 {
+			n := b.newNode(label)
+			b.put32(link, n)
+			return n
+		}
+		nameLen := propUint32(b.data, cur+propBTNameLen)
+		name := string(b.data[cur+propBTName : cur+propBTName+nameLen])
+		switch {
+		case label == name:
+			return cur
+		case len(label) < len(name) || len(label) == len(name) && label < name:
+			link = cur + propBTLeft
+		default:
+			link = cur + propBTRight
+		}
+	}
+}
+
+func (b *propAreaBuilder) set(name, value string) {
+	node := uint32(0)
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i == len(name) || name[i] == '.' {
+			node = b.child(node, name[start:i])
+			start = i + 1
+		}
+	}
+	prop := b.alloc(propInfoValue + propValueMax + len(name) + 1)
+	copy(b.data[prop+propInfoValue:], value)
+	b.put32(node+propBTProp, prop)
+}
+
+func (b *propAreaBuilder) bytes() []byte {
+	hdr := make([]byte, propAreaHeader)
+	hdr[8], hdr[9], hdr[10], hdr[11] = 0x50, 0x52, 0x4f, 0x50
+	hdr[12], hdr[13], hdr[14], hdr[15] = 0xab, 0xd0, 0x6e, 0xfc
+	return append(hdr, b.data...)
+}
+
+func newPropArea(props map[string]string) []byte {
+	b := &propAreaBuilder{}
+	b.newNode("") // the root
+	for name, value := range props {
+		b.set(name, value)
+	}
+	return b.bytes()
+}
+
+func TestFindAndroidProperty(t *testing.T) {
+	area := newPropArea(map[string]string{
+		"net.dns1":             "192.0.2.1",
+		"net.dns2":             "2001:db8::1",
+		"net.hostname":         "phone",
+		"ro.build.version.sdk": "25",
+		"net":                  "top",
+	})
+	for name, want := range map[string]string{
+		"net.dns1":             "192.0.2.1",
+		"net.dns2":             "2001:db8::1",
+		"net.hostname":         "phone",
+		"ro.build.version.sdk": "25",
+		"net":                  "top",
+	} {
+		if got, ok := findAndroidProperty(area, name); !ok || got != want {
+			t.Errorf("findAndroidProperty(%q) = %q, %v; want %q, true", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"net.dns3", "ro.build", "ro", "net.dns1.x", ""} {
+		if got, ok := findAndroidProperty(area, name); ok {
+			t.Errorf("findAndroidProperty(%q) = %q; want not found", name, got)
+		}
+	}
+	for _, bad := range [][]byte{nil, area[:propAreaHeader], area[:len(area)/2], make([]byte, len(area))} {
+		findAndroidProperty(bad, "net.dns1") // must not panic
+	}
+}
+
+func TestReadAndroidProperties(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"u:object_r:net_dns_prop:s0": newPropArea(map[string]string{"net.dns1": "192.0.2.1"}),
+		"u:object_r:default_prop:s0": newPropArea(map[string]string{"net.dns2": "192.0.2.2"}),
+		"properties_serial":          newPropArea(map[string]string{"net.dns3": "192.0.2.3"}),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	props := readAndroidProperties(dir, []string{"net.dns1", "net.dns2", "net.dns3"})
+	if len(props) != 2 || props["net.dns1"] != "192.0.2.1" || props["net.dns2"] != "192.0.2.2" {
+		t.Errorf("readAndroidProperties = %v; want net.dns1 and net.dns2", props)
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Resolution of .local names with the Avahi daemon, over the system
+// D-Bus: see the D-Bus specification and avahi-daemon's
+// org.freedesktop.Avahi.Server interface.
+
+package net
+
+import (
+	"context"
+	"errors"
+	"internal/bytealg"
+	"internal/itoa"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+
+	// Header field codes.
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+
+	dbusMaxMessage = 64 << 10
+
+	avahiProtoInet  = 0  // AVAHI_PROTO_INET
+	avahiProtoInet6 = 1  // AVAHI_PROTO_INET6
+	avahiUnspec     = -1 // AVAHI_IF_UNSPEC, AVAHI_PROTO_UNSPEC
+
+	// avahiTimeout bounds a lookup; avahi-daemon gives up on a
+	// host after 5 seconds.
+	avahiTimeout = 6 * time.Second
+)
+
+// dbusSystemBusPath is the socket of the system bus, unless
+// DBUS_SYSTEM_BUS_ADDRESS names another one.
+var dbusSystemBusPath = "/var/run/dbus/system_bus_socket"
+
+// avahiLookupHost looks up the addresses of name for network by asking
+// the Avahi daemon to resolve it with mDNS, one address per protocol. It
+// returns the name that Avahi resolved.
+func avahiLookupHost(ctx context.Context, network, name string) (addrs []IPAddr, canonical string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, avahiTimeout)
+	defer cancel()
+	c, err := dbusDialSystemBus(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer c.Close()
+
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	protos := []int32{avahiProtoInet, avahiProtoInet6}
+	switch ipVersion(network) {
+	case '4':
+		protos = protos[:1]
+	case '6':
+		protos = protos[1:]
+	}
+	// Both protocols are resolved at the same time, as a failing
+	// resolution lasts until Avahi's timeout.
+	msgs := dbusHello()
+	pending := make(map[uint32]bool)
+	for i, proto := range protos {
+		var body dbusEncoder
+		body.int32(avahiUnspec) // interface
+		body.int32(avahiUnspec) // protocol
+		body.string(name)
+		body.int32(proto) // aprotocol
+		body.uint32(0)    // flags
+		serial := uint32(2 + i)
+		msgs = append(msgs, dbusEncodeMessage(dbusMethodCall, serial, []dbusField{
+			{code: dbusFieldPath, sig: "o", value: "/"},
+			{code: dbusFieldInterface, sig: "s", value: "org.freedesktop.Avahi.Server"},
+			{code: dbusFieldMember, sig: "s", value: "ResolveHostName"},
+			{code: dbusFieldDestination, sig: "s", value: "org.freedesktop.Avahi"},
+		}, "iisiu", body.b)...)
+		pending[serial] = true
+	}
+	if _, err := c.Write(msgs); err != nil {
+		return nil, "", err
+	}
+
+	for len(pending) > 0 {
+		m, err := dbusReadMessage(c)
+		if err != nil {
+			return nil, "", err
+		}
+		if !pending[m.replySerial] {
+			continue // e.g. the reply to Hello, or a signal
+		}
+		delete(pending, m.replySerial)
+		switch m.typ {
+		case dbusError:
+			switch m.errorName {
+			case "org.freedesktop.Avahi.NotFoundError", "org.freedesktop.Avahi.TimeoutError":
+				continue
+			}
+			return nil, "", errors.New("avahi: " + m.errorName)
+		case dbusMethodReturn:
+			if m.signature != "iisisu" {
+				return nil, "", errors.New("avahi: unexpected reply signature " + m.signature)
+			}
+			body := dbusDecoder{b: m.body, big: m.big}
+			iface := body.int32()
+			body.int32() // protocol
+			rname := body.string()
+			body.int32() // aprotocol
+			address := body.string()
+			if body.bad {
+				return nil, "", errors.New("avahi: malformed reply")
+			}
+			ip, zone := parseIPv6Zone(address)
+			if ip4 := parseIPv4(address); ip4 != nil {
+				ip = ip4
+			} else if ip == nil {
+				continue
+			} else if zone == "" && ip.IsLinkLocalUnicast() && iface > 0 {
+				zone = zoneCache.name(int(iface))
+			}
+			addrs = append(addrs, IPAddr{IP: ip, Zone: zone})
+			if canonical == "" {
+				canonical = rname
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, "", &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	}
+	if canonical == "" {
+		canonical = name
+	}
+	return addrs, canonical, nil
+}
+
+// dbusDialSystemBus connects to the system bus and authenticates. The
+// connection is bounded by the deadline of ctx.
+func dbusDialSystemBus(ctx context.Context) (Conn, error) {
+	var d Dialer
+	c, err := d.DialContext(ctx, "unix", dbusSystemBus())
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	if err := dbusAuth(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// dbusHello returns the Hello call, with serial 1, that the bus wants
+// before any other message.
+func dbusHello() []byte {
+	return dbusEncodeMessage(dbusMethodCall, 1, []dbusField{
+		{code: dbusFieldPath, sig: "o", value: "/org/freedesktop/DBus"},
+		{code: dbusFieldInterface, sig: "s", value: "org.freedesktop.DBus"},
+		{code: dbusFieldMember, sig: "s", value: "Hello"},
+		{code: dbusFieldDestination, sig: "s", value: "org.freedesktop.DBus"},
+	}, "", nil)
+}
+
+// dbusSystemBus returns the path of the socket of the system bus.
+func dbusSystemBus() string {
+	const prefix = "unix:path="
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); stringsHasPrefix(addr, prefix) {
+		path := addr[len(prefix):]
+		if i := bytealg.IndexByteString(path, ','); i >= 0 {
+			path = path[:i]
+		}
+		return path
+	}
+	return dbusSystemBusPath
+}
+
+// dbusAuth authenticates the connection c with the credentials of the
+// process, and starts the exchange of messages.
+func dbusAuth(c Conn) error {
+	uid := itoa.Itoa(os.Getuid())
+	const hex = "0123456789abcdef"
+	auth := []byte("\x00AUTH EXTERNAL ")
+	for i := 0; i < len(uid); i++ {
+		auth = append(auth, hex[uid[i]>>4], hex[uid[i]&0xf])
+	}
+	auth = append(auth, "\r\n"...)
+	if _, err := c.Write(auth); err != nil {
+		return err
+	}
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < 512 {
+		if _, err := io.ReadFull(c, b); err != nil {
+			return err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+	if !stringsHasPrefix(string(line), "OK ") {
+		return errors.New("dbus: authentication failed")
+	}
+	_, err := c.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// A dbusField is a header field of a message.
+type dbusField struct {
+	code  byte
+	sig   string // "s", "o", "g" or "u"
+	value string
+	num   uint32 // the value of a "u" field
+}
+
+// dbusEncoder marshals values in little-endian order, aligned from the
+// start of the message.
+type dbusEncoder struct {
+	b []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.b)%n != 0 {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *dbusEncoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+	e.b = append(e.b, 0)
+}
+
+func (e *dbusEncoder) signature(s string) {
+	e.b = append(e.b, byte(len(s)))
+	e.b = append(e.b, s...)
+	e.b = append(e.b, 0)
+}
+
+// dbusEncodeMessage returns a message with the header fields, and the
+// body with signature sig.
+func dbusEncodeMessage(typ byte, serial uint32, fields []dbusField, sig string, body []byte) []byte {
+	if sig != "" {
+		fields = append(fields, dbusField{code: dbusFieldSignature, sig: "g", value: sig})
+	}
+	e := dbusEncoder{b: []byte{'l', typ, 0, 1}}
+	e.uint32(uint32(len(body)))
+	e.uint32(serial)
+	e.uint32(0) // length of the header fields
+	start := len(e.b)
+	for _, f := range fields {
+		e.align(8)
+		e.b = append(e.b, f.code)
+		e.signature(f.sig)
+		switch f.sig {
+		case "g":
+			e.signature(f.value)
+		case "u":
+			e.uint32(f.num)
+		default:
+			e.string(f.value)
+		}
+	}
+	n := len(e.b) - start
+	e.b[12], e.b[13], e.b[14], e.b[15] = byte(n), byte(n>>8), byte(n>>16), byte(n>>24)
+	e.align(8)
+	return append(e.b, body...)
+}
+
+// dbusDecoder unmarshals values aligned from the start of b.
+type dbusDecoder struct {
+	b   []byte
+	off int
+	big bool // big-endian
+	bad bool // a value overran b
+}
+
+func (d *dbusDecoder) align(n int) {
+	for d.off%n != 0 {
+		d.off++
+	}
+}
+
+func (d *dbusDecoder) byte() byte {
+	if d.off >= len(d.b) {
+		d.bad = true
+		return 0
+	}
+	d.off++
+	return d.b[d.off-1]
+}
+
+func (d *dbusDecoder) uint32() uint32 {
+	d.align(4)
+	if d.off+4 > len(d.b) {
+		d.bad = true
+		return 0
+	}
+	b := d.b[d.off : d.off+4]
+	d.off += 4
+	if d.big {
+		return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	}
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func (d *dbusDecoder) int32() int32 {
+	return int32(d.uint32())
+}
+
+func (d *dbusDecoder) bytes(n int) string {
+	if n < 0 || d.off+n+1 > len(d.b) {
+		d.bad = true
+		return ""
+	}
+	s := string(d.b[d.off : d.off+n])
+	d.off += n + 1 // and the NUL
+	return s
+}
+
+// byteArray returns an array of bytes, of signature "ay".
+func (d *dbusDecoder) byteArray() []byte {
+	n := int(d.uint32())
+	if d.bad || n > len(d.b)-d.off {
+		d.bad = true
+		return nil
+	}
+	d.off += n
+	return d.b[d.off-n : d.off]
+}
+
+func (d *dbusDecoder) string() string {
+	return d.bytes(int(d.uint32()))
+}
+
+func (d *dbusDecoder) signature() string {
+	return d.bytes(int(d.byte()))
+}
+
+// A dbusMessage is a message read from the bus.
+type dbusMessage struct {
+	typ         byte
+	big         bool
+	serial      uint32
+	member      string
+	replySerial uint32
+	errorName   string
+	signature   string
+	body        []byte
+}
+
+// dbusReadMessage reads a message from r.
+func dbusReadMessage(r io.Reader) (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	d := dbusDecoder{b: fixed, off: 4, big: fixed[0] == 'B'}
+	bodyLen := d.uint32()
+	serial := d.uint32()
+	fieldsLen := d.uint32()
+	headerLen := (16 + uint64(fieldsLen) + 7) &^ 7
+	if headerLen+uint64(bodyLen) > dbusMaxMessage {
+		return nil, errors.New("dbus: message too long")
+	}
+	b := make([]byte, headerLen+uint64(bodyLen))
+	copy(b, fixed)
+	if _, err := io.ReadFull(r, b[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &dbusMessage{typ: fixed[1], big: d.big, serial: serial, body: b[headerLen:]}
+	d = dbusDecoder{b: b[:16+fieldsLen], off: 16, big: d.big}
+	for d.off < len(d.b) && !d.bad {
+		d.align(8)
+		code := d.byte()
+		switch sig := d.signature(); sig {
+		case "s", "o":
+			v := d.string()
+			switch code {
+			case dbusFieldMember:
+				m.member = v
+			case dbusFieldErrorName:
+				m.errorName = v
+			}
+		case "g":
+			v := d.signature()
+			if code == dbusFieldSignature {
+				m.signature = v
+			}
+		case "u":
+			v := d.uint32()
+			if code == dbusFieldReplySerial {
+				m.replySerial = v
+			}
+		default:
+			return nil, errors.New("dbus: unexpected header field type " + sig)
+		}
+	}
+	if d.bad {
+		return nil, errors.New("dbus: malformed message header")
+	}
+	return m, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"bufio"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveFakeBus answers the calls on c as the system bus would, passing
+// the calls other than Hello to handle, which returns the reply.
+func serveFakeBus(t *testing.T, c Conn, handle func(m *dbusMessage, reply []dbusField) []byte) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for _, want := range []string{"\x00AUTH EXTERNAL ", "BEGIN\r\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil || !stringsHasPrefix(line, want) {
+			t.Errorf("got %q, %v; want %q", line, err, want)
+			return
+		}
+		if want != "BEGIN\r\n" {
+			c.Write([]byte("OK 0123456789abcdef\r\n"))
+		}
+	}
+	for {
+		m, err := dbusReadMessage(r)
+		if err != nil {
+			return
+		}
+		reply := []dbusField{{code: dbusFieldReplySerial, sig: "u", num: m.serial}}
+		var out []byte
+		if m.member == "Hello" {
+			var body dbusEncoder
+			body.string(":1.42")
+			out = dbusEncodeMessage(dbusMethodReturn, 1, reply, "s", body.b)
+			out = append(out, dbusEncodeMessage(dbusSignal, 2, []dbusField{
+				{code: dbusFieldMember, sig: "s", value: "NameAcquired"},
+			}, "", nil)...)
+		} else {
+			out = handle(m, reply)
+		}
+		c.Write(out)
+	}
+}
+
+// startFakeBus makes a fake system bus, served by serveFakeBus, the
+// system bus of the process until the end of the test.
+func startFakeBus(t *testing.T, handle func(m *dbusMessage, reply []dbusField) []byte) {
+	if !testableNetwork("unix") {
+		t.Skip("unix sockets not supported")
+	}
+	dir := t.TempDir()
+	orig := dbusSystemBusPath
+	dbusSystemBusPath = filepath.Join(dir, "system_bus_socket")
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "")
+	ln, err := Listen("unix", dbusSystemBusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+		dbusSystemBusPath = orig
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveFakeBus(t, c, handle)
+			}()
+		}
+	}()
+}
+
+// dbusErrorReply returns an error reply named name.
+func dbusErrorReply(reply []dbusField, name string) []byte {
+	var body dbusEncoder
+	body.string("failed")
+	reply = append(reply, dbusField{code: dbusFieldErrorName, sig: "s", value: name})
+	return dbusEncodeMessage(dbusError, 4, reply, "s", body.b)
+}
+
+// fakeAvahi answers the ResolveHostName calls as the Avahi daemon
+// would, knowing only printer.local's IPv4 address.
+func fakeAvahi(m *dbusMessage, reply []dbusField) []byte {
+	d := dbusDecoder{b: m.body}
+	d.int32()
+	d.int32()
+	name := d.string()
+	proto := d.int32()
+	if m.member != "ResolveHostName" || name != "printer.local" || proto != avahiProtoInet {
+		return dbusErrorReply(reply, "org.freedesktop.Avahi.TimeoutError")
+	}
+	var body dbusEncoder
+	body.int32(2)
+	body.int32(avahiProtoInet)
+	body.string("Printer.local")
+	body.int32(avahiProtoInet)
+	body.string("192.168.1.20")
+	body.uint32(0)
+	return dbusEncodeMessage(dbusMethodReturn, 3, reply, "iisisu", body.b)
+}
+
+func TestAvahiLookupHost(t *testing.T) {
+	startFakeBus(t, fakeAvahi)
+
+	addrs, canonical, err := avahiLookupHost(context.Background(), "ip", "printer.local.")
+	if err != nil || canonical != "Printer.local" || len(addrs) != 1 || !addrs[0].IP.Equal(IPv4(192, 168, 1, 20)) {
+		t.Errorf("got %v, %q, %v; want [192.168.1.20], Printer.local, nil", addrs, canonical, err)
+	}
+	_, _, err = avahiLookupHost(context.Background(), "ip6", "printer.local")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("got error %v for a missing IPv6 address; want not found", err)
+	}
+}
+
+func TestDBusMessage(t *testing.T) {
+	var body dbusEncoder
+	body.int32(-1)
+	body.string("x.local")
+	body.uint32(7)
+	b := dbusEncodeMessage(dbusMethodCall, 9, []dbusField{
+		{code: dbusFieldPath, sig: "o", value: "/"},
+		{code: dbusFieldMember, sig: "s", value: "ResolveHostName"},
+		{code: dbusFieldReplySerial, sig: "u", num: 5},
+	}, "isu", body.b)
+	if (len(b)-len(body.b))%8 != 0 {
+		t.Errorf("body of %x not 8-byte aligned", b)
+	}
+	m, err := dbusReadMessage(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.typ != dbusMethodCall || m.serial != 9 || m.member != "ResolveHostName" || m.replySerial != 5 || m.signature != "isu" {
+		t.Errorf("got %+v", m)
+	}
+	d := dbusDecoder{b: m.body}
+	if i, s, u := d.int32(), d.string(), d.uint32(); i != -1 || s != "x.local" || u != 7 || d.bad {
+		t.Errorf("got body %d, %q, %d", i, s, u)
+	}
+	for n := 0; n < len(b); n++ {
+		if _, err := dbusReadMessage(strings.NewReader(string(b[:n]))); err == nil {
+			t.Errorf("read message truncated to %d bytes", n)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !linux
+
+package net
+
+import "context"
+
+// avahiLookupHost is never called: the Go resolver only asks the Avahi
+// daemon for addresses on Linux.
+func avahiLookupHost(ctx context.Context, network, name string) (addrs []IPAddr, canonical string, err error) {
+	return nil, "", &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+}
@@ -33,3 +33,19 @@ func cgoLookupCNAME(ctx context.Context, name string) (cname string, err error,
 func cgoLookupPTR(ctx context.Context, addr string) (ptrs []string, err error, completed bool) {
 	return nil, nil, false
 }
+
+func cgoLookupMX(ctx context.Context, name string) (mxs []*MX, err error, completed bool) {
+	return nil, nil, false
+}
+
+func cgoLookupNS(ctx context.Context, name string) (nss []*NS, err error, completed bool) {
+	return nil, nil, false
+}
+
+func cgoLookupSRV(ctx context.Context, target string) (cname string, srvs []*SRV, err error, completed bool) {
+	return "", nil, nil, false
+}
+
+func cgoLookupTXT(ctx context.Context, name string) (txts []string, err error, completed bool) {
+	return nil, nil, false
+}
@@ -29,6 +29,12 @@ func (eai addrinfoErrno) Error() string   { return _C_gai_strerror(_C_int(eai))
 func (eai addrinfoErrno) Temporary() bool { return eai == _C_EAI_AGAIN }
 func (eai addrinfoErrno) Timeout() bool   { return false }
 
+// Is reports whether eai matches target: EAI_AGAIN, which the
+// resolver reports for SERVFAIL responses, matches ErrServFail.
+func (eai addrinfoErrno) Is(target error) bool {
+	return target == ErrServFail && eai == _C_EAI_AGAIN
+}
+
 type portLookupResult struct {
 	port int
 	err  error
@@ -108,7 +114,7 @@ func cgoLookupServicePort(hints *_C_struct_addrinfo, network, service string) (p
 			err = addrinfoErrno(gerrno)
 			isTemporary = addrinfoErrno(gerrno).Temporary()
 		}
-		return 0, &DNSError{Err: err.Error(), Name: network + "/" + service, IsTemporary: isTemporary}
+		return 0, &DNSError{Err: err.Error(), Name: network + "/" + service, IsTemporary: isTemporary, UnwrapErr: err}
 	}
 	defer _C_freeaddrinfo(res)
 
@@ -174,7 +180,7 @@ func cgoLookupIPCNAME(network, name string) (addrs []IPAddr, cname string, err e
 			isTemporary = addrinfoErrno(gerrno).Temporary()
 		}
 
-		return nil, "", &DNSError{Err: err.Error(), Name: name, IsNotFound: isErrorNoSuchHost, IsTemporary: isTemporary}
+		return nil, "", &DNSError{Err: err.Error(), Name: name, IsNotFound: isErrorNoSuchHost, IsTemporary: isTemporary, UnwrapErr: err}
 	}
 	defer _C_freeaddrinfo(res)
 
@@ -290,7 +296,7 @@ func cgoLookupAddrPTR(addr string, sa *_C_struct_sockaddr, salen _C_socklen_t) (
 			err = addrinfoErrno(gerrno)
 			isTemporary = addrinfoErrno(gerrno).Temporary()
 		}
-		return nil, &DNSError{Err: err.Error(), Name: addr, IsTemporary: isTemporary}
+		return nil, &DNSError{Err: err.Error(), Name: addr, IsTemporary: isTemporary, UnwrapErr: err}
 	}
 	for i := 0; i < len(b); i++ {
 		if b[i] == 0 {
@@ -328,6 +334,76 @@ func cgoLookupCNAME(ctx context.Context, name string) (cname string, err error,
 	return cname, nil, true
 }
 
+// The record lookups below use res_nsearch, like cgoLookupCNAME. If it
+// fails, they report that they did not complete, so that Go's resolver
+// can produce a detailed error.
+
+func cgoLookupMX(ctx context.Context, name string) (mxs []*MX, err error, completed bool) {
+	resources, err := resSearch(ctx, name, int(dnsmessage.TypeMX), int(dnsmessage.ClassINET))
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, rr := range resources {
+		if mx, ok := rr.Body.(*dnsmessage.MXResource); ok {
+			mxs = append(mxs, &MX{Host: mx.MX.String(), Pref: mx.Pref})
+		}
+	}
+	byPref(mxs).sort()
+	return mxs, nil, true
+}
+
+func cgoLookupNS(ctx context.Context, name string) (nss []*NS, err error, completed bool) {
+	resources, err := resSearch(ctx, name, int(dnsmessage.TypeNS), int(dnsmessage.ClassINET))
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, rr := range resources {
+		if ns, ok := rr.Body.(*dnsmessage.NSResource); ok {
+			nss = append(nss, &NS{Host: ns.NS.String()})
+		}
+	}
+	return nss, nil, true
+}
+
+func cgoLookupSRV(ctx context.Context, target string) (cname string, srvs []*SRV, err error, completed bool) {
+	resources, err := resSearch(ctx, target, int(dnsmessage.TypeSRV), int(dnsmessage.ClassINET))
+	if err != nil {
+		return "", nil, nil, false
+	}
+	for _, rr := range resources {
+		srv, ok := rr.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		if cname == "" {
+			cname = rr.Header.Name.String()
+		}
+		srvs = append(srvs, &SRV{Target: srv.Target.String(), Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+	return cname, srvs, nil, true
+}
+
+func cgoLookupTXT(ctx context.Context, name string) (txts []string, err error, completed bool) {
+	resources, err := resSearch(ctx, name, int(dnsmessage.TypeTXT), int(dnsmessage.ClassINET))
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, rr := range resources {
+		txt, ok := rr.Body.(*dnsmessage.TXTResource)
+		if !ok {
+			continue
+		}
+		// As in goLookupTXT, the strings of a record are
+		// concatenated without separator.
+		var b []byte
+		for _, s := range txt.TXT {
+			b = append(b, s...)
+		}
+		txts = append(txts, string(b))
+	}
+	return txts, nil, true
+}
+
 // resSearch will make a call to the 'res_nsearch' routine in the C library
 // and parse the output as a slice of DNS resources.
 func resSearch(ctx context.Context, hostname string, rtype, class int) ([]dnsmessage.Resource, error) {
@@ -8,6 +8,7 @@ package net
 
 import (
 	"context"
+	"errors"
 	"testing"
 )
 
@@ -85,3 +86,12 @@ func TestCgoLookupPTRWithCancel(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestAddrinfoErrnoIs(t *testing.T) {
+	if !errors.Is(&DNSError{UnwrapErr: addrinfoErrno(_C_EAI_AGAIN)}, ErrServFail) {
+		t.Error("EAI_AGAIN does not match ErrServFail")
+	}
+	if errors.Is(&DNSError{UnwrapErr: addrinfoErrno(_C_EAI_NONAME)}, ErrServFail) {
+		t.Error("EAI_NONAME matches ErrServFail")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A Clock tells the time. See SetClock.
+type Clock interface {
+	Now() time.Time
+}
+
+var clockOverride atomic.Pointer[Clock] // set by SetClock
+
+// SetClock sets the clock by which the resolver decides when the
+// files and answers it caches are stale, such as resolv.conf, which is
+// checked for changes at most every few seconds, or the hosts and
+// nsswitch.conf files, in place of the system's clock. It lets tests
+// and simulations control when these are read again. The deadlines
+// of queries and connections still follow the system's clock. A nil
+// c restores the system's clock.
+func SetClock(c Clock) {
+	if c == nil {
+		clockOverride.Store(nil)
+		return
+	}
+	clockOverride.Store(&c)
+}
+
+// clockNow returns the current time of the clock set with SetClock, or
+// of the system's clock.
+func clockNow() time.Time {
+	if c := clockOverride.Load(); c != nil {
+		return (*c).Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestSetClock(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	SetClock(clock)
+	defer SetClock(nil)
+	defer SetServicesPath("")
+
+	path := filepath.Join(t.TempDir(), "services")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lookup := func(want int) {
+		t.Helper()
+		if port, err := LookupPort("tcp", "clocktest"); err != nil || port != want {
+			t.Errorf("LookupPort(tcp, clocktest) = %d, %v; want %d", port, err, want)
+		}
+	}
+
+	write("clocktest 1000/tcp\n", time.Now().Add(-time.Hour))
+	SetServicesPath(path)
+	lookup(1000)
+
+	// The change is not seen until the clock says the file is stale.
+	write("clocktest 2000/tcp\n", time.Now())
+	lookup(1000)
+	clock.advance(cacheMaxAge + time.Second)
+	lookup(2000)
+}
@@ -9,10 +9,13 @@ package net
 import (
 	"internal/bytealg"
 	"internal/godebug"
+	"internal/itoa"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // conf represents a system's network configuration.
@@ -23,9 +26,24 @@ type conf struct {
 	netGo  bool // go DNS resolution forced
 	netCgo bool // non-go DNS resolution forced (cgo, or win32)
 
+	// cgoFallback retries failed go DNS resolution with cgo
+	// (netdns=go+cgo). It is only set along with netGo.
+	cgoFallback bool
+
 	// machine has an /etc/mdns.allow file
 	hasMDNSAllow bool
 
+	// Linux: the Avahi daemon is running
+	hasAvahi bool
+
+	// the machine's /etc/host.conf, consulted without nsswitch.conf
+	hostConf *hostConf
+
+	// Solaris: machine has an NIS domain, and /etc/netconfig names
+	// name-to-address libraries for the internet transports
+	hasNISDomain  bool
+	netconfigLibs bool
+
 	goos          string // the runtime.GOOS, to ease testing
 	dnsDebugLevel int
 
@@ -34,21 +52,82 @@ type conf struct {
 
 var (
 	confOnce sync.Once // guards init of confVal via initConfVal
-	confVal  = &conf{goos: runtime.GOOS}
+	confVal  atomic.Pointer[conf]
 )
 
 // systemConf returns the machine's network configuration.
 func systemConf() *conf {
 	confOnce.Do(initConfVal)
-	return confVal
+	return confVal.Load()
 }
 
 func initConfVal() {
+	confVal.Store(readConf())
+}
+
+// ReloadResolverConfig makes the resolver reconsider the settings that
+// it otherwise reads only once, when it is first used: the GODEBUG
+// netdns setting and the environment variables, such as LOCALDOMAIN,
+// RES_OPTIONS and HOSTALIASES, that decide between Go's built-in
+// resolver and the native one, along with the system files those
+// decisions depend on. This is meant for long-running programs whose
+// environment is only settled after they start. Lookups in progress
+// are not affected.
+func ReloadResolverConfig() {
+	confOnce.Do(initConfVal)
+	confVal.Store(readConf())
+}
+
+// FlushResolverConfig drops what the resolver caches of the system's
+// configuration, so that the next lookup reads it again: resolv.conf,
+// including the files of Resolvers with a ConfigPath and those with
+// the no-reload option, nsswitch.conf, the hosts files, gai.conf, the
+// services and protocols files, the host name and which address
+// families the host has. It also does what ReloadResolverConfig does.
+// Programs can call it after the network changes under them, as when
+// a VPN connects or the program moves to another network namespace,
+// or after tests change these files. Lookups in progress are not
+// affected.
+//
+// The caches of the native resolver, such as that of nscd, are not
+// flushed.
+func FlushResolverConfig() {
+	resolvConf.flush()
+	resolvConfs.Lock()
+	for _, conf := range resolvConfs.m {
+		conf.flush()
+	}
+	resolvConfs.Unlock()
+	nssConfig.changed.Store(true)
+	FlushHostsCache()
+	FlushHostnameCache()
+
+	gaiConfig.Lock()
+	gaiConfig.conf = nil
+	gaiConfig.Unlock()
+	servicesDB.Lock()
+	servicesDB.path = ""
+	servicesDB.Unlock()
+	protocolsDB.Lock()
+	protocolsDB.path = ""
+	protocolsDB.Unlock()
+	addrFamilies.Lock()
+	addrFamilies.expires = time.Time{}
+	addrFamilies.Unlock()
+
+	ReloadResolverConfig()
+}
+
+// readConf reads the network configuration of the machine and of the
+// process environment.
+func readConf() *conf {
+	c := &conf{goos: runtime.GOOS}
 	dnsMode, debugLevel := goDebugNetDNS()
-	confVal.dnsDebugLevel = debugLevel
-	confVal.netGo = netGo || dnsMode == "go"
-	confVal.netCgo = netCgo || dnsMode == "cgo"
-	if !confVal.netGo && !confVal.netCgo && (runtime.GOOS == "windows" || runtime.GOOS == "plan9") {
+	c.dnsDebugLevel = debugLevel
+	c.netGo = netGo || dnsMode == "go" || dnsMode == "go+cgo"
+	c.cgoFallback = !netGo && dnsMode == "go+cgo"
+	c.netCgo = netCgo || dnsMode == "cgo"
+	if !c.netGo && !c.netCgo && (runtime.GOOS == "windows" || runtime.GOOS == "plan9") {
 		// Neither of these platforms actually use cgo.
 		//
 		// The meaning of "cgo" mode in the net package is
@@ -57,25 +136,28 @@ func initConfVal() {
 		// PreferGo support before Windows and Plan9 got support,
 		// at which time the GODEBUG=netdns=go and GODEBUG=netdns=cgo
 		// names were already kinda locked in.
-		confVal.netCgo = true
+		c.netCgo = true
 	}
 
-	if confVal.dnsDebugLevel > 0 {
+	if c.dnsDebugLevel > 0 {
 		defer func() {
-			if confVal.dnsDebugLevel > 1 {
-				println("go package net: confVal.netCgo =", confVal.netCgo, " netGo =", confVal.netGo)
+			if c.dnsDebugLevel > 1 {
+				dnsDebugLog("resolver config", "netCgo", boolString(c.netCgo), "netGo", boolString(c.netGo))
 			}
 			switch {
-			case confVal.netGo:
-				if netGo {
-					println("go package net: built with netgo build tag; using Go's DNS resolver")
-				} else {
-					println("go package net: GODEBUG setting forcing use of Go's resolver")
+			case c.netGo:
+				switch {
+				case netGo:
+					dnsDebugLog("using Go's DNS resolver", "reason", "netgo build tag")
+				case c.cgoFallback:
+					dnsDebugLog("using Go's DNS resolver with cgo fallback", "reason", "GODEBUG setting")
+				default:
+					dnsDebugLog("using Go's DNS resolver", "reason", "GODEBUG setting")
 				}
-			case confVal.forceCgoLookupHost:
-				println("go package net: using cgo DNS resolver")
+			case c.forceCgoLookupHost:
+				dnsDebugLog("using cgo DNS resolver")
 			default:
-				println("go package net: dynamic selection of DNS resolver")
+				dnsDebugLog("dynamic selection of DNS resolver")
 			}
 		}()
 	}
@@ -84,12 +166,12 @@ func initConfVal() {
 	// their own DNS requests. So always use cgo instead, which
 	// avoids that.
 	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
-		confVal.forceCgoLookupHost = true
-		return
+		c.forceCgoLookupHost = true
+		return c
 	}
 
 	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
-		return
+		return c
 	}
 
 	// If any environment-specified resolver options are specified,
@@ -98,32 +180,57 @@ func initConfVal() {
 	_, localDomainDefined := syscall.Getenv("LOCALDOMAIN")
 	if os.Getenv("RES_OPTIONS") != "" ||
 		os.Getenv("HOSTALIASES") != "" ||
-		confVal.netCgo ||
+		c.netCgo ||
 		localDomainDefined {
-		confVal.forceCgoLookupHost = true
-		return
+		c.forceCgoLookupHost = true
+		return c
 	}
 
 	// OpenBSD apparently lets you override the location of resolv.conf
 	// with ASR_CONFIG. If we notice that, defer to libc.
 	if runtime.GOOS == "openbsd" && os.Getenv("ASR_CONFIG") != "" {
-		confVal.forceCgoLookupHost = true
-		return
+		c.forceCgoLookupHost = true
+		return c
 	}
 
-	confVal.resolv = dnsReadConfig("/etc/resolv.conf")
-	if confVal.resolv.err != nil && !os.IsNotExist(confVal.resolv.err) &&
-		!os.IsPermission(confVal.resolv.err) {
+	if override := dnsConfigOverride.Load(); override != nil {
+		// Set by SetDNSConfig; there is no file to read.
+		c.resolv = override
+	} else {
+		c.resolv = dnsReadConfig(resolvConfPath())
+	}
+	if c.resolv.err != nil && !os.IsNotExist(c.resolv.err) &&
+		!os.IsPermission(c.resolv.err) {
 		// If we can't read the resolv.conf file, assume it
 		// had something important in it and defer to cgo.
 		// libc's resolver might then fail too, but at least
 		// it wasn't our fault.
-		confVal.forceCgoLookupHost = true
+		if c.dnsDebugLevel > 1 {
+			dnsDebugLog("cannot use resolv.conf", "file", resolvConfPath(), "err", c.resolv.err.Error())
+		}
+		c.forceCgoLookupHost = true
+	}
+	if c.resolv.limitErr != nil && c.dnsDebugLevel > 1 {
+		dnsDebugLog("resolv.conf truncated", "file", resolvConfPath(), "err", c.resolv.limitErr.Error())
 	}
 
 	if _, err := os.Stat("/etc/mdns.allow"); err == nil {
-		confVal.hasMDNSAllow = true
+		c.hasMDNSAllow = true
+	}
+
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat("/var/run/avahi-daemon/socket"); err == nil {
+			c.hasAvahi = true
+		}
 	}
+
+	c.hostConf = parseHostConf(hostConfPath)
+
+	if runtime.GOOS == "solaris" {
+		c.hasNISDomain = hasNISDomain("/etc/defaultdomain")
+		c.netconfigLibs = netconfigHasNameLibs("/etc/netconfig")
+	}
+	return c
 }
 
 // canUseCgo reports whether calling cgo functions is allowed
@@ -132,31 +239,35 @@ func (c *conf) canUseCgo() bool {
 	return c.hostLookupOrder(nil, "") == hostLookupCgo
 }
 
+// resolvConfig returns the DNS configuration set by SetDNSConfig, if
+// any, and the one read from resolv.conf otherwise.
+func (c *conf) resolvConfig() *dnsConfig {
+	if override := dnsConfigOverride.Load(); override != nil {
+		return override
+	}
+	return c.resolv
+}
+
 // hostLookupOrder determines which strategy to use to resolve hostname.
 // The provided Resolver is optional. nil means to not consider its options.
 func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrder) {
 	if c.dnsDebugLevel > 1 {
 		defer func() {
-			print("go package net: hostLookupOrder(", hostname, ") = ", ret.String(), "\n")
+			dnsDebugLog("hostLookupOrder", "host", hostname, "order", ret.String())
 		}()
 	}
 	fallbackOrder := hostLookupCgo
 	if c.netGo || r.preferGo() {
-		switch c.goos {
-		case "windows":
-			// TODO(bradfitz): implement files-based
-			// lookup on Windows too? I guess /etc/hosts
-			// kinda exists on Windows. But for now, only
-			// do DNS.
-			fallbackOrder = hostLookupDNS
-		default:
-			fallbackOrder = hostLookupFilesDNS
-		}
+		fallbackOrder = hostLookupFilesDNS
 	}
 	if c.goos == "windows" || c.goos == "plan9" {
 		return fallbackOrder
 	}
-	if c.forceCgoLookupHost || c.resolv.unknownOpt || c.goos == "android" {
+	resolv := c.resolvConfig()
+	if c.forceCgoLookupHost || resolv.unknownOpt || c.goos == "android" {
+		if resolv.unknownOpt {
+			c.logConfigPos(resolv.unknownOptAt, "unknown directive or option")
+		}
 		return fallbackOrder
 	}
 	if bytealg.IndexByteString(hostname, '\\') != -1 || bytealg.IndexByteString(hostname, '%') != -1 {
@@ -171,10 +282,10 @@ func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrde
 		// OpenBSD's resolv.conf manpage says that a non-existent
 		// resolv.conf means "lookup" defaults to only "files",
 		// without DNS lookups.
-		if os.IsNotExist(c.resolv.err) {
+		if os.IsNotExist(resolv.err) {
 			return hostLookupFiles
 		}
-		lookup := c.resolv.lookup
+		lookup := resolv.lookup
 		if len(lookup) == 0 {
 			// https://www.openbsd.org/cgi-bin/man.cgi/OpenBSD-current/man5/resolv.conf.5
 			// "If the lookup keyword is not used in the
@@ -212,47 +323,124 @@ func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrde
 		hostname = hostname[:len(hostname)-1]
 	}
 	if stringsHasSuffixFold(hostname, ".local") {
-		// Per RFC 6762, the ".local" TLD is special. And
-		// because Go's native resolver doesn't do mDNS or
-		// similar local resolution mechanisms, assume that
+		// Per RFC 6762, the ".local" TLD is special. Go's
+		// native resolver only does mDNS through Avahi, when
+		// nsswitch.conf has it used. Otherwise, assume that
 		// libc might (via Avahi, etc) and use cgo.
+		if c.avahiResolves(r, hostname) {
+			return hostLookupFilesDNS
+		}
+		return fallbackOrder
+	}
+
+	if c.netconfigLibs {
+		// Solaris maps names to addresses with the libraries
+		// listed in /etc/netconfig rather than with nsswitch.conf.
 		return fallbackOrder
 	}
 
 	nss := getSystemNSS()
 	srcs := nss.sources["hosts"]
 	// If /etc/nsswitch.conf doesn't exist or doesn't specify any
-	// sources for "hosts", assume Go's DNS will work fine.
+	// sources for "hosts", assume Go's DNS will work fine, in the
+	// order that /etc/host.conf may set.
 	if os.IsNotExist(nss.err) || (nss.err == nil && len(srcs) == 0) {
-		if c.goos == "solaris" {
-			// illumos defaults to "nis [NOTFOUND=return] files"
-			return fallbackOrder
+		if c.goos != "solaris" {
+			return c.hostConf.lookupOrder(fallbackOrder)
 		}
-		return hostLookupFilesDNS
-	}
-	if nss.err != nil {
+		srcs = solarisDefaultHostSources
+	} else if nss.err != nil {
 		// We failed to parse or open nsswitch.conf, so
 		// conservatively assume we should use cgo if it's
 		// available.
+		if c.dnsDebugLevel > 1 {
+			dnsDebugLog("cannot use nsswitch.conf", "file", nssConfigPath, "err", nss.err.Error())
+		}
 		return fallbackOrder
 	}
 
-	var mdnsSource, filesSource, dnsSource bool
+	// nonStandard reports src as what makes the lookup go to libc.
+	nonStandard := func(src nssSource, reason string) hostLookupOrder {
+		c.logConfigPos(configPos{file: nssConfigPath, line: src.line, token: src.String()}, reason)
+		return fallbackOrder
+	}
+	var mdnsSource, filesSource, dnsSource, winsSource, libvirtSource bool
 	var first string
-	for _, src := range srcs {
+	for i, src := range srcs {
 		if src.source == "myhostname" {
+			if c.nativeMyhostname() {
+				// The Go resolver answers the names of the source
+				// itself after files: see myhostnameResolves.
+				if !src.standardCriteria(i == len(srcs)-1) {
+					return nonStandard(src, "non-standard criteria")
+				}
+				continue
+			}
 			if isLocalhost(hostname) || isGateway(hostname) || isOutbound(hostname) {
-				return fallbackOrder
+				return nonStandard(src, "name resolved by myhostname")
 			}
-			hn, err := getHostname()
+			hn, err := cachedHostname()
 			if err != nil || stringsEqualFold(hostname, hn) {
-				return fallbackOrder
+				return nonStandard(src, "name resolved by myhostname")
+			}
+			continue
+		}
+		if src.source == "nis" && c.goos == "solaris" && !c.hasNISDomain {
+			// Without an NIS domain, the source is unavailable
+			// and the lookup goes on with the next one, unless
+			// the criteria say otherwise.
+			if !src.continuesWhenUnavailable() {
+				return nonStandard(src, "non-standard criteria")
+			}
+			continue
+		}
+		if src.source == "cache" && c.goos == "freebsd" {
+			// nscd(8) only caches the results of the other
+			// sources. The Go resolver consults it as well.
+			continue
+		}
+		if src.source == "mymachines" {
+			// The machines of systemd-machined, which the Go resolver
+			// asks for before or after files, at the place of the
+			// source, and before DNS: see machinedResolves.
+			if dnsSource {
+				return nonStandard(src, "source after dns")
+			}
+			if !src.standardCriteria(i == len(srcs)-1) {
+				return nonStandard(src, "non-standard criteria")
+			}
+			continue
+		}
+		if src.source == "wins" {
+			// Samba's NetBIOS name queries, which the Go resolver
+			// makes after the other sources failed.
+			if !src.standardCriteria(i == len(srcs)-1) {
+				return nonStandard(src, "non-standard criteria")
+			}
+			winsSource = true
+			continue
+		}
+		if src.source == "libvirt" || src.source == "libvirt_guest" {
+			// The leases of libvirt's virtual networks, which the Go
+			// resolver reads after files and before DNS.
+			if dnsSource {
+				return nonStandard(src, "source after dns")
 			}
+			if !src.standardCriteria(i == len(srcs)-1) {
+				return nonStandard(src, "non-standard criteria")
+			}
+			libvirtSource = true
 			continue
 		}
 		if src.source == "files" || src.source == "dns" {
-			if !src.standardCriteria() {
-				return fallbackOrder // non-standard; let libc deal with it.
+			if winsSource {
+				return nonStandard(src, "source after wins")
+			}
+			if libvirtSource && src.source == "files" {
+				return nonStandard(src, "source after libvirt")
+			}
+			if !src.standardCriteria(i == len(srcs)-1) {
+				return nonStandard(src, "non-standard criteria") // let libc deal with it.
 			}
 			if src.source == "files" {
 				filesSource = true
@@ -272,13 +460,14 @@ func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrde
 			continue
 		}
 		// Some source we don't know how to deal with.
-		return fallbackOrder
+		return nonStandard(src, "unknown source")
 	}
 
 	// We don't parse mdns.allow files. They're rare. If one
 	// exists, it might list other TLDs (besides .local) or even
 	// '*', so just let libc deal with it.
 	if mdnsSource && c.hasMDNSAllow {
+		c.logConfigPos(configPos{file: "/etc/mdns.allow"}, "mdns.allow is not parsed")
 		return fallbackOrder
 	}
 
@@ -301,6 +490,204 @@ func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrde
 	return fallbackOrder
 }
 
+// logConfigPos writes, at netdns debug level 2 and above, where in a
+// configuration file the Go resolver found what made it defer to the
+// native resolver, and why, so that administrators can see which
+// directive makes lookups go through libc.
+func (c *conf) logConfigPos(pos configPos, reason string) {
+	if c.dnsDebugLevel < 2 {
+		return
+	}
+	kvs := []string{"file", pos.file}
+	if pos.line > 0 {
+		kvs = append(kvs, "line", itoa.Itoa(pos.line))
+	}
+	if pos.token != "" {
+		kvs = append(kvs, "token", pos.token)
+	}
+	dnsDebugLog("non-standard configuration", append(kvs, "reason", reason)...)
+}
+
+// avahiResolves reports whether the Go resolver asks the Avahi daemon for
+// the addresses of hostname, a .local name, rather than DNS, as the
+// mdns sources of nsswitch.conf do. A Resolver with its own Dial
+// function keeps to DNS.
+func (c *conf) avahiResolves(r *Resolver, hostname string) bool {
+	if c.goos != "linux" || !c.hasAvahi || c.hasMDNSAllow || (r != nil && r.Dial != nil) {
+		return false
+	}
+	if stringsHasSuffix(hostname, ".") {
+		hostname = hostname[:len(hostname)-1]
+	}
+	if !stringsHasSuffixFold(hostname, ".local") {
+		return false
+	}
+	for _, src := range getSystemNSS().sources["hosts"] {
+		if stringsHasPrefix(src.source, "mdns") {
+			return true
+		}
+	}
+	return false
+}
+
+// winsResolves reports whether the Go resolver makes NetBIOS name
+// queries for hostname when the other sources failed to resolve it, as
+// the wins source of nsswitch.conf does. A Resolver with its own Dial
+// function keeps to DNS.
+func (c *conf) winsResolves(r *Resolver, hostname string) bool {
+	if c.goos == "windows" || c.goos == "plan9" || (r != nil && r.Dial != nil) || !isNetBIOSName(hostname) {
+		return false
+	}
+	for _, src := range getSystemNSS().sources["hosts"] {
+		if src.source == "wins" {
+			return true
+		}
+	}
+	return false
+}
+
+// libvirtSources returns the libvirt and libvirt_guest sources of the
+// hosts database in nsswitch.conf, in order, which the Go resolver
+// consults after the files source. A Resolver with its own Dial
+// function keeps to DNS.
+func (c *conf) libvirtSources(r *Resolver) []string {
+	if r != nil && r.Dial != nil {
+		return nil
+	}
+	var srcs []string
+	for _, src := range getSystemNSS().sources["hosts"] {
+		if src.source == "libvirt" || src.source == "libvirt_guest" {
+			srcs = append(srcs, src.source)
+		}
+	}
+	return srcs
+}
+
+// myhostnameResolves reports whether the Go resolver answers the
+// lookup of hostname itself, as the myhostname source of nsswitch.conf
+// does for localhost, the host's own name, _gateway and _outbound. It
+// does so when the files source, if any, has no addresses for it. A
+// Resolver with its own Dial function keeps to DNS.
+func (c *conf) myhostnameResolves(r *Resolver, hostname string) bool {
+	if !c.nativeMyhostname() || (r != nil && r.Dial != nil) {
+		return false
+	}
+	for _, src := range getSystemNSS().sources["hosts"] {
+		if src.source == "myhostname" {
+			return myhostnameName(hostname)
+		}
+	}
+	return false
+}
+
+// nativeMyhostname reports whether the Go resolver can answer the names
+// of the myhostname source on c.goos, whose routing tables it reads for
+// the default gateways: with netlink on Linux and with the route sysctl
+// on the BSDs.
+func (c *conf) nativeMyhostname() bool {
+	switch c.goos {
+	case "linux", "darwin", "dragonfly", "freebsd", "netbsd", "openbsd":
+		return true
+	}
+	return false
+}
+
+// machinedStatePath holds a file for each machine registered with
+// systemd-machined.
+var machinedStatePath = "/run/systemd/machines"
+
+// machinedResolves reports whether the Go resolver asks systemd-machined
+// for the addresses of hostname, as the mymachines source of
+// nsswitch.conf does. Only the names of registered machines are looked
+// up, at the place of the source: before the hosts file if it comes
+// first (see machinedBeforeFiles), and after it otherwise, so that an
+// entry of the file wins over a machine of the same name. A Resolver
+// with its own Dial function keeps to DNS.
+func (c *conf) machinedResolves(r *Resolver, hostname string) bool {
+	if c.goos != "linux" || (r != nil && r.Dial != nil) {
+		return false
+	}
+	found := false
+	for _, src := range getSystemNSS().sources["hosts"] {
+		if src.source == "mymachines" {
+			found = true
+			break
+		}
+	}
+	if stringsHasSuffix(hostname, ".") {
+		hostname = hostname[:len(hostname)-1]
+	}
+	if !found || hostname == "" || hostname == "." || hostname == ".." || bytealg.IndexByteString(hostname, '/') >= 0 {
+		return false
+	}
+	_, err := os.Stat(machinedStatePath + "/" + hostname)
+	return err == nil
+}
+
+// machinedBeforeFiles reports whether the mymachines source comes before
+// files in the hosts database of nsswitch.conf.
+func (c *conf) machinedBeforeFiles() bool {
+	for _, src := range getSystemNSS().sources["hosts"] {
+		switch src.source {
+		case "mymachines":
+			return true
+		case "files":
+			return false
+		}
+	}
+	return false
+}
+
+// solarisDefaultHostSources are the sources of the hosts database on
+// illumos and Solaris when nsswitch.conf doesn't list any:
+// "nis [NOTFOUND=return] files".
+var solarisDefaultHostSources = []nssSource{
+	{source: "nis", criteria: []nssCriterion{{status: "notfound", action: "return"}}},
+	{source: "files"},
+}
+
+// hasNISDomain reports whether file, such as Solaris'
+// /etc/defaultdomain, sets an NIS domain name.
+func hasNISDomain(file string) bool {
+	f, err := open(file)
+	if err != nil {
+		return false
+	}
+	defer f.close()
+	for line, ok := f.readLine(); ok; line, ok = f.readLine() {
+		if len(getFields(line)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// netconfigHasNameLibs reports whether the Solaris network configuration
+// database in file, described in netconfig(4), lists name-to-address
+// translation libraries for an internet transport. The default "-"
+// means that names are resolved as set up in nsswitch.conf.
+func netconfigHasNameLibs(file string) bool {
+	f, err := open(file)
+	if err != nil {
+		return false
+	}
+	defer f.close()
+	for line, ok := f.readLine(); ok; line, ok = f.readLine() {
+		if len(line) > 0 && line[0] == '#' {
+			continue
+		}
+		// network_id semantics flags protofamily protoname device nametoaddr_libs
+		fields := getFields(line)
+		if len(fields) < 7 || fields[3] != "inet" && fields[3] != "inet6" {
+			continue
+		}
+		if fields[6] != "-" {
+			return true
+		}
+	}
+	return false
+}
+
 // goDebugNetDNS parses the value of the GODEBUG "netdns" value.
 // The netdns value can be of the form:
 //
@@ -311,33 +698,90 @@ func (c *conf) hostLookupOrder(r *Resolver, hostname string) (ret hostLookupOrde
 //	cgo+1   // use cgo for DNS lookups + debug level 1
 //	1+cgo   // same
 //	cgo+2   // same, but debug level 2
+//	go+cgo  // use go for DNS lookups, retrying failures with cgo
+//	go+cgo+1 // same, with debug level 1
 //
 // etc.
 func goDebugNetDNS() (dnsMode string, debugLevel int) {
-	goDebug := godebug.Get("netdns")
-	parsePart := func(s string) {
-		if s == "" {
-			return
-		}
+	return parseNetDNS(godebug.Get("netdns"))
+}
+
+// parseNetDNS parses a GODEBUG "netdns" value. See goDebugNetDNS.
+func parseNetDNS(goDebug string) (dnsMode string, debugLevel int) {
+	for _, s := range splitAtBytes(goDebug, "+") {
 		if '0' <= s[0] && s[0] <= '9' {
 			debugLevel, _, _ = dtoi(s)
+		} else if dnsMode == "go" && s == "cgo" {
+			dnsMode = "go+cgo"
 		} else {
 			dnsMode = s
 		}
 	}
-	if i := bytealg.IndexByteString(goDebug, '+'); i != -1 {
-		parsePart(goDebug[:i])
-		parsePart(goDebug[i+1:])
+	return
+}
+
+// dnsDebugOutput writes one line of netdns debugging output.
+// It is a variable for testing.
+var dnsDebugOutput = func(line string) { println(line) }
+
+// dnsDebugLogger is the function set by SetDNSDebugLogger, if any.
+var dnsDebugLogger atomic.Pointer[func(msg string, kv ...string)]
+
+// SetDNSDebugLogger makes the resolver pass its debugging messages,
+// which the GODEBUG netdns setting turns on (see the package
+// documentation), to f instead of writing them to standard error.
+// Each call of f receives a message, such as "hostLookupOrder", and
+// its details as alternating keys and values, such as "host" and
+// "example.com", for programs to log in their own format. f may be
+// called concurrently. A nil f restores standard error.
+func SetDNSDebugLogger(f func(msg string, kv ...string)) {
+	if f == nil {
+		dnsDebugLogger.Store(nil)
 		return
 	}
-	parsePart(goDebug)
-	return
+	dnsDebugLogger.Store(&f)
 }
 
-// isLocalhost reports whether h should be considered a "localhost"
-// name for the myhostname NSS module.
-func isLocalhost(h string) bool {
-	return stringsEqualFold(h, "localhost") || stringsEqualFold(h, "localhost.localdomain") || stringsHasSuffixFold(h, ".localhost") || stringsHasSuffixFold(h, ".localhost.localdomain")
+// dnsDebugLog passes a netdns debugging message to the function set by
+// SetDNSDebugLogger, or else writes it as a single line holding msg
+// followed by space-separated key=value pairs, so that the output can
+// be parsed by log collectors. Values containing spaces, quotes or
+// equal signs are quoted.
+func dnsDebugLog(msg string, kvs ...string) {
+	if f := dnsDebugLogger.Load(); f != nil {
+		(*f)(msg, kvs...)
+		return
+	}
+	line := "go package net: " + msg
+	for i := 0; i+1 < len(kvs); i += 2 {
+		line += " " + kvs[i] + "=" + debugQuote(kvs[i+1])
+	}
+	dnsDebugOutput(line)
+}
+
+// debugQuote returns s, surrounded by double quotes if it contains
+// characters that would make a key=value pair ambiguous.
+func debugQuote(s string) string {
+	if s != "" && bytealg.IndexByteString(s, ' ') < 0 &&
+		bytealg.IndexByteString(s, '"') < 0 && bytealg.IndexByteString(s, '=') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return string(append(b, '"'))
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
 }
 
 // isGateway reports whether h should be considered a "gateway"
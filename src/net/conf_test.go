@@ -7,8 +7,13 @@
 package net
 
 import (
+	"context"
 	"io/fs"
+	"os"
+	"reflect"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -61,6 +66,17 @@ func TestConfHostLookupOrder(t *testing.T) {
 				{"x.com", "myhostname", hostLookupDNSFiles},
 			},
 		},
+		{
+			name: "netgo_windows",
+			c: &conf{
+				netGo:  true,
+				goos:   "windows",
+				resolv: defaultResolvConf,
+			},
+			hostTests: []nssHostTest{
+				{"x.com", "myhostname", hostLookupFilesDNS},
+			},
+		},
 		{
 			name: "netgo_fallback_on_cgo",
 			c: &conf{
@@ -95,6 +111,143 @@ func TestConfHostLookupOrder(t *testing.T) {
 			nss:       nssStr("foo: bar"),
 			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupFilesDNS}},
 		},
+		{
+			name: "linux_no_nsswitch_host_conf",
+			c: &conf{
+				goos:     "linux",
+				resolv:   defaultResolvConf,
+				hostConf: &hostConf{order: []string{"bind", "hosts"}},
+			},
+			nss:       &nssConf{err: fs.ErrNotExist},
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupDNSFiles}},
+		},
+		{
+			name: "linux_host_conf_ignored_with_nsswitch",
+			c: &conf{
+				goos:     "linux",
+				resolv:   defaultResolvConf,
+				hostConf: &hostConf{order: []string{"bind", "hosts"}},
+			},
+			nss:       nssStr("hosts: files dns"),
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "freebsd_cache",
+			c: &conf{
+				goos:   "freebsd",
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: cache files dns"),
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "linux_cache",
+			c: &conf{
+				goos:   "linux",
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: cache files dns"),
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "linux_avahi",
+			c: &conf{
+				goos:     "linux",
+				hasAvahi: true,
+				resolv:   defaultResolvConf,
+			},
+			nss: nssStr("hosts: files mdns4_minimal [NOTFOUND=return] dns"),
+			hostTests: []nssHostTest{
+				{"printer.local", "myhostname", hostLookupFilesDNS},
+				{"printer.local.", "myhostname", hostLookupFilesDNS},
+				{"google.com", "myhostname", hostLookupFilesDNS},
+			},
+		},
+		{
+			name: "linux_avahi_no_mdns_source",
+			c: &conf{
+				goos:     "linux",
+				hasAvahi: true,
+				resolv:   defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns"),
+			hostTests: []nssHostTest{{"printer.local", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "linux_avahi_resolver_dial",
+			c: &conf{
+				goos:     "linux",
+				hasAvahi: true,
+				resolv:   defaultResolvConf,
+			},
+			resolver:  &Resolver{Dial: func(ctx context.Context, network, address string) (Conn, error) { return nil, nil }},
+			nss:       nssStr("hosts: files mdns4_minimal [NOTFOUND=return] dns"),
+			hostTests: []nssHostTest{{"printer.local", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "samba_wins_last",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns wins"),
+			hostTests: []nssHostTest{{"fileserver", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "samba_wins_before_dns",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files wins dns"),
+			hostTests: []nssHostTest{{"fileserver", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "libvirt",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files libvirt libvirt_guest dns"),
+			hostTests: []nssHostTest{{"fedora", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "libvirt_after_dns",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns libvirt"),
+			hostTests: []nssHostTest{{"fedora", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "libvirt_before_files",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: libvirt files dns"),
+			hostTests: []nssHostTest{{"fedora", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "mymachines",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: mymachines files myhostname dns"),
+			hostTests: []nssHostTest{{"web", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "mymachines_after_files",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files myhostname mymachines dns"),
+			hostTests: []nssHostTest{{"web", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "mymachines_after_dns",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns mymachines"),
+			hostTests: []nssHostTest{{"web", "myhostname", hostLookupCgo}},
+		},
 		// On OpenBSD, no resolv.conf means no DNS.
 		{
 			name: "openbsd_no_resolv_conf",
@@ -106,11 +259,51 @@ func TestConfHostLookupOrder(t *testing.T) {
 		},
 		{
 			name: "solaris_no_nsswitch",
+			c: &conf{
+				goos:         "solaris",
+				hasNISDomain: true,
+				resolv:       defaultResolvConf,
+			},
+			nss:       &nssConf{err: fs.ErrNotExist},
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupCgo}},
+		},
+		// Without an NIS domain, the default "nis [NOTFOUND=return] files"
+		// means files only.
+		{
+			name: "solaris_no_nsswitch_no_nis",
 			c: &conf{
 				goos:   "solaris",
 				resolv: defaultResolvConf,
 			},
 			nss:       &nssConf{err: fs.ErrNotExist},
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupFiles}},
+		},
+		{
+			name: "solaris_nis_no_domain",
+			c: &conf{
+				goos:   "solaris",
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: nis [NOTFOUND=return] files dns"),
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "solaris_nis_unavail_return",
+			c: &conf{
+				goos:   "solaris",
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: nis [UNAVAIL=return] files dns"),
+			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "solaris_netconfig_libs",
+			c: &conf{
+				goos:          "solaris",
+				netconfigLibs: true,
+				resolv:        defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns"),
 			hostTests: []nssHostTest{{"google.com", "myhostname", hostLookupCgo}},
 		},
 		{
@@ -287,6 +480,32 @@ func TestConfHostLookupOrder(t *testing.T) {
 				{"", "myhostname", hostLookupFilesDNS}, // Issue 13623
 			},
 		},
+		// On Linux, the Go resolver answers the names of the
+		// myhostname source itself.
+		{
+			name: "myhostname_linux",
+			c: &conf{
+				goos:   "linux",
+				resolv: defaultResolvConf,
+			},
+			nss: nssStr("hosts: files myhostname dns"),
+			hostTests: []nssHostTest{
+				{"x.com", "myhostname", hostLookupFilesDNS},
+				{"myhostname", "myhostname", hostLookupFilesDNS},
+				{"_gateway", "myhostname", hostLookupFilesDNS},
+				{"_outbound", "myhostname", hostLookupFilesDNS},
+				{"anything.localhost", "myhostname", hostLookupFilesDNS},
+			},
+		},
+		{
+			name: "myhostname_linux_criteria",
+			c: &conf{
+				goos:   "linux",
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files myhostname [success=continue] dns"),
+			hostTests: []nssHostTest{{"x.com", "myhostname", hostLookupCgo}},
+		},
 		{
 			name: "ubuntu14.04.02",
 			c: &conf{
@@ -314,6 +533,33 @@ func TestConfHostLookupOrder(t *testing.T) {
 				{"somehostname", "myhostname", hostLookupDNSFiles},
 			},
 		},
+		// A negated criterion applies to all the other statuses:
+		// [!UNAVAIL=return] also returns on NOTFOUND, which only
+		// changes nothing after the last source.
+		{
+			name: "negated_criterion_last",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files dns [!UNAVAIL=return]"),
+			hostTests: []nssHostTest{{"x.com", "myhostname", hostLookupFilesDNS}},
+		},
+		{
+			name: "negated_criterion_not_last",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: files [!UNAVAIL=return] dns"),
+			hostTests: []nssHostTest{{"x.com", "myhostname", hostLookupCgo}},
+		},
+		{
+			name: "negated_criterion_standard",
+			c: &conf{
+				resolv: defaultResolvConf,
+			},
+			nss:       nssStr("hosts: dns [!SUCCESS=continue] files"),
+			hostTests: []nssHostTest{{"x.com", "myhostname", hostLookupDNSFiles}},
+		},
 		{
 			name: "resolv.conf-unknown",
 			c: &conf{
@@ -352,13 +598,17 @@ func TestConfHostLookupOrder(t *testing.T) {
 	}
 
 	origGetHostname := getHostname
-	defer func() { getHostname = origGetHostname }()
+	defer func() {
+		getHostname = origGetHostname
+		FlushHostnameCache()
+	}()
 	defer setSystemNSS(getSystemNSS(), 0)
 
 	for _, tt := range tests {
 
 		for _, ht := range tt.hostTests {
 			getHostname = func() (string, error) { return ht.localhost, nil }
+			FlushHostnameCache()
 			setSystemNSS(tt.nss, time.Hour)
 
 			gotOrder := tt.c.hostLookupOrder(tt.resolver, ht.host)
@@ -374,10 +624,249 @@ func setSystemNSS(nss *nssConf, addDur time.Duration) {
 	nssConfig.nssConf = nss
 	nssConfig.mu.Unlock()
 	nssConfig.acquireSema()
-	nssConfig.lastChecked = time.Now().Add(addDur)
+	nssConfig.lastChecked = clockNow().Add(addDur)
+	nssConfig.changed.Store(false)
 	nssConfig.releaseSema()
 }
 
 func TestSystemConf(t *testing.T) {
 	systemConf()
 }
+
+func TestDNSDebugLog(t *testing.T) {
+	origOutput := dnsDebugOutput
+	defer func() { dnsDebugOutput = origOutput }()
+	var lines []string
+	dnsDebugOutput = func(line string) { lines = append(lines, line) }
+	defer setSystemNSS(getSystemNSS(), 0)
+	setSystemNSS(nssStr("hosts: files dns"), time.Hour)
+
+	c := &conf{
+		goos:          "linux",
+		netGo:         true,
+		dnsDebugLevel: 2,
+		resolv:        defaultResolvConf,
+	}
+	c.hostLookupOrder(nil, "example.com")
+	dnsDebugLog("dns query", "name", "example.com.", "err", `i/o "timeout"`, "empty", "")
+
+	want := []string{
+		`go package net: hostLookupOrder host=example.com order=files,dns`,
+		`go package net: dns query name=example.com. err="i/o \"timeout\"" empty=""`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got debug output:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSetDNSDebugLogger(t *testing.T) {
+	origOutput := dnsDebugOutput
+	defer func() { dnsDebugOutput = origOutput }()
+	dnsDebugOutput = func(line string) { t.Errorf("unexpected debug output %q", line) }
+
+	var got []string
+	SetDNSDebugLogger(func(msg string, kv ...string) {
+		got = append(got, msg)
+		got = append(got, kv...)
+	})
+	defer SetDNSDebugLogger(nil)
+	dnsDebugLog("dns query", "name", "example.com.", "err", "i/o timeout")
+	if want := []string{"dns query", "name", "example.com.", "err", "i/o timeout"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logger got %q; want %q", got, want)
+	}
+
+	SetDNSDebugLogger(nil)
+	var lines []string
+	dnsDebugOutput = func(line string) { lines = append(lines, line) }
+	dnsDebugLog("dns query", "name", "example.com.")
+	if want := []string{"go package net: dns query name=example.com."}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("after SetDNSDebugLogger(nil), got output %q; want %q", lines, want)
+	}
+}
+
+func TestDNSDebugNonStandardConfig(t *testing.T) {
+	origOutput := dnsDebugOutput
+	defer func() { dnsDebugOutput = origOutput }()
+	var lines []string
+	dnsDebugOutput = func(line string) { lines = append(lines, line) }
+	defer setSystemNSS(getSystemNSS(), 0)
+	setSystemNSS(nssStr("# comment\nhosts: files dns [!UNAVAIL=return] mdns4\n"), time.Hour)
+
+	c := &conf{
+		goos:          "linux",
+		dnsDebugLevel: 2,
+		resolv:        defaultResolvConf,
+	}
+	c.hostLookupOrder(nil, "example.com")
+	c.resolv = &dnsConfig{
+		unknownOpt:   true,
+		unknownOptAt: configPos{file: "/etc/resolv.conf", line: 3, token: "inet6"},
+	}
+	c.hostLookupOrder(nil, "example.com")
+
+	want := []string{
+		`go package net: non-standard configuration file=/etc/nsswitch.conf line=2 token="dns [!unavail=return]" reason="non-standard criteria"`,
+		`go package net: hostLookupOrder host=example.com order=cgo`,
+		`go package net: non-standard configuration file=/etc/resolv.conf line=3 token=inet6 reason="unknown directive or option"`,
+		`go package net: hostLookupOrder host=example.com order=cgo`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got debug output:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseNetDNS(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		mode  string
+		level int
+	}{
+		{"", "", 0},
+		{"1", "", 1},
+		{"go", "go", 0},
+		{"cgo+2", "cgo", 2},
+		{"1+cgo", "cgo", 1},
+		{"go+cgo", "go+cgo", 0},
+		{"go+cgo+1", "go+cgo", 1},
+		{"cgo+go", "go", 0},
+	} {
+		mode, level := parseNetDNS(tt.in)
+		if mode != tt.mode || level != tt.level {
+			t.Errorf("parseNetDNS(%q) = %q, %d; want %q, %d", tt.in, mode, level, tt.mode, tt.level)
+		}
+	}
+}
+
+func TestSolarisNameConfig(t *testing.T) {
+	if !hasNISDomain("testdata/defaultdomain") {
+		t.Error("hasNISDomain(testdata/defaultdomain) = false; want true")
+	}
+	if hasNISDomain("testdata/defaultdomain-empty") || hasNISDomain("testdata/nonexistent") {
+		t.Error("hasNISDomain of an empty or missing file = true; want false")
+	}
+	for _, tt := range []struct {
+		file string
+		want bool
+	}{
+		{"testdata/netconfig", false},
+		{"testdata/netconfig-libs", true},
+		{"testdata/nonexistent", false},
+	} {
+		if got := netconfigHasNameLibs(tt.file); got != tt.want {
+			t.Errorf("netconfigHasNameLibs(%s) = %v; want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestMachinedResolves(t *testing.T) {
+	defer setSystemNSS(getSystemNSS(), 0)
+	defer func(orig string) { machinedStatePath = orig }(machinedStatePath)
+	machinedStatePath = t.TempDir()
+	if err := os.WriteFile(machinedStatePath+"/web", []byte("NAME=web\nCLASS=container\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &conf{goos: "linux"}
+	tests := []struct {
+		nss  string
+		r    *Resolver
+		name string
+		want bool
+	}{
+		{"hosts: mymachines files dns", nil, "web", true},
+		{"hosts: mymachines files dns", nil, "web.", true},
+		{"hosts: mymachines files dns", nil, "db", false},
+		{"hosts: mymachines files dns", nil, "../machines/web", false},
+		{"hosts: mymachines files dns", &Resolver{Dial: func(ctx context.Context, network, address string) (Conn, error) { return nil, nil }}, "web", false},
+		{"hosts: files dns", nil, "web", false},
+	}
+	for _, tt := range tests {
+		setSystemNSS(nssStr(tt.nss), time.Hour)
+		if got := c.machinedResolves(tt.r, tt.name); got != tt.want {
+			t.Errorf("%s: machinedResolves(%q) = %v; want %v", tt.nss, tt.name, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		nss  string
+		want bool
+	}{
+		{"hosts: mymachines files dns", true},
+		{"hosts: files myhostname mymachines dns", false},
+		{"hosts: myhostname mymachines dns", true},
+	} {
+		setSystemNSS(nssStr(tt.nss), time.Hour)
+		if got := c.machinedBeforeFiles(); got != tt.want {
+			t.Errorf("%s: machinedBeforeFiles() = %v; want %v", tt.nss, got, tt.want)
+		}
+	}
+}
+
+func TestReloadResolverConfig(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		t.Skip("always uses the native resolver")
+	}
+	// Runs after the environment is restored.
+	t.Cleanup(ReloadResolverConfig)
+	t.Setenv("RES_OPTIONS", "")
+	t.Setenv("HOSTALIASES", "")
+	if _, ok := syscall.Getenv("LOCALDOMAIN"); ok {
+		t.Skip("LOCALDOMAIN is set")
+	}
+	if systemConf().netCgo {
+		t.Skip("netdns=cgo")
+	}
+	ReloadResolverConfig()
+	before := systemConf()
+	if before.forceCgoLookupHost {
+		t.Skip("native resolver forced by the system configuration")
+	}
+
+	t.Setenv("RES_OPTIONS", "ndots:3")
+	if systemConf() != before {
+		t.Fatal("configuration changed before ReloadResolverConfig")
+	}
+	ReloadResolverConfig()
+	if !systemConf().forceCgoLookupHost {
+		t.Error("RES_OPTIONS ignored after ReloadResolverConfig")
+	}
+
+	t.Setenv("RES_OPTIONS", "")
+	ReloadResolverConfig()
+	if systemConf().forceCgoLookupHost {
+		t.Error("RES_OPTIONS still in effect after it was cleared")
+	}
+}
+
+func TestHostnameCache(t *testing.T) {
+	origGetHostname := getHostname
+	defer func() {
+		getHostname = origGetHostname
+		FlushHostnameCache()
+	}()
+	calls := 0
+	name := "before.example"
+	getHostname = func() (string, error) {
+		calls++
+		return name, nil
+	}
+	FlushHostnameCache()
+
+	for i := 0; i < 3; i++ {
+		if hn, err := cachedHostname(); hn != "before.example" || err != nil {
+			t.Fatalf("cachedHostname() = %q, %v; want before.example", hn, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("getHostname called %d times; want 1", calls)
+	}
+
+	// A renamed host shows up once the cache is flushed.
+	name = "after.example"
+	if hn, _ := cachedHostname(); hn != "before.example" {
+		t.Errorf("cachedHostname() = %q before flush; want before.example", hn)
+	}
+	FlushHostnameCache()
+	if hn, _ := cachedHostname(); hn != "after.example" {
+		t.Errorf("cachedHostname() = %q after flush; want after.example", hn)
+	}
+}
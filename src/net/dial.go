@@ -70,6 +70,13 @@ type Dialer struct {
 	// A negative value disables Fast Fallback support.
 	FallbackDelay time.Duration
 
+	// PreferIPv4 makes dials to host names with both IPv4 and IPv6
+	// addresses try the IPv4 addresses first, with the IPv6 ones
+	// following after FallbackDelay, or after the IPv4 ones if Fast
+	// Fallback is disabled. By default the family of the address
+	// that the resolver sorted first, usually IPv6, is tried first.
+	PreferIPv4 bool
+
 	// KeepAlive specifies the interval between keep-alive
 	// probes for an active network connection.
 	// If zero, keep-alive probes are sent with a default value
@@ -430,6 +437,9 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 		address: address,
 	}
 
+	if d.PreferIPv4 {
+		addrs = addrs.withIPv4First()
+	}
 	var primaries, fallbacks addrList
 	if d.dualStack() && network == "tcp" {
 		primaries, fallbacks = addrs.partition(isIPv4)
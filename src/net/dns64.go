@@ -0,0 +1,229 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// Synthesis of the IPv6 addresses of IPv4-only hosts on networks with a
+// NAT64 gateway: see RFC 6052, RFC 6147 and RFC 7050.
+
+package net
+
+import (
+	"context"
+	"internal/singleflight"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// nat64MinTTL and nat64MaxTTL bound how long a discovered
+	// prefix is kept, and nat64NegativeTTL how long its absence is.
+	nat64MinTTL      = time.Minute
+	nat64MaxTTL      = 24 * time.Hour
+	nat64NegativeTTL = 5 * time.Minute
+)
+
+// nat64WKAs are the well-known IPv4 addresses of ipv4only.arpa.
+var nat64WKAs = [...][4]byte{{192, 0, 0, 170}, {192, 0, 0, 171}}
+
+// nat64PrefixLens are the lengths of the prefixes of RFC 6052.
+var nat64PrefixLens = [...]int{96, 64, 56, 48, 40, 32}
+
+// nat64Cache holds the NAT64 prefixes discovered, keyed by the list of
+// servers they were discovered through, since Resolvers with their own
+// Servers or ConfigPath may reach other DNS64 servers, or none.
+var nat64Cache struct {
+	sync.Mutex
+	m map[string]nat64Entry
+}
+
+// A nat64Entry is a NAT64 prefix discovered through some servers.
+type nat64Entry struct {
+	prefix  netip.Prefix // not valid if no NAT64 was found
+	expires time.Time
+}
+
+// nat64Group merges the discoveries through the same servers, which
+// are made without holding nat64Cache, so that a slow one only holds
+// up the lookups that need its result.
+var nat64Group singleflight.Group
+
+// FlushDNSCache drops the answers that Go's built-in DNS resolver
+// keeps from earlier lookups, so that the next lookups query the
+// servers again. The resolver does not cache the answers of lookups
+// themselves: only the NAT64 prefix it discovers on hosts that have
+// no IPv4 addresses is kept, for as long as its TTL allows. Programs can
+// call it after the network changes under them, as when a VPN
+// connects. The caches of the native resolver, such as that of nscd,
+// and of DNS servers are not flushed.
+func FlushDNSCache() {
+	nat64Cache.Lock()
+	nat64Cache.m = nil
+	nat64Cache.Unlock()
+}
+
+// nat64Prefix returns the prefix with which the DNS64 servers of the
+// network synthesize IPv6 addresses, discovering it as in RFC 7050 by
+// asking for the IPv6 addresses of ipv4only.arpa.
+func (r *Resolver) nat64Prefix(ctx context.Context, conf *dnsConfig) (netip.Prefix, bool) {
+	var key string
+	for _, s := range conf.servers {
+		key += s + "\000"
+	}
+	nat64Cache.Lock()
+	e, ok := nat64Cache.m[key]
+	nat64Cache.Unlock()
+	if ok && clockNow().Before(e.expires) {
+		return e.prefix, e.prefix.IsValid()
+	}
+
+	// The discovery outlives ctx, as it may be shared with other
+	// lookups; tryOneName bounds it with the timeouts of conf.
+	ch := nat64Group.DoChan(key, func() (any, error) {
+		e, ok := r.discoverNAT64(withUnexpiredValuesPreserved(ctx), conf)
+		if !ok {
+			return nat64Entry{}, nil
+		}
+		nat64Cache.Lock()
+		defer nat64Cache.Unlock()
+		now := clockNow()
+		for k, old := range nat64Cache.m {
+			if !now.Before(old.expires) {
+				delete(nat64Cache.m, k)
+			}
+		}
+		if nat64Cache.m == nil {
+			nat64Cache.m = make(map[string]nat64Entry)
+		}
+		nat64Cache.m[key] = e
+		return e, nil
+	})
+	select {
+	case res := <-ch:
+		e := res.Val.(nat64Entry)
+		return e.prefix, e.prefix.IsValid()
+	case <-ctx.Done():
+		return netip.Prefix{}, false
+	}
+}
+
+// discoverNAT64 asks the servers of conf for the IPv6 addresses of
+// ipv4only.arpa and returns the cache entry for the prefix found in
+// them, if any. It reports false if the query failed, in which case
+// the discovery is tried again with the next lookup.
+func (r *Resolver) discoverNAT64(ctx context.Context, conf *dnsConfig) (nat64Entry, bool) {
+	var addrs []netip.Addr
+	ttl := nat64MaxTTL
+	p, _, err := r.tryOneName(ctx, conf, "ipv4only.arpa.", dnsmessage.TypeAAAA)
+	if err != nil {
+		if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+			return nat64Entry{}, false
+		}
+	}
+	for err == nil {
+		var h dnsmessage.ResourceHeader
+		if h, err = p.AnswerHeader(); err != nil {
+			break
+		}
+		if h.Type != dnsmessage.TypeAAAA {
+			err = p.SkipAnswer()
+			continue
+		}
+		var aaaa dnsmessage.AAAAResource
+		if aaaa, err = p.AAAAResource(); err != nil {
+			break
+		}
+		addrs = append(addrs, netip.AddrFrom16(aaaa.AAAA))
+		if d := time.Duration(h.TTL) * time.Second; d < ttl {
+			ttl = d
+		}
+	}
+	prefix := nat64PrefixOf(addrs)
+	if !prefix.IsValid() {
+		ttl = nat64NegativeTTL
+	} else if ttl < nat64MinTTL {
+		ttl = nat64MinTTL
+	}
+	return nat64Entry{prefix: prefix, expires: clockNow().Add(ttl)}, true
+}
+
+// nat64PrefixOf returns the NAT64 prefix of the first of the IPv6
+// addresses of ipv4only.arpa in which a well-known address is embedded.
+func nat64PrefixOf(addrs []netip.Addr) netip.Prefix {
+	for _, a := range addrs {
+		if !a.Is6() || a.Is4In6() {
+			continue
+		}
+		for _, bits := range nat64PrefixLens {
+			ip4 := nat64Extract(a, bits)
+			for _, wka := range nat64WKAs {
+				if ip4 == wka {
+					p, _ := a.Prefix(bits)
+					return p
+				}
+			}
+		}
+	}
+	return netip.Prefix{}
+}
+
+// nat64Extract returns the IPv4 address embedded in a after a prefix of
+// bits bits, as laid out by RFC 6052, section 2.2: bits 64 to 71 are
+// skipped.
+func nat64Extract(a netip.Addr, bits int) (ip4 [4]byte) {
+	b := a.As16()
+	i := bits / 8
+	for j := range ip4 {
+		if i == 8 {
+			i++
+		}
+		ip4[j] = b[i]
+		i++
+	}
+	return ip4
+}
+
+// nat64Synthesize returns the IPv6 address that embeds ip4 in prefix.
+func nat64Synthesize(prefix netip.Prefix, ip4 [4]byte) netip.Addr {
+	b := prefix.Masked().Addr().As16()
+	i := prefix.Bits() / 8
+	for _, c := range ip4 {
+		if i == 8 {
+			i++
+		}
+		b[i] = c
+		i++
+	}
+	return netip.AddrFrom16(b)
+}
+
+// synthesizeDNS64 returns the addresses of a host for an IPv6-only
+// machine behind a NAT64 gateway with prefix: the IPv6 addresses of the
+// host if it has any, or else the addresses synthesized from its IPv4
+// ones, which keep their TTLs in ttls.
+func synthesizeDNS64(addrs []IPAddr, prefix netip.Prefix, ttls map[netip.Addr]uint32) []IPAddr {
+	var v6 []IPAddr
+	for _, a := range addrs {
+		if a.IP.To4() == nil {
+			v6 = append(v6, a)
+		}
+	}
+	if len(v6) > 0 {
+		return v6
+	}
+	for _, a := range addrs {
+		ip4, _ := netip.AddrFromSlice(a.IP.To4())
+		synth := nat64Synthesize(prefix, ip4.As4())
+		v6 = append(v6, IPAddr{IP: IP(synth.AsSlice())})
+		if ttls != nil {
+			if ttl, ok := ttls[ip4]; ok {
+				recordTTL(ttls, synth, ttl)
+			}
+		}
+	}
+	return v6
+}
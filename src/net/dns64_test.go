@@ -0,0 +1,141 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package net
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The examples of RFC 6052, section 2.4.
+var nat64Tests = []struct {
+	prefix string
+	addr   string // of 192.0.2.33
+}{
+	{"2001:db8::/32", "2001:db8:c000:221::"},
+	{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+	{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+	{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+	{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+	{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+}
+
+func TestNAT64Synthesize(t *testing.T) {
+	for _, tt := range nat64Tests {
+		p := netip.MustParsePrefix(tt.prefix)
+		got := nat64Synthesize(p, [4]byte{192, 0, 2, 33})
+		if got != netip.MustParseAddr(tt.addr) {
+			t.Errorf("nat64Synthesize(%v) = %v; want %v", p, got, tt.addr)
+		}
+		if ip4 := nat64Extract(got, p.Bits()); ip4 != [4]byte{192, 0, 2, 33} {
+			t.Errorf("nat64Extract(%v, %d) = %v", got, p.Bits(), ip4)
+		}
+		wka := nat64Synthesize(p, nat64WKAs[1])
+		if got := nat64PrefixOf([]netip.Addr{netip.MustParseAddr("2001:db8::1"), wka}); got != p {
+			t.Errorf("nat64PrefixOf(%v) = %v; want %v", wka, got, p)
+		}
+	}
+}
+
+func TestSynthesizeDNS64(t *testing.T) {
+	prefix := netip.MustParsePrefix("64:ff9b::/96")
+	ttls := map[netip.Addr]uint32{netip.MustParseAddr("192.0.2.1"): 300}
+	got := synthesizeDNS64([]IPAddr{{IP: ParseIP("192.0.2.1")}}, prefix, ttls)
+	want := []IPAddr{{IP: ParseIP("64:ff9b::192.0.2.1")}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("synthesized %v; want %v", got, want)
+	}
+	if ttl := ttls[netip.MustParseAddr("64:ff9b::c000:201")]; ttl != 300 {
+		t.Errorf("TTL of synthesized address = %d; want 300", ttl)
+	}
+
+	in := []IPAddr{{IP: ParseIP("192.0.2.1")}, {IP: ParseIP("2001:db8::1")}}
+	if got := synthesizeDNS64(in, prefix, nil); !reflect.DeepEqual(got, in[1:]) {
+		t.Errorf("host with IPv6 addresses: got %v; want %v", got, in[1:])
+	}
+}
+
+func TestNAT64PrefixDiscovery(t *testing.T) {
+	defer FlushDNSCache()
+	var mu sync.Mutex
+	queries := 0
+	nat64 := true
+	unblock := make(chan struct{})
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		if s == "192.0.2.55:53" {
+			<-unblock
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		queries++
+		r := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		}
+		if q.Questions[0].Name.String() == "ipv4only.arpa." && nat64 && s != "192.0.2.54:53" {
+			r.Header.RCode = dnsmessage.RCodeSuccess
+			for _, a := range []string{"64:ff9b::c000:aa", "64:ff9b::c000:ab"} {
+				r.Answers = append(r.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: 3600},
+					Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(a).As16()},
+				})
+			}
+		}
+		return r, nil
+	}}
+	r := Resolver{PreferGo: true, Dial: fake.DialContext}
+	conf := &dnsConfig{servers: []string{"192.0.2.53:53"}, timeout: time.Second, attempts: 1}
+
+	want := netip.MustParsePrefix("64:ff9b::/96")
+	for i := 0; i < 2; i++ {
+		if p, ok := r.nat64Prefix(context.Background(), conf); !ok || p != want {
+			t.Errorf("nat64Prefix = %v, %v; want %v, true", p, ok, want)
+		}
+	}
+	if queries != 1 {
+		t.Errorf("sent %d queries; want 1 while the prefix is cached", queries)
+	}
+
+	// The prefix is kept for the servers it was discovered through.
+	other := &dnsConfig{servers: []string{"192.0.2.54:53"}, timeout: time.Second, attempts: 1}
+	if p, ok := r.nat64Prefix(context.Background(), other); ok {
+		t.Errorf("nat64Prefix through servers without DNS64 = %v, true", p)
+	}
+	if p, ok := r.nat64Prefix(context.Background(), conf); !ok || p != want {
+		t.Errorf("nat64Prefix after a discovery through other servers = %v, %v; want %v, true", p, ok, want)
+	}
+
+	// A slow discovery holds up neither the lookups that stop
+	// waiting for it nor the other users of the cache.
+	slow := &dnsConfig{servers: []string{"192.0.2.55:53"}, timeout: 5 * time.Second, attempts: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if p, ok := r.nat64Prefix(ctx, slow); ok {
+		t.Errorf("nat64Prefix with a canceled context = %v, true", p)
+	}
+	if p, ok := r.nat64Prefix(context.Background(), conf); !ok || p != want {
+		t.Errorf("nat64Prefix during a slow discovery = %v, %v; want %v, true", p, ok, want)
+	}
+	close(unblock)
+	if p, ok := r.nat64Prefix(context.Background(), slow); !ok || p != want {
+		t.Errorf("nat64Prefix after the slow discovery = %v, %v; want %v, true", p, ok, want)
+	}
+
+	FlushDNSCache()
+	mu.Lock()
+	nat64 = false
+	mu.Unlock()
+	if p, ok := r.nat64Prefix(context.Background(), conf); ok {
+		t.Errorf("nat64Prefix without NAT64 = %v, true", p)
+	}
+}
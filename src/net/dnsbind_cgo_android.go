@@ -0,0 +1,56 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo && !netgo
+
+package net
+
+/*
+#cgo LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdint.h>
+
+typedef int (*setsocknetwork_fn)(uint64_t, int);
+
+// android_setsocknetwork is only in the libandroid of Android 6.0 and
+// later, so look it up rather than link against it.
+static setsocknetwork_fn lookup_setsocknetwork(void) {
+	void *lib = dlopen("libandroid.so", RTLD_NOW);
+	if (lib == NULL)
+		return NULL;
+	return (setsocknetwork_fn)dlsym(lib, "android_setsocknetwork");
+}
+
+static int call_setsocknetwork(setsocknetwork_fn fn, uint64_t handle, int fd) {
+	return fn(handle, fd);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+var setSockNetwork struct {
+	once sync.Once
+	fn   C.setsocknetwork_fn
+}
+
+// setSocketNetwork binds the socket fd to the Android network with
+// the given handle, as Resolver.NetworkHandle asks.
+func setSocketNetwork(fd uintptr, handle uint64) error {
+	setSockNetwork.once.Do(func() {
+		setSockNetwork.fn = C.lookup_setsocknetwork()
+	})
+	if setSockNetwork.fn == nil {
+		return errors.New("network handles need Android 6.0 or later")
+	}
+	if r, err := C.call_setsocknetwork(setSockNetwork.fn, C.uint64_t(handle), C.int(fd)); r != 0 {
+		return os.NewSyscallError("android_setsocknetwork", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"syscall"
+)
+
+// bindToDevice binds the socket fd to the network interface ifname,
+// as Resolver.Interface asks.
+func bindToDevice(fd uintptr, ifname string) error {
+	return os.NewSyscallError("setsockopt", syscall.BindToDevice(int(fd), ifname))
+}
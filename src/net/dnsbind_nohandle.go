@@ -0,0 +1,15 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !android || !cgo || netgo
+
+package net
+
+import "errors"
+
+// setSocketNetwork reports an error: network handles are only
+// supported on Android, by programs built with cgo.
+func setSocketNetwork(fd uintptr, handle uint64) error {
+	return errors.New("network handles only supported on Android with cgo")
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package net
+
+import "errors"
+
+// bindToDevice reports an error: only Linux and Android can bind a
+// socket to a network interface.
+func bindToDevice(fd uintptr, ifname string) error {
+	return errors.New("binding to a network interface not supported on this system")
+}
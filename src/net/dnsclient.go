@@ -131,6 +131,55 @@ func isDomainName(s string) bool {
 	return nonNumeric
 }
 
+// isHostName reports whether s is a host name as defined by RFC 952
+// and RFC 1123: labels of letters, digits and hyphens that do not
+// start or end with a hyphen, the last of which is not all digits
+// (see RFC 3696, section 2), with the same length limits as in
+// isDomainName.
+func isHostName(s string) bool {
+	if s == "." || !isDomainName(s) || bytealg.IndexByteString(s, '_') >= 0 {
+		return false
+	}
+	if s[len(s)-1] == '.' {
+		s = s[:len(s)-1]
+	}
+	// isDomainName has checked the hyphens and lengths.
+	for i := last(s, '.') + 1; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// isWireDomainName reports whether s is a domain name that fits in a
+// DNS message: labels of 1 to 63 bytes, separated by dots, adding up
+// to at most 253 bytes, or 254 with a final dot.
+func isWireDomainName(s string) bool {
+	if s == "." {
+		return true
+	}
+	l := len(s)
+	if l == 0 || l > 254 || l == 254 && s[l-1] != '.' {
+		return false
+	}
+	if s[l-1] == '.' {
+		s = s[:l-1]
+	}
+	partlen := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '.' {
+			partlen++
+			continue
+		}
+		if partlen == 0 || partlen > 63 {
+			return false
+		}
+		partlen = 0
+	}
+	return partlen > 0 && partlen <= 63
+}
+
 // absDomainName returns an absolute domain name which ends with a
 // trailing dot to match pure Go reverse resolver and all other lookup
 // routines.
@@ -164,15 +213,15 @@ func (s byPriorityWeight) Less(i, j int) bool {
 func (s byPriorityWeight) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 // shuffleByWeight shuffles SRV records by weight using the algorithm
-// described in RFC 2782.
-func (addrs byPriorityWeight) shuffleByWeight() {
+// described in RFC 2782, with randn returning random numbers in [0, n).
+func (addrs byPriorityWeight) shuffleByWeight(randn func(n int) int) {
 	sum := 0
 	for _, addr := range addrs {
 		sum += int(addr.Weight)
 	}
 	for sum > 0 && len(addrs) > 1 {
 		s := 0
-		n := randIntn(sum)
+		n := randn(sum)
 		for i := range addrs {
 			s += int(addrs[i].Weight)
 			if s > n {
@@ -187,17 +236,18 @@ func (addrs byPriorityWeight) shuffleByWeight() {
 	}
 }
 
-// sort reorders SRV records as specified in RFC 2782.
-func (addrs byPriorityWeight) sort() {
+// sort reorders SRV records as specified in RFC 2782, with randn
+// returning random numbers in [0, n).
+func (addrs byPriorityWeight) sort(randn func(n int) int) {
 	sort.Sort(addrs)
 	i := 0
 	for j := 1; j < len(addrs); j++ {
 		if addrs[i].Priority != addrs[j].Priority {
-			addrs[i:j].shuffleByWeight()
+			addrs[i:j].shuffleByWeight(randn)
 			i = j
 		}
 	}
-	addrs[i:].shuffleByWeight()
+	addrs[i:].shuffleByWeight(randn)
 }
 
 // An MX represents a single DNS MX record.
@@ -222,6 +272,96 @@ func (s byPref) sort() {
 	sort.Sort(s)
 }
 
+// dnsTypeTLSA is the DNS resource record type of TLSA records,
+// which the dnsmessage package does not know about.
+const dnsTypeTLSA dnsmessage.Type = 52
+
+// A TLSA represents a single DNS TLSA record (RFC 6698), which
+// associates a TLS server certificate or public key with the domain
+// name where the record is found.
+type TLSA struct {
+	Usage        uint8  // certificate usage
+	Selector     uint8  // part of the certificate to match
+	MatchingType uint8  // how Data is presented
+	Data         []byte // certificate association data
+}
+
+// dnsTypeNAPTR is the DNS resource record type of NAPTR records,
+// which the dnsmessage package does not know about.
+const dnsTypeNAPTR dnsmessage.Type = 35
+
+// A NAPTR represents a single DNS NAPTR record (RFC 3403).
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// byOrderPref implements sort.Interface to sort NAPTR records by
+// order and then by preference.
+type byOrderPref []*NAPTR
+
+func (s byOrderPref) Len() int { return len(s) }
+func (s byOrderPref) Less(i, j int) bool {
+	return s[i].Order < s[j].Order || (s[i].Order == s[j].Order && s[i].Preference < s[j].Preference)
+}
+func (s byOrderPref) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// sort reorders NAPTR records as specified in RFC 3403, keeping the
+// response order of records with the same order and preference.
+func (s byOrderPref) sort() {
+	sort.Stable(s)
+}
+
+// parseNAPTR parses the RDATA of a NAPTR record. It reports whether
+// the data is well formed.
+func parseNAPTR(data []byte) (*NAPTR, bool) {
+	if len(data) < 4 {
+		return nil, false
+	}
+	rr := &NAPTR{
+		Order:      uint16(data[0])<<8 | uint16(data[1]),
+		Preference: uint16(data[2])<<8 | uint16(data[3]),
+	}
+	data = data[4:]
+	for _, f := range []*string{&rr.Flags, &rr.Service, &rr.Regexp} {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, false
+		}
+		*f = string(data[1 : 1+data[0]])
+		data = data[1+data[0]:]
+	}
+	// The replacement field is a domain name, which must not be
+	// compressed.
+	var name []byte
+	for {
+		if len(data) < 1 {
+			return nil, false
+		}
+		n := int(data[0])
+		if n == 0 {
+			break
+		}
+		if n&0xC0 != 0 || len(data) < 1+n {
+			return nil, false
+		}
+		name = append(name, data[1:1+n]...)
+		name = append(name, '.')
+		data = data[1+n:]
+	}
+	if len(data) != 1 {
+		return nil, false
+	}
+	if len(name) == 0 {
+		name = append(name, '.')
+	}
+	rr.Replacement = string(name)
+	return rr, true
+}
+
 // An NS represents a single DNS NS record.
 type NS struct {
 	Host string
@@ -5,6 +5,7 @@
 package net
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -20,7 +21,7 @@ func checkDistribution(t *testing.T, data []*SRV, margin float64) {
 	for j := 0; j < count; j++ {
 		d := make([]*SRV, len(data))
 		copy(d, data)
-		byPriorityWeight(d).shuffleByWeight()
+		byPriorityWeight(d).shuffleByWeight(randIntn)
 		key := d[0].Target
 		results[key] = results[key] + 1
 	}
@@ -64,3 +65,29 @@ func testWeighting(t *testing.T, margin float64) {
 func TestWeighting(t *testing.T) {
 	testWeighting(t, 0.05)
 }
+
+func TestParseNAPTR(t *testing.T) {
+	for _, tt := range []struct {
+		data []byte
+		want *NAPTR
+	}{
+		{
+			data: []byte("\x00\x64\x00\x0a\x01S\x07SIP+D2U\x00\x04_sip\x04_udp\x07example\x03com\x00"),
+			want: &NAPTR{Order: 100, Preference: 10, Flags: "S", Service: "SIP+D2U", Replacement: "_sip._udp.example.com."},
+		},
+		{
+			data: []byte("\x00\x01\x00\x02\x01U\x07E2U+sip\x1b!^.*$!sip:info@example.com!\x00"),
+			want: &NAPTR{Order: 1, Preference: 2, Flags: "U", Service: "E2U+sip", Regexp: "!^.*$!sip:info@example.com!", Replacement: "."},
+		},
+		{data: []byte("\x00\x01\x00")},                         // short header
+		{data: []byte("\x00\x01\x00\x02\x05S")},                // short flags
+		{data: []byte("\x00\x01\x00\x02\x00\x00\x00\x03com")},  // unterminated replacement
+		{data: []byte("\x00\x01\x00\x02\x00\x00\x00\xc0\x0c")}, // compressed replacement
+		{data: []byte("\x00\x01\x00\x02\x00\x00\x00\x00\x00")}, // trailing data
+	} {
+		got, ok := parseNAPTR(tt.data)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseNAPTR(%q) = %+v, %v; want %+v", tt.data, got, ok, tt.want)
+		}
+	}
+}
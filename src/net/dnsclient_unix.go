@@ -19,9 +19,11 @@ import (
 	"errors"
 	"internal/itoa"
 	"io"
+	"net/netip"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/dns/dnsmessage"
@@ -43,7 +45,6 @@ var (
 	errCannotMarshalDNSMessage   = errors.New("cannot marshal DNS message")
 	errServerMisbehaving         = errors.New("server misbehaving")
 	errInvalidDNSResponse        = errors.New("invalid DNS response")
-	errNoAnswerFromDNSServer     = errors.New("no answer from DNS server")
 
 	// errServerTemporarilyMisbehaving is like errServerMisbehaving, except
 	// that when it gets translated to a DNSError, the IsTemporary field
@@ -51,7 +52,30 @@ var (
 	errServerTemporarilyMisbehaving = errors.New("server misbehaving")
 )
 
-func newRequest(q dnsmessage.Question, ad bool) (id uint16, udpReq, tcpReq []byte, err error) {
+// ednsPayloadSize returns the UDP payload size to advertise in queries.
+func (r *Resolver) ednsPayloadSize() uint16 {
+	switch {
+	case r == nil || r.EDNSPayloadSize == 0:
+		return maxDNSPacketSize
+	case r.EDNSPayloadSize < 512:
+		return 512
+	}
+	return r.EDNSPayloadSize
+}
+
+// ednsOptions returns the EDNS0 options to add to queries.
+func (r *Resolver) ednsOptions() []dnsmessage.Option {
+	if r == nil || len(r.EDNSOptions) == 0 {
+		return nil
+	}
+	opts := make([]dnsmessage.Option, len(r.EDNSOptions))
+	for i, o := range r.EDNSOptions {
+		opts[i] = dnsmessage.Option{Code: o.Code, Data: o.Data}
+	}
+	return opts
+}
+
+func newRequest(q dnsmessage.Question, ad bool, payloadSize uint16, opts []dnsmessage.Option) (id uint16, udpReq, tcpReq []byte, err error) {
 	id = uint16(randInt())
 	b := dnsmessage.NewBuilder(make([]byte, 2, 514), dnsmessage.Header{ID: id, RecursionDesired: true, AuthenticData: ad})
 	if err := b.StartQuestions(); err != nil {
@@ -61,15 +85,15 @@ func newRequest(q dnsmessage.Question, ad bool) (id uint16, udpReq, tcpReq []byt
 		return 0, nil, nil, err
 	}
 
-	// Accept packets up to maxDNSPacketSize.  RFC 6891.
+	// Accept packets up to payloadSize.  RFC 6891.
 	if err := b.StartAdditionals(); err != nil {
 		return 0, nil, nil, err
 	}
 	var rh dnsmessage.ResourceHeader
-	if err := rh.SetEDNS0(maxDNSPacketSize, dnsmessage.RCodeSuccess, false); err != nil {
+	if err := rh.SetEDNS0(int(payloadSize), dnsmessage.RCodeSuccess, false); err != nil {
 		return 0, nil, nil, err
 	}
-	if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+	if err := b.OPTResource(rh, dnsmessage.OPTResource{Options: opts}); err != nil {
 		return 0, nil, nil, err
 	}
 
@@ -97,16 +121,16 @@ func checkResponse(reqID uint16, reqQues dnsmessage.Question, respHdr dnsmessage
 	return true
 }
 
-func dnsPacketRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte) (dnsmessage.Parser, dnsmessage.Header, error) {
+func dnsPacketRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte, maxSize int) (dnsmessage.Parser, dnsmessage.Header, []byte, error) {
 	if _, err := c.Write(b); err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, err
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
 	}
 
-	b = make([]byte, maxDNSPacketSize)
+	b = make([]byte, maxSize)
 	for {
 		n, err := c.Read(b)
 		if err != nil {
-			return dnsmessage.Parser{}, dnsmessage.Header{}, err
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
 		}
 		var p dnsmessage.Parser
 		// Ignore invalid responses as they may be malicious
@@ -120,86 +144,260 @@ func dnsPacketRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte)
 		if err != nil || !checkResponse(id, query, h, q) {
 			continue
 		}
-		return p, h, nil
+		return p, h, b[:n], nil
 	}
 }
 
-func dnsStreamRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte) (dnsmessage.Parser, dnsmessage.Header, error) {
+func dnsStreamRoundTrip(c Conn, id uint16, query dnsmessage.Question, b []byte) (dnsmessage.Parser, dnsmessage.Header, []byte, error) {
 	if _, err := c.Write(b); err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, err
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
 	}
 
-	b = make([]byte, 1280) // 1280 is a reasonable initial size for IP over Ethernet, see RFC 4035
-	if _, err := io.ReadFull(c, b[:2]); err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, err
-	}
-	l := int(b[0])<<8 | int(b[1])
-	if l > len(b) {
-		b = make([]byte, l)
-	}
-	n, err := io.ReadFull(c, b[:l])
+	b, err := readStreamMessage(c)
 	if err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, err
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
 	}
 	var p dnsmessage.Parser
-	h, err := p.Start(b[:n])
+	h, err := p.Start(b)
 	if err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, errCannotUnmarshalDNSMessage
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, errCannotUnmarshalDNSMessage
 	}
 	q, err := p.Question()
 	if err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, errCannotUnmarshalDNSMessage
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, errCannotUnmarshalDNSMessage
 	}
 	if !checkResponse(id, query, h, q) {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, errInvalidDNSResponse
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, errInvalidDNSResponse
+	}
+	return p, h, b, nil
+}
+
+// readStreamMessage reads one length-prefixed DNS message from c.
+func readStreamMessage(c Conn) ([]byte, error) {
+	b := make([]byte, 1280) // 1280 is a reasonable initial size for IP over Ethernet, see RFC 4035
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return nil, err
+	}
+	l := int(b[0])<<8 | int(b[1])
+	if l > len(b) {
+		b = make([]byte, l)
 	}
-	return p, h, nil
+	n, err := io.ReadFull(c, b[:l])
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
 }
 
 // exchange sends a query on the connection and hopes for a response.
-func (r *Resolver) exchange(ctx context.Context, server string, q dnsmessage.Question, timeout time.Duration, useTCP, ad bool) (dnsmessage.Parser, dnsmessage.Header, error) {
+// It also returns the transport, "udp" or "tcp", of the last attempt.
+func (r *Resolver) exchange(ctx context.Context, server string, q dnsmessage.Question, timeout time.Duration, useTCP, ad bool) (dnsmessage.Parser, dnsmessage.Header, string, error) {
 	q.Class = dnsmessage.ClassINET
-	id, udpReq, tcpReq, err := newRequest(q, ad)
+	p, h, network, badCookie, err := r.exchangeOnce(ctx, server, q, timeout, useTCP, ad)
+	if badCookie {
+		// The server rejected our cookie, but sent a fresh one
+		// along with BADCOOKIE. Retry once with it.
+		// See RFC 7873, section 5.3.
+		p, h, network, _, err = r.exchangeOnce(ctx, server, q, timeout, useTCP, ad)
+	}
+	return p, h, network, err
+}
+
+// exchangeOnce implements exchange. It reports whether the response
+// was BADCOOKIE when using DNS cookies.
+func (r *Resolver) exchangeOnce(ctx context.Context, server string, q dnsmessage.Question, timeout time.Duration, useTCP, ad bool) (dnsmessage.Parser, dnsmessage.Header, string, bool, error) {
+	payloadSize := r.ednsPayloadSize()
+	opts := r.ednsOptions()
+	cookies := r != nil && r.DNSCookies
+	if cookies {
+		opts = append(opts, r.cookieOption(server))
+	}
+	id, udpReq, tcpReq, err := newRequest(q, ad, payloadSize, opts)
 	if err != nil {
-		return dnsmessage.Parser{}, dnsmessage.Header{}, errCannotMarshalDNSMessage
+		return dnsmessage.Parser{}, dnsmessage.Header{}, "", false, errCannotMarshalDNSMessage
 	}
+	req := &dnsRequest{id: id, q: q, udp: udpReq, tcp: tcpReq, maxSize: int(payloadSize), cookies: cookies}
+	p, h, _, badCookie, err := r.roundTrip(ctx, server, req, timeout, useTCP)
+	return p, h, req.network, badCookie, err
+}
+
+// A dnsRequest is a packed DNS query, ready to be sent by roundTrip.
+type dnsRequest struct {
+	id      uint16
+	q       dnsmessage.Question
+	udp     []byte // query for UDP
+	tcp     []byte // query for TCP, with its length prefix
+	maxSize int    // largest UDP response accepted
+	cookies bool   // check the DNS cookie of the response
+
+	network string // transport of the last attempt, set by roundTrip
+}
+
+// roundTrip sends req to server, over UDP first unless useTCP is set,
+// and over TCP if the UDP response is truncated. It returns the response
+// both packed and parsed up to the answer section, and whether it was
+// BADCOOKIE when checking DNS cookies.
+func (r *Resolver) roundTrip(ctx context.Context, server string, req *dnsRequest, timeout time.Duration, useTCP bool) (dnsmessage.Parser, dnsmessage.Header, []byte, bool, error) {
 	var networks []string
 	if useTCP {
 		networks = []string{"tcp"}
 	} else {
 		networks = []string{"udp", "tcp"}
 	}
+	trace := ContextDNSTrace(ctx)
+	dialTimeout := r.dialTimeout(ctx)
 	for _, network := range networks {
 		ctx, cancel := context.WithDeadline(ctx, time.Now().Add(timeout))
 		defer cancel()
 
-		c, err := r.dial(ctx, network, server)
+		release, err := r.acquireQuerySlot(ctx)
 		if err != nil {
-			return dnsmessage.Parser{}, dnsmessage.Header{}, err
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, mapErr(err)
 		}
-		if d, ok := ctx.Deadline(); ok && !d.IsZero() {
-			c.SetDeadline(d)
+
+		req.network = network
+		var info DNSQueryStartInfo
+		start := time.Now()
+		if trace != nil {
+			info = DNSQueryStartInfo{Name: req.q.Name.String(), Type: uint16(req.q.Type), Server: server, Network: network}
+			trace.queryStart(info)
 		}
 		var p dnsmessage.Parser
 		var h dnsmessage.Header
-		if _, ok := c.(PacketConn); ok {
-			p, h, err = dnsPacketRoundTrip(c, id, q, udpReq)
+		var msg []byte
+		if network == "udp" && r.poolUDP() && !isUnixSocketServer(server) {
+			p, h, msg, err = r.pooledUDPRoundTrip(ctx, server, req)
 		} else {
-			p, h, err = dnsStreamRoundTrip(c, id, q, tcpReq)
+			var c Conn
+			if dialTimeout > 0 && dialTimeout < timeout {
+				dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+				c, err = r.dial(dialCtx, network, server)
+				cancel()
+			} else {
+				c, err = r.dial(ctx, network, server)
+			}
+			if err != nil {
+				release()
+				trace.queryDone(DNSQueryDoneInfo{Name: info.Name, Type: info.Type, Server: server, Network: network, Duration: time.Since(start), Err: err})
+				return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, err
+			}
+			dnsStats.queries.Add(1)
+			if d, ok := ctx.Deadline(); ok && !d.IsZero() {
+				c.SetDeadline(d)
+			}
+			if isPacketConn(c) {
+				p, h, msg, err = dnsPacketRoundTrip(c, req.id, req.q, req.udp, req.maxSize)
+			} else {
+				p, h, msg, err = dnsStreamRoundTrip(c, req.id, req.q, req.tcp)
+			}
+			c.Close()
 		}
-		c.Close()
+		release()
 		if err != nil {
-			return dnsmessage.Parser{}, dnsmessage.Header{}, mapErr(err)
+			err = mapErr(err)
+			trace.queryDone(DNSQueryDoneInfo{Name: info.Name, Type: info.Type, Server: server, Network: network, Duration: time.Since(start), Err: err})
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, err
 		}
+		trace.queryDone(DNSQueryDoneInfo{Name: info.Name, Type: info.Type, Server: server, Network: network, RCode: int(h.RCode), Truncated: h.Truncated, Duration: time.Since(start)})
 		if err := p.SkipQuestion(); err != dnsmessage.ErrSectionDone {
-			return dnsmessage.Parser{}, dnsmessage.Header{}, errInvalidDNSResponse
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, errInvalidDNSResponse
+		}
+		if req.cookies {
+			ok, badCookie := r.checkCookie(server, p, h)
+			if !ok {
+				// The response does not echo our client
+				// cookie, so it may be forged.
+				return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, errInvalidDNSResponse
+			}
+			if badCookie {
+				return p, h, msg, true, nil
+			}
 		}
 		if h.Truncated { // see RFC 5966
+			if network == "udp" {
+				dnsStats.tcpFallbacks.Add(1)
+				trace.tcpFallback(info.Name, server)
+			}
 			continue
 		}
-		return p, h, nil
+		return p, h, msg, false, nil
+	}
+	// Even the TCP response was truncated.
+	return dnsmessage.Parser{}, dnsmessage.Header{}, nil, false, ErrTruncated
+}
+
+// isPacketConn reports whether queries are sent on c as datagrams
+// rather than over a stream. Connections to Unix sockets, which may be
+// either, are PacketConns regardless.
+func isPacketConn(c Conn) bool {
+	if _, ok := c.(PacketConn); !ok {
+		return false
+	}
+	if uc, ok := c.(*UnixConn); ok {
+		a, _ := uc.RemoteAddr().(*UnixAddr)
+		return a != nil && a.Net == "unixgram"
+	}
+	return true
+}
+
+// pooledUDPRoundTrip is like dnsPacketRoundTrip, but sends req on
+// one of the UDP sockets to server that r shares among its queries.
+func (r *Resolver) pooledUDPRoundTrip(ctx context.Context, server string, req *dnsRequest) (dnsmessage.Parser, dnsmessage.Header, []byte, error) {
+	pool := r.getUDPPool()
+	var uc *dnsUDPConn
+	var ch chan []byte
+	for {
+		var err error
+		uc, err = pool.get(ctx, r, server)
+		if err != nil {
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
+		}
+		id := req.id
+		var ok bool
+		if ch, ok = uc.register(&id); ok {
+			if id != req.id {
+				req.setID(id)
+			}
+			break
+		}
+		// The socket was closed after being idle; get another.
+	}
+	defer uc.unregister(req.id)
+
+	dnsStats.queries.Add(1)
+	if _, err := uc.c.Write(req.udp); err != nil {
+		return dnsmessage.Parser{}, dnsmessage.Header{}, nil, err
+	}
+	for {
+		select {
+		case b := <-ch:
+			if len(b) > req.maxSize {
+				b = b[:req.maxSize]
+			}
+			// As in dnsPacketRoundTrip, ignore invalid responses.
+			var p dnsmessage.Parser
+			h, err := p.Start(b)
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil || !checkResponse(req.id, req.q, h, q) {
+				continue
+			}
+			return p, h, b, nil
+		case <-uc.done:
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, uc.readErr()
+		case <-ctx.Done():
+			return dnsmessage.Parser{}, dnsmessage.Header{}, nil, ctx.Err()
+		}
 	}
-	return dnsmessage.Parser{}, dnsmessage.Header{}, errNoAnswerFromDNSServer
+}
+
+// setID changes the ID of req to id.
+func (req *dnsRequest) setID(id uint16) {
+	req.id = id
+	req.udp[0], req.udp[1] = byte(id>>8), byte(id)
+	req.tcp[2], req.tcp[3] = byte(id>>8), byte(id)
 }
 
 // checkHeader performs basic sanity checks on the header.
@@ -252,12 +450,147 @@ func skipToAnswer(p *dnsmessage.Parser, qtype dnsmessage.Type) error {
 	}
 }
 
+// queryLimits returns the timeout and number of attempts of queries
+// made with ctx, as set by WithLookupOptions or else by c.
+func (c *dnsConfig) queryLimits(ctx context.Context) (timeout time.Duration, attempts int) {
+	timeout, attempts = c.timeout, c.attempts
+	if opts := lookupOptions(ctx); opts != nil {
+		if opts.Timeout > 0 {
+			timeout = opts.Timeout
+		}
+		if opts.Attempts > 0 {
+			attempts = opts.Attempts
+		}
+	}
+	return timeout, attempts
+}
+
+// exchangeError returns the DNSError reported when exchanging a query
+// for name with server failed with err.
+func exchangeError(err error, name, server string) *DNSError {
+	dnsErr := &DNSError{
+		Err:       err.Error(),
+		Name:      name,
+		Server:    server,
+		UnwrapErr: err,
+	}
+	if nerr, ok := err.(Error); ok && nerr.Timeout() {
+		dnsErr.IsTimeout = true
+	}
+	// Set IsTemporary for socket-level errors. Note that this flag
+	// may also be used to indicate a SERVFAIL response.
+	if _, ok := err.(*OpError); ok {
+		dnsErr.IsTemporary = true
+	}
+	return dnsErr
+}
+
+// setQuery records in e the question q, the transport it was last
+// sent over and the response code of h, the header of the response
+// if one was received.
+func (e *DNSError) setQuery(q dnsmessage.Question, network string, h dnsmessage.Header) {
+	e.Type = uint16(q.Type)
+	e.Class = uint16(q.Class)
+	e.Network = network
+	e.RCode = int(h.RCode)
+}
+
+// exchangeRaw implements Resolver.Exchange.
+func (r *Resolver) exchangeRaw(ctx context.Context, msg []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, &DNSError{Err: errCannotUnmarshalDNSMessage.Error()}
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, &DNSError{Err: "query must have exactly one question"}
+	}
+	if _, err := p.Question(); err != dnsmessage.ErrSectionDone {
+		return nil, &DNSError{Err: "query must have exactly one question", Name: q.Name.String()}
+	}
+	if err := reservedNameError(q.Name.String()); err != nil {
+		return nil, err
+	}
+
+	// Accept responses as large as the query advertises.
+	maxSize := maxDNSPacketSize
+	if p.SkipAllAnswers() == nil && p.SkipAllAuthorities() == nil {
+		for {
+			rh, err := p.AdditionalHeader()
+			if err != nil {
+				break
+			}
+			if rh.Type == dnsmessage.TypeOPT && int(rh.Class) > maxSize {
+				maxSize = int(rh.Class)
+			}
+			if err := p.SkipAdditional(); err != nil {
+				break
+			}
+		}
+	}
+
+	// Send the query under a fresh random ID, and give the response
+	// the caller's ID back.
+	id := uint16(randInt())
+	tcpReq := make([]byte, 2+len(msg))
+	tcpReq[0], tcpReq[1] = byte(len(msg)>>8), byte(len(msg))
+	copy(tcpReq[2:], msg)
+	tcpReq[2], tcpReq[3] = byte(id>>8), byte(id)
+	req := &dnsRequest{id: id, q: q, udp: tcpReq[2:], tcp: tcpReq, maxSize: maxSize}
+
+	cfg := r.dnsConfig()
+	timeout, attempts := cfg.queryLimits(ctx)
+	serverOffset := cfg.serverOffset()
+	servers := cfg.serversFor(q.Name.String())
+	sLen := uint32(len(servers))
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		for j := uint32(0); j < sLen; j++ {
+			server := servers[(serverOffset+j)%sLen]
+			_, _, resp, _, err := r.roundTrip(ctx, server, req, timeout, cfg.useTCP)
+			if err != nil {
+				lastErr = exchangeError(err, q.Name.String(), server)
+				continue
+			}
+			resp[0], resp[1] = byte(h.ID>>8), byte(h.ID)
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// unforwardedName reports whether the rooted name is one of the
+// special-use names of RFC 6761 that are answered as nonexistent
+// without a query: those under invalid, and, if r.LocalTestNames is
+// set, those under test and example unless their queries were
+// explicitly directed somewhere: by the Dial, Servers or ConfigPath of
+// r, or by a route of cfg for their domain.
+func (r *Resolver) unforwardedName(cfg *dnsConfig, name string) bool {
+	if isInvalidName(name) {
+		return true
+	}
+	if r == nil || !r.LocalTestNames || !isTestingName(name) || r.Dial != nil || len(r.Servers) > 0 || r.configPath() != "" {
+		return false
+	}
+	return cfg.routeIndex.lookup(name) < 0
+}
+
 // Do a lookup for a single name, which must be rooted
 // (otherwise answer will not find the answers).
 func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
+	if r.qnameMinimization() {
+		return r.tryMinimized(ctx, cfg, name, qtype)
+	}
+	return r.tryServers(ctx, cfg, cfg.serversFor(name), name, qtype)
+}
+
+// tryServers does a lookup for a single name, which must be rooted,
+// with servers, in the order and with the limits of cfg.
+func (r *Resolver) tryServers(ctx context.Context, cfg *dnsConfig, servers []string, name string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
 	var lastErr error
 	serverOffset := cfg.serverOffset()
-	sLen := uint32(len(cfg.servers))
+	sLen := uint32(len(servers))
 
 	n, err := dnsmessage.NewName(name)
 	if err != nil {
@@ -269,35 +602,55 @@ func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string,
 		Class: dnsmessage.ClassINET,
 	}
 
-	for i := 0; i < cfg.attempts; i++ {
+	if r.unforwardedName(cfg, name) {
+		dnsErr := &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+		dnsErr.setQuery(q, "", dnsmessage.Header{})
+		return dnsmessage.Parser{}, "", dnsErr
+	}
+
+	timeout, attempts := cfg.queryLimits(ctx)
+	debug := systemConf().dnsDebugLevel > 1
+	trace := ContextDNSTrace(ctx)
+	for i := 0; i < attempts; i++ {
 		for j := uint32(0); j < sLen; j++ {
-			server := cfg.servers[(serverOffset+j)%sLen]
+			server := servers[(serverOffset+j)%sLen]
+			if i > 0 || j > 0 {
+				if r != nil && r.Backoff != nil {
+					delay, ok := r.Backoff(server, i)
+					if !ok {
+						continue
+					}
+					if err := sleepContext(ctx, delay); err != nil {
+						dnsErr := exchangeError(err, name, server)
+						dnsErr.setQuery(q, "", dnsmessage.Header{})
+						return dnsmessage.Parser{}, "", dnsErr
+					}
+				}
+				dnsStats.retries.Add(1)
+				trace.retry(DNSQueryStartInfo{Name: name, Type: uint16(qtype), Server: server}, lastErr)
+			}
 
-			p, h, err := r.exchange(ctx, server, q, cfg.timeout, cfg.useTCP, cfg.trustAD)
+			p, h, network, err := r.exchange(ctx, server, q, timeout, cfg.useTCP, cfg.trustAD)
+			if debug {
+				debugLogQuery(name, qtype, server, h, err)
+			}
 			if err != nil {
-				dnsErr := &DNSError{
-					Err:    err.Error(),
-					Name:   name,
-					Server: server,
-				}
-				if nerr, ok := err.(Error); ok && nerr.Timeout() {
-					dnsErr.IsTimeout = true
-				}
-				// Set IsTemporary for socket-level errors. Note that this flag
-				// may also be used to indicate a SERVFAIL response.
-				if _, ok := err.(*OpError); ok {
-					dnsErr.IsTemporary = true
-				}
+				countServerQuery(server, true)
+				dnsErr := exchangeError(err, name, server)
+				dnsErr.setQuery(q, network, dnsmessage.Header{})
 				lastErr = dnsErr
 				continue
 			}
 
-			if err := checkHeader(&p, h); err != nil {
+			err = checkHeader(&p, h)
+			countServerQuery(server, err != nil && err != errNoSuchHost)
+			if err != nil {
 				dnsErr := &DNSError{
 					Err:    err.Error(),
 					Name:   name,
 					Server: server,
 				}
+				dnsErr.setQuery(q, network, h)
 				if err == errServerTemporarilyMisbehaving {
 					dnsErr.IsTemporary = true
 				}
@@ -316,16 +669,18 @@ func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string,
 			if err == nil {
 				return p, server, nil
 			}
-			lastErr = &DNSError{
+			dnsErr := &DNSError{
 				Err:    err.Error(),
 				Name:   name,
 				Server: server,
 			}
+			dnsErr.setQuery(q, network, h)
+			lastErr = dnsErr
 			if err == errNoSuchHost {
 				// The name does not exist, so trying another
 				// server won't help.
 
-				lastErr.(*DNSError).IsNotFound = true
+				dnsErr.IsNotFound = true
 				return p, server, lastErr
 			}
 		}
@@ -333,30 +688,138 @@ func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string,
 	return dnsmessage.Parser{}, "", lastErr
 }
 
+// sleepContext waits for d to elapse, or for ctx to be done, in which
+// case it returns the error of ctx, mapped by mapErr.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return mapErr(ctx.Err())
+	}
+}
+
+// debugLogQuery reports the outcome of a single DNS exchange.
+// It is used at netdns debug level 2 and above.
+func debugLogQuery(name string, qtype dnsmessage.Type, server string, h dnsmessage.Header, err error) {
+	if err != nil {
+		dnsDebugLog("dns query", "name", name, "type", qtype.String(), "server", server, "err", err.Error())
+		return
+	}
+	dnsDebugLog("dns query", "name", name, "type", qtype.String(), "server", server, "rcode", h.RCode.String())
+}
+
 // A resolverConfig represents a DNS stub resolver configuration.
 type resolverConfig struct {
 	initOnce sync.Once // guards init of resolverConfig
 
 	// ch is used as a semaphore that only allows one lookup at a
 	// time to recheck resolv.conf.
-	ch          chan struct{} // guards lastChecked and modTime
+	ch          chan struct{} // guards lastChecked, modTime, path, the file identity and the watch fields
 	lastChecked time.Time     // last time resolv.conf was checked
+	path        string        // file dnsConfig was read from
+
+	// target and file identify the file at path when it was read:
+	// the target of path if it is a symbolic link, and the file it
+	// leads to. NetworkManager and systemd-resolved point the link
+	// at another file, which may be no newer than the one it
+	// replaces, so the mtime alone does not tell.
+	target string
+	file   os.FileInfo
+
+	// changed is set by the file watcher, if any, when the file
+	// at watchPath may have changed. It makes the next tryUpdate
+	// reread the file without waiting for the polling interval.
+	changed   atomic.Bool
+	flushed   atomic.Bool // set by flush; overrides the no-reload option
+	watchPath string      // file being watched
+	stopWatch func()      // stops the watch on watchPath; nil if none
 
 	mu        sync.RWMutex // protects dnsConfig
 	dnsConfig *dnsConfig   // parsed resolv.conf structure used in lookups
+
+	used time.Time // last time resolverConfigFor returned conf; guarded by resolvConfs
 }
 
 var resolvConf resolverConfig
 
+// resolvConfIdle is how long the configuration of a ConfigPath may go
+// unused before resolverConfigFor drops it and stops its watch.
+const resolvConfIdle = 10 * time.Minute
+
+// resolvConfs holds the configurations of Resolvers that set
+// ConfigPath, keyed by path.
+var resolvConfs struct {
+	sync.Mutex
+	m     map[string]*resolverConfig
+	swept time.Time // last time idle configurations were dropped
+}
+
+// resolverConfigFor returns the resolverConfig for the named file,
+// creating it on first use. Configurations unused for resolvConfIdle
+// are dropped along the way, so that programs making Resolvers for
+// many short-lived files do not keep them all.
+func resolverConfigFor(name string) *resolverConfig {
+	resolvConfs.Lock()
+	defer resolvConfs.Unlock()
+	now := clockNow()
+	if now.Sub(resolvConfs.swept) >= resolvConfIdle {
+		resolvConfs.swept = now
+		for path, conf := range resolvConfs.m {
+			if path != name && now.Sub(conf.used) >= resolvConfIdle && conf.release() {
+				delete(resolvConfs.m, path)
+			}
+		}
+	}
+	conf := resolvConfs.m[name]
+	if conf == nil {
+		if resolvConfs.m == nil {
+			resolvConfs.m = make(map[string]*resolverConfig)
+		}
+		conf = &resolverConfig{path: name}
+		resolvConfs.m[name] = conf
+	}
+	conf.used = now
+	return conf
+}
+
+// release stops the watch of conf, which is about to be dropped from
+// resolvConfs. It reports false, leaving conf alone, if an update of
+// conf is in progress. A lookup still holding conf afterwards polls
+// the file.
+func (conf *resolverConfig) release() bool {
+	conf.initOnce.Do(conf.init)
+	if !conf.tryAcquireSema() {
+		return false
+	}
+	defer conf.releaseSema()
+	if conf.stopWatch != nil {
+		conf.stopWatch()
+		conf.stopWatch = nil
+	}
+	return true
+}
+
 // init initializes conf and is only called via conf.initOnce.
 func (conf *resolverConfig) init() {
 	// Set dnsConfig and lastChecked so we don't parse
 	// resolv.conf twice the first time.
-	conf.dnsConfig = systemConf().resolv
+	if conf.path == "" {
+		// The process-wide configuration, which systemConf
+		// has already read.
+		conf.path = resolvConfPath()
+		conf.dnsConfig = systemConf().resolv
+	}
+	conf.target, conf.file = fileIdentity(conf.path)
 	if conf.dnsConfig == nil {
-		conf.dnsConfig = dnsReadConfig("/etc/resolv.conf")
+		conf.dnsConfig = dnsReadConfig(conf.path)
 	}
-	conf.lastChecked = time.Now()
+	conf.lastChecked = clockNow()
 
 	// Prepare ch so that only one update of resolverConfig may
 	// run at once.
@@ -364,48 +827,91 @@ func (conf *resolverConfig) init() {
 }
 
 // tryUpdate tries to update conf with the named resolv.conf file.
-// The name variable only exists for testing. It is otherwise always
-// "/etc/resolv.conf".
+// The name is normally the result of resolvConfPath. A name different
+// from the one conf was last read from is loaded right away.
 func (conf *resolverConfig) tryUpdate(name string) {
 	conf.initOnce.Do(conf.init)
 
-	if conf.dnsConfig.noReload {
-		return
-	}
-
 	// Ensure only one update at a time checks resolv.conf.
 	if !conf.tryAcquireSema() {
 		return
 	}
 	defer conf.releaseSema()
 
-	now := time.Now()
-	if conf.lastChecked.After(now.Add(-5 * time.Second)) {
+	samePath := name == conf.path
+	flushed := conf.flushed.Swap(false)
+	if samePath && conf.dnsConfig.noReload && !flushed {
+		return
+	}
+	if name != conf.watchPath {
+		conf.watch(name)
+	}
+
+	// A change reported by the watcher is picked up right away;
+	// otherwise fall back to polling the file every few seconds.
+	changed := conf.changed.Swap(false)
+	now := clockNow()
+	if samePath && !changed && conf.lastChecked.After(now.Add(-5*time.Second)) {
 		return
 	}
 	conf.lastChecked = now
 
-	switch runtime.GOOS {
-	case "windows":
+	switch {
+	case runtime.GOOS == "windows":
 		// There's no file on disk, so don't bother checking
 		// and failing.
 		//
 		// The Windows implementation of dnsReadConfig (called
 		// below) ignores the name.
+	case (runtime.GOOS == "darwin" || runtime.GOOS == "android" || runtime.GOOS == "plan9") && name == defaultResolvConfPath:
+		// The system configuration read along with the file
+		// changes without touching it, so read it again.
 	default:
+		target, file := fileIdentity(name)
 		var mtime time.Time
-		if fi, err := os.Stat(name); err == nil {
-			mtime = fi.ModTime()
+		if file != nil {
+			mtime = file.ModTime()
 		}
-		if mtime.Equal(conf.dnsConfig.mtime) {
+		if samePath && !changed && mtime.Equal(conf.dnsConfig.mtime) && target == conf.target && sameFile(file, conf.file) {
 			return
 		}
+		conf.target, conf.file = target, file
 	}
 
 	dnsConf := dnsReadConfig(name)
 	conf.mu.Lock()
 	conf.dnsConfig = dnsConf
 	conf.mu.Unlock()
+	conf.path = name
+}
+
+// flush makes the next tryUpdate read the file again, even if it was
+// read moments ago or has the no-reload option.
+func (conf *resolverConfig) flush() {
+	conf.flushed.Store(true)
+	conf.changed.Store(true)
+}
+
+// fileIdentity returns the target of the symbolic link name, or "" if
+// name is not one, and the information of the file it leads to, or nil
+// if there is none.
+func fileIdentity(name string) (target string, file os.FileInfo) {
+	target, _ = os.Readlink(name)
+	file, _ = os.Stat(name)
+	return target, file
+}
+
+// watch replaces any existing watch with one on the named file.
+// It must be called with the semaphore held.
+func (conf *resolverConfig) watch(name string) {
+	if conf.stopWatch != nil {
+		conf.stopWatch()
+		conf.stopWatch = nil
+	}
+	conf.watchPath = name
+	if stop, ok := watchFile(name, func() { conf.changed.Store(true) }); ok {
+		conf.stopWatch = stop
+	}
 }
 
 func (conf *resolverConfig) tryAcquireSema() bool {
@@ -421,8 +927,100 @@ func (conf *resolverConfig) releaseSema() {
 	<-conf.ch
 }
 
+// dnsConfig returns the DNS configuration used by r, first checking
+// whether its resolv.conf file needs to be reread. The configuration
+// set by SetDNSConfig, if any, takes the place of the process-wide
+// resolv.conf file.
+func (r *Resolver) dnsConfig() *dnsConfig {
+	rc, name := &resolvConf, resolvConfPath()
+	if path := r.configPath(); path != "" {
+		rc, name = resolverConfigFor(path), path
+	} else if override := dnsConfigOverride.Load(); override != nil {
+		return r.withOverrides(override)
+	}
+	rc.tryUpdate(name)
+	rc.mu.RLock()
+	conf := rc.dnsConfig
+	rc.mu.RUnlock()
+	return r.withOverrides(conf)
+}
+
+// withOverrides returns conf, or a copy of it if r has settings,
+// such as Servers, Search, Ndots or NoSearch, that take precedence
+// over the configuration.
+func (r *Resolver) withOverrides(conf *dnsConfig) *dnsConfig {
+	if r == nil || len(r.Servers) == 0 && len(r.Search) == 0 && r.Ndots == 0 && !r.NoSearch {
+		return conf
+	}
+	if o := r.overridden.Load(); o != nil && o.base == conf && equalSlice(o.servers, r.Servers) && equalSlice(o.search, r.Search) && o.ndots == r.Ndots && o.noSearch == r.NoSearch {
+		return o.conf
+	}
+	c := conf.clone()
+	if len(r.Servers) > 0 {
+		c.setRoutes(nil)
+		c.servers = make([]string, 0, len(r.Servers))
+		for _, s := range r.Servers {
+			port := s.Port()
+			if port == 0 {
+				port = 53
+			}
+			c.servers = append(c.servers, JoinHostPort(s.Addr().String(), itoa.Uitoa(uint(port))))
+		}
+	}
+	if len(r.Search) > 0 {
+		c.search = make([]string, 0, len(r.Search))
+		for _, s := range r.Search {
+			if s = ensureRooted(s); s != "." {
+				c.search = append(c.search, s)
+			}
+		}
+	}
+	switch {
+	case r.Ndots < 0:
+		c.ndots = 0
+	case r.Ndots > 15:
+		c.ndots = 15
+	case r.Ndots > 0:
+		c.ndots = r.Ndots
+	}
+	if r.NoSearch {
+		c.search = nil
+		c.ndots = 0
+	}
+	r.overridden.Store(&overriddenDNSConfig{
+		base:     conf,
+		servers:  append([]netip.AddrPort(nil), r.Servers...),
+		search:   append([]string(nil), r.Search...),
+		ndots:    r.Ndots,
+		noSearch: r.NoSearch,
+		conf:     c,
+	})
+	return c
+}
+
+// equalSlice reports whether a and b hold the same elements. The
+// cached settings are compared by value, so that changing an element
+// of Servers or Search in place is not missed.
+func equalSlice[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// systemDNSConfig returns the process-wide DNS configuration for
+// ResolverConfig.
+func systemDNSConfig() *DNSConfig {
+	return (*Resolver)(nil).dnsConfig().export()
+}
+
 func (r *Resolver) lookup(ctx context.Context, name string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
-	if !isDomainName(name) {
+	if !r.validName(name) {
 		// We used to use "invalid domain name" as the error,
 		// but that is a detail of the specific lookup mechanism.
 		// Other lookups might allow broader name syntax
@@ -430,17 +1028,23 @@ func (r *Resolver) lookup(ctx context.Context, name string, qtype dnsmessage.Typ
 		// For consistency with libc resolvers, report no such host.
 		return dnsmessage.Parser{}, "", &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
 	}
-	resolvConf.tryUpdate("/etc/resolv.conf")
-	resolvConf.mu.RLock()
-	conf := resolvConf.dnsConfig
-	resolvConf.mu.RUnlock()
+	conf := r.dnsConfig()
 	var (
 		p      dnsmessage.Parser
 		server string
 		err    error
 	)
-	for _, fqdn := range conf.nameList(name) {
-		p, server, err = r.tryOneName(ctx, conf, fqdn, qtype)
+	names := conf.nameList(name)
+	tryOneName := func(fqdn string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
+		return r.tryOneName(ctx, conf, fqdn, qtype)
+	}
+	if r != nil && r.ParallelSearch && len(names) > 1 {
+		var cancel context.CancelFunc
+		tryOneName, cancel = r.tryNamesInParallel(ctx, conf, names, []dnsmessage.Type{qtype})
+		defer cancel()
+	}
+	for _, fqdn := range names {
+		p, server, err = tryOneName(fqdn, qtype)
 		if err == nil {
 			break
 		}
@@ -462,6 +1066,64 @@ func (r *Resolver) lookup(ctx context.Context, name string, qtype dnsmessage.Typ
 	return dnsmessage.Parser{}, "", err
 }
 
+// tryNamesInParallel starts queries of every type in qtypes for every
+// name in names at once, as requested by Resolver.ParallelSearch.
+// The returned function waits for and returns the result of one of
+// those queries, as tryOneName would have; the returned cancel function
+// stops the queries whose results are no longer needed.
+func (r *Resolver) tryNamesInParallel(ctx context.Context, cfg *dnsConfig, names []string, qtypes []dnsmessage.Type) (tryOneName func(string, dnsmessage.Type) (dnsmessage.Parser, string, error), cancel context.CancelFunc) {
+	type query struct {
+		name  string
+		qtype dnsmessage.Type
+	}
+	type result struct {
+		p      dnsmessage.Parser
+		server string
+		err    error
+	}
+	ctx, cancel = context.WithCancel(ctx)
+	results := make(map[query]chan result, len(names)*len(qtypes))
+	for _, name := range names {
+		for _, qtype := range qtypes {
+			results[query{name, qtype}] = make(chan result, 1)
+		}
+	}
+	run := func(q query) {
+		p, server, err := r.tryOneName(ctx, cfg, q.name, q.qtype)
+		select {
+		case results[q] <- result{p, server, err}:
+		case <-ctx.Done():
+		}
+	}
+	for _, name := range names {
+		dnsWaitGroup.Add(1)
+		go func(name string) {
+			defer dnsWaitGroup.Done()
+			if cfg.singleRequest {
+				// Keep to one query at a time per name.
+				for _, qtype := range qtypes {
+					run(query{name, qtype})
+				}
+				return
+			}
+			var wg sync.WaitGroup
+			for _, qtype := range qtypes {
+				wg.Add(1)
+				go func(qtype dnsmessage.Type) {
+					defer wg.Done()
+					run(query{name, qtype})
+				}(qtype)
+			}
+			wg.Wait()
+		}(name)
+	}
+	tryOneName = func(name string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
+		res := <-results[query{name, qtype}]
+		return res.p, res.server, res.err
+	}
+	return tryOneName, cancel
+}
+
 // avoidDNS reports whether this is a hostname for which we should not
 // use DNS. Currently this includes only .onion, per RFC 7686. See
 // golang.org/issue/13705. Does not cover .local names (RFC 6762),
@@ -504,11 +1166,19 @@ func (conf *dnsConfig) nameList(name string) []string {
 	if hasNdots {
 		names = append(names, name)
 	}
-	// Try suffixes that are not too long (see isDomainName).
-	for _, suffix := range conf.search {
-		if l+len(suffix) <= 254 {
-			names = append(names, name+suffix)
+	// Try suffixes that are not too long (see isDomainName), each
+	// once even if the search list repeats it.
+search:
+	for i, suffix := range conf.search {
+		if l+len(suffix) > 254 {
+			continue
+		}
+		for _, s := range conf.search[:i] {
+			if s == suffix {
+				continue search
+			}
 		}
+		names = append(names, name+suffix)
 	}
 	// Try unsuffixed, if not tried first above.
 	if !hasNdots {
@@ -565,9 +1235,10 @@ func (r *Resolver) goLookupHostOrder(ctx context.Context, name string, order hos
 		}
 	}
 	ips, _, err := r.goLookupIPCNAMEOrder(ctx, "ip", name, order)
-	if err != nil {
+	if len(ips) == 0 {
 		return
 	}
+	err = nil // a partial error; see Resolver.PartialErrors
 	addrs = make([]string, 0, len(ips))
 	for _, ip := range ips {
 		addrs = append(addrs, ip.String())
@@ -598,6 +1269,70 @@ func (r *Resolver) goLookupIP(ctx context.Context, network, host string) (addrs
 }
 
 func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name string, order hostLookupOrder) (addrs []IPAddr, cname dnsmessage.Name, err error) {
+	return r.goLookupIPCNAMEOrderTTL(ctx, network, name, order, nil)
+}
+
+// goLookupIPTTL is like goLookupIP, but uses the given order and also
+// returns the TTL of the DNS records each address came from.
+func (r *Resolver) goLookupIPTTL(ctx context.Context, network, host string, order hostLookupOrder) ([]AddrTTL, error) {
+	ttls := make(map[netip.Addr]uint32)
+	addrs, _, err := r.goLookupIPCNAMEOrderTTL(ctx, network, host, order, ttls)
+	if len(addrs) == 0 {
+		return nil, err
+	}
+	ret := make([]AddrTTL, 0, len(addrs))
+	for _, addr := range addrs {
+		if a, ok := netip.AddrFromSlice(addr.IP); ok {
+			ret = append(ret, AddrTTL{Addr: a, TTL: time.Duration(ttls[a]) * time.Second})
+		}
+	}
+	return ret, nil
+}
+
+// useNSCD reports whether lookups through r may take the answers of
+// nscd. The daemon answers with the results of the system's own
+// configuration, so not for Resolvers with settings or a Dial function
+// that depart from it, nor in processes that replace resolv.conf with
+// SetDNSConfig or SetResolvConfPath.
+func (r *Resolver) useNSCD() bool {
+	if r != nil && (r.Dial != nil || r.goOnly()) {
+		return false
+	}
+	return dnsConfigOverride.Load() == nil && resolvConfPath() == defaultResolvConfPath
+}
+
+// goLookupIPCNAMEOrderTTL is goLookupIPCNAMEOrder. If ttls is not nil,
+// it also records in ttls the TTL of each address found in DNS.
+func (r *Resolver) goLookupIPCNAMEOrderTTL(ctx context.Context, network, name string, order hostLookupOrder, ttls map[netip.Addr]uint32) (addrs []IPAddr, cname dnsmessage.Name, err error) {
+	if network != "CNAME" && r.useNSCD() {
+		// The name service caching daemon may hold the results
+		// of the sources of nsswitch.conf.
+		if addrs, canonical, ok := nscdLookupHost(ctx, network, name); ok {
+			if len(addrs) == 0 {
+				return nil, dnsmessage.Name{}, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+			}
+			cname, err := dnsmessage.NewName(ensureRooted(canonical))
+			if err != nil {
+				return nil, dnsmessage.Name{}, err
+			}
+			return addrs, cname, nil
+		}
+	}
+	machined := network != "CNAME" && systemConf().machinedResolves(r, name)
+	machinedLookup := func() ([]IPAddr, dnsmessage.Name, error) {
+		addrs, err := machinedLookupHost(ctx, network, name)
+		if err != nil {
+			return nil, dnsmessage.Name{}, err
+		}
+		cname, err := dnsmessage.NewName(ensureRooted(name))
+		return addrs, cname, err
+	}
+	if machined && systemConf().machinedBeforeFiles() {
+		if addrs, cname, err := machinedLookup(); err == nil {
+			return addrs, cname, nil
+		}
+		machined = false
+	}
 	if order == hostLookupFilesDNS || order == hostLookupFiles {
 		var canonical string
 		addrs, canonical = goLookupIPFiles(name)
@@ -610,23 +1345,63 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 			}
 			return addrs, cname, nil
 		}
+	}
+	if machined {
+		if addrs, cname, err := machinedLookup(); err == nil {
+			return addrs, cname, nil
+		}
+	}
+	if network != "CNAME" && systemConf().myhostnameResolves(r, name) {
+		if addrs, err := myhostnameLookupIP(ctx, network, name); err == nil {
+			cname, err := dnsmessage.NewName(ensureRooted(name))
+			if err != nil {
+				return nil, dnsmessage.Name{}, err
+			}
+			return addrs, cname, nil
+		}
+	}
+	if network != "CNAME" && order != hostLookupDNSFiles {
+		for _, src := range systemConf().libvirtSources(r) {
+			addrs, canonical := libvirtLookupIP(libvirtLeaseDir, src == "libvirt_guest", network, name, clockNow())
+			if len(addrs) > 0 {
+				cname, err := dnsmessage.NewName(canonical)
+				if err != nil {
+					return nil, dnsmessage.Name{}, err
+				}
+				return addrs, cname, nil
+			}
+		}
+	}
+	if order == hostLookupFiles {
+		if network != "CNAME" && systemConf().winsResolves(r, name) {
+			if addrs, err := winsLookupIP(ctx, network, name); err == nil {
+				return addrs, dnsmessage.Name{}, nil
+			}
+		}
+		return nil, dnsmessage.Name{}, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	}
 
-		if order == hostLookupFiles {
-			return nil, dnsmessage.Name{}, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	if network != "CNAME" && systemConf().avahiResolves(r, name) {
+		addrs, canonical, err := avahiLookupHost(ctx, network, name)
+		if err != nil {
+			return nil, dnsmessage.Name{}, err
 		}
+		cname, err := dnsmessage.NewName(ensureRooted(canonical))
+		if err != nil {
+			return nil, dnsmessage.Name{}, err
+		}
+		return addrs, cname, nil
 	}
 
-	if !isDomainName(name) {
+	if !r.validName(name) {
 		// See comment in func lookup above about use of errNoSuchHost.
 		return nil, dnsmessage.Name{}, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
 	}
-	resolvConf.tryUpdate("/etc/resolv.conf")
-	resolvConf.mu.RLock()
-	conf := resolvConf.dnsConfig
-	resolvConf.mu.RUnlock()
+	conf := r.dnsConfig()
 	type result struct {
 		p      dnsmessage.Parser
 		server string
+		qtype  dnsmessage.Type
 		error
 	}
 	lane := make(chan result, 1)
@@ -640,22 +1415,54 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 	case '6':
 		qtypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
 	}
+	var nat64 netip.Prefix
+	if network == "ip" && (r == nil || r.Dial == nil) {
+		// Skip the family that the host has no addresses to reach,
+		// as getaddrinfo does with AI_ADDRCONFIG. A Resolver with
+		// its own Dial function may not be reaching it from here.
+		switch want4, want6 := addrConfig(); {
+		case !want6:
+			qtypes = []dnsmessage.Type{dnsmessage.TypeA}
+		case !want4:
+			// Behind a NAT64 gateway, the IPv4 addresses of a
+			// host without IPv6 ones are reachable through
+			// the addresses synthesized from them.
+			if prefix, ok := r.nat64Prefix(ctx, conf); ok {
+				nat64 = prefix
+			} else {
+				qtypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+			}
+		}
+	}
+	names := conf.nameList(name)
 	var queryFn func(fqdn string, qtype dnsmessage.Type)
 	var responseFn func(fqdn string, qtype dnsmessage.Type) result
-	if conf.singleRequest {
+	if r != nil && r.ParallelSearch && len(names) > 1 {
+		tryOneName, cancel := r.tryNamesInParallel(ctx, conf, names, qtypes)
+		defer cancel()
+		queryFn = func(fqdn string, qtype dnsmessage.Type) {}
+		responseFn = func(fqdn string, qtype dnsmessage.Type) result {
+			p, server, err := tryOneName(fqdn, qtype)
+			return result{p, server, qtype, err}
+		}
+	} else if conf.singleRequest || r != nil && r.AddrQueries == AddrQuerySerial {
 		queryFn = func(fqdn string, qtype dnsmessage.Type) {}
 		responseFn = func(fqdn string, qtype dnsmessage.Type) result {
 			dnsWaitGroup.Add(1)
 			defer dnsWaitGroup.Done()
 			p, server, err := r.tryOneName(ctx, conf, fqdn, qtype)
-			return result{p, server, err}
+			return result{p, server, qtype, err}
 		}
 	} else {
+		// The query left unanswered when a lookup returns early, as
+		// r.AddrQueries allows, is canceled.
+		queryCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
 		queryFn = func(fqdn string, qtype dnsmessage.Type) {
 			dnsWaitGroup.Add(1)
 			go func(qtype dnsmessage.Type) {
-				p, server, err := r.tryOneName(ctx, conf, fqdn, qtype)
-				lane <- result{p, server, err}
+				p, server, err := r.tryOneName(queryCtx, conf, fqdn, qtype)
+				lane <- result{p, server, qtype, err}
 				dnsWaitGroup.Done()
 			}(qtype)
 		}
@@ -664,13 +1471,18 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 		}
 	}
 	var lastErr error
-	for _, fqdn := range conf.nameList(name) {
+	// partialErr is the failure of a query for the name being tried
+	// other than by the absence of records; see Resolver.PartialErrors.
+	var partialErr error
+	for _, fqdn := range names {
 		for _, qtype := range qtypes {
 			queryFn(fqdn, qtype)
 		}
 		hitStrictError := false
+		partialErr = nil
 		for _, qtype := range qtypes {
 			result := responseFn(fqdn, qtype)
+			found := len(addrs)
 			if result.error != nil {
 				if nerr, ok := result.error.(Error); ok && nerr.Temporary() && r.strictErrors() {
 					// This error will abort the nameList loop.
@@ -680,6 +1492,9 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 					// Prefer error for original name.
 					lastErr = result.error
 				}
+				if dnsErr, ok := result.error.(*DNSError); !ok || !dnsErr.IsNotFound {
+					partialErr = result.error
+				}
 				continue
 			}
 
@@ -723,6 +1538,9 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 						break loop
 					}
 					addrs = append(addrs, IPAddr{IP: IP(a.A[:])})
+					if ttls != nil {
+						recordTTL(ttls, netip.AddrFrom4(a.A), h.TTL)
+					}
 					if cname.Length == 0 && h.Name.Length != 0 {
 						cname = h.Name
 					}
@@ -738,6 +1556,9 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 						break loop
 					}
 					addrs = append(addrs, IPAddr{IP: IP(aaaa.AAAA[:])})
+					if ttls != nil {
+						recordTTL(ttls, netip.AddrFrom16(aaaa.AAAA), h.TTL)
+					}
 					if cname.Length == 0 && h.Name.Length != 0 {
 						cname = h.Name
 					}
@@ -768,6 +1589,9 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 					continue
 				}
 			}
+			if network == "ip" && r.addrQueryDone(result.qtype, len(addrs) > found) {
+				break
+			}
 		}
 		if hitStrictError {
 			// If either family hit an error with StrictErrors enabled,
@@ -786,6 +1610,12 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 		// just one is misleading. See also golang.org/issue/6324.
 		lastErr.Name = name
 	}
+	if partialErr, ok := partialErr.(*DNSError); ok {
+		partialErr.Name = name
+	}
+	if nat64.IsValid() {
+		addrs = synthesizeDNS64(addrs, nat64, ttls)
+	}
 	sortByRFC6724(addrs)
 	if len(addrs) == 0 && !(network == "CNAME" && cname.Length > 0) {
 		if order == hostLookupDNSFiles {
@@ -801,12 +1631,36 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, network, name strin
 			}
 		}
 		if lastErr != nil {
+			if network != "CNAME" && useLLMNR(name) {
+				// Peers on Windows networks often have no DNS
+				// entries, but answer LLMNR queries.
+				if addrs, err := llmnrLookupIP(ctx, network, name); err == nil {
+					return addrs, dnsmessage.Name{}, nil
+				}
+			}
+			if network != "CNAME" && systemConf().winsResolves(r, name) {
+				// Samba's wins source of nsswitch.conf.
+				if addrs, err := winsLookupIP(ctx, network, name); err == nil {
+					return addrs, dnsmessage.Name{}, nil
+				}
+			}
 			return nil, dnsmessage.Name{}, lastErr
 		}
 	}
+	if network == "ip" && len(addrs) > 0 && partialErr != nil && r.partialErrors() {
+		return addrs, cname, partialErr
+	}
 	return addrs, cname, nil
 }
 
+// recordTTL records ttl as the TTL of addr in ttls, keeping the
+// smallest TTL if addr was seen before.
+func recordTTL(ttls map[netip.Addr]uint32, addr netip.Addr, ttl uint32) {
+	if old, ok := ttls[addr]; !ok || ttl < old {
+		ttls[addr] = ttl
+	}
+}
+
 // goLookupCNAME is the native Go (non-cgo) implementation of LookupCNAME.
 func (r *Resolver) goLookupCNAME(ctx context.Context, host string) (string, error) {
 	order := systemConf().hostLookupOrder(r, host)
@@ -10,9 +10,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -79,7 +84,7 @@ func TestDNSTransportFallback(t *testing.T) {
 	for _, tt := range dnsTransportFallbackTests {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		_, h, err := r.exchange(ctx, tt.server, tt.question, time.Second, useUDPOrTCP, false)
+		_, h, _, err := r.exchange(ctx, tt.server, tt.question, time.Second, useUDPOrTCP, false)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -135,7 +140,7 @@ func TestSpecialDomainName(t *testing.T) {
 	for _, tt := range specialDomainNameTests {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		_, h, err := r.exchange(ctx, server, tt.question, 3*time.Second, useUDPOrTCP, false)
+		_, h, _, err := r.exchange(ctx, server, tt.question, 3*time.Second, useUDPOrTCP, false)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -219,8 +224,8 @@ func TestLookupTorOnion(t *testing.T) {
 	defer dnsWaitGroup.Wait()
 	r := Resolver{PreferGo: true, Dial: fakeDNSServerSuccessful.DialContext}
 	addrs, err := r.LookupIPAddr(context.Background(), "foo.onion")
-	if err != nil {
-		t.Fatalf("lookup = %v; want nil", err)
+	if !errors.Is(err, ErrOnionName) {
+		t.Fatalf("lookup = %v; want %v", err, ErrOnionName)
 	}
 	if len(addrs) > 0 {
 		t.Errorf("unexpected addresses: %v", addrs)
@@ -244,6 +249,7 @@ func newResolvConfTest() (*resolvConfTest, error) {
 		resolverConfig: &resolvConf,
 	}
 	conf.initOnce.Do(conf.init)
+	SetResolvConfPath(conf.path)
 	return conf, nil
 }
 
@@ -279,6 +285,7 @@ func (conf *resolvConfTest) forceUpdate(name string, lastChecked time.Time) erro
 	for i := 0; i < 5; i++ {
 		if conf.tryAcquireSema() {
 			conf.lastChecked = lastChecked
+			conf.resolverConfig.path = name
 			conf.releaseSema()
 			return nil
 		}
@@ -294,7 +301,8 @@ func (conf *resolvConfTest) servers() []string {
 }
 
 func (conf *resolvConfTest) teardown() error {
-	err := conf.forceUpdate("/etc/resolv.conf", time.Time{})
+	SetResolvConfPath("")
+	err := conf.forceUpdate(resolvConfPath(), time.Time{})
 	os.RemoveAll(conf.dir)
 	return err
 }
@@ -954,7 +962,7 @@ func TestIgnoreDNSForgeries(t *testing.T) {
 		t.Fatal("Pack failed:", err)
 	}
 
-	p, _, err := dnsPacketRoundTrip(c, 42, msg.Questions[0], b)
+	p, _, _, err := dnsPacketRoundTrip(c, 42, msg.Questions[0], b, maxDNSPacketSize)
 	if err != nil {
 		t.Fatalf("dnsPacketRoundTrip failed: %v", err)
 	}
@@ -1020,6 +1028,360 @@ func TestRetryTimeout(t *testing.T) {
 	}
 }
 
+// fakeFailoverServer answers A queries as two servers would: the
+// first, 192.0.2.91:53, fails and the second truncates its answer
+// over UDP.
+var fakeFailoverServer = fakeDNSServer{rh: func(n, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+	r := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:       q.ID,
+			Response: true,
+		},
+		Questions: q.Questions,
+	}
+	switch {
+	case s == "192.0.2.91:53":
+		r.Header.RCode = dnsmessage.RCodeServerFailure
+	case n == "udp":
+		r.Header.Truncated = true
+	default:
+		r.Header.RecursionAvailable = true
+		r.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  q.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			},
+			Body: &dnsmessage.AResource{A: TestAddr},
+		}}
+	}
+	return r, nil
+}}
+
+func TestDNSStats(t *testing.T) {
+	r := &Resolver{PreferGo: true, Dial: fakeFailoverServer.DialContext}
+	cfg := &dnsConfig{
+		servers:  []string{"192.0.2.91:53", "192.0.2.92:53"},
+		timeout:  time.Second,
+		attempts: 1,
+	}
+
+	before := ReadDNSStats()
+	if _, _, err := r.tryOneName(context.Background(), cfg, "stats.example.", dnsmessage.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	after := ReadDNSStats()
+
+	// Other tests may resolve names concurrently, so only the
+	// counters of the servers above are known exactly.
+	if n := after.Queries - before.Queries; n < 3 {
+		t.Errorf("got %d more queries; want at least 3", n)
+	}
+	if n := after.Retries - before.Retries; n < 1 {
+		t.Errorf("got %d more retries; want at least 1", n)
+	}
+	if n := after.TCPFallbacks - before.TCPFallbacks; n < 1 {
+		t.Errorf("got %d more TCP fallbacks; want at least 1", n)
+	}
+	for server, want := range map[string]DNSServerStats{
+		"192.0.2.91:53": {Queries: 1, Errors: 1},
+		"192.0.2.92:53": {Queries: 1, Errors: 0},
+	} {
+		got := after.Servers[server]
+		got.Queries -= before.Servers[server].Queries
+		got.Errors -= before.Servers[server].Errors
+		if got != want {
+			t.Errorf("got %+v for %s; want %+v", got, server, want)
+		}
+	}
+}
+
+func TestDNSTrace(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	event := func(format string, args ...any) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+	trace := &DNSTrace{
+		QueryStart: func(info DNSQueryStartInfo) {
+			event("start %s %d %s %s", info.Name, info.Type, info.Server, info.Network)
+		},
+		QueryDone: func(info DNSQueryDoneInfo) {
+			event("done %s %s rcode=%d truncated=%v err=%v", info.Server, info.Network, info.RCode, info.Truncated, info.Err)
+		},
+		Retry: func(info DNSQueryStartInfo, err error) {
+			event("retry %s %s after %v", info.Name, info.Server, err)
+		},
+		TCPFallback: func(name, server string) {
+			event("tcp %s %s", name, server)
+		},
+		CgoFallback: func(host string, err error) {
+			event("cgo %s %v", host, err)
+		},
+	}
+	ctx := WithDNSTrace(context.Background(), trace)
+	if ContextDNSTrace(ctx) != trace {
+		t.Fatal("ContextDNSTrace does not return the trace attached")
+	}
+
+	r := &Resolver{PreferGo: true, Dial: fakeFailoverServer.DialContext}
+	cfg := &dnsConfig{
+		servers:  []string{"192.0.2.91:53", "192.0.2.92:53"},
+		timeout:  time.Second,
+		attempts: 1,
+	}
+	if _, _, err := r.tryOneName(ctx, cfg, "trace.example.", dnsmessage.TypeA); err != nil {
+		t.Fatal(err)
+	}
+	lookupErr := &DNSError{Err: "server misbehaving", Name: "trace.example"}
+	if !(&Resolver{CgoFallback: true}).retryWithCgo(ctx, "trace.example", lookupErr) {
+		t.Error("lookup not retried with cgo")
+	}
+
+	want := []string{
+		"start trace.example. 1 192.0.2.91:53 udp",
+		"done 192.0.2.91:53 udp rcode=2 truncated=false err=<nil>",
+		"retry trace.example. 192.0.2.92:53 after lookup trace.example. on 192.0.2.91:53: server misbehaving",
+		"start trace.example. 1 192.0.2.92:53 udp",
+		"done 192.0.2.92:53 udp rcode=0 truncated=true err=<nil>",
+		"tcp trace.example. 192.0.2.92:53",
+		"start trace.example. 1 192.0.2.92:53 tcp",
+		"done 192.0.2.92:53 tcp rcode=0 truncated=false err=<nil>",
+		"cgo trace.example lookup trace.example: server misbehaving",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDNSErrorUnwrap(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		return dnsmessage.Message{}, os.ErrDeadlineExceeded
+	}}
+	cfg := &dnsConfig{
+		servers:  []string{"192.0.2.1:53"},
+		timeout:  time.Second,
+		attempts: 1,
+	}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+	_, _, err := r.tryOneName(context.Background(), cfg, "unwrap.example.", dnsmessage.TypeA)
+	var dnsErr *DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.Server != "192.0.2.1:53" || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("got %#v; want a DNSError from 192.0.2.1:53 wrapping os.ErrDeadlineExceeded", err)
+	}
+
+	opErr := &OpError{Op: "dial", Net: "udp", Err: os.ErrPermission}
+	r = &Resolver{PreferGo: true, Dial: func(context.Context, string, string) (Conn, error) {
+		return nil, opErr
+	}}
+	_, _, err = r.tryOneName(context.Background(), cfg, "unwrap.example.", dnsmessage.TypeA)
+	var gotOpErr *OpError
+	if !errors.As(err, &gotOpErr) || gotOpErr != opErr || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("got %#v; want a DNSError wrapping %v", err, opErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.LookupIPAddr(ctx, "unwrap.example")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v from a canceled lookup; want an error wrapping context.Canceled", err)
+	}
+}
+
+func TestDNSSentinelErrors(t *testing.T) {
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		r := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 q.ID,
+				Response:           true,
+				RecursionAvailable: true,
+			},
+			Questions: q.Questions,
+		}
+		switch s {
+		case "192.0.2.1:53":
+			r.Header.RCode = dnsmessage.RCodeNameError
+		case "192.0.2.2:53":
+			r.Header.RCode = dnsmessage.RCodeServerFailure
+		case "192.0.2.3:53":
+			r.Header.Truncated = true
+		}
+		return r, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+	for _, tt := range []struct {
+		server string
+		want   error
+	}{
+		{"192.0.2.1:53", ErrNXDomain},
+		{"192.0.2.2:53", ErrServFail},
+		{"192.0.2.3:53", ErrTruncated},
+		{"192.0.2.4:53", nil}, // NODATA is not NXDOMAIN
+	} {
+		cfg := &dnsConfig{servers: []string{tt.server}, timeout: time.Second, attempts: 1}
+		_, _, err := r.tryOneName(context.Background(), cfg, "sentinel.example.", dnsmessage.TypeA)
+		for _, sentinel := range []error{ErrNXDomain, ErrServFail, ErrTruncated} {
+			if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+				t.Errorf("%s: errors.Is(%v, %v) = %v", tt.server, err, sentinel, got)
+			}
+		}
+	}
+}
+
+func TestPartialErrors(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	var aaaaRCode atomic.Value
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		r := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 q.ID,
+				Response:           true,
+				RecursionAvailable: true,
+			},
+			Questions: q.Questions,
+		}
+		if q.Questions[0].Type == dnsmessage.TypeAAAA {
+			r.Header.RCode = aaaaRCode.Load().(dnsmessage.RCode)
+			return r, nil
+		}
+		r.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  q.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			},
+			Body: &dnsmessage.AResource{A: TestAddr},
+		}}
+		return r, nil
+	}}
+	r := &Resolver{
+		PreferGo:      true,
+		PartialErrors: true,
+		Servers:       []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")},
+		Dial:          fake.DialContext,
+	}
+	want := []IPAddr{{IP: IP(TestAddr[:])}}
+
+	// A failed AAAA query is reported along with the IPv4 address.
+	aaaaRCode.Store(dnsmessage.RCodeServerFailure)
+	addrs, err := r.LookupIPAddr(context.Background(), "partial.example.")
+	var dnsErr *DNSError
+	if !reflect.DeepEqual(addrs, want) || !errors.As(err, &dnsErr) || dnsErr.Type != uint16(dnsmessage.TypeAAAA) || !errors.Is(err, ErrServFail) {
+		t.Errorf("LookupIPAddr = %v, %#v; want %v and a SERVFAIL error for AAAA", addrs, err, want)
+	}
+	if ips, err := r.LookupIP(context.Background(), "ip", "partial.example."); len(ips) != 1 || err == nil {
+		t.Errorf("LookupIP = %v, %v; want an address and an error", ips, err)
+	}
+	if hosts, err := r.LookupHost(context.Background(), "partial.example."); len(hosts) != 1 || err != nil {
+		t.Errorf("LookupHost = %v, %v; want an address and no error", hosts, err)
+	}
+	r.PartialErrors = false
+	if addrs, err := r.LookupIPAddr(context.Background(), "partial.example."); !reflect.DeepEqual(addrs, want) || err != nil {
+		t.Errorf("LookupIPAddr without PartialErrors = %v, %v; want %v, nil", addrs, err, want)
+	}
+
+	// The absence of IPv6 addresses is not an error.
+	r.PartialErrors = true
+	aaaaRCode.Store(dnsmessage.RCodeSuccess)
+	if addrs, err := r.LookupIPAddr(context.Background(), "partial.example."); !reflect.DeepEqual(addrs, want) || err != nil {
+		t.Errorf("LookupIPAddr with no AAAA records = %v, %v; want %v, nil", addrs, err, want)
+	}
+}
+
+func TestResolverBackoff(t *testing.T) {
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		return dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:       q.ID,
+				Response: true,
+				RCode:    dnsmessage.RCodeServerFailure,
+			},
+			Questions: q.Questions,
+		}, nil
+	}}
+	var calls []string
+	r := &Resolver{
+		PreferGo: true,
+		Dial:     fake.DialContext,
+		Backoff: func(server string, attempt int) (time.Duration, bool) {
+			calls = append(calls, fmt.Sprintf("%s#%d", server, attempt))
+			return time.Millisecond, server != "192.0.2.2:53"
+		},
+	}
+	cfg := &dnsConfig{
+		servers:  []string{"192.0.2.1:53", "192.0.2.2:53"},
+		timeout:  time.Second,
+		attempts: 3,
+	}
+	before := ReadDNSStats().Servers
+	if _, _, err := r.tryOneName(context.Background(), cfg, "backoff.example.", dnsmessage.TypeA); err == nil {
+		t.Fatal("lookup succeeded")
+	}
+	want := []string{"192.0.2.2:53#0", "192.0.2.1:53#1", "192.0.2.2:53#1", "192.0.2.1:53#2", "192.0.2.2:53#2"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v; want %v", calls, want)
+	}
+	if n := ReadDNSStats().Servers["192.0.2.2:53"].Queries - before["192.0.2.2:53"].Queries; n != 0 {
+		t.Errorf("skipped server queried %d times", n)
+	}
+
+	// A canceled context interrupts the wait.
+	r.Backoff = func(string, int) (time.Duration, bool) { return time.Hour, true }
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := r.tryOneName(ctx, cfg, "backoff.example.", dnsmessage.TypeA); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v; want an error wrapping context.DeadlineExceeded", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second, 4)
+	for _, tt := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 0, 0},
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+	} {
+		for i := 0; i < 20; i++ {
+			if d, ok := backoff("192.0.2.1:53", tt.attempt); !ok || d < tt.min || d > tt.max {
+				t.Fatalf("attempt %d: got %v, %v; want between %v and %v", tt.attempt, d, ok, tt.min, tt.max)
+			}
+		}
+	}
+	if _, ok := backoff("192.0.2.1:53", 4); ok {
+		t.Error("budget of 4 queries exceeded")
+	}
+	if d, _ := ExponentialBackoff(time.Second, 3*time.Second, 0)("192.0.2.1:53", 10); d < 1500*time.Millisecond || d > 3*time.Second {
+		t.Errorf("got %v; want at most the maximum of 3s", d)
+	}
+	// Delays whose jitter does not fit in 32 bits.
+	for _, tt := range []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{time.Second, 4, 8 * time.Second},
+		{time.Hour, 3, 4 * time.Hour},
+		{time.Hour, 20, time.Hour << 19},
+	} {
+		for i := 0; i < 100; i++ {
+			if d, ok := ExponentialBackoff(tt.base, 0, 0)("192.0.2.1:53", tt.attempt); !ok || d < tt.want/2 || d > tt.want {
+				t.Fatalf("base %v, attempt %d: got %v, %v; want between %v and %v", tt.base, tt.attempt, d, ok, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
 func TestRotate(t *testing.T) {
 	// without rotation, always uses the first server
 	testRotate(t, false, []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1:53", "192.0.2.1:53", "192.0.2.1:53"})
@@ -1068,6 +1430,57 @@ func testRotate(t *testing.T, rotate bool, nameservers, wantServers []string) {
 	}
 }
 
+func TestRotateWithResolverServers(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+	if err := conf.writeAndUpdate([]string{"nameserver 192.0.2.9", "options rotate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var usedServers []string
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, deadline time.Time) (dnsmessage.Message, error) {
+		usedServers = append(usedServers, s)
+		return mockTXTResponse(q), nil
+	}}
+	r := Resolver{
+		Servers: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53"), netip.MustParseAddrPort("192.0.2.2:53")},
+		Dial:    fake.DialContext,
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := r.LookupTXT(context.Background(), "www.golang.org"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"192.0.2.1:53", "192.0.2.2:53", "192.0.2.1:53"}; !reflect.DeepEqual(usedServers, want) {
+		t.Errorf("got used servers %v; want %v", usedServers, want)
+	}
+
+	// A change of the Resolver's settings takes effect.
+	usedServers = nil
+	r.Servers = r.Servers[1:]
+	if _, err := r.LookupTXT(context.Background(), "www.golang.org"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.2:53"}; !reflect.DeepEqual(usedServers, want) {
+		t.Errorf("after changing Servers, got used servers %v; want %v", usedServers, want)
+	}
+
+	// So does a change of an element in place.
+	usedServers = nil
+	r.Servers[0] = netip.MustParseAddrPort("192.0.2.3:53")
+	if _, err := r.LookupTXT(context.Background(), "www.golang.org"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.3:53"}; !reflect.DeepEqual(usedServers, want) {
+		t.Errorf("after changing Servers[0], got used servers %v; want %v", usedServers, want)
+	}
+}
+
 func mockTXTResponse(q dnsmessage.Message) dnsmessage.Message {
 	r := dnsmessage.Message{
 		Header: dnsmessage.Header{
@@ -1127,28 +1540,45 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 		resolveTimeout
 	)
 
-	makeTempError := func(err string) error {
+	makeTempError := func(err string, qtype dnsmessage.Type, rcode dnsmessage.RCode) error {
 		return &DNSError{
 			Err:         err,
 			Name:        name,
 			Server:      server,
 			IsTemporary: true,
+			Type:        uint16(qtype),
+			Class:       uint16(dnsmessage.ClassINET),
+			RCode:       int(rcode),
+			Network:     "udp",
 		}
 	}
-	makeTimeout := func() error {
+	makeOpError := func(err string, qtype dnsmessage.Type) error {
+		dnsErr := makeTempError(err, qtype, dnsmessage.RCodeSuccess).(*DNSError)
+		dnsErr.UnwrapErr = &OpError{Op: "write", Err: fmt.Errorf("socket on fire")}
+		return dnsErr
+	}
+	makeTimeout := func(qtype dnsmessage.Type) error {
 		return &DNSError{
 			Err:       os.ErrDeadlineExceeded.Error(),
 			Name:      name,
 			Server:    server,
 			IsTimeout: true,
+			Type:      uint16(qtype),
+			Class:     uint16(dnsmessage.ClassINET),
+			Network:   "udp",
+			UnwrapErr: os.ErrDeadlineExceeded,
 		}
 	}
-	makeNxDomain := func() error {
+	makeNxDomain := func(qtype dnsmessage.Type) error {
 		return &DNSError{
 			Err:        errNoSuchHost.Error(),
 			Name:       name,
 			Server:     server,
 			IsNotFound: true,
+			Type:       uint16(qtype),
+			Class:      uint16(dnsmessage.ClassINET),
+			RCode:      int(dnsmessage.RCodeNameError),
+			Network:    "udp",
 		}
 	}
 
@@ -1174,7 +1604,7 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTimeout(),
+			wantStrictErr: makeTimeout(0),
 			wantIPs:       []string{ip4, ip6},
 		},
 		{
@@ -1185,7 +1615,7 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTimeout(),
+			wantStrictErr: makeTimeout(dnsmessage.TypeA),
 			wantIPs:       []string{ip4, ip6},
 		},
 		{
@@ -1196,7 +1626,7 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTempError("server misbehaving"),
+			wantStrictErr: makeTempError("server misbehaving", dnsmessage.TypeAAAA, dnsmessage.RCodeServerFailure),
 			wantIPs:       []string{ip4, ip6},
 		},
 		{
@@ -1207,8 +1637,8 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTimeout(),
-			wantLaxErr:    makeNxDomain(), // This one reaches the "test." FQDN.
+			wantStrictErr: makeTimeout(0),
+			wantLaxErr:    makeNxDomain(0), // This one reaches the "test." FQDN.
 		},
 		{
 			desc: "searchY IPv4-only socket error fails in strict mode",
@@ -1218,7 +1648,7 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTempError("write: socket on fire"),
+			wantStrictErr: makeOpError("write: socket on fire", dnsmessage.TypeA),
 			wantIPs:       []string{ip6},
 		},
 		{
@@ -1229,7 +1659,7 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 				}
 				return resolveOK
 			},
-			wantStrictErr: makeTimeout(),
+			wantStrictErr: makeTimeout(dnsmessage.TypeAAAA),
 			wantIPs:       []string{ip4},
 		},
 	}
@@ -1327,6 +1757,15 @@ func TestStrictErrorsLookupIP(t *testing.T) {
 			} else {
 				wantErr = tt.wantLaxErr
 			}
+			// A Type of 0 stands for either A or AAAA, whose
+			// failures may arrive in any order.
+			if want, ok := wantErr.(*DNSError); ok && want.Type == 0 {
+				if got, ok := err.(*DNSError); ok {
+					w := *want
+					w.Type = got.Type
+					wantErr = &w
+				}
+			}
 			if !reflect.DeepEqual(err, wantErr) {
 				t.Errorf("#%d (%s) strict=%v: got err %#v; want %#v", i, tt.desc, strict, err, wantErr)
 			}
@@ -1397,6 +1836,10 @@ func TestStrictErrorsLookupTXT(t *testing.T) {
 				Name:      name,
 				Server:    server,
 				IsTimeout: true,
+				Type:      uint16(dnsmessage.TypeTXT),
+				Class:     uint16(dnsmessage.ClassINET),
+				Network:   "udp",
+				UnwrapErr: os.ErrDeadlineExceeded,
 			}
 		} else {
 			wantRRs = 1
@@ -1601,7 +2044,7 @@ func TestDNSDialTCP(t *testing.T) {
 	}
 	r := Resolver{PreferGo: true, Dial: fake.DialContext}
 	ctx := context.Background()
-	_, _, err := r.exchange(ctx, "0.0.0.0", mustQuestion("com.", dnsmessage.TypeALL, dnsmessage.ClassINET), time.Second, useUDPOrTCP, false)
+	_, _, _, err := r.exchange(ctx, "0.0.0.0", mustQuestion("com.", dnsmessage.TypeALL, dnsmessage.ClassINET), time.Second, useUDPOrTCP, false)
 	if err != nil {
 		t.Fatal("exhange failed:", err)
 	}
@@ -1754,7 +2197,7 @@ func TestDNSUseTCP(t *testing.T) {
 	r := Resolver{PreferGo: true, Dial: fake.DialContext}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	_, _, err := r.exchange(ctx, "0.0.0.0", mustQuestion("com.", dnsmessage.TypeALL, dnsmessage.ClassINET), time.Second, useTCPOnly, false)
+	_, _, _, err := r.exchange(ctx, "0.0.0.0", mustQuestion("com.", dnsmessage.TypeALL, dnsmessage.ClassINET), time.Second, useTCPOnly, false)
 	if err != nil {
 		t.Fatal("exchange failed:", err)
 	}
@@ -2275,6 +2718,56 @@ func TestDNSPacketSize(t *testing.T) {
 	}
 }
 
+func TestDNSEDNSOptions(t *testing.T) {
+	// Client Subnet option for 192.0.2.0/24, see RFC 7871.
+	ecs := EDNSOption{Code: 8, Data: []byte{0, 1, 24, 0, 192, 0, 2}}
+	var (
+		mu   sync.Mutex
+		seen int
+	)
+	fake := fakeDNSServer{
+		rh: func(n, s string, q dnsmessage.Message, tm time.Time) (dnsmessage.Message, error) {
+			if len(q.Additionals) == 0 {
+				t.Error("missing EDNS record")
+			} else if opt, ok := q.Additionals[0].Body.(*dnsmessage.OPTResource); !ok {
+				t.Errorf("additional record type %T, expected OPTResource", q.Additionals[0])
+			} else {
+				mu.Lock()
+				seen++
+				mu.Unlock()
+				if got := int(q.Additionals[0].Header.Class); got != 4096 {
+					t.Errorf("EDNS packet size == %d, want 4096", got)
+				}
+				want := []dnsmessage.Option{{Code: ecs.Code, Data: ecs.Data}}
+				if !reflect.DeepEqual(opt.Options, want) {
+					t.Errorf("EDNS options = %v, want %v", opt.Options, want)
+				}
+			}
+			return fakeDNSServerSuccessful.rh(n, s, q, tm)
+		},
+	}
+	r := &Resolver{
+		EDNSPayloadSize: 4096,
+		EDNSOptions:     []EDNSOption{ecs},
+		Dial:            fake.DialContext,
+	}
+	if !r.preferGo() {
+		t.Error("EDNS settings do not imply PreferGo")
+	}
+	if _, err := r.LookupIPAddr(context.Background(), "go.dev."); err != nil {
+		t.Fatal(err)
+	}
+	if seen == 0 {
+		t.Error("no query seen")
+	}
+
+	for size, want := range map[uint16]uint16{0: maxDNSPacketSize, 100: 512, 512: 512, 4096: 4096} {
+		if got := (&Resolver{EDNSPayloadSize: size}).ednsPayloadSize(); got != want {
+			t.Errorf("EDNSPayloadSize %d: advertised %d, want %d", size, got, want)
+		}
+	}
+}
+
 func TestLongDNSNames(t *testing.T) {
 	const longDNSsuffix = ".go.dev."
 	const longDNSsuffixNoEndingDot = ".go.dev"
@@ -2472,35 +2965,1658 @@ func TestDNSTrustAD(t *testing.T) {
 	}
 }
 
-func TestDNSConfigNoReload(t *testing.T) {
+func TestSetResolvConfPath(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	dir := t.TempDir()
+	name := path.Join(dir, "resolv.conf")
+	if err := os.WriteFile(name, []byte("nameserver 192.0.2.7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		dialed []string
+	)
 	r := &Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (Conn, error) {
-		if address != "192.0.2.1:53" {
-			return nil, errors.New("configuration unexpectedly changed")
-		}
+		mu.Lock()
+		dialed = append(dialed, address)
+		mu.Unlock()
 		return fakeDNSServerSuccessful.DialContext(ctx, network, address)
 	}}
 
+	resolvConf.tryUpdate(resolvConfPath())
+	SetResolvConfPath(name)
+	defer func() {
+		SetResolvConfPath("")
+		resolvConf.tryUpdate(resolvConfPath())
+	}()
+	if got := resolvConfPath(); got != name {
+		t.Fatalf("resolvConfPath() = %q; want %q", got, name)
+	}
+	if _, err := r.LookupHost(context.Background(), "go.dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range dialed {
+		if address != "192.0.2.7:53" {
+			t.Errorf("dialed %q; want 192.0.2.7:53", address)
+		}
+	}
+}
+
+func TestResolverConfig(t *testing.T) {
 	conf, err := newResolvConfTest()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer conf.teardown()
 
-	err = conf.writeAndUpdateWithLastCheckedTime([]string{"nameserver 192.0.2.1", "options no-reload"}, time.Now().Add(-time.Hour))
-	if err != nil {
+	if err := conf.writeAndUpdate([]string{
+		"nameserver 192.0.2.1",
+		"nameserver 192.0.2.2",
+		"search example.com example.net",
+		"options ndots:3 timeout:4 attempts:5",
+	}); err != nil {
 		t.Fatal(err)
 	}
+	want := &DNSConfig{
+		Servers:  []string{"192.0.2.1:53", "192.0.2.2:53"},
+		Search:   []string{"example.com.", "example.net."},
+		Ndots:    3,
+		Timeout:  4 * time.Second,
+		Attempts: 5,
+	}
+	got := ResolverConfig()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ResolverConfig() = %+v; want %+v", got, want)
+	}
 
-	if _, err = r.LookupHost(context.Background(), "go.dev"); err != nil {
-		t.Fatal(err)
+	// The result is a copy that callers may modify.
+	got.Servers[0] = "192.0.2.99:53"
+	if servers := conf.servers(); servers[0] != "192.0.2.1:53" {
+		t.Errorf("modifying ResolverConfig result changed servers to %v", servers)
 	}
+}
 
-	err = conf.write([]string{"nameserver 192.0.2.200"})
-	if err != nil {
-		t.Fatal(err)
+func TestSetDNSConfig(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	defer SetDNSConfig(nil)
+
+	SetDNSConfig(&DNSConfig{
+		Servers: []string{"192.0.2.1", "[2001:db8::1]:5353"},
+		Search:  []string{"example.com", "."},
+		Ndots:   20,
+	})
+	want := &DNSConfig{
+		Servers:  []string{"192.0.2.1:53", "[2001:db8::1]:5353"},
+		Search:   []string{"example.com."},
+		Ndots:    15,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+	if got := ResolverConfig(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ResolverConfig() = %+v; want %+v", got, want)
 	}
 
-	if _, err = r.LookupHost(context.Background(), "go.dev"); err != nil {
+	var (
+		mu     sync.Mutex
+		dialed []string
+	)
+	r := &Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, address)
+		mu.Unlock()
+		return fakeDNSServerSuccessful.DialContext(ctx, network, address)
+	}}
+	if _, err := r.LookupHost(context.Background(), "go.dev"); err != nil {
 		t.Fatal(err)
 	}
+	for _, address := range dialed {
+		if address != want.Servers[0] && address != want.Servers[1] {
+			t.Errorf("dialed %q; want one of %v", address, want.Servers)
+		}
+	}
+
+	// Servers that are not IP addresses are left out, and a zero
+	// Ndots selects the default.
+	SetDNSConfig(&DNSConfig{
+		Servers: []string{"ns.example", "ns.example:53", "fe80::1%lo0", "/run/dns.sock"},
+	})
+	if got, want := ResolverConfig(), (&DNSConfig{
+		Servers:  []string{"[fe80::1%lo0]:53", "/run/dns.sock"},
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolverConfig() = %+v; want %+v", got, want)
+	}
+
+	SetDNSConfig(nil)
+	if got := ResolverConfig(); reflect.DeepEqual(got, want) {
+		t.Errorf("ResolverConfig() after SetDNSConfig(nil) = %+v; want system configuration", got)
+	}
+}
+
+func TestResolverServers(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	fake := fakeDNSServerRCode(dnsmessage.RCodeServerFailure)
+	var (
+		mu     sync.Mutex
+		dialed = make(map[string]bool)
+	)
+	r := &Resolver{
+		Servers: []netip.AddrPort{
+			netip.MustParseAddrPort("192.0.2.1:0"),
+			netip.MustParseAddrPort("[2001:db8::1]:5353"),
+		},
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			mu.Lock()
+			dialed[address] = true
+			mu.Unlock()
+			return fake.DialContext(ctx, network, address)
+		},
+	}
+	if !r.preferGo() {
+		t.Error("Servers does not imply PreferGo")
+	}
+	if _, err := r.LookupHost(context.Background(), "servers.example.com."); err == nil {
+		t.Fatal("LookupHost succeeded against failing servers")
+	}
+	want := map[string]bool{"192.0.2.1:53": true, "[2001:db8::1]:5353": true}
+	if !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %v; want %v", dialed, want)
+	}
+}
+
+func TestResolverSearch(t *testing.T) {
+	base := &dnsConfig{
+		servers: defaultNS,
+		search:  []string{"default.svc.cluster.local.", "svc.cluster.local.", "cluster.local."},
+		ndots:   5,
+	}
+	r := &Resolver{Search: []string{"example.com", "corp.example.", "."}}
+	if !r.preferGo() {
+		t.Error("Search does not imply PreferGo")
+	}
+	conf := r.withOverrides(base)
+	want := []string{"example.com.", "corp.example."}
+	if !reflect.DeepEqual(conf.search, want) {
+		t.Errorf("search = %v; want %v", conf.search, want)
+	}
+	if len(base.search) != 3 {
+		t.Errorf("withOverrides modified the base configuration: %v", base.search)
+	}
+	if got, want := conf.nameList("api"), []string{"api.example.com.", "api.corp.example.", "api."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nameList = %v; want %v", got, want)
+	}
+}
+
+func TestResolverNdots(t *testing.T) {
+	base := &dnsConfig{servers: defaultNS, search: []string{"example.com."}, ndots: 5}
+	for _, tt := range []struct {
+		ndots int
+		want  int
+	}{
+		{0, 5},
+		{1, 1},
+		{-1, 0},
+		{20, 15},
+	} {
+		r := &Resolver{Ndots: tt.ndots}
+		if got := r.withOverrides(base).ndots; got != tt.want {
+			t.Errorf("Ndots %d: ndots = %d; want %d", tt.ndots, got, tt.want)
+		}
+	}
+	if base.ndots != 5 {
+		t.Errorf("withOverrides modified the base configuration: ndots = %d", base.ndots)
+	}
+	r := &Resolver{Ndots: -1}
+	if got, want := r.withOverrides(base).nameList("a.b"), []string{"a.b.", "a.b.example.com."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nameList = %v; want %v", got, want)
+	}
+}
+
+func TestResolverNoSearch(t *testing.T) {
+	base := &dnsConfig{
+		servers: defaultNS,
+		search:  []string{"default.svc.cluster.local.", "svc.cluster.local.", "cluster.local."},
+		ndots:   5,
+	}
+	r := &Resolver{NoSearch: true, Search: []string{"example.com"}, Ndots: 2}
+	if !r.preferGo() {
+		t.Error("NoSearch does not imply PreferGo")
+	}
+	conf := r.withOverrides(base)
+	for _, name := range []string{"api", "api.example.com", "api.example.com."} {
+		want := []string{ensureRooted(name)}
+		if got := conf.nameList(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("nameList(%q) = %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestResolverParallelSearch(t *testing.T) {
+
+	answer := func(q dnsmessage.Message, ip [4]byte) dnsmessage.Message {
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		h := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: q.Questions[0].Type, Class: dnsmessage.ClassINET}
+		switch q.Questions[0].Type {
+		case dnsmessage.TypeA:
+			m.Answers = []dnsmessage.Resource{{Header: h, Body: &dnsmessage.AResource{A: ip}}}
+		case dnsmessage.TypeTXT:
+			txt := IPv4(ip[0], ip[1], ip[2], ip[3]).String()
+			m.Answers = []dnsmessage.Resource{{Header: h, Body: &dnsmessage.TXTResource{TXT: []string{txt}}}}
+		}
+		return m
+	}
+	// newResolver returns a Resolver whose server only answers for
+	// the first name in search order once the second one has been
+	// asked for, which never happens if the names are tried one
+	// after the other.
+	newResolver := func(firstExists bool) *Resolver {
+		secondAsked := make(chan struct{})
+		var once sync.Once
+		fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+			switch q.Questions[0].Name.String() {
+			case "host.first.example.":
+				select {
+				case <-secondAsked:
+				case <-time.After(5 * time.Second):
+					return dnsmessage.Message{}, os.ErrDeadlineExceeded
+				}
+				if firstExists {
+					return answer(q, [4]byte{192, 0, 2, 1}), nil
+				}
+			case "host.second.example.":
+				once.Do(func() { close(secondAsked) })
+				return answer(q, [4]byte{192, 0, 2, 2}), nil
+			}
+			m := answer(q, [4]byte{})
+			m.Answers = nil
+			m.RCode = dnsmessage.RCodeNameError
+			return m, nil
+		}}
+		return &Resolver{
+			ParallelSearch: true,
+			Servers:        []netip.AddrPort{netip.MustParseAddrPort("192.0.2.53:53")},
+			Search:         []string{"first.example", "second.example"},
+			Ndots:          5,
+			Dial:           fake.DialContext,
+		}
+	}
+
+	for _, firstExists := range []bool{false, true} {
+		// The answer for the first name that exists wins, even if
+		// it arrives after the one for a later name.
+		want := "192.0.2.2"
+		if firstExists {
+			want = "192.0.2.1"
+		}
+		addrs, err := newResolver(firstExists).LookupIP(context.Background(), "ip4", "host")
+		if err != nil || len(addrs) != 1 || addrs[0].String() != want {
+			t.Errorf("firstExists=%v: LookupIP = %v, %v; want [%s]", firstExists, addrs, err, want)
+		}
+		txts, err := newResolver(firstExists).LookupTXT(context.Background(), "host")
+		if err != nil || len(txts) != 1 || txts[0] != want {
+			t.Errorf("firstExists=%v: LookupTXT = %v, %v; want [%s]", firstExists, txts, err, want)
+		}
+	}
+
+	// A domain repeated in the search list is queried once, and no
+	// query is left waiting to report its result.
+	r := newResolver(true)
+	r.Search = append(r.Search, "second.example")
+	if addrs, err := r.LookupIP(context.Background(), "ip4", "host"); err != nil || len(addrs) != 1 || addrs[0].String() != "192.0.2.1" {
+		t.Errorf("repeated search domain: LookupIP = %v, %v; want [192.0.2.1]", addrs, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		dnsWaitGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("queries still running after the lookup returned")
+	}
+}
+
+func TestLookupOptions(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	var (
+		mu       sync.Mutex
+		queries  int
+		deadline time.Duration
+	)
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, t time.Time) (dnsmessage.Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if q.Questions[0].Type == dnsmessage.TypeA {
+			queries++
+			if d := time.Until(t); d > deadline {
+				deadline = d
+			}
+		}
+		return dnsmessage.Message{}, os.ErrDeadlineExceeded
+	}}
+	r := &Resolver{
+		Servers: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")},
+		Dial:    fake.DialContext,
+	}
+	ctx := WithLookupOptions(context.Background(), LookupOptions{Timeout: 100 * time.Millisecond, Attempts: 3})
+	_, err := r.LookupIPAddr(ctx, "options.example.com.")
+	if de, ok := err.(*DNSError); !ok || !de.IsTimeout {
+		t.Fatalf("LookupIPAddr error = %v; want timeout", err)
+	}
+	if queries != 3 {
+		t.Errorf("sent %d A queries; want 3", queries)
+	}
+	if deadline > 100*time.Millisecond {
+		t.Errorf("query deadline %v in the future; want at most 100ms", deadline)
+	}
+}
+
+func TestResolverDialTimeout(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	// The first server never accepts the connection.
+	dead := "192.0.2.1:53"
+	for _, viaOptions := range []bool{false, true} {
+		r := &Resolver{
+			Servers: []netip.AddrPort{netip.MustParseAddrPort(dead), netip.MustParseAddrPort("192.0.2.2:53")},
+			Dial: func(ctx context.Context, network, address string) (Conn, error) {
+				if address == dead {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return fakeDNSServerSuccessful.DialContext(ctx, network, address)
+			},
+		}
+		opts := LookupOptions{Timeout: time.Minute, Attempts: 1}
+		if viaOptions {
+			opts.DialTimeout = 10 * time.Millisecond
+		} else {
+			r.DialTimeout = 10 * time.Millisecond
+		}
+		ctx, cancel := context.WithTimeout(WithLookupOptions(context.Background(), opts), 10*time.Second)
+		addrs, err := r.LookupIPAddr(ctx, "dialtimeout.example.com.")
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			t.Errorf("via LookupOptions %v: LookupIPAddr = %v, %v; want an address from the second server", viaOptions, addrs, err)
+		}
+	}
+}
+
+func TestResolverMaxConcurrentQueries(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	const limit = 2
+	var inFlight, maxInFlight atomic.Int32
+	fake := fakeDNSServer{rh: func(n, s string, q dnsmessage.Message, tm time.Time) (dnsmessage.Message, error) {
+		cur := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if cur <= m || maxInFlight.CompareAndSwap(m, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return fakeDNSServerSuccessful.rh(n, s, q, tm)
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext, MaxConcurrentQueries: limit}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("host%d.example.com.", i)
+			if _, err := r.LookupIPAddr(context.Background(), name); err != nil {
+				t.Errorf("LookupIPAddr(%q): %v", name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := maxInFlight.Load(); got > limit {
+		t.Errorf("%d queries in flight at once; want at most %d", got, limit)
+	}
+}
+
+func TestResolverConfigPath(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	dir := t.TempDir()
+	for _, server := range []string{"192.0.2.10", "192.0.2.20"} {
+		name := path.Join(dir, server+".conf")
+		if err := os.WriteFile(name, []byte("nameserver "+server+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			mu     sync.Mutex
+			dialed []string
+		)
+		r := &Resolver{ConfigPath: name, Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, address)
+			mu.Unlock()
+			return fakeDNSServerSuccessful.DialContext(ctx, network, address)
+		}}
+		if !r.preferGo() {
+			t.Errorf("Resolver with ConfigPath does not prefer Go")
+		}
+		if _, err := r.LookupHost(context.Background(), "go.dev"); err != nil {
+			t.Fatal(err)
+		}
+		if len(dialed) == 0 {
+			t.Fatalf("ConfigPath %s: no DNS server dialed", name)
+		}
+		for _, address := range dialed {
+			if want := server + ":53"; address != want {
+				t.Errorf("ConfigPath %s: dialed %q; want %q", name, address, want)
+			}
+		}
+	}
+}
+
+func TestResolvConfPathEnv(t *testing.T) {
+	defer func() {
+		resolvConfEnvOnce = sync.Once{}
+	}()
+	for _, tt := range []struct {
+		env, want string
+	}{
+		{"", defaultResolvConfPath},
+		{"/run/custom/resolv.conf", "/run/custom/resolv.conf"},
+	} {
+		t.Setenv("RESOLV_CONF", tt.env)
+		resolvConfEnvOnce = sync.Once{}
+		if got := resolvConfPath(); got != tt.want {
+			t.Errorf("RESOLV_CONF=%q: resolvConfPath() = %q; want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestDNSLinkLocalNameserver(t *testing.T) {
+	var dialed []string
+	r := &Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (Conn, error) {
+		dialed = append(dialed, address)
+		return fakeDNSServerSuccessful.DialContext(ctx, network, address)
+	}}
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+
+	if err := conf.writeAndUpdate([]string{"nameserver fe80::1%eth0", "options single-request"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LookupHost(context.Background(), "go.dev"); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialed) == 0 {
+		t.Fatal("no DNS server dialed")
+	}
+	for _, address := range dialed {
+		ua, err := ResolveUDPAddr("udp", address)
+		if err != nil {
+			t.Fatalf("ResolveUDPAddr(%q): %v", address, err)
+		}
+		if ua.Zone != "eth0" || !ua.IP.IsLinkLocalUnicast() {
+			t.Errorf("dialed %q; want link-local address scoped to eth0", address)
+		}
+	}
+}
+
+func TestDNSConfigNoReload(t *testing.T) {
+	r := &Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (Conn, error) {
+		if address != "192.0.2.1:53" {
+			return nil, errors.New("configuration unexpectedly changed")
+		}
+		return fakeDNSServerSuccessful.DialContext(ctx, network, address)
+	}}
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+
+	err = conf.writeAndUpdateWithLastCheckedTime([]string{"nameserver 192.0.2.1", "options no-reload"}, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.LookupHost(context.Background(), "go.dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = conf.write([]string{"nameserver 192.0.2.200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.LookupHost(context.Background(), "go.dev"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolvConfSymlinkRetarget(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Now().Add(-time.Hour)
+	for _, f := range []struct{ name, server string }{{"a.conf", "192.0.2.1"}, {"b.conf", "192.0.2.2"}} {
+		name := filepath.Join(dir, f.name)
+		if err := os.WriteFile(name, []byte("nameserver "+f.server+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Both files have the same mtime, so only the change of
+		// target tells the link was pointed elsewhere.
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "resolv.conf")
+	if err := os.Symlink("a.conf", link); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a watch, only polling notices the change.
+	conf := &resolverConfig{path: link, watchPath: link}
+	conf.tryUpdate(link)
+	if got := conf.dnsConfig.servers; !reflect.DeepEqual(got, []string{"192.0.2.1:53"}) {
+		t.Fatalf("servers = %v; want [192.0.2.1:53]", got)
+	}
+
+	// Replace the link, as NetworkManager does.
+	tmp := filepath.Join(dir, "resolv.conf.tmp")
+	if err := os.Symlink("b.conf", tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		t.Fatal(err)
+	}
+	conf.lastChecked = time.Time{}
+	conf.tryUpdate(link)
+	if got := conf.dnsConfig.servers; !reflect.DeepEqual(got, []string{"192.0.2.2:53"}) {
+		t.Errorf("after retargeting the link, servers = %v; want [192.0.2.2:53]", got)
+	}
+}
+
+func TestResolverConfigForIdle(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	SetClock(clock)
+	defer SetClock(nil)
+
+	dir := t.TempDir()
+	idle, busy := filepath.Join(dir, "idle.conf"), filepath.Join(dir, "busy.conf")
+	for _, name := range []string{idle, busy} {
+		if err := os.WriteFile(name, []byte("nameserver 192.0.2.1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		resolvConfs.Lock()
+		delete(resolvConfs.m, idle)
+		delete(resolvConfs.m, busy)
+		resolvConfs.Unlock()
+	}()
+	has := func(name string) bool {
+		resolvConfs.Lock()
+		defer resolvConfs.Unlock()
+		return resolvConfs.m[name] != nil
+	}
+
+	resolvConfs.Lock()
+	resolvConfs.swept = time.Time{}
+	resolvConfs.Unlock()
+	conf := resolverConfigFor(idle)
+	conf.tryUpdate(idle)
+	resolverConfigFor(busy)
+
+	// Used within resolvConfIdle, both are kept.
+	clock.advance(resolvConfIdle / 2)
+	resolverConfigFor(busy)
+	if !has(idle) {
+		t.Fatalf("%s dropped before it was idle", idle)
+	}
+
+	clock.advance(resolvConfIdle / 2)
+	resolverConfigFor(busy)
+	if has(idle) {
+		t.Errorf("%s kept after %v unused", idle, resolvConfIdle)
+	}
+	if !has(busy) {
+		t.Errorf("%s dropped while in use", busy)
+	}
+	if conf.stopWatch != nil {
+		t.Errorf("watch of dropped %s not stopped", idle)
+	}
+}
+
+func TestFlushResolverConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "resolv.conf")
+	mtime := time.Now().Add(-time.Hour)
+	write := func(server string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte("nameserver "+server+"\noptions no-reload\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("192.0.2.1")
+
+	conf := resolverConfigFor(name)
+	defer func() {
+		resolvConfs.Lock()
+		delete(resolvConfs.m, name)
+		resolvConfs.Unlock()
+	}()
+	// Without a watch, only polling could notice the change.
+	conf.watchPath = name
+	conf.tryUpdate(name)
+	if got := conf.dnsConfig.servers; !reflect.DeepEqual(got, []string{"192.0.2.1:53"}) {
+		t.Fatalf("servers = %v; want [192.0.2.1:53]", got)
+	}
+
+	write("192.0.2.2")
+	conf.lastChecked = time.Time{}
+	conf.tryUpdate(name)
+	if got := conf.dnsConfig.servers; !reflect.DeepEqual(got, []string{"192.0.2.1:53"}) {
+		t.Fatalf("with no-reload, servers = %v; want [192.0.2.1:53]", got)
+	}
+
+	FlushResolverConfig()
+	conf.tryUpdate(name)
+	if got := conf.dnsConfig.servers; !reflect.DeepEqual(got, []string{"192.0.2.2:53"}) {
+		t.Errorf("after FlushResolverConfig, servers = %v; want [192.0.2.2:53]", got)
+	}
+}
+
+// fakeDNSServerRCode returns a fake DNS server answering every query
+// with an empty response carrying rcode.
+func fakeDNSServerRCode(rcode dnsmessage.RCode) fakeDNSServer {
+	return fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		return dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 q.ID,
+				Response:           true,
+				RCode:              rcode,
+				RecursionAvailable: true,
+			},
+			Questions: q.Questions,
+		}, nil
+	}}
+}
+
+// withFakeCgo replaces the cgo resolver used for fallbacks with one
+// that answers every name with addr, or with err if it is non-nil.
+// It returns a function restoring the original.
+func withFakeCgo(addr IPAddr, err error) func() {
+	origHost, origIP := cgoLookupHostFunc, cgoLookupIPFunc
+	cgoLookupHostFunc = func(ctx context.Context, name string) ([]string, error, bool) {
+		if err != nil {
+			return nil, err, true
+		}
+		return []string{addr.String()}, nil, true
+	}
+	cgoLookupIPFunc = func(ctx context.Context, network, name string) ([]IPAddr, error, bool) {
+		if err != nil {
+			return nil, err, true
+		}
+		return []IPAddr{addr}, nil, true
+	}
+	return func() { cgoLookupHostFunc, cgoLookupIPFunc = origHost, origIP }
+}
+
+func TestCgoFallback(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	cgoAddr := IPAddr{IP: IPv4(192, 0, 2, 99)}
+	fake := fakeDNSServerRCode(dnsmessage.RCodeNameError)
+
+	for _, tt := range []struct {
+		name     string
+		fallback bool
+		cgoErr   error
+		want     string // address expected, or "" for an error
+	}{
+		{"no fallback", false, nil, ""},
+		{"fallback", true, nil, "192.0.2.99"},
+		{"fallback fails", true, errors.New("cgo failure"), ""},
+	} {
+		restore := withFakeCgo(cgoAddr, tt.cgoErr)
+		r := &Resolver{CgoFallback: tt.fallback, PreferGo: true, Dial: fake.DialContext}
+
+		addrs, err := r.LookupIPAddr(context.Background(), "fallback.example.com")
+		if tt.want == "" {
+			if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+				t.Errorf("%s: LookupIPAddr error = %v; want Go resolver's not found error", tt.name, err)
+			}
+		} else if err != nil || len(addrs) != 1 || addrs[0].String() != tt.want {
+			t.Errorf("%s: LookupIPAddr = %v, %v; want [%s]", tt.name, addrs, err, tt.want)
+		}
+
+		hosts, err := r.LookupHost(context.Background(), "fallback.example.com")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: LookupHost = %v; want error", tt.name, hosts)
+			}
+		} else if err != nil || len(hosts) != 1 || hosts[0] != tt.want {
+			t.Errorf("%s: LookupHost = %v, %v; want [%s]", tt.name, hosts, err, tt.want)
+		}
+		restore()
+	}
+}
+
+func TestCgoRetryOnServerFailure(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	defer withFakeCgo(IPAddr{IP: IPv4(192, 0, 2, 99)}, nil)()
+
+	for _, tt := range []struct {
+		rcode dnsmessage.RCode
+		retry bool
+	}{
+		{dnsmessage.RCodeServerFailure, true},
+		{dnsmessage.RCodeRefused, true},
+		{dnsmessage.RCodeNameError, false},
+	} {
+		fake := fakeDNSServerRCode(tt.rcode)
+		r := &Resolver{CgoRetryOnServerFailure: true, PreferGo: true, Dial: fake.DialContext}
+		addrs, err := r.LookupIPAddr(context.Background(), "retry.example.com")
+		if tt.retry {
+			if err != nil || len(addrs) != 1 || addrs[0].String() != "192.0.2.99" {
+				t.Errorf("%v: LookupIPAddr = %v, %v; want [192.0.2.99]", tt.rcode, addrs, err)
+			}
+		} else if err == nil {
+			t.Errorf("%v: LookupIPAddr = %v; want error", tt.rcode, addrs)
+		}
+	}
+
+	// Only the server's response code counts, not the error text.
+	if err := (&DNSError{Err: errServerMisbehaving.Error(), Name: "retry.example.com"}); isServerFailure(err) {
+		t.Errorf("isServerFailure(%v) = true for an error without a response code", err)
+	}
+}
+
+func TestRaceCgo(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	origIP := cgoLookupIPFunc
+	defer func() { cgoLookupIPFunc = origIP }()
+
+	// A cgo lookup that only finishes when cancelled must lose the
+	// race against a successful Go lookup, and be cancelled.
+	cancelled := make(chan bool, 1)
+	cgoLookupIPFunc = func(ctx context.Context, network, name string) ([]IPAddr, error, bool) {
+		<-ctx.Done()
+		cancelled <- true
+		return nil, ctx.Err(), false
+	}
+	r := &Resolver{RaceCgo: true, Dial: fakeDNSServerSuccessful.DialContext}
+	addrs, err := r.LookupIPAddr(context.Background(), "race.example.com")
+	if err != nil || len(addrs) == 0 {
+		t.Fatalf("LookupIPAddr with slow cgo = %v, %v; want Go's answer", addrs, err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Error("losing cgo lookup was not cancelled")
+	}
+
+	// A successful cgo lookup wins over a failing Go lookup.
+	defer withFakeCgo(IPAddr{IP: IPv4(192, 0, 2, 99)}, nil)()
+	fake := fakeDNSServerRCode(dnsmessage.RCodeNameError)
+	r = &Resolver{RaceCgo: true, Dial: fake.DialContext}
+	addrs, err = r.LookupIPAddr(context.Background(), "race.example.com")
+	if err != nil || len(addrs) != 1 || addrs[0].String() != "192.0.2.99" {
+		t.Errorf("LookupIPAddr with failing Go = %v, %v; want [192.0.2.99]", addrs, err)
+	}
+
+	// If both fail, Go's error is reported.
+	cgoLookupIPFunc = func(ctx context.Context, network, name string) ([]IPAddr, error, bool) {
+		return nil, errors.New("cgo failure"), true
+	}
+	_, err = r.LookupIPAddr(context.Background(), "race.example.com")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("LookupIPAddr with both failing error = %v; want Go resolver's not found error", err)
+	}
+}
+
+func TestResolverExchange(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		switch q.Questions[0].Name.String() {
+		case "exists.example.com.":
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.TXTResource{TXT: []string{"hello"}},
+			}}
+		default:
+			m.RCode = dnsmessage.RCodeNameError
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	query := func(names ...string) []byte {
+		m := dnsmessage.Message{Header: dnsmessage.Header{ID: 0x1234, RecursionDesired: true}}
+		for _, name := range names {
+			m.Questions = append(m.Questions, dnsmessage.Question{
+				Name:  dnsmessage.MustNewName(name),
+				Type:  dnsmessage.TypeTXT,
+				Class: dnsmessage.ClassINET,
+			})
+		}
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for _, tt := range []struct {
+		name  string
+		rcode dnsmessage.RCode
+		txt   string
+	}{
+		{"exists.example.com.", dnsmessage.RCodeSuccess, "hello"},
+		{"missing.example.com.", dnsmessage.RCodeNameError, ""},
+	} {
+		b, err := r.Exchange(context.Background(), query(tt.name))
+		if err != nil {
+			t.Errorf("Exchange(%s): %v", tt.name, err)
+			continue
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(b); err != nil {
+			t.Errorf("Exchange(%s): cannot unpack response: %v", tt.name, err)
+			continue
+		}
+		if resp.ID != 0x1234 {
+			t.Errorf("Exchange(%s): response ID = %#x; want 0x1234", tt.name, resp.ID)
+		}
+		if resp.RCode != tt.rcode {
+			t.Errorf("Exchange(%s): rcode = %v; want %v", tt.name, resp.RCode, tt.rcode)
+		}
+		var txt string
+		if len(resp.Answers) == 1 {
+			txt = resp.Answers[0].Body.(*dnsmessage.TXTResource).TXT[0]
+		}
+		if txt != tt.txt {
+			t.Errorf("Exchange(%s): TXT = %q; want %q", tt.name, txt, tt.txt)
+		}
+	}
+
+	if _, err := r.Exchange(context.Background(), query("a.example.com.", "b.example.com.")); err == nil {
+		t.Error("Exchange with two questions succeeded")
+	}
+	if _, err := r.Exchange(context.Background(), query("hidden.onion.")); !errors.Is(err, ErrOnionName) {
+		t.Errorf("Exchange(hidden.onion.) error = %v; want %v", err, ErrOnionName)
+	}
+	_, err := r.Exchange(context.Background(), query("x.invalid."))
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("Exchange(x.invalid.) error = %v; want not found", err)
+	}
+	if _, err := r.Exchange(context.Background(), []byte{1, 2, 3}); err == nil {
+		t.Error("Exchange with malformed query succeeded")
+	}
+}
+
+func TestLookupTLSA(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	assoc := []byte{0xde, 0xad, 0xbe, 0xef}
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		switch q.Questions[0].Name.String() {
+		case "_25._tcp.mail.example.com.":
+			if q.Questions[0].Type != dnsTypeTLSA {
+				t.Errorf("query type = %v; want TLSA", q.Questions[0].Type)
+			}
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsTypeTLSA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.UnknownResource{Type: dnsTypeTLSA, Data: append([]byte{3, 1, 1}, assoc...)},
+			}}
+		case "_443._tcp.short.example.com.":
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsTypeTLSA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.UnknownResource{Type: dnsTypeTLSA, Data: []byte{3, 1}},
+			}}
+		default:
+			m.RCode = dnsmessage.RCodeNameError
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	tlsas, err := r.LookupTLSA(context.Background(), "25", "tcp", "mail.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &TLSA{Usage: 3, Selector: 1, MatchingType: 1, Data: assoc}
+	if len(tlsas) != 1 || !reflect.DeepEqual(tlsas[0], want) {
+		t.Errorf("LookupTLSA = %+v; want [%+v]", tlsas, want)
+	}
+
+	if _, err := r.LookupTLSA(context.Background(), "443", "tcp", "short.example.com."); err == nil {
+		t.Error("LookupTLSA with truncated record succeeded; want error")
+	}
+	_, err = r.LookupTLSA(context.Background(), "25", "tcp", "missing.example.com.")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("LookupTLSA error = %v; want not found", err)
+	}
+}
+
+func TestLookupNAPTR(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	naptr := func(order, pref byte, service, replacement string) dnsmessage.Resource {
+		data := []byte{0, order, 0, pref, 1, 'S', byte(len(service))}
+		data = append(data, service...)
+		data = append(data, 0)
+		for _, label := range strings.Split(strings.TrimSuffix(replacement, "."), ".") {
+			data = append(data, byte(len(label)))
+			data = append(data, label...)
+		}
+		data = append(data, 0)
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example.com."), Type: dnsTypeNAPTR, Class: dnsmessage.ClassINET},
+			Body:   &dnsmessage.UnknownResource{Type: dnsTypeNAPTR, Data: data},
+		}
+	}
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		return dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+			Answers: []dnsmessage.Resource{
+				naptr(20, 1, "SIP+D2T", "_sip._tcp.example.com."),
+				naptr(10, 2, "SIP+D2U", "_sip._udp.example.com."),
+				naptr(10, 1, "SIPS+D2T", "_sips._tcp.example.com."),
+				naptr(30, 1, "SIP+D2S", "bad name.example.com."),
+			},
+		}, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	naptrs, err := r.LookupNAPTR(context.Background(), "example.com.")
+	if de, ok := err.(*DNSError); !ok || de.Err != errMalformedDNSRecordsDetail {
+		t.Errorf("LookupNAPTR error = %v; want %v", err, errMalformedDNSRecordsDetail)
+	}
+	var got []string
+	for _, rr := range naptrs {
+		got = append(got, rr.Service)
+	}
+	if want := []string{"SIPS+D2T", "SIP+D2U", "SIP+D2T"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupNAPTR services = %v; want %v", got, want)
+	}
+}
+
+func TestLookupNetIPTTL(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		name := q.Questions[0].Name
+		switch q.Questions[0].Type {
+		case dnsmessage.TypeA:
+			m.Answers = []dnsmessage.Resource{
+				{
+					Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+				},
+				{
+					// The smallest TTL of duplicate records wins.
+					Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 100},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+				},
+			}
+		case dnsmessage.TypeAAAA:
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()},
+			}}
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	ttls := make(map[netip.Addr]time.Duration)
+	addrs, err := r.LookupNetIPTTL(context.Background(), "ip", "ttl.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		ttls[a.Addr] = a.TTL
+	}
+	want := map[netip.Addr]time.Duration{
+		netip.MustParseAddr("192.0.2.1"):   100 * time.Second,
+		netip.MustParseAddr("2001:db8::1"): 60 * time.Second,
+	}
+	if !reflect.DeepEqual(ttls, want) {
+		t.Errorf("LookupNetIPTTL = %v; want %v", addrs, want)
+	}
+
+	addrs, err = r.LookupNetIPTTL(context.Background(), "ip4", "ttl.example.com.")
+	if err != nil || len(addrs) == 0 {
+		t.Fatalf("LookupNetIPTTL(ip4) = %v, %v; want 192.0.2.1", addrs, err)
+	}
+	for _, a := range addrs {
+		if a.Addr != netip.MustParseAddr("192.0.2.1") {
+			t.Errorf("LookupNetIPTTL(ip4) returned %v; want only 192.0.2.1", a.Addr)
+		}
+	}
+
+	addrs, err = r.LookupNetIPTTL(context.Background(), "ip", "2001:db8::2")
+	if err != nil || len(addrs) != 1 || addrs[0] != (AddrTTL{Addr: netip.MustParseAddr("2001:db8::2")}) {
+		t.Errorf("LookupNetIPTTL(literal) = %v, %v; want 2001:db8::2 without TTL", addrs, err)
+	}
+	if _, err := r.LookupNetIPTTL(context.Background(), "ip4", "2001:db8::2"); err == nil {
+		t.Error("LookupNetIPTTL(ip4, IPv6 literal) succeeded; want error")
+	}
+}
+
+func TestLookupNetIPFamilies(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	var (
+		mu     sync.Mutex
+		qtypes []dnsmessage.Type
+	)
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		mu.Lock()
+		qtypes = append(qtypes, q.Questions[0].Type)
+		mu.Unlock()
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		name := q.Questions[0].Name
+		switch q.Questions[0].Type {
+		case dnsmessage.TypeA:
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+			}}
+		case dnsmessage.TypeAAAA:
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()},
+			}}
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	v4 := netip.MustParseAddr("192.0.2.1")
+	v6 := netip.MustParseAddr("2001:db8::1")
+	for _, tt := range []struct {
+		families []string
+		want     []netip.Addr
+		queries  int
+	}{
+		{[]string{"ip4"}, []netip.Addr{v4}, 1},
+		{[]string{"ip6"}, []netip.Addr{v6}, 1},
+		{[]string{"ip4", "ip6"}, []netip.Addr{v4, v6}, 2},
+		{[]string{"ip6", "ip4"}, []netip.Addr{v6, v4}, 2},
+		{[]string{"ip4", "ip4"}, []netip.Addr{v4}, 1},
+		{[]string{"ip6", "ip4", "ip6"}, []netip.Addr{v6, v4}, 2},
+	} {
+		qtypes = nil
+		addrs, err := r.LookupNetIPFamilies(context.Background(), "families.example.com.", tt.families...)
+		if err != nil {
+			t.Errorf("LookupNetIPFamilies(%v): %v", tt.families, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, tt.want) {
+			t.Errorf("LookupNetIPFamilies(%v) = %v; want %v", tt.families, addrs, tt.want)
+		}
+		if len(qtypes) != tt.queries {
+			t.Errorf("LookupNetIPFamilies(%v) sent queries %v; want %d", tt.families, qtypes, tt.queries)
+		}
+	}
+
+	for _, families := range [][]string{{"ip"}, {"ip4", "tcp"}, {"tcp"}} {
+		if _, err := r.LookupNetIPFamilies(context.Background(), "families.example.com.", families...); err == nil {
+			t.Errorf("LookupNetIPFamilies(%v) succeeded; want error", families)
+		}
+	}
+}
+
+func TestAddrQueries(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	for _, tt := range []struct {
+		mode AddrQueryMode
+		want []string // the addresses found, when AAAA answers late
+	}{
+		{AddrQueryParallel, []string{"192.0.2.1", "2001:db8::1"}},
+		{AddrQuerySerial, []string{"192.0.2.1", "2001:db8::1"}},
+		{AddrQueryPreferIPv4, []string{"192.0.2.1"}},
+		{AddrQueryPreferIPv6, []string{"192.0.2.1", "2001:db8::1"}},
+		{AddrQueryFirstAnswer, []string{"192.0.2.1"}},
+	} {
+		mode := tt.mode
+		var mu sync.Mutex
+		inflight, maxInflight := 0, 0
+		release := make(chan struct{})
+		fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+			mu.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inflight--
+				mu.Unlock()
+			}()
+			r := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, Response: true},
+				Questions: q.Questions,
+			}
+			h := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: q.Questions[0].Type, Class: dnsmessage.ClassINET, TTL: 60}
+			switch q.Questions[0].Type {
+			case dnsmessage.TypeA:
+				r.Answers = []dnsmessage.Resource{{Header: h, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}}}
+			case dnsmessage.TypeAAAA:
+				if mode != AddrQuerySerial {
+					<-release
+				}
+				r.Answers = []dnsmessage.Resource{{Header: h, Body: &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()}}}
+			}
+			return r, nil
+		}}
+		r := &Resolver{
+			Dial:        fake.DialContext,
+			Servers:     []netip.AddrPort{netip.MustParseAddrPort("192.0.2.53:53")},
+			NoSearch:    true,
+			AddrQueries: tt.mode,
+		}
+		if tt.mode != AddrQueryPreferIPv4 && tt.mode != AddrQueryFirstAnswer {
+			time.AfterFunc(50*time.Millisecond, func() { close(release) })
+		}
+		addrs, _, err := r.goLookupIPCNAMEOrder(context.Background(), "ip", "www.example.com.", hostLookupDNS)
+		if tt.mode == AddrQueryPreferIPv4 || tt.mode == AddrQueryFirstAnswer {
+			close(release)
+		}
+		dnsWaitGroup.Wait() // for the canceled query
+		if err != nil {
+			t.Errorf("mode %d: %v", tt.mode, err)
+			continue
+		}
+		var got []string
+		for _, a := range addrs {
+			got = append(got, a.IP.String())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mode %d: got %v; want %v", tt.mode, got, tt.want)
+		}
+		mu.Lock()
+		if tt.mode == AddrQuerySerial && maxInflight != 1 {
+			t.Errorf("serial queries: %d in flight at once", maxInflight)
+		}
+		mu.Unlock()
+	}
+}
+
+// testAResponse returns the answer to the query packed in b, with
+// TestAddr as the address of any name.
+func testAResponse(b []byte) (dnsmessage.Message, bool) {
+	var q dnsmessage.Message
+	if err := q.Unpack(b); err != nil || len(q.Questions) != 1 {
+		return dnsmessage.Message{}, false
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.Header.ID,
+			Response:           true,
+			RecursionAvailable: true,
+		},
+		Questions: q.Questions,
+	}
+	if q.Questions[0].Type == dnsmessage.TypeA {
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  q.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			},
+			Body: &dnsmessage.AResource{A: TestAddr},
+		}}
+	}
+	return resp, true
+}
+
+func TestUDPConnsPerServer(t *testing.T) {
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 is not supported")
+	}
+	ln, err := ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	ports := make(map[int]bool)
+	done := make(chan struct{})
+	defer func() {
+		ln.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		b := make([]byte, 512)
+		for {
+			n, addr, err := ln.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			ports[addr.(*UDPAddr).Port] = true
+			mu.Unlock()
+			resp, ok := testAResponse(b[:n])
+			if !ok {
+				continue
+			}
+			// Send a forged response first, which must be ignored.
+			forged := resp
+			forged.Header.ID ^= 0xffff
+			forged.Answers = nil
+			if p, err := forged.Pack(); err == nil {
+				ln.WriteTo(p, addr)
+			}
+			if p, err := resp.Pack(); err == nil {
+				ln.WriteTo(p, addr)
+			}
+		}
+	}()
+
+	const conns = 2
+	r := &Resolver{
+		Servers:           []netip.AddrPort{ln.LocalAddr().(*UDPAddr).AddrPort()},
+		UDPConnsPerServer: conns,
+	}
+	if !r.preferGo() {
+		t.Error("UDPConnsPerServer does not imply PreferGo")
+	}
+	defer r.getUDPPool().closeAll()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("host%d.example.", i)
+			addrs, err := r.LookupNetIP(context.Background(), "ip4", name)
+			if err != nil {
+				t.Errorf("LookupNetIP(%q): %v", name, err)
+				return
+			}
+			if len(addrs) != 1 || addrs[0] != netip.AddrFrom4(TestAddr) {
+				t.Errorf("LookupNetIP(%q) = %v; want [%v]", name, addrs, netip.AddrFrom4(TestAddr))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ports) == 0 || len(ports) > conns {
+		t.Errorf("queries sent from %d ports; want 1 to %d", len(ports), conns)
+	}
+}
+
+func TestUnixSocketNameServer(t *testing.T) {
+	// Queries are sent as datagrams where the client socket can be
+	// given an address to reply to, and over a stream otherwise.
+	networks := []string{"unix"}
+	if runtime.GOOS == "linux" || runtime.GOOS == "android" {
+		networks = append(networks, "unixgram")
+	}
+	for _, network := range networks {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			if !testableNetwork(network) {
+				t.Skipf("%s is not supported", network)
+			}
+			testUnixSocketNameServer(t, network)
+		})
+	}
+}
+
+func testUnixSocketNameServer(t *testing.T, network string) {
+	dir := t.TempDir()
+	sock := dir + "/dns.sock"
+	conf := "nameserver " + sock + "\n"
+
+	done := make(chan struct{})
+	var closer interface{ Close() error }
+	if network == "unixgram" {
+		c, err := ListenPacket(network, sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closer = c
+		go func() {
+			defer close(done)
+			b := make([]byte, 512)
+			for {
+				n, addr, err := c.ReadFrom(b)
+				if err != nil {
+					return
+				}
+				if resp, ok := testAResponse(b[:n]); ok {
+					p, _ := resp.Pack()
+					c.WriteTo(p, addr)
+				}
+			}
+		}()
+	} else {
+		ln, err := Listen(network, sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closer = ln
+		go func() {
+			defer close(done)
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				b := make([]byte, 514)
+				if _, err := io.ReadFull(c, b[:2]); err == nil {
+					n := int(b[0])<<8 | int(b[1])
+					if _, err := io.ReadFull(c, b[2:2+n]); err == nil {
+						if resp, ok := testAResponse(b[2 : 2+n]); ok {
+							p, _ := resp.Pack()
+							c.Write(append([]byte{byte(len(p) >> 8), byte(len(p))}, p...))
+						}
+					}
+				}
+				c.Close()
+			}
+		}()
+		// Skip the datagram query where it would be tried first.
+		conf += "options use-vc\n"
+	}
+	defer func() {
+		closer.Close()
+		<-done
+	}()
+
+	confPath := dir + "/resolv.conf"
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &Resolver{ConfigPath: confPath}
+	addrs, err := r.LookupNetIP(context.Background(), "ip4", "stub.example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := netip.AddrFrom4(TestAddr); len(addrs) != 1 || addrs[0] != want {
+		t.Errorf("LookupNetIP = %v; want [%v]", addrs, want)
+	}
+}
+
+func TestLookupIDNA(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		mu.Lock()
+		names = append(names, q.Questions[0].Name.String())
+		mu.Unlock()
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		name := q.Questions[0].Name
+		switch q.Questions[0].Type {
+		case dnsmessage.TypeA:
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: TestAddr},
+			}}
+		case dnsmessage.TypePTR:
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("xn--bcher-kva.example.")},
+			}}
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+	ctx := context.Background()
+
+	addrs, err := r.LookupNetIP(ctx, "ip4", "Bücher.example.")
+	if err != nil || len(addrs) != 1 || addrs[0] != netip.AddrFrom4(TestAddr) {
+		t.Errorf("LookupNetIP = %v, %v; want [%v]", addrs, err, netip.AddrFrom4(TestAddr))
+	}
+	mu.Lock()
+	if len(names) != 1 || names[0] != "xn--bcher-kva.example." {
+		t.Errorf("queried %q; want [xn--bcher-kva.example.]", names)
+	}
+	mu.Unlock()
+
+	r.StrictIDNA = true
+	_, err = r.LookupNetIP(ctx, "ip4", "Bücher.example.")
+	if !errors.Is(err, errInvalidIDN) {
+		t.Errorf("strict LookupNetIP error = %v; want %v", err, errInvalidIDN)
+	}
+
+	ptrs, err := r.LookupAddr(ctx, "192.0.2.1")
+	if err != nil || len(ptrs) != 1 || ptrs[0] != "xn--bcher-kva.example." {
+		t.Errorf("LookupAddr = %q, %v; want [xn--bcher-kva.example.]", ptrs, err)
+	}
+	r.UnicodeNames = true
+	ptrs, err = r.LookupAddr(ctx, "192.0.2.1")
+	if err != nil || len(ptrs) != 1 || ptrs[0] != "bücher.example." {
+		t.Errorf("LookupAddr with UnicodeNames = %q, %v; want [bücher.example.]", ptrs, err)
+	}
+}
+
+func TestSpecialUseNames(t *testing.T) {
+	cfg := &dnsConfig{servers: []string{"192.0.2.1:53"}, timeout: time.Second, attempts: 1}
+	routed := cfg.clone()
+	routed.setRoutes([]dnsRoute{{name: ".test.", servers: []string{"192.0.2.2:53"}}})
+	dial := func(ctx context.Context, network, address string) (Conn, error) {
+		return nil, errors.New("no DNS in this test")
+	}
+	tests := []struct {
+		name            string
+		want            bool // with LocalTestNames and neither routes nor servers of r's own
+		routed, dialing bool
+	}{
+		{"foo.invalid.", true, true, true},
+		{"INVALID.", true, true, true},
+		{"app.test.", true, false, false},
+		{"www.Example.", true, true, false},
+		{"www.example.com.", false, false, false},
+		{"test.golang.org.", false, false, false},
+		{"invalid.golang.org.", false, false, false},
+	}
+	for _, tt := range tests {
+		if got := (&Resolver{LocalTestNames: true}).unforwardedName(cfg, tt.name); got != tt.want {
+			t.Errorf("unforwardedName(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+		if got := (&Resolver{LocalTestNames: true}).unforwardedName(routed, tt.name); got != tt.routed {
+			t.Errorf("unforwardedName(%q) with a route for test = %v; want %v", tt.name, got, tt.routed)
+		}
+		if got := (&Resolver{LocalTestNames: true, Dial: dial}).unforwardedName(cfg, tt.name); got != tt.dialing {
+			t.Errorf("unforwardedName(%q) with Dial = %v; want %v", tt.name, got, tt.dialing)
+		}
+		// By default, only the names under invalid are kept local.
+		if got, want := (&Resolver{}).unforwardedName(cfg, tt.name), isInvalidName(tt.name); got != want {
+			t.Errorf("unforwardedName(%q) without LocalTestNames = %v; want %v", tt.name, got, want)
+		}
+	}
+
+	// Names under invalid are not found without a query, even before
+	// the hosts file is consulted.
+	r := &Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			t.Errorf("unexpected dial of %s %s", network, address)
+			return nil, errors.New("no DNS for invalid names")
+		},
+	}
+	for _, name := range []string{"foo.invalid", "bar.INVALID."} {
+		_, err := r.LookupHost(context.Background(), name)
+		if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+			t.Errorf("LookupHost(%q) error = %v; want not found", name, err)
+		}
+		_, err = r.LookupNetIP(context.Background(), "ip", name)
+		if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+			t.Errorf("LookupNetIP(%q) error = %v; want not found", name, err)
+		}
+		_, err = r.LookupMX(context.Background(), name)
+		if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+			t.Errorf("LookupMX(%q) error = %v; want not found", name, err)
+		}
+	}
+}
+
+func TestLookupSRVOrder(t *testing.T) {
+	// The records of the response, in the order of the zone.
+	records := []SRV{
+		{Target: "c.example.com.", Port: 1, Priority: 20, Weight: 0},
+		{Target: "a.example.com.", Port: 2, Priority: 10, Weight: 60},
+		{Target: "b.example.com.", Port: 3, Priority: 10, Weight: 40},
+		{Target: "d.example.com.", Port: 4, Priority: 10, Weight: 40},
+	}
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		r := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+			Questions: q.Questions,
+		}
+		for _, srv := range records {
+			r.Answers = append(r.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(srv.Target), Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight},
+			})
+		}
+		return r, nil
+	}}
+
+	tests := []struct {
+		order SRVOrderMode
+		rand  func(n int) int
+		want  []uint16 // ports
+	}{
+		{SRVOrderNone, nil, []uint16{1, 2, 3, 4}},
+		{SRVOrderSorted, nil, []uint16{3, 4, 2, 1}},
+		// With random numbers of 0, the first of the records of a
+		// priority, sorted by weight, is picked each time.
+		{SRVOrderWeighted, func(int) int { return 0 }, []uint16{3, 4, 2, 1}},
+		// With the largest random numbers, the last one is.
+		{SRVOrderWeighted, func(n int) int { return n - 1 }, []uint16{2, 3, 4, 1}},
+	}
+	for _, tt := range tests {
+		r := &Resolver{PreferGo: true, Dial: fake.DialContext, SRVOrder: tt.order, SRVRand: tt.rand}
+		for i := 0; i < 10; i++ {
+			_, srvs, err := r.LookupSRV(context.Background(), "", "", "_sip._tcp.example.com.")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ports []uint16
+			for _, srv := range srvs {
+				ports = append(ports, srv.Port)
+			}
+			if !reflect.DeepEqual(ports, tt.want) {
+				t.Errorf("order %d: ports = %v; want %v", tt.order, ports, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// malformedNames returns the names that err, the error of a lookup
+// that found malformed records, reports.
+func malformedNames(t *testing.T, err error) []string {
+	t.Helper()
+	if de, ok := err.(*DNSError); !ok || de.Err != errMalformedDNSRecordsDetail {
+		t.Errorf("error = %v; want %v", err, errMalformedDNSRecordsDetail)
+		return nil
+	}
+	var mre *MalformedRecordsError
+	if !errors.As(err, &mre) {
+		return nil
+	}
+	return mre.Names
+}
+
+func TestKeepMalformedRecords(t *testing.T) {
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		r := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+			Questions: q.Questions,
+		}
+		for i, host := range []string{"mail-.example.com.", "mail.example.com."} {
+			h := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: q.Questions[0].Type, Class: dnsmessage.ClassINET}
+			var body dnsmessage.ResourceBody
+			switch q.Questions[0].Type {
+			case dnsmessage.TypeMX:
+				body = &dnsmessage.MXResource{Pref: uint16(10 * (i + 1)), MX: dnsmessage.MustNewName(host)}
+			case dnsmessage.TypeNS:
+				body = &dnsmessage.NSResource{NS: dnsmessage.MustNewName(host)}
+			default:
+				return r, nil
+			}
+			r.Answers = append(r.Answers, dnsmessage.Resource{Header: h, Body: body})
+		}
+		return r, nil
+	}}
+	ctx := context.Background()
+
+	for _, keep := range []bool{false, true} {
+		r := &Resolver{PreferGo: true, Dial: fake.DialContext, KeepMalformedRecords: keep}
+		wantHosts := []string{"mail.example.com."}
+		var wantMalformed []string
+		if keep {
+			wantHosts = []string{"mail-.example.com.", "mail.example.com."}
+			wantMalformed = []string{"mail-.example.com."}
+		}
+
+		mxs, err := r.LookupMX(ctx, "example.com")
+		var hosts []string
+		for _, mx := range mxs {
+			hosts = append(hosts, mx.Host)
+		}
+		if got := malformedNames(t, err); !reflect.DeepEqual(got, wantMalformed) {
+			t.Errorf("KeepMalformedRecords=%v: LookupMX malformed names = %q; want %q", keep, got, wantMalformed)
+		}
+		if !reflect.DeepEqual(hosts, wantHosts) {
+			t.Errorf("KeepMalformedRecords=%v: LookupMX hosts = %q; want %q", keep, hosts, wantHosts)
+		}
+
+		nss, err := r.LookupNS(ctx, "example.com")
+		hosts = nil
+		for _, ns := range nss {
+			hosts = append(hosts, ns.Host)
+		}
+		if got := malformedNames(t, err); !reflect.DeepEqual(got, wantMalformed) {
+			t.Errorf("KeepMalformedRecords=%v: LookupNS malformed names = %q; want %q", keep, got, wantMalformed)
+		}
+		if !reflect.DeepEqual(hosts, wantHosts) {
+			t.Errorf("KeepMalformedRecords=%v: LookupNS hosts = %q; want %q", keep, hosts, wantHosts)
+		}
+	}
 }
@@ -5,7 +5,13 @@
 package net
 
 import (
+	"errors"
+	"internal/bytealg"
+	"internal/itoa"
+	"io"
+	"net/netip"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -15,22 +21,480 @@ var (
 	getHostname = os.Hostname // variable for testing
 )
 
+// hostnameCacheMaxAge is how long the host name of the machine is
+// cached for the myhostname NSS module, which needs it for every
+// lookup.
+const hostnameCacheMaxAge = 5 * time.Second
+
+var hostnameCache struct {
+	sync.Mutex
+	name   string
+	err    error
+	expire time.Time
+}
+
+// cachedHostname returns the host name of the machine, as getHostname
+// does, from a cache refreshed every hostnameCacheMaxAge.
+func cachedHostname() (string, error) {
+	hostnameCache.Lock()
+	defer hostnameCache.Unlock()
+	if now := clockNow(); !now.Before(hostnameCache.expire) {
+		hostnameCache.name, hostnameCache.err = getHostname()
+		hostnameCache.expire = now.Add(hostnameCacheMaxAge)
+	}
+	return hostnameCache.name, hostnameCache.err
+}
+
+// FlushHostnameCache drops the host name of the machine that the
+// resolver caches for a few seconds, for lookups of the host's own
+// name as the myhostname source of /etc/nsswitch.conf has them
+// answered. Programs that rename the host, such as those applying a
+// name from DHCP or cloud-init, can call it to make the new name take
+// effect right away.
+func FlushHostnameCache() {
+	hostnameCache.Lock()
+	hostnameCache.expire = time.Time{}
+	hostnameCache.Unlock()
+}
+
+// defaultResolvConfPath is the location of the resolver configuration
+// file used when neither SetResolvConfPath nor the RESOLV_CONF
+// environment variable say otherwise.
+const defaultResolvConfPath = "/etc/resolv.conf"
+
+var (
+	resolvConfPathOverride atomic.Pointer[string] // set by SetResolvConfPath
+
+	resolvConfEnvOnce sync.Once
+	resolvConfEnv     string // value of $RESOLV_CONF
+)
+
+// SetResolvConfPath sets the path of the resolv.conf file read by Go's
+// built-in DNS resolver, overriding both the RESOLV_CONF environment
+// variable and the default /etc/resolv.conf. An empty path removes the
+// override. The new file is read by the next lookup.
+//
+// The path is only used on systems where the Go resolver reads its
+// configuration from a resolv.conf file. It has no effect on lookups
+// handled by the native (cgo) resolver.
+func SetResolvConfPath(path string) {
+	resolvConfPathOverride.Store(&path)
+}
+
+// resolvConfPath returns the path of the resolv.conf file to read.
+func resolvConfPath() string {
+	if p := resolvConfPathOverride.Load(); p != nil && *p != "" {
+		return *p
+	}
+	resolvConfEnvOnce.Do(func() {
+		resolvConfEnv = os.Getenv("RESOLV_CONF")
+	})
+	if resolvConfEnv != "" {
+		return resolvConfEnv
+	}
+	return defaultResolvConfPath
+}
+
+// DNSConfig describes the configuration used by Go's built-in DNS
+// resolver, as read from resolv.conf on Unix systems or from the
+// network adapters on Windows.
+type DNSConfig struct {
+	// Servers lists the name servers to query, in host:port form,
+	// or as the absolute path of a Unix socket for a local stub
+	// resolver.
+	Servers []string
+
+	// Search lists the rooted domain suffixes appended to names
+	// with fewer than Ndots dots.
+	Search []string
+
+	// Ndots is the number of dots a name must contain to be
+	// tried as an absolute name before the search list is applied.
+	// Zero means the default of 1; a negative Ndots means that
+	// names are always tried as absolute names first (ndots:0).
+	Ndots int
+
+	// Timeout is how long to wait for a reply from a server.
+	Timeout time.Duration
+
+	// Attempts is the number of times each server is queried
+	// before giving up.
+	Attempts int
+}
+
+// ResolverConfig returns a copy of the DNS configuration currently
+// used by Go's built-in resolver: the one set by SetDNSConfig, or else
+// the default resolv.conf file, reread first if it may have changed.
+// It returns nil on systems without Go's resolver. Lookups handled by
+// the native (cgo) resolver may use a different configuration.
+func ResolverConfig() *DNSConfig {
+	return systemDNSConfig()
+}
+
+// dnsConfigOverride is the configuration set by SetDNSConfig.
+var dnsConfigOverride atomic.Pointer[dnsConfig]
+
+// SetDNSConfig makes Go's built-in DNS resolver use c instead of the
+// system configuration, such as /etc/resolv.conf, which is then no
+// longer read. This is meant for environments that lack such a file.
+// A nil c restores the system configuration.
+//
+// Servers must be IP addresses, optionally with a port, or the paths
+// of Unix sockets; the others, such as host names, are left out.
+// Servers given without a port use port 53, and Search domains need
+// not be rooted. An Ndots, Timeout or Attempts of zero selects the
+// default of 1 dot, 5 seconds and 2 attempts, as when resolv.conf
+// leaves them out, and an empty Servers list selects the local host.
+// The configuration only applies to Go's resolver: it has
+// no effect on lookups handled by the native (cgo) resolver, and
+// Resolvers with a ConfigPath keep reading their own file.
+func SetDNSConfig(c *DNSConfig) {
+	if c == nil {
+		dnsConfigOverride.Store(nil)
+		return
+	}
+	conf := &dnsConfig{
+		ndots:    c.Ndots,
+		timeout:  c.Timeout,
+		attempts: c.Attempts,
+		noReload: true,
+	}
+	for _, s := range c.Servers {
+		if !isUnixSocketServer(s) {
+			ap, err := netip.ParseAddrPort(s)
+			if err != nil {
+				ip, err := netip.ParseAddr(s)
+				if err != nil {
+					continue
+				}
+				ap = netip.AddrPortFrom(ip, 53)
+			}
+			s = ap.String()
+		}
+		conf.servers = append(conf.servers, s)
+	}
+	for _, s := range c.Search {
+		if s = ensureRooted(s); s != "." {
+			conf.search = append(conf.search, s)
+		}
+	}
+	if len(conf.servers) == 0 {
+		conf.servers = defaultNS
+	}
+	if conf.ndots == 0 {
+		conf.ndots = 1
+	} else if conf.ndots < 0 {
+		conf.ndots = 0
+	} else if conf.ndots > 15 {
+		conf.ndots = 15
+	}
+	if conf.timeout <= 0 {
+		conf.timeout = 5 * time.Second
+	}
+	if conf.attempts <= 0 {
+		conf.attempts = 2
+	}
+	dnsConfigOverride.Store(conf)
+}
+
+// export returns a copy of c as a DNSConfig.
+func (c *dnsConfig) export() *DNSConfig {
+	ndots := c.ndots
+	if ndots == 0 {
+		ndots = -1 // a zero Ndots means the default
+	}
+	return &DNSConfig{
+		Servers:  append([]string(nil), c.servers...),
+		Search:   append([]string(nil), c.search...),
+		Ndots:    ndots,
+		Timeout:  c.timeout,
+		Attempts: c.attempts,
+	}
+}
+
+// WriteTo writes c to w in the syntax of resolv.conf, so that reading
+// the result back, as Resolver.ConfigPath and SetResolvConfPath do,
+// gives Go's resolver the same configuration. It implements
+// io.WriterTo.
+//
+// As with SetDNSConfig, Servers may be given without a port, Search
+// domains need not be rooted, and an Ndots, Timeout or Attempts of
+// zero selects the default. The Timeout is rounded up to whole seconds.
+// Empty Servers and Search lists are left out, so that the defaults
+// apply when the file is read. All the servers are written, although
+// only the first three are used when the file is read unless
+// GODEBUG=netdnsservers says otherwise. resolv.conf cannot give the port of a
+// server, nor name one by host name, so servers on ports other than
+// 53, servers that are not IP addresses or Unix socket paths, and
+// names that do not fit on a line of the file make WriteTo fail
+// without writing anything.
+func (c *DNSConfig) WriteTo(w io.Writer) (n int64, err error) {
+	b, err := c.appendResolvConf(nil)
+	if err != nil {
+		return 0, err
+	}
+	m, err := w.Write(b)
+	return int64(m), err
+}
+
+// appendResolvConf appends c in the syntax of resolv.conf to b.
+func (c *DNSConfig) appendResolvConf(b []byte) ([]byte, error) {
+	for _, s := range c.Servers {
+		host := s
+		if isUnixSocketServer(s) {
+			if countAnyByte(s, " \t\r\n") > 0 {
+				return nil, errors.New("name server path " + s + " contains white space")
+			}
+		} else {
+			if h, port, err := SplitHostPort(s); err == nil {
+				if port != "53" {
+					return nil, errors.New("resolv.conf cannot give the port of name server " + s)
+				}
+				host = h
+			}
+			ip, zone := parseIPv6Zone(host)
+			if ip == nil && parseIPv4(host) == nil || ip != nil && zone == "" && bytealg.IndexByteString(host, '%') >= 0 {
+				return nil, errors.New("name server " + s + " is not an IP address")
+			}
+		}
+		if len(host) > maxConfigLine-len("nameserver ") {
+			return nil, errors.New("name server " + s + " too long")
+		}
+		b = append(b, "nameserver "...)
+		b = append(b, host...)
+		b = append(b, '\n')
+	}
+
+	if len(c.Search) > maxSearchDomains {
+		return nil, errors.New("search list longer than " + itoa.Itoa(maxSearchDomains) + " domains")
+	}
+	line := []byte("search")
+	for _, s := range c.Search {
+		if s == "" || s == "." || countAnyByte(s, " \t\r\n") > 0 {
+			return nil, errors.New("invalid search domain " + s)
+		}
+		if s[len(s)-1] == '.' {
+			s = s[:len(s)-1]
+		}
+		line = append(line, ' ')
+		line = append(line, s...)
+	}
+	if len(c.Search) > 0 {
+		if len(line) > maxConfigLine {
+			return nil, errors.New("search list longer than " + itoa.Itoa(maxConfigLine) + " bytes")
+		}
+		b = append(b, line...)
+		b = append(b, '\n')
+	}
+
+	line = append(line[:0], "options"...)
+	if ndots := c.Ndots; ndots != 0 && ndots != 1 {
+		if ndots < 0 {
+			ndots = 0
+		} else if ndots > 15 {
+			ndots = 15
+		}
+		line = append(line, " ndots:"...)
+		line = append(line, itoa.Itoa(ndots)...)
+	}
+	if c.Timeout > 0 {
+		if secs := (c.Timeout + time.Second - 1) / time.Second; secs != 5 {
+			line = append(line, " timeout:"...)
+			line = append(line, itoa.Itoa(int(secs))...)
+		}
+	}
+	if c.Attempts > 0 && c.Attempts != 2 {
+		line = append(line, " attempts:"...)
+		line = append(line, itoa.Itoa(c.Attempts)...)
+	}
+	if len(line) > len("options") {
+		b = append(b, line...)
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
 type dnsConfig struct {
-	servers       []string      // server addresses (in host:port form) to use
+	servers       []string      // server addresses (in host:port form, or Unix socket paths) to use
 	search        []string      // rooted suffixes to append to local name
 	ndots         int           // number of dots in name to trigger absolute lookup
 	timeout       time.Duration // wait before giving up on a query, including retries
 	attempts      int           // lost packets before giving up on server
 	rotate        bool          // round robin among servers
 	unknownOpt    bool          // anything unknown was encountered
+	unknownOptAt  configPos     // where the first unknown thing was
 	lookup        []string      // OpenBSD top-level database "lookup" order
 	err           error         // any error that occurs during open of resolv.conf
+	limitErr      error         // the first limit of the parser exceeded, for debugging; see parse.go
 	mtime         time.Time     // time of resolv.conf modification
 	soffset       uint32        // used by serverOffset
 	singleRequest bool          // use sequential A and AAAA queries instead of parallel queries
 	useTCP        bool          // force usage of TCP for DNS resolutions
 	trustAD       bool          // add AD flag to queries
 	noReload      bool          // do not check for config file updates
+	routes        []dnsRoute    // servers for specific namespaces, see serversFor
+	routeIndex    dnsRouteIndex // finds the route of a name; set with routes by setRoutes
+}
+
+// A configPos locates a token of a configuration file, for netdns
+// debugging output.
+type configPos struct {
+	file  string
+	line  int
+	token string
+}
+
+// A zoneCutCache holds the zone cuts that QNAME minimization found
+// with the servers of a configuration, by rooted domain, so that only
+// the first lookup in a zone walks down to it. It is emptied when the
+// configuration changes. See dnsqnamemin_unix.go.
+type zoneCutCache struct {
+	mu   sync.Mutex
+	conf *dnsConfig // configuration the zone cuts were found with
+	m    map[string]zoneCut
+}
+
+// A zoneCut tells whether a domain is the top of a zone of its own.
+type zoneCut struct {
+	ns      []string  // names of the name servers of the zone; nil if not a zone
+	servers []string  // addresses of the name servers, once looked up
+	expires time.Time // end of the TTL of the NS records
+}
+
+// A dnsRoute directs the queries for the names in a namespace to their
+// own servers, as the Name Resolution Policy Table does on Windows.
+type dnsRoute struct {
+	name    string   // rooted; a leading dot also matches the names below it
+	servers []string // server addresses in host:port form
+}
+
+// A dnsRouteIndex maps the lower-cased names of the namespaces of
+// routes, without their leading dot, to the routes for them, so that
+// finding the route of a name takes a map lookup per label of the name
+// rather than a comparison per route. It is built once per
+// configuration, as there may be many routes, such as the files of
+// /etc/resolver or the NRPT rules of a corporate network, and each
+// lookup asks for the route of every name it tries.
+type dnsRouteIndex map[string]dnsRouteEntry
+
+// A dnsRouteEntry holds the positions of the first route for a name
+// alone and of the first route for it and the names below it, or -1.
+type dnsRouteEntry struct {
+	exact, below int
+}
+
+// newDNSRouteIndex returns the index of routes, or nil if there are
+// none.
+func newDNSRouteIndex(routes []dnsRoute) dnsRouteIndex {
+	if len(routes) == 0 {
+		return nil
+	}
+	idx := make(dnsRouteIndex, len(routes))
+	for i, rt := range routes {
+		if rt.name == "" {
+			continue
+		}
+		key, below := rt.name, rt.name[0] == '.'
+		if below {
+			key = key[1:]
+		}
+		b := []byte(key)
+		lowerASCIIBytes(b)
+		key = string(b)
+		e, ok := idx[key]
+		if !ok {
+			e = dnsRouteEntry{exact: -1, below: -1}
+		}
+		if below && e.below < 0 {
+			e.below = i
+		} else if !below && e.exact < 0 {
+			e.exact = i
+		}
+		idx[key] = e
+	}
+	return idx
+}
+
+// lookup returns the position of the most specific route for name,
+// which must be rooted, or -1 if no route applies to it. Of routes as
+// specific as each other, the first one wins.
+func (idx dnsRouteIndex) lookup(name string) int {
+	if idx == nil {
+		return -1
+	}
+	var buf [256]byte
+	b := append(buf[:0], name...)
+	lowerASCIIBytes(b)
+	if e, ok := idx[string(b)]; ok {
+		switch {
+		case e.exact < 0:
+			return e.below
+		case e.below < 0 || e.exact < e.below:
+			return e.exact
+		default:
+			return e.below
+		}
+	}
+	// Try the parent domains, from the longest to the root.
+	for i := 0; i < len(b); i++ {
+		if b[i] == '.' {
+			if e, ok := idx[string(b[i+1:])]; ok && e.below >= 0 {
+				return e.below
+			}
+		}
+	}
+	return -1
+}
+
+// setRoutes sets the routes of c, along with their index.
+func (c *dnsConfig) setRoutes(routes []dnsRoute) {
+	c.routes = routes
+	c.routeIndex = newDNSRouteIndex(routes)
+}
+
+// An overriddenDNSConfig is a configuration derived by withOverrides
+// from base and from the settings of a Resolver as they were then.
+type overriddenDNSConfig struct {
+	base     *dnsConfig
+	servers  []netip.AddrPort
+	search   []string
+	ndots    int
+	noSearch bool
+	conf     *dnsConfig
+}
+
+// clone returns a copy of c, with a fresh server offset, whose fields
+// can be changed without affecting c. The slices are shared.
+func (c *dnsConfig) clone() *dnsConfig {
+	return &dnsConfig{
+		servers:       c.servers,
+		search:        c.search,
+		ndots:         c.ndots,
+		timeout:       c.timeout,
+		attempts:      c.attempts,
+		rotate:        c.rotate,
+		unknownOpt:    c.unknownOpt,
+		unknownOptAt:  c.unknownOptAt,
+		lookup:        c.lookup,
+		err:           c.err,
+		limitErr:      c.limitErr,
+		mtime:         c.mtime,
+		singleRequest: c.singleRequest,
+		useTCP:        c.useTCP,
+		trustAD:       c.trustAD,
+		noReload:      c.noReload,
+		routes:        c.routes,
+		routeIndex:    c.routeIndex,
+	}
+}
+
+// serversFor returns the servers to send the queries for name to: the
+// ones of the most specific route that applies to it, or c.servers.
+func (c *dnsConfig) serversFor(name string) []string {
+	if i := c.routeIndex.lookup(name); i >= 0 {
+		return c.routes[i].servers
+	}
+	return c.servers
 }
 
 // serverOffset returns an offset that can be used to determine
@@ -43,3 +507,10 @@ func (c *dnsConfig) serverOffset() uint32 {
 	}
 	return 0
 }
+
+func ensureRooted(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '.' {
+		return s
+	}
+	return s + "."
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+// androidPropertiesPath is where Android keeps its system properties.
+var androidPropertiesPath = "/dev/__properties__"
+
+// androidDNSProperties are the system properties in which netd
+// publishes the DNS servers of the default network.
+var androidDNSProperties = []string{"net.dns1", "net.dns2", "net.dns3", "net.dns4"}
+
+// dnsReadSystemConfig sets the servers of conf to those in the DNS
+// system properties, as Android has no resolv.conf. It reports whether
+// any were found: recent versions of Android hide the properties from
+// apps, whose lookups must then go through the C library.
+func dnsReadSystemConfig(conf *dnsConfig) bool {
+	props := readAndroidProperties(androidPropertiesPath, androidDNSProperties)
+	var servers []string
+	for _, name := range androidDNSProperties {
+		v := props[name]
+		if parseIPv4(v) != nil {
+			servers = append(servers, JoinHostPort(v, "53"))
+		} else if ip, _ := parseIPv6Zone(v); ip != nil {
+			servers = append(servers, JoinHostPort(v, "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return false
+	}
+	conf.servers = servers
+	return true
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/itoa"
+	"internal/syscall/unix"
+)
+
+// dnsReadSystemConfig replaces the servers, search list and routes of
+// conf with those that configd publishes from the SystemConfiguration
+// dynamic store, which account for the active network services, VPNs
+// and /etc/resolver files. It reports whether that configuration was
+// available.
+func dnsReadSystemConfig(conf *dnsConfig) bool {
+	resolvers := unix.DNSConfiguration()
+	if resolvers == nil {
+		return false
+	}
+	var routes []dnsRoute
+	for i, r := range resolvers {
+		servers := dnsResolverServers(r)
+		switch {
+		case i == 0 && r.Domain == "":
+			if len(servers) > 0 {
+				conf.servers = servers
+			}
+			if len(r.Search) > 0 {
+				conf.search = conf.search[:0:0]
+				for _, s := range r.Search {
+					conf.search = append(conf.search, ensureRooted(s))
+				}
+			}
+		case r.Domain != "" && len(servers) > 0 && isDomainName(r.Domain):
+			// Resolvers without servers, such as those of
+			// the mDNS domains, are of no use to us.
+			routes = append(routes, dnsRoute{name: "." + ensureRooted(r.Domain), servers: servers})
+		}
+	}
+	conf.setRoutes(routes)
+	return true
+}
+
+// dnsResolverServers returns the name servers of r in host:port form.
+func dnsResolverServers(r unix.DNSResolver) []string {
+	port := "53"
+	if r.Port != 0 {
+		port = itoa.Uitoa(uint(r.Port))
+	}
+	var servers []string
+	for _, ns := range r.Nameservers {
+		host := IP(ns.IP).String()
+		if ns.ScopeID != 0 && len(ns.IP) == IPv6len {
+			host += "%" + zoneCache.name(int(ns.ScopeID))
+		}
+		servers = append(servers, JoinHostPort(host, port))
+	}
+	return servers
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+// dnsReadSystemConfig sets the servers and search domains of conf to
+// those in the network database, as Plan 9 has no resolv.conf. It
+// reports whether any servers were found.
+func dnsReadSystemConfig(conf *dnsConfig) bool {
+	netNdb, _ := readNdb(netdir + "/ndb")
+	local, _ := readNdb(ndbLocalPath)
+	sysname, _ := getHostname()
+	servers, search := ndbResolverConfig(netNdb, local, sysname)
+	if len(servers) == 0 {
+		return false
+	}
+	if maxNS := maxNameservers(); len(servers) > maxNS {
+		servers = servers[:maxNS]
+	}
+	conf.servers = servers
+	if len(search) > 0 {
+		conf.search = search
+	}
+	return true
+}
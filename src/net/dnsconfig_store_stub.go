@@ -0,0 +1,13 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !windows && !darwin && !android && !plan9
+
+package net
+
+// dnsReadSystemConfig reports false: only Darwin, Android and Plan 9
+// have a system DNS configuration beyond resolv.conf.
+func dnsReadSystemConfig(conf *dnsConfig) bool {
+	return false
+}
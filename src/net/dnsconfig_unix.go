@@ -10,9 +10,37 @@ package net
 
 import (
 	"internal/bytealg"
+	"internal/godebug"
+	"internal/itoa"
+	"os"
+	"runtime"
 	"time"
 )
 
+// resolverDir is the directory of per-domain resolver files on macOS.
+// See resolver(5) on a macOS machine.
+const resolverDir = "/etc/resolver"
+
+// defaultMaxNameservers is the number of nameserver lines honored in
+// resolv.conf by default. It matches MAXNS in libc's resolv.h.
+const defaultMaxNameservers = 3
+
+// maxNameservers returns the number of nameserver lines honored in
+// resolv.conf. The limit can be changed with GODEBUG=netdnsservers=N,
+// or lifted entirely with GODEBUG=netdnsservers=all.
+func maxNameservers() int {
+	switch v := godebug.Get("netdnsservers"); v {
+	case "":
+	case "all":
+		return int(^uint(0) >> 1)
+	default:
+		if n, _, ok := dtoi(v); ok && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxNameservers
+}
+
 // See resolv.conf(5) on a Linux machine.
 func dnsReadConfig(filename string) *dnsConfig {
 	conf := &dnsConfig{
@@ -20,6 +48,16 @@ func dnsReadConfig(filename string) *dnsConfig {
 		timeout:  5 * time.Second,
 		attempts: 2,
 	}
+	if (runtime.GOOS == "darwin" || runtime.GOOS == "android" || runtime.GOOS == "plan9") && filename == defaultResolvConfPath {
+		// The system configuration complements resolv.conf, not
+		// a configuration file chosen by the program.
+		defer func() {
+			if !dnsReadSystemConfig(conf) && runtime.GOOS == "darwin" {
+				conf.setRoutes(dnsReadResolverDir(resolverDir))
+			}
+		}()
+	}
+	maxNS := maxNameservers()
 	file, err := open(filename)
 	if err != nil {
 		conf.servers = defaultNS
@@ -36,7 +74,26 @@ func dnsReadConfig(filename string) *dnsConfig {
 		conf.err = err
 		return conf
 	}
+	n := 0
+	// Going beyond a limit of the parser drops what is beyond it, but
+	// does not make the file unusable: glibc has no such limits.
+	invalid := func(reason string) {
+		if conf.limitErr == nil {
+			conf.limitErr = &ParseError{Type: filename + " line " + itoa.Itoa(n), Text: reason}
+		}
+	}
+	unknown := func(token string) {
+		if !conf.unknownOpt {
+			conf.unknownOpt = true
+			conf.unknownOptAt = configPos{file: filename, line: n, token: token}
+		}
+	}
 	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		n++
+		if len(line) > maxConfigLine {
+			invalid("line longer than " + itoa.Itoa(maxConfigLine) + " bytes")
+			continue
+		}
 		if len(line) > 0 && (line[0] == ';' || line[0] == '#') {
 			// comment.
 			continue
@@ -47,14 +104,25 @@ func dnsReadConfig(filename string) *dnsConfig {
 		}
 		switch f[0] {
 		case "nameserver": // add one name server
-			if len(f) > 1 && len(conf.servers) < 3 { // small, but the standard limit
+			if len(f) > 1 && len(conf.servers) < maxNS { // see maxNameservers
 				// One more check: make sure server name is
 				// just an IP address. Otherwise we need DNS
 				// to look it up.
 				if parseIPv4(f[1]) != nil {
 					conf.servers = append(conf.servers, JoinHostPort(f[1], "53"))
-				} else if ip, _ := parseIPv6Zone(f[1]); ip != nil {
+				} else if ip, zone := parseIPv6Zone(f[1]); ip != nil {
+					// A zone identifier, as in "fe80::1%eth0",
+					// scopes a link-local server to an interface.
+					// Keep it so that the dialer can pick the
+					// right interface, but reject an empty one.
+					if zone == "" && bytealg.IndexByteString(f[1], '%') >= 0 {
+						continue
+					}
 					conf.servers = append(conf.servers, JoinHostPort(f[1], "53"))
+				} else if isUnixSocketServer(f[1]) {
+					// A local stub resolver listening
+					// on a Unix socket.
+					conf.servers = append(conf.servers, f[1])
 				}
 			}
 
@@ -64,6 +132,10 @@ func dnsReadConfig(filename string) *dnsConfig {
 			}
 
 		case "search": // set search path to given servers
+			if len(f)-1 > maxSearchDomains {
+				invalid("search list longer than " + itoa.Itoa(maxSearchDomains) + " domains")
+				f = f[:1+maxSearchDomains]
+			}
 			conf.search = make([]string, 0, len(f)-1)
 			for i := 1; i < len(f); i++ {
 				name := ensureRooted(f[i])
@@ -104,6 +176,13 @@ func dnsReadConfig(filename string) *dnsConfig {
 					// "By default, glibc performs IPv4 and IPv6 lookups in parallel [...]
 					//  This option disables the behavior and makes glibc
 					//  perform the IPv6 and IPv4 requests sequentially."
+					// "single-request-reopen" additionally makes glibc
+					// close and reopen the socket between the two
+					// requests. The Go resolver dials a fresh socket
+					// for every exchange, so both options map onto
+					// sequential queries, except for Resolvers with
+					// UDPConnsPerServer set, whose queries share
+					// their sockets whatever the options.
 					conf.singleRequest = true
 				case s == "use-vc" || s == "usevc" || s == "tcp":
 					// Linux (use-vc), FreeBSD (usevc) and OpenBSD (tcp) option:
@@ -121,7 +200,7 @@ func dnsReadConfig(filename string) *dnsConfig {
 				case s == "no-reload":
 					conf.noReload = true
 				default:
-					conf.unknownOpt = true
+					unknown(s)
 				}
 			}
 
@@ -132,9 +211,14 @@ func dnsReadConfig(filename string) *dnsConfig {
 			conf.lookup = f[1:]
 
 		default:
-			conf.unknownOpt = true
+			unknown(f[0])
 		}
 	}
+	if !file.atEOF && len(file.data) == cap(file.data) {
+		// readLine gave up on a line longer than its buffer.
+		n++
+		invalid("line longer than " + itoa.Itoa(maxConfigLine) + " bytes")
+	}
 	if len(conf.servers) == 0 {
 		conf.servers = defaultNS
 	}
@@ -144,6 +228,70 @@ func dnsReadConfig(filename string) *dnsConfig {
 	return conf
 }
 
+// dnsReadResolverDir returns the routes configured by the files in dir.
+// Each file is named after the domain whose queries, including those
+// for the names below it, go to the name servers it lists.
+func dnsReadResolverDir(dir string) []dnsRoute {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var routes []dnsRoute
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		if rt, ok := dnsReadResolverFile(dir+"/"+e.Name(), e.Name()); ok {
+			routes = append(routes, rt)
+		}
+	}
+	return routes
+}
+
+// dnsReadResolverFile parses the resolver file filename for domain.
+// Only the nameserver, port and domain options matter to Go's
+// resolver; the others, such as search_order and timeout, are ignored.
+func dnsReadResolverFile(filename, domain string) (dnsRoute, bool) {
+	file, err := open(filename)
+	if err != nil {
+		return dnsRoute{}, false
+	}
+	defer file.close()
+	var addrs []string
+	port := "53"
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		if len(line) > 0 && (line[0] == ';' || line[0] == '#') {
+			continue
+		}
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "nameserver":
+			if parseIPv4(f[1]) != nil {
+				addrs = append(addrs, f[1])
+			} else if ip, _ := parseIPv6Zone(f[1]); ip != nil {
+				addrs = append(addrs, f[1])
+			}
+		case "port":
+			if n, _, ok := dtoi(f[1]); ok && n > 0 && n <= 0xffff {
+				port = f[1]
+			}
+		case "domain":
+			domain = f[1]
+		}
+	}
+	if len(addrs) == 0 || !isDomainName(domain) {
+		return dnsRoute{}, false
+	}
+	rt := dnsRoute{name: "." + ensureRooted(domain)}
+	for _, addr := range addrs {
+		rt.servers = append(rt.servers, JoinHostPort(addr, port))
+	}
+	return rt, true
+}
+
 func dnsDefaultSearch() []string {
 	hn, err := getHostname()
 	if err != nil {
@@ -159,10 +307,3 @@ func dnsDefaultSearch() []string {
 func hasPrefix(s, prefix string) bool {
 	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
 }
-
-func ensureRooted(s string) string {
-	if len(s) > 0 && s[len(s)-1] == '.' {
-		return s
-	}
-	return s + "."
-}
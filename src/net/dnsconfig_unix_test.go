@@ -8,8 +8,10 @@ package net
 
 import (
 	"errors"
+	"internal/itoa"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -30,6 +32,11 @@ var dnsReadConfigTests = []struct {
 			attempts:   3,
 			rotate:     true,
 			unknownOpt: true, // the "options attempts 3" line
+			unknownOptAt: configPos{
+				file:  "testdata/resolv.conf",
+				line:  8,
+				token: "attempts",
+			},
 		},
 	},
 	{
@@ -135,6 +142,16 @@ var dnsReadConfigTests = []struct {
 			search:        []string{"domain.local."},
 		},
 	},
+	{
+		name: "testdata/linklocal-resolv.conf",
+		want: &dnsConfig{
+			servers:  []string{"[fe80::1%eth0]:53", "[fe80::2%2]:53"},
+			ndots:    1,
+			timeout:  5 * time.Second,
+			attempts: 2,
+			search:   []string{"domain.local."},
+		},
+	},
 	{
 		name: "testdata/linux-use-vc-resolv.conf",
 		want: &dnsConfig{
@@ -146,6 +163,16 @@ var dnsReadConfigTests = []struct {
 			search:   []string{"domain.local."},
 		},
 	},
+	{
+		name: "testdata/unix-socket-resolv.conf",
+		want: &dnsConfig{
+			servers:  []string{"/run/dns/stub.sock", "8.8.8.8:53"},
+			ndots:    1,
+			timeout:  5 * time.Second,
+			attempts: 2,
+			search:   []string{"domain.local."},
+		},
+	},
 	{
 		name: "testdata/freebsd-usevc-resolv.conf",
 		want: &dnsConfig{
@@ -191,6 +218,154 @@ func TestDNSReadConfig(t *testing.T) {
 	}
 }
 
+func TestDNSReadConfigMaxNameservers(t *testing.T) {
+	all := []string{"192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:53", "192.0.2.4:53", "192.0.2.5:53"}
+	tests := []struct {
+		godebug string
+		want    []string
+	}{
+		{"", all[:3]},
+		{"netdnsservers=4", all[:4]},
+		{"netdnsservers=all", all},
+		{"netdnsservers=0", all[:3]},
+		{"netdnsservers=bogus", all[:3]},
+	}
+	for _, tt := range tests {
+		t.Setenv("GODEBUG", tt.godebug)
+		conf := dnsReadConfig("testdata/many-nameservers-resolv.conf")
+		if conf.err != nil {
+			t.Fatal(conf.err)
+		}
+		if !reflect.DeepEqual(conf.servers, tt.want) {
+			t.Errorf("GODEBUG=%q: got servers %v; want %v", tt.godebug, conf.servers, tt.want)
+		}
+	}
+}
+
+func TestDNSReadConfigLimits(t *testing.T) {
+	var search []string
+	for i := 0; i < maxSearchDomains+10; i++ {
+		search = append(search, "d"+itoa.Itoa(i)+".example.")
+	}
+	tests := []struct {
+		name    string
+		content string
+		search  []string
+	}{
+		{"long line", "nameserver 192.0.2.1\n# " + strings.Repeat("x", maxConfigLine) + "\nsearch a.example\n", []string{"a.example."}},
+		{"line longer than the read buffer", "search a.example\n# " + strings.Repeat("x", 128<<10) + "\n", []string{"a.example."}},
+		{"long search list", "search " + strings.Join(search, " ") + "\n", search[:maxSearchDomains]},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "resolv.conf")
+		if err := os.WriteFile(name, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conf := dnsReadConfig(name)
+		if conf.err != nil {
+			t.Errorf("%s: err = %v; want nil, so that the file is still used", tt.name, conf.err)
+		}
+		if _, ok := conf.limitErr.(*ParseError); !ok {
+			t.Errorf("%s: limitErr = %v; want a *ParseError", tt.name, conf.limitErr)
+		}
+		if !reflect.DeepEqual(conf.search, tt.search) {
+			t.Errorf("%s: search = %v; want %v", tt.name, conf.search, tt.search)
+		}
+	}
+}
+
+func TestDNSConfigWriteTo(t *testing.T) {
+	tests := []struct {
+		conf DNSConfig
+		text string
+		want DNSConfig // as read back
+	}{
+		{
+			conf: DNSConfig{
+				Servers:  []string{"[2001:db8::1]:53", "fe80::1%lo0", "/run/dns.sock"},
+				Search:   []string{"a.example.", "b.example"},
+				Ndots:    1,
+				Timeout:  5 * time.Second,
+				Attempts: 2,
+			},
+			text: "nameserver 2001:db8::1\nnameserver fe80::1%lo0\nnameserver /run/dns.sock\nsearch a.example b.example\n",
+			want: DNSConfig{
+				Servers:  []string{"[2001:db8::1]:53", "[fe80::1%lo0]:53", "/run/dns.sock"},
+				Search:   []string{"a.example.", "b.example."},
+				Ndots:    1,
+				Timeout:  5 * time.Second,
+				Attempts: 2,
+			},
+		},
+		{
+			conf: DNSConfig{
+				Servers:  []string{"192.0.2.1:53"},
+				Search:   []string{"a.example"},
+				Timeout:  1500 * time.Millisecond,
+				Attempts: 3,
+			},
+			text: "nameserver 192.0.2.1\nsearch a.example\noptions timeout:2 attempts:3\n",
+			want: DNSConfig{
+				Servers:  []string{"192.0.2.1:53"},
+				Search:   []string{"a.example."},
+				Ndots:    1,
+				Timeout:  2 * time.Second,
+				Attempts: 3,
+			},
+		},
+		{
+			conf: DNSConfig{
+				Servers: []string{"192.0.2.1"},
+				Ndots:   -1,
+			},
+			text: "nameserver 192.0.2.1\noptions ndots:0\n",
+			want: DNSConfig{
+				Servers:  []string{"192.0.2.1:53"},
+				Ndots:    -1,
+				Timeout:  5 * time.Second,
+				Attempts: 2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		n, err := tt.conf.WriteTo(&buf)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.conf, err)
+			continue
+		}
+		if buf.String() != tt.text || n != int64(buf.Len()) {
+			t.Errorf("%+v: wrote %d bytes %q; want %q", tt.conf, n, buf.String(), tt.text)
+		}
+		name := filepath.Join(t.TempDir(), "resolv.conf")
+		if err := os.WriteFile(name, []byte(buf.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conf := dnsReadConfig(name)
+		if conf.err != nil || conf.unknownOpt {
+			t.Errorf("%+v: reading back: err = %v, unknownOpt = %v", tt.conf, conf.err, conf.unknownOpt)
+		}
+		if got := conf.export(); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%+v: read back %+v; want %+v", tt.conf, *got, tt.want)
+		}
+	}
+
+	for _, c := range []DNSConfig{
+		{Servers: []string{"192.0.2.1:5353"}},
+		{Servers: []string{"ns.example"}},
+		{Servers: []string{"fe80::1%"}},
+		{Servers: []string{"/run/dns sock"}},
+		{Search: []string{"a.example\nnameserver 192.0.2.66"}},
+		{Search: []string{""}},
+		{Search: make([]string, maxSearchDomains+1)},
+	} {
+		var buf strings.Builder
+		if _, err := c.WriteTo(&buf); err == nil || buf.Len() != 0 {
+			t.Errorf("%+v: wrote %q, err = %v; want an error and nothing written", c, buf.String(), err)
+		}
+	}
+}
+
 func TestDNSReadMissingFile(t *testing.T) {
 	origGetHostname := getHostname
 	defer func() { getHostname = origGetHostname }()
@@ -243,6 +418,74 @@ var dnsDefaultSearchTests = []struct {
 	},
 }
 
+func TestDNSConfigServersFor(t *testing.T) {
+	c := &dnsConfig{servers: []string{"192.0.2.1:53"}}
+	c.setRoutes([]dnsRoute{
+		{name: ".example.com.", servers: []string{"192.0.2.2:53"}},
+		{name: ".corp.example.com.", servers: []string{"192.0.2.3:53"}},
+		{name: "www.corp.example.com.", servers: []string{"192.0.2.4:53"}},
+		{name: ".www.corp.example.com.", servers: []string{"192.0.2.5:53"}},
+		{name: "Mail.Example.Org.", servers: []string{"192.0.2.6:53"}},
+		{name: ".example.com.", servers: []string{"192.0.2.7:53"}},
+	})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"golang.org.", "192.0.2.1:53"},
+		{"notexample.com.", "192.0.2.1:53"},
+		{"example.com.", "192.0.2.2:53"},
+		{"host.Example.COM.", "192.0.2.2:53"},
+		{"host.corp.example.com.", "192.0.2.3:53"},
+		{"www.corp.example.com.", "192.0.2.4:53"},
+		{"a.www.corp.example.com.", "192.0.2.5:53"},
+		{"mail.example.org.", "192.0.2.6:53"},
+		{"a.mail.example.org.", "192.0.2.1:53"},
+	}
+	for _, tt := range tests {
+		if got := c.serversFor(tt.name); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("serversFor(%q) = %v; want [%s]", tt.name, got, tt.want)
+		}
+	}
+
+	// A route for the root applies to the names without a more
+	// specific one.
+	c.setRoutes(append(c.routes, dnsRoute{name: ".", servers: []string{"192.0.2.8:53"}}))
+	for name, want := range map[string]string{"golang.org.": "192.0.2.8:53", "host.example.com.": "192.0.2.2:53"} {
+		if got := c.serversFor(name); len(got) != 1 || got[0] != want {
+			t.Errorf("with a root route, serversFor(%q) = %v; want [%s]", name, got, want)
+		}
+	}
+}
+
+func BenchmarkDNSConfigServersFor(b *testing.B) {
+	c := &dnsConfig{servers: []string{"192.0.2.1:53"}}
+	var routes []dnsRoute
+	for i := 0; i < 100; i++ {
+		routes = append(routes, dnsRoute{name: ".corp" + itoa.Itoa(i) + ".example.com.", servers: []string{"192.0.2.2:53"}})
+	}
+	c.setRoutes(routes)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.serversFor("www.corp50.example.com.")
+		c.serversFor("www.golang.org.")
+	}
+}
+
+func TestDNSReadResolverDir(t *testing.T) {
+	routes := dnsReadResolverDir("testdata/resolver")
+	want := []dnsRoute{
+		{name: ".corp.example.com.", servers: []string{"10.0.0.53:53", "[fd00::53]:53"}},
+		{name: ".vpn.example.net.", servers: []string{"10.8.0.1:5353"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("dnsReadResolverDir = %+v; want %+v", routes, want)
+	}
+	if routes := dnsReadResolverDir("testdata/nonexistent"); routes != nil {
+		t.Errorf("dnsReadResolverDir of missing directory = %+v; want none", routes)
+	}
+}
+
 func TestDNSDefaultSearch(t *testing.T) {
 	origGetHostname := getHostname
 	defer func() { getHostname = origGetHostname }()
@@ -0,0 +1,116 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// fileWatchMask selects the inotify events that may signal a
+// rewritten configuration file: in-place writes, and the create,
+// rename and delete steps used by tools that replace the file
+// atomically.
+const fileWatchMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// maxFileWatches bounds the files watched at once, each of which takes
+// an inotify descriptor and a goroutine. Programs with Resolvers for
+// many ConfigPaths poll the files beyond it instead.
+const maxFileWatches = 16
+
+// fileWatches is the number of files being watched.
+var fileWatches atomic.Int32
+
+// watchFile uses inotify to watch the directory holding the named
+// file, such as resolv.conf, nsswitch.conf or the hosts file, and the
+// directory holding its target if it is a symbolic link, and calls
+// notify whenever either entry changes.
+// It reports false if the file cannot be watched, or if maxFileWatches
+// files are watched already, in which case the caller must rely on
+// polling alone. Otherwise the returned function stops the watch.
+func watchFile(name string, notify func()) (stop func(), ok bool) {
+	if fileWatches.Add(1) > maxFileWatches {
+		fileWatches.Add(-1)
+		return nil, false
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		fileWatches.Add(-1)
+		return nil, false
+	}
+	paths := []string{name}
+	if target, err := os.Readlink(name); err == nil {
+		if len(target) > 0 && target[0] != '/' {
+			dir, _ := splitFilePath(name)
+			target = dir + "/" + target
+		}
+		paths = append(paths, target)
+	}
+	files := make(map[string]bool)
+	for _, p := range paths {
+		dir, file := splitFilePath(p)
+		if _, err := syscall.InotifyAddWatch(fd, dir, fileWatchMask); err == nil {
+			files[file] = true
+		}
+	}
+	if len(files) == 0 {
+		syscall.Close(fd)
+		fileWatches.Add(-1)
+		return nil, false
+	}
+
+	// The descriptor is non-blocking, so os.File waits for events
+	// in the runtime poller instead of tying up a thread.
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				off += syscall.SizeofInotifyEvent
+				end := off + int(ev.Len)
+				if end > n {
+					break
+				}
+				file := buf[off:end]
+				for len(file) > 0 && file[len(file)-1] == 0 {
+					file = file[:len(file)-1]
+				}
+				if ev.Mask&syscall.IN_Q_OVERFLOW != 0 || files[string(file)] {
+					notify()
+				}
+				off = end
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.Close()
+			fileWatches.Add(-1)
+		})
+	}, true
+}
+
+// splitFilePath splits a slash-separated file name into its
+// directory and final element.
+func splitFilePath(name string) (dir, file string) {
+	i := last(name, '/')
+	switch {
+	case i < 0:
+		return ".", name
+	case i == 0:
+		return "/", name[1:]
+	}
+	return name[:i], name[i+1:]
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolvConfWatch(t *testing.T) {
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+
+	// writeAndUpdate postpones the next polling check by an hour,
+	// so only the watcher can make the new contents visible.
+	if err := conf.writeAndUpdate([]string{"nameserver 192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	conf.tryUpdate(conf.path)
+	if conf.stopWatch == nil {
+		t.Skip("resolv.conf watching not available")
+	}
+
+	// Replace the file atomically, the way NetworkManager does.
+	tmp := path.Join(conf.dir, "resolv.conf.tmp")
+	if err := os.WriteFile(tmp, []byte("nameserver 192.0.2.2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, conf.path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"192.0.2.2:53"}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		conf.tryUpdate(conf.path)
+		if reflect.DeepEqual(conf.servers(), want) {
+			return
+		}
+	}
+	t.Fatalf("got servers %v after rewriting resolv.conf; want %v", conf.servers(), want)
+}
+
+func TestWatchFileLimit(t *testing.T) {
+	name := path.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stops []func()
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}()
+	for fileWatches.Load() < maxFileWatches {
+		stop, ok := watchFile(name, func() {})
+		if !ok {
+			t.Skip("file watching not available")
+		}
+		stops = append(stops, stop)
+	}
+	if stop, ok := watchFile(name, func() {}); ok {
+		stop()
+		t.Fatalf("watchFile succeeded with %d files watched; want failure", maxFileWatches)
+	}
+
+	// Stopping a watch, even twice, frees one place.
+	stops[0]()
+	stops[0]()
+	stop, ok := watchFile(name, func() {})
+	if !ok {
+		t.Fatal("watchFile failed after a watch was stopped")
+	}
+	stops[0] = stop
+	if n := fileWatches.Load(); n != maxFileWatches {
+		t.Errorf("%d files watched; want %d", n, maxFileWatches)
+	}
+}
+
+func TestSplitFilePath(t *testing.T) {
+	for _, tt := range []struct {
+		name, dir, file string
+	}{
+		{"/etc/resolv.conf", "/etc", "resolv.conf"},
+		{"/resolv.conf", "/", "resolv.conf"},
+		{"resolv.conf", ".", "resolv.conf"},
+		{"testdata/resolv.conf", "testdata", "resolv.conf"},
+	} {
+		if dir, file := splitFilePath(tt.name); dir != tt.dir || file != tt.file {
+			t.Errorf("splitFilePath(%q) = %q, %q; want %q, %q", tt.name, dir, file, tt.dir, tt.file)
+		}
+	}
+}
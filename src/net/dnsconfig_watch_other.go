@@ -0,0 +1,14 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package net
+
+// watchFile reports that file watching is not available, so the
+// caches of resolv.conf, nsswitch.conf and the hosts file rely on
+// polling alone.
+func watchFile(name string, notify func()) (stop func(), ok bool) {
+	return nil, false
+}
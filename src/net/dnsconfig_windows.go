@@ -5,10 +5,23 @@
 package net
 
 import (
+	"internal/bytealg"
+	"internal/syscall/windows"
+	"internal/syscall/windows/registry"
+	"net/netip"
 	"syscall"
 	"time"
 )
 
+const (
+	// tcpipParametersKey holds the DNS settings of the TCP/IP stack.
+	tcpipParametersKey = `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`
+
+	// dnsClientPolicyKey holds the DNS settings set by group policy,
+	// which take precedence over tcpipParametersKey.
+	dnsClientPolicyKey = `SOFTWARE\Policies\Microsoft\Windows NT\DNSClient`
+)
+
 func dnsReadConfig(ignoredFilename string) (conf *dnsConfig) {
 	conf = &dnsConfig{
 		ndots:    1,
@@ -28,7 +41,14 @@ func dnsReadConfig(ignoredFilename string) (conf *dnsConfig) {
 	// the interfaces in some random order. It should order it by
 	// default route, or only use the default route(s) instead.
 	// In practice, however, it mostly works.
+	var suffixes []string
 	for _, aa := range aas {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		if aa.DnsSuffix != nil {
+			suffixes = append(suffixes, windows.UTF16PtrToString(aa.DnsSuffix))
+		}
 		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
 			sa, err := dns.Address.Sockaddr.Sockaddr()
 			if err != nil {
@@ -54,5 +74,183 @@ func dnsReadConfig(ignoredFilename string) (conf *dnsConfig) {
 			conf.servers = append(conf.servers, JoinHostPort(ip.String(), "53"))
 		}
 	}
+
+	searchList := registryString(dnsClientPolicyKey, "SearchList")
+	if searchList == "" {
+		searchList = registryString(tcpipParametersKey, "SearchList")
+	}
+	primary := registryString(dnsClientPolicyKey, "PrimaryDnsSuffix")
+	if primary == "" {
+		primary = registryString(tcpipParametersKey, "NV Domain")
+	}
+	if primary == "" {
+		primary = registryString(tcpipParametersKey, "Domain")
+	}
+	conf.search = dnsSearchList(searchList, primary, suffixes, devolutionLevel())
+	conf.setRoutes(readNRPT())
 	return conf
 }
+
+// defaultDevolutionLevel is the fewest labels that Windows devolves
+// the primary DNS suffix to, unless DomainNameDevolutionLevel says
+// otherwise.
+const defaultDevolutionLevel = 2
+
+// dnsSearchList returns the suffix search list, as Windows builds it.
+// An explicit, comma-separated searchList wins. Otherwise the list is
+// the primary DNS suffix of the computer, followed by the
+// connection-specific suffixes of the adapters that are up, and then
+// by the parents of the primary suffix down to level labels, a
+// process Windows calls devolution. A level of zero turns devolution
+// off.
+func dnsSearchList(searchList, primary string, suffixes []string, level int) []string {
+	var names []string
+	if searchList != "" {
+		names = splitAtBytes(searchList, ", ")
+	} else {
+		names = append([]string{primary}, suffixes...)
+		names = append(names, devolve(primary, level)...)
+	}
+	var search []string
+next:
+	for _, name := range names {
+		if name == "" || !isDomainName(name) {
+			continue
+		}
+		name = ensureRooted(name)
+		for _, s := range search {
+			if stringsEqualFold(s, name) {
+				continue next
+			}
+		}
+		search = append(search, name)
+	}
+	return search
+}
+
+// devolve returns the parent domains of name that have at least level
+// labels, from the longest to the shortest. It returns none if level
+// is zero.
+func devolve(name string, level int) []string {
+	if level == 0 || name == "" || !isDomainName(name) {
+		return nil
+	}
+	if name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	labels := count(name, '.') + 1
+	var parents []string
+	for ; labels > level; labels-- {
+		name = name[bytealg.IndexByteString(name, '.')+1:]
+		parents = append(parents, name)
+	}
+	return parents
+}
+
+// devolutionLevel returns the fewest labels to which the primary DNS
+// suffix is devolved, from the UseDomainNameDevolution and
+// DomainNameDevolutionLevel settings, or zero if devolution is turned
+// off.
+func devolutionLevel() int {
+	use, ok := registryInteger(dnsClientPolicyKey, "UseDomainNameDevolution")
+	if !ok {
+		use, ok = registryInteger(tcpipParametersKey, "UseDomainNameDevolution")
+	}
+	if ok && use == 0 {
+		return 0
+	}
+	level, ok := registryInteger(dnsClientPolicyKey, "DomainNameDevolutionLevel")
+	if !ok {
+		level, ok = registryInteger(tcpipParametersKey, "DomainNameDevolutionLevel")
+	}
+	if !ok || level < defaultDevolutionLevel || level > 127 {
+		return defaultDevolutionLevel
+	}
+	return int(level)
+}
+
+// nrptKeys are the registry keys holding the rules of the Name
+// Resolution Policy Table: those set by group policy, and the local
+// ones, such as those added by VPN clients for split DNS.
+var nrptKeys = []string{
+	dnsClientPolicyKey + `\DnsPolicyConfig`,
+	`SYSTEM\CurrentControlSet\Services\Dnscache\Parameters\DnsPolicyConfig`,
+}
+
+// readNRPT returns the routes of the rules of the Name Resolution
+// Policy Table. Only rules that name DNS servers matter to Go's
+// resolver; those that merely require DNSSEC or DirectAccess
+// settings are ignored.
+func readNRPT() []dnsRoute {
+	var routes []dnsRoute
+	for _, path := range nrptKeys {
+		k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		rules, _ := k.ReadSubKeyNames()
+		k.Close()
+		for _, rule := range rules {
+			rk, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\`+rule, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			names, _, err1 := rk.GetStringsValue("Name")
+			servers, _, err2 := rk.GetStringValue("GenericDNSServers")
+			rk.Close()
+			if err1 == nil && err2 == nil {
+				routes = append(routes, nrptRoutes(names, servers)...)
+			}
+		}
+	}
+	return routes
+}
+
+// nrptRoutes returns the routes of an NRPT rule for the namespaces in
+// names, which are either fully qualified names or suffixes starting
+// with a dot, to the semicolon-separated server addresses in servers.
+func nrptRoutes(names []string, servers string) []dnsRoute {
+	var addrs []string
+	for _, s := range splitAtBytes(servers, "; ") {
+		if ip, err := netip.ParseAddr(s); err == nil {
+			addrs = append(addrs, JoinHostPort(ip.String(), "53"))
+		}
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	var routes []dnsRoute
+	for _, name := range names {
+		if name != "" {
+			routes = append(routes, dnsRoute{name: ensureRooted(name), servers: addrs})
+		}
+	}
+	return routes
+}
+
+// registryString returns the string value name of the key at path
+// under HKEY_LOCAL_MACHINE, or "" if it is not set.
+func registryString(path, name string) string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	s, _, err := k.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// registryInteger returns the integer value name of the key at path
+// under HKEY_LOCAL_MACHINE, and whether it is set.
+func registryInteger(path, name string) (uint64, bool) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return 0, false
+	}
+	defer k.Close()
+	v, _, err := k.GetIntegerValue(name)
+	return v, err == nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDNSSearchList(t *testing.T) {
+	tests := []struct {
+		searchList string
+		primary    string
+		suffixes   []string
+		level      int
+		want       []string
+	}{
+		{"", "", nil, 2, nil},
+		{"", "corp.example.com", []string{"", "lab.example.com", "Corp.Example.com"}, 0, []string{"corp.example.com.", "lab.example.com."}},
+		{"a.example, b.example.,c.example", "corp.example.com", []string{"lab.example.com"}, 2, []string{"a.example.", "b.example.", "c.example."}},
+		{"bad..name,ok.example", "", nil, 2, []string{"ok.example."}},
+
+		// Devolution of the primary suffix.
+		{"", "a.b.corp.example.com", []string{"lab.example.net"}, 2, []string{"a.b.corp.example.com.", "lab.example.net.", "b.corp.example.com.", "corp.example.com.", "example.com."}},
+		{"", "a.b.corp.example.co.uk.", nil, 3, []string{"a.b.corp.example.co.uk.", "b.corp.example.co.uk.", "corp.example.co.uk.", "example.co.uk."}},
+		{"", "corp.example.com", []string{"example.com"}, 2, []string{"corp.example.com.", "example.com."}},
+		{"", "example.com", nil, 2, []string{"example.com."}},
+	}
+	for _, tt := range tests {
+		if got := dnsSearchList(tt.searchList, tt.primary, tt.suffixes, tt.level); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dnsSearchList(%q, %q, %q, %d) = %q; want %q", tt.searchList, tt.primary, tt.suffixes, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestNRPTRoutes(t *testing.T) {
+	routes := nrptRoutes([]string{".corp.example.com", "vpn.example.com", ""}, "10.0.0.53; fd00::53;bogus")
+	want := []dnsRoute{
+		{name: ".corp.example.com.", servers: []string{"10.0.0.53:53", "[fd00::53]:53"}},
+		{name: "vpn.example.com.", servers: []string{"10.0.0.53:53", "[fd00::53]:53"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("nrptRoutes = %+v; want %+v", routes, want)
+	}
+	if routes := nrptRoutes([]string{".example.com"}, ""); routes != nil {
+		t.Errorf("nrptRoutes without servers = %+v; want none", routes)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// DNS cookies: see RFC 7873.
+
+package net
+
+import (
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ednsCookie is the EDNS0 option code of DNS cookies.
+	ednsCookie = 10
+
+	// rcodeBadCookie is the extended response code sent by servers
+	// that reject a query because of a missing or invalid cookie.
+	rcodeBadCookie dnsmessage.RCode = 23
+)
+
+// dnsCookie holds the cookies exchanged by a Resolver with one server.
+type dnsCookie struct {
+	client [8]byte // client cookie, random per server
+
+	mu     sync.Mutex
+	server []byte // last server cookie received, if any; guarded by mu
+}
+
+// cookieOption returns the COOKIE option to send in a query to server.
+func (r *Resolver) cookieOption(server string) dnsmessage.Option {
+	c, ok := r.cookies.Load(server)
+	if !ok {
+		nc := new(dnsCookie)
+		for i := range nc.client {
+			nc.client[i] = byte(fastrandu())
+		}
+		c, _ = r.cookies.LoadOrStore(server, nc)
+	}
+	cookie := c.(*dnsCookie)
+	cookie.mu.Lock()
+	defer cookie.mu.Unlock()
+	data := make([]byte, 0, len(cookie.client)+len(cookie.server))
+	data = append(data, cookie.client[:]...)
+	data = append(data, cookie.server...)
+	return dnsmessage.Option{Code: ednsCookie, Data: data}
+}
+
+// checkCookie looks for a COOKIE option in the response p from server,
+// which must be positioned after the question section, and remembers
+// the server cookie it carries for the next query. It reports whether
+// the response should be accepted, which is not the case if the
+// option echoes a client cookie other than ours, and whether the server
+// rejected the query with BADCOOKIE.
+func (r *Resolver) checkCookie(server string, p dnsmessage.Parser, h dnsmessage.Header) (ok, badCookie bool) {
+	// Work on a copy, so that the caller's parser still starts
+	// at the answer section.
+	if err := p.SkipAllAnswers(); err != nil {
+		return true, false
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return true, false
+	}
+	for {
+		rh, err := p.AdditionalHeader()
+		if err != nil {
+			return true, false
+		}
+		if rh.Type != dnsmessage.TypeOPT {
+			if err := p.SkipAdditional(); err != nil {
+				return true, false
+			}
+			continue
+		}
+		badCookie = rh.ExtendedRCode(h.RCode) == rcodeBadCookie
+		opt, err := p.OPTResource()
+		if err != nil {
+			return true, badCookie
+		}
+		for _, o := range opt.Options {
+			if o.Code != ednsCookie {
+				continue
+			}
+			return r.updateCookie(server, o.Data), badCookie
+		}
+		return true, badCookie
+	}
+}
+
+// updateCookie records the server cookie in the COOKIE option data
+// received from server, and reports whether its client cookie is ours.
+func (r *Resolver) updateCookie(server string, data []byte) bool {
+	v, ok := r.cookies.Load(server)
+	if !ok {
+		return false
+	}
+	c := v.(*dnsCookie)
+	if len(data) < len(c.client) || string(data[:len(c.client)]) != string(c.client[:]) {
+		return false
+	}
+	// Server cookies are 8 to 32 bytes long. Ignore anything else.
+	if sc := data[len(c.client):]; len(sc) >= 8 && len(sc) <= 32 {
+		c.mu.Lock()
+		c.server = append(c.server[:0:0], sc...)
+		c.mu.Unlock()
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// queryCookie returns the data of the COOKIE option in query q.
+func queryCookie(q dnsmessage.Message) []byte {
+	for _, rr := range q.Additionals {
+		if opt, ok := rr.Body.(*dnsmessage.OPTResource); ok {
+			for _, o := range opt.Options {
+				if o.Code == ednsCookie {
+					return o.Data
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cookieResponse returns a successful response to q carrying the
+// COOKIE option data and the extended rcode.
+func cookieResponse(q dnsmessage.Message, data []byte, rcode dnsmessage.RCode) dnsmessage.Message {
+	m, _ := fakeDNSServerSuccessful.rh("", "", q, time.Time{})
+	m.RecursionAvailable = true
+	m.RCode = rcode & 0xF
+	var rh dnsmessage.ResourceHeader
+	rh.SetEDNS0(maxDNSPacketSize, rcode, false)
+	m.Additionals = []dnsmessage.Resource{{
+		Header: rh,
+		Body:   &dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: ednsCookie, Data: data}}},
+	}}
+	return m
+}
+
+func TestDNSCookies(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	serverCookie := []byte("srvcooki")
+
+	var (
+		mu   sync.Mutex
+		sent [][]byte
+	)
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		c := queryCookie(q)
+		mu.Lock()
+		sent = append(sent, c)
+		mu.Unlock()
+		if len(c) < 8 {
+			t.Errorf("query to %s carries cookie %x; want at least a client cookie", s, c)
+			return fakeDNSServerSuccessful.rh("", "", q, time.Time{})
+		}
+		return cookieResponse(q, append(c[:8:8], serverCookie...), dnsmessage.RCodeSuccess), nil
+	}}
+	r := &Resolver{
+		DNSCookies: true,
+		Servers:    []netip.AddrPort{netip.MustParseAddrPort("192.0.2.10:53")},
+		Dial:       fake.DialContext,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.LookupIP(context.Background(), "ip4", "cookie.example.com."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sent) != 2 {
+		t.Fatalf("sent %d queries; want 2", len(sent))
+	}
+	if len(sent[0]) != 8 {
+		t.Errorf("first query sent cookie %x; want only a client cookie", sent[0])
+	}
+	if want := append(sent[0][:8:8], serverCookie...); !bytes.Equal(sent[1], want) {
+		t.Errorf("second query sent cookie %x; want %x", sent[1], want)
+	}
+}
+
+func TestDNSCookiesWrongClientCookie(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		return cookieResponse(q, []byte("notours!srvcooki"), dnsmessage.RCodeSuccess), nil
+	}}
+	r := &Resolver{
+		DNSCookies: true,
+		Servers:    []netip.AddrPort{netip.MustParseAddrPort("192.0.2.11:53")},
+		Dial:       fake.DialContext,
+	}
+	_, err := r.LookupIP(context.Background(), "ip4", "cookie.example.com.")
+	if de, ok := err.(*DNSError); !ok || de.Err != errInvalidDNSResponse.Error() {
+		t.Errorf("LookupIP error = %v; want %v", err, errInvalidDNSResponse)
+	}
+}
+
+func TestDNSCookiesBadCookie(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	serverCookie := []byte("freshsrvcookie00")
+
+	var (
+		mu      sync.Mutex
+		queries int
+	)
+	fake := fakeDNSServer{rh: func(_, _ string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		c := queryCookie(q)
+		mu.Lock()
+		defer mu.Unlock()
+		queries++
+		if !bytes.Equal(c[8:], serverCookie) {
+			// Demand the fresh server cookie.
+			return cookieResponse(q, append(c[:8:8], serverCookie...), rcodeBadCookie), nil
+		}
+		return cookieResponse(q, c, dnsmessage.RCodeSuccess), nil
+	}}
+	r := &Resolver{
+		DNSCookies: true,
+		Servers:    []netip.AddrPort{netip.MustParseAddrPort("192.0.2.12:53")},
+		Dial:       fake.DialContext,
+	}
+	addrs, err := r.LookupIP(context.Background(), "ip4", "cookie.example.com.")
+	if err != nil || len(addrs) != 1 {
+		t.Fatalf("LookupIP = %v, %v; want one address", addrs, err)
+	}
+	if queries != 2 {
+		t.Errorf("sent %d queries; want 2", queries)
+	}
+}
@@ -84,3 +84,51 @@ func BenchmarkDNSName(b *testing.B) {
 		}
 	}
 }
+
+func TestResolverValidName(t *testing.T) {
+	long := strings.Repeat("a", 64)
+	tests := []struct {
+		name                    string
+		def, strict, permissive bool
+	}{
+		{"foo.example.com.", true, true, true},
+		{"_sip._tcp.example.com", true, false, true},
+		{"10-0-0-1", true, true, true},
+		{"foo.123", true, false, true},
+		{"123.com", true, true, true},
+		{"a b.example", false, false, true},
+		{"*.example", false, false, true},
+		{long + ".example", false, false, false},
+		{"a..example", false, false, false},
+		{"-a.example", false, false, true},
+		{".", true, false, true},
+	}
+	for _, tt := range tests {
+		for _, mode := range []struct {
+			r    *Resolver
+			want bool
+		}{
+			{nil, tt.def},
+			{&Resolver{}, tt.def},
+			{&Resolver{NameValidation: NameValidationStrict}, tt.strict},
+			{&Resolver{NameValidation: NameValidationPermissive}, tt.permissive},
+			{&Resolver{ValidateName: func(string) bool { return true }}, tt.permissive},
+		} {
+			if got := mode.r.validName(tt.name); got != mode.want {
+				var m NameValidationMode
+				if mode.r != nil {
+					m = mode.r.NameValidation
+				}
+				t.Errorf("validName(%q) with mode %d = %v; want %v", tt.name, m, got, mode.want)
+			}
+		}
+	}
+
+	r := &Resolver{ValidateName: func(name string) bool { return strings.HasSuffix(name, ".internal.") }}
+	if !r.preferGo() {
+		t.Error("ValidateName does not imply PreferGo")
+	}
+	if !r.validName("db.internal.") || r.validName("db.example.") {
+		t.Error("ValidateName not used")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// DNS NOTIFY: see RFC 1996.
+
+package net
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// opcodeNotify is the opcode of DNS NOTIFY messages.
+const opcodeNotify dnsmessage.OpCode = 4
+
+// A DNSNotify is a DNS NOTIFY message (RFC 1996), by which the primary
+// name server of a zone announces that the zone has changed.
+type DNSNotify struct {
+	// Zone is the name of the zone that changed.
+	Zone string
+
+	// Serial is the new serial number of the zone, if HasSerial is
+	// set. Primaries may omit it.
+	Serial    uint32
+	HasSerial bool
+
+	// From is the address of the sender.
+	From Addr
+
+	// Msg is the message in wire format, for example to verify its
+	// TSIG record (RFC 8945).
+	Msg []byte
+}
+
+// ServeDNSNotify reads DNS NOTIFY messages from c and calls handler for
+// each of them. If handler returns nil, the message is acknowledged;
+// otherwise it is refused, as for an unknown zone or an invalid
+// signature. Other messages are answered with NOTIMP, or ignored if
+// malformed.
+//
+// Handlers are called one at a time, before the acknowledgment is
+// sent, so they should return quickly, for example by starting a zone
+// transfer in another goroutine.
+//
+// ServeDNSNotify returns when reading from c fails, for example
+// because c was closed, with the error.
+func ServeDNSNotify(c PacketConn, handler func(*DNSNotify) error) error {
+	buf := make([]byte, 65535) // largest UDP payload
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		resp, ok := notifyResponse(msg, from, handler)
+		if !ok {
+			continue
+		}
+		// Senders retransmit unacknowledged messages, so there
+		// is nothing to do if the response is lost.
+		c.WriteTo(resp, from)
+	}
+}
+
+// notifyResponse parses the NOTIFY message msg received from from,
+// calls handler for it and returns the response to send. It reports
+// false if msg is not a request that deserves a response.
+func notifyResponse(msg []byte, from Addr, handler func(*DNSNotify) error) ([]byte, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Response {
+		return nil, false
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, false
+	}
+	rh := dnsmessage.Header{ID: h.ID, Response: true, OpCode: h.OpCode, Authoritative: true}
+	switch {
+	case h.OpCode != opcodeNotify:
+		rh.RCode = dnsmessage.RCodeNotImplemented
+	case q.Type != dnsmessage.TypeSOA:
+		rh.RCode = dnsmessage.RCodeFormatError
+	default:
+		n := &DNSNotify{Zone: q.Name.String(), From: from, Msg: msg}
+		if err := p.SkipAllQuestions(); err == nil {
+			for {
+				ah, err := p.AnswerHeader()
+				if err != nil {
+					break
+				}
+				if ah.Type != dnsmessage.TypeSOA {
+					if p.SkipAnswer() != nil {
+						break
+					}
+					continue
+				}
+				if soa, err := p.SOAResource(); err == nil {
+					n.Serial, n.HasSerial = soa.Serial, true
+				}
+				break
+			}
+		}
+		if handler(n) != nil {
+			rh.RCode = dnsmessage.RCodeRefused
+		}
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), rh)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, false
+	}
+	if err := b.Question(q); err != nil {
+		return nil, false
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServeDNSNotify(t *testing.T) {
+	if !testableNetwork("udp") {
+		t.Skip("udp is not supported")
+	}
+	ln := newLocalPacketListener(t, "udp")
+	notifies := make(chan *DNSNotify, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeDNSNotify(ln, func(n *DNSNotify) error {
+			notifies <- n
+			if n.Zone != "example.com." {
+				return errors.New("unknown zone")
+			}
+			return nil
+		})
+	}()
+
+	c, err := Dial(ln.LocalAddr().Network(), ln.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for i, tt := range []struct {
+		zone   string
+		serial bool
+		rcode  dnsmessage.RCode
+	}{
+		{"example.com.", true, dnsmessage.RCodeSuccess},
+		{"example.com.", false, dnsmessage.RCodeSuccess},
+		{"example.org.", false, dnsmessage.RCodeRefused},
+	} {
+		name := dnsmessage.MustNewName(tt.zone)
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: uint16(i), OpCode: opcodeNotify, Authoritative: true},
+			Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}},
+		}
+		if tt.serial {
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.SOAResource{NS: name, MBox: name, Serial: 42},
+			}}
+		}
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Write(b); err != nil {
+			t.Fatal(err)
+		}
+
+		n := <-notifies
+		if n.Zone != tt.zone || n.HasSerial != tt.serial || tt.serial && n.Serial != 42 {
+			t.Errorf("got notify for %s (serial %d, %v); want %s (serial 42, %v)", n.Zone, n.Serial, n.HasSerial, tt.zone, tt.serial)
+		}
+
+		buf := make([]byte, 512)
+		nr, err := c.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:nr]); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Response || resp.ID != uint16(i) || resp.OpCode != opcodeNotify || resp.RCode != tt.rcode {
+			t.Errorf("response header = %+v; want response %d to NOTIFY with %v", resp.Header, i, tt.rcode)
+		}
+	}
+
+	ln.Close()
+	if err := <-done; err == nil {
+		t.Error("ServeDNSNotify returned nil after close; want error")
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// QNAME minimization: see RFC 9156, which obsoletes RFC 7816.
+
+package net
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// maxMinimizedCNAMEs bounds the CNAME records followed by a
+	// minimized lookup, which asks authoritative servers that do not
+	// follow them.
+	maxMinimizedCNAMEs = 8
+
+	// maxMinimizedNS bounds the name servers of a zone whose
+	// addresses are looked up.
+	maxMinimizedNS = 3
+
+	// maxZoneCuts bounds the zone cuts cached per configuration.
+	// zoneCutMaxTTL bounds how long one is kept, and
+	// zoneCutNegativeTTL how long a domain is known not to be a zone.
+	maxZoneCuts        = 1024
+	zoneCutMaxTTL      = time.Hour
+	zoneCutNegativeTTL = 5 * time.Minute
+)
+
+func (r *Resolver) qnameMinimization() bool {
+	return r != nil && r.QNAMEMinimization
+}
+
+// tryMinimized does a lookup for a single name, which must be rooted,
+// as tryOneName does, but without sending name to the servers of cfg:
+// the query goes to the name servers of the zone of name, found by
+// zoneServers. As those servers answer with the CNAME record of an
+// alias rather than with the records it leads to, the lookup moves on
+// to the name the alias stands for, as a recursive server would.
+func (r *Resolver) tryMinimized(ctx context.Context, cfg *dnsConfig, name string, qtype dnsmessage.Type) (dnsmessage.Parser, string, error) {
+	for i := 0; ; i++ {
+		servers, err := r.zoneServers(ctx, cfg, name)
+		if err != nil {
+			return dnsmessage.Parser{}, "", err
+		}
+		p, server, err := r.tryServers(ctx, cfg, servers, name, qtype)
+		if de, ok := err.(*DNSError); !ok || !de.IsNotFound || de.RCode != int(dnsmessage.RCodeSuccess) || qtype == dnsmessage.TypeCNAME || i == maxMinimizedCNAMEs {
+			return p, server, err
+		}
+		// The name exists, but has no records of type qtype.
+		cp, _, cerr := r.tryServers(ctx, cfg, servers, name, dnsmessage.TypeCNAME)
+		if cerr != nil {
+			return p, server, err
+		}
+		c, cerr := cp.CNAMEResource()
+		if cerr != nil {
+			return p, server, err
+		}
+		name = c.CNAME.String()
+	}
+}
+
+// zoneServers returns the addresses of the name servers of the zone
+// that holds name, found without revealing name to the servers of cfg:
+// they are only asked for the NS records of the domains above name, one
+// label at a time from the top-level domain down. The name servers of
+// the closest zone found are then asked whether name is a zone of its
+// own. If no domain above name is a zone, as for top-level domains, the
+// servers of cfg are returned. The zone cuts found are cached in r.
+func (r *Resolver) zoneServers(ctx context.Context, cfg *dnsConfig, name string) ([]string, error) {
+	var zone string
+	var cut zoneCut
+	for i := len(name) - 2; i > 0; i-- {
+		if name[i] != '.' {
+			continue
+		}
+		domain := name[i+1:]
+		c, err := r.forwarderZoneCut(ctx, cfg, domain)
+		if err != nil {
+			if de, ok := err.(*DNSError); ok && de.IsNotFound {
+				// Nor do the names below a domain that does
+				// not exist (RFC 8020).
+				de.Name = name
+			}
+			return nil, err
+		}
+		if c.ns != nil {
+			zone, cut = domain, c
+		}
+	}
+	if zone == "" {
+		return cfg.serversFor(name), nil
+	}
+	servers, err := r.zoneCutServers(ctx, cfg, zone, cut)
+	if err != nil {
+		return nil, err
+	}
+	if child, ok := r.delegation(ctx, cfg, servers, name); ok && child.ns != nil {
+		if childServers, err := r.zoneCutServers(ctx, cfg, name, child); err == nil {
+			servers = childServers
+		}
+	}
+	return servers, nil
+}
+
+// forwarderZoneCut returns the zone cut of domain, asking the servers
+// of cfg for its NS records unless it is cached.
+func (r *Resolver) forwarderZoneCut(ctx context.Context, cfg *dnsConfig, domain string) (zoneCut, error) {
+	if c, ok := r.zoneCuts.get(cfg, domain); ok {
+		return c, nil
+	}
+	c := zoneCut{expires: clockNow().Add(zoneCutNegativeTTL)}
+	p, _, err := r.tryServers(ctx, cfg, cfg.serversFor(domain), domain, dnsmessage.TypeNS)
+	if err != nil {
+		de, ok := err.(*DNSError)
+		if !ok || !de.IsNotFound || de.RCode != int(dnsmessage.RCodeSuccess) {
+			return zoneCut{}, err
+		}
+		// The domain exists, but is not a zone.
+	} else if ns, ttl := answerNSNames(&p); len(ns) > 0 {
+		c = zoneCut{ns: ns, expires: zoneCutExpiry(ttl)}
+	}
+	r.zoneCuts.put(cfg, domain, c)
+	return c, nil
+}
+
+// zoneCutServers returns the addresses of the name servers of the zone
+// cut c of domain, looking them up unless they are cached.
+func (r *Resolver) zoneCutServers(ctx context.Context, cfg *dnsConfig, domain string, c zoneCut) ([]string, error) {
+	if c.servers != nil {
+		return c.servers, nil
+	}
+	servers, err := r.nameServerAddrs(ctx, cfg, c.ns)
+	if err != nil {
+		return nil, err
+	}
+	c.servers = servers
+	r.zoneCuts.put(cfg, domain, c)
+	return servers, nil
+}
+
+// delegation returns the zone cut of name, unless it is cached asking
+// servers, the name servers of the zone above name, for its NS records:
+// it is a zone of its own if they refer to other name servers for it.
+// ok is false if no server answered.
+func (r *Resolver) delegation(ctx context.Context, cfg *dnsConfig, servers []string, name string) (c zoneCut, ok bool) {
+	if c, ok := r.zoneCuts.get(cfg, name); ok {
+		return c, true
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return zoneCut{}, false
+	}
+	q := dnsmessage.Question{Name: n, Type: dnsmessage.TypeNS, Class: dnsmessage.ClassINET}
+	timeout, _ := cfg.queryLimits(ctx)
+	for _, server := range servers {
+		p, h, _, err := r.exchange(ctx, server, q, timeout, cfg.useTCP, cfg.trustAD)
+		if err != nil {
+			continue
+		}
+		c := zoneCut{expires: clockNow().Add(zoneCutNegativeTTL)}
+		// Unless name does not exist or the servers hold its zone
+		// themselves, a referral lists the name servers of the zone
+		// in its authority section.
+		if h.RCode == dnsmessage.RCodeSuccess && !h.Authoritative && p.SkipAllAnswers() == nil {
+			var ns []string
+			ttl := uint32(zoneCutMaxTTL / time.Second)
+			for {
+				ah, err := p.AuthorityHeader()
+				if err != nil {
+					break
+				}
+				if ah.Type != dnsmessage.TypeNS || !equalASCIIName(ah.Name, n) {
+					if p.SkipAuthority() != nil {
+						break
+					}
+					continue
+				}
+				rr, err := p.NSResource()
+				if err != nil {
+					break
+				}
+				ns = append(ns, rr.NS.String())
+				if ah.TTL < ttl {
+					ttl = ah.TTL
+				}
+			}
+			if len(ns) > 0 {
+				c = zoneCut{ns: ns, expires: zoneCutExpiry(ttl)}
+			}
+		}
+		r.zoneCuts.put(cfg, name, c)
+		return c, true
+	}
+	return zoneCut{}, false
+}
+
+// zoneCutExpiry returns when a zone cut whose NS records have the given
+// TTL expires.
+func zoneCutExpiry(ttl uint32) time.Time {
+	d := time.Duration(ttl) * time.Second
+	if d > zoneCutMaxTTL {
+		d = zoneCutMaxTTL
+	}
+	return clockNow().Add(d)
+}
+
+// get returns the zone cut of domain found with cfg, if it is cached
+// and has not expired.
+func (zc *zoneCutCache) get(cfg *dnsConfig, domain string) (zoneCut, bool) {
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	c, ok := zc.m[domain]
+	if !ok || zc.conf != cfg || !clockNow().Before(c.expires) {
+		return zoneCut{}, false
+	}
+	return c, true
+}
+
+// put caches c as the zone cut of domain found with cfg, dropping
+// those found with another configuration. Once maxZoneCuts are cached,
+// the expired ones are dropped to make room, and then arbitrary ones.
+func (zc *zoneCutCache) put(cfg *dnsConfig, domain string, c zoneCut) {
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	if zc.conf != cfg {
+		zc.conf, zc.m = cfg, nil
+	}
+	if zc.m == nil {
+		zc.m = make(map[string]zoneCut)
+	}
+	if _, ok := zc.m[domain]; !ok && len(zc.m) >= maxZoneCuts {
+		now := clockNow()
+		for d, old := range zc.m {
+			if !now.Before(old.expires) {
+				delete(zc.m, d)
+			}
+		}
+		for d := range zc.m {
+			if len(zc.m) < maxZoneCuts {
+				break
+			}
+			delete(zc.m, d)
+		}
+	}
+	zc.m[domain] = c
+}
+
+// answerNSNames returns the names of the name servers in the NS
+// records of the answer section of p, and the lowest of their TTLs.
+func answerNSNames(p *dnsmessage.Parser) (ns []string, ttl uint32) {
+	ttl = uint32(zoneCutMaxTTL / time.Second)
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return ns, ttl
+		}
+		if h.Type != dnsmessage.TypeNS {
+			if p.SkipAnswer() != nil {
+				return ns, ttl
+			}
+			continue
+		}
+		rr, err := p.NSResource()
+		if err != nil {
+			return ns, ttl
+		}
+		ns = append(ns, rr.NS.String())
+		if h.TTL < ttl {
+			ttl = h.TTL
+		}
+	}
+}
+
+// nameServerAddrs looks up the addresses of the name servers named ns,
+// at most maxMinimizedNS of them, with the servers of cfg, and returns
+// them in host:port form, those of IPv4 first.
+func (r *Resolver) nameServerAddrs(ctx context.Context, cfg *dnsConfig, ns []string) ([]string, error) {
+	if len(ns) > maxMinimizedNS {
+		ns = ns[:maxMinimizedNS]
+	}
+	var servers []string
+	var lastErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		for _, name := range ns {
+			p, _, err := r.tryServers(ctx, cfg, cfg.serversFor(name), name, qtype)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			servers = appendAnswerServers(servers, &p)
+		}
+	}
+	if len(servers) > 0 {
+		return servers, nil
+	}
+	if lastErr == nil {
+		lastErr = &DNSError{Err: "no address for name server", Name: ns[0]}
+	}
+	return nil, lastErr
+}
+
+// appendAnswerServers appends to servers the addresses in the A and
+// AAAA records of the answer section of p, in host:port form.
+func appendAnswerServers(servers []string, p *dnsmessage.Parser) []string {
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return servers
+		}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return servers
+			}
+			servers = append(servers, JoinHostPort(IP(a.A[:]).String(), "53"))
+		case dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return servers
+			}
+			servers = append(servers, JoinHostPort(IP(aaaa.AAAA[:]).String(), "53"))
+		default:
+			if p.SkipAnswer() != nil {
+				return servers
+			}
+		}
+	}
+}
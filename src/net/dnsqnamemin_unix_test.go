@@ -0,0 +1,147 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package net
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestQNAMEMinimization(t *testing.T) {
+	rr := func(name string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   body,
+		}
+	}
+	ns := func(name, target string) dnsmessage.Resource {
+		return rr(name, &dnsmessage.NSResource{NS: dnsmessage.MustNewName(target)})
+	}
+	a := func(name string, ip [4]byte) dnsmessage.Resource {
+		return rr(name, &dnsmessage.AResource{A: ip})
+	}
+	cname := rr("alias.example.com.", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("www.dept.example.com.")})
+
+	// The forwarder, 192.0.2.53, knows that com. and example.com. are
+	// zones, and where the name servers of the zones are. The name
+	// servers of example.com. and of sub.example.com., which it
+	// delegates, answer for their own zones.
+	zones := map[string]map[string][]dnsmessage.Resource{
+		"192.0.2.53:53": {
+			"com./NS":               {ns("com.", "ns.com-servers.net.")},
+			"example.com./NS":       {ns("example.com.", "ns1.example.net.")},
+			"ns1.example.net./A":    {a("ns1.example.net.", [4]byte{192, 0, 2, 20})},
+			"ns.sub.example.net./A": {a("ns.sub.example.net.", [4]byte{192, 0, 2, 30})},
+		},
+		"192.0.2.20:53": {
+			"www.dept.example.com./A":  {a("www.dept.example.com.", [4]byte{192, 0, 2, 100})},
+			"alias.example.com./A":     {cname},
+			"alias.example.com./CNAME": {cname},
+		},
+		"192.0.2.30:53": {
+			"sub.example.com./A": {a("sub.example.com.", [4]byte{192, 0, 2, 101})},
+		},
+	}
+	var mu sync.Mutex
+	var forwarded []string
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		name := q.Questions[0].Name.String()
+		key := name + "/" + q.Questions[0].Type.String()[len("Type"):]
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true},
+			Questions: q.Questions,
+		}
+		zone, ok := zones[s]
+		if !ok {
+			t.Errorf("query for %s sent to %s", key, s)
+			resp.RCode = dnsmessage.RCodeRefused
+			return resp, nil
+		}
+		switch {
+		case s == "192.0.2.53:53":
+			mu.Lock()
+			forwarded = append(forwarded, name)
+			mu.Unlock()
+			resp.RecursionAvailable = true
+			if name == "nowhere.example.com." {
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+		case s == "192.0.2.20:53" && key == "sub.example.com./NS":
+			// A referral to the name servers of sub.example.com.
+			resp.Authorities = []dnsmessage.Resource{ns("sub.example.com.", "ns.sub.example.net.")}
+			return resp, nil
+		default:
+			resp.Authoritative = true
+		}
+		resp.Answers = zone[key]
+		return resp, nil
+	}}
+	r := &Resolver{
+		QNAMEMinimization: true,
+		Servers:           []netip.AddrPort{netip.MustParseAddrPort("192.0.2.53:53")},
+		Dial:              fake.DialContext,
+	}
+	if !r.preferGo() {
+		t.Error("QNAMEMinimization does not imply PreferGo")
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"www.dept.example.com.", []string{"192.0.2.100"}},
+		{"alias.example.com.", []string{"192.0.2.100"}},
+		{"sub.example.com.", []string{"192.0.2.101"}},
+	}
+	for _, tt := range tests {
+		addrs, err := r.LookupHost(ctx, tt.name)
+		if err != nil || !reflect.DeepEqual(addrs, tt.want) {
+			t.Errorf("LookupHost(%q) = %v, %v; want %v", tt.name, addrs, err, tt.want)
+		}
+	}
+
+	// The zone cuts found are cached, so that looking the names up
+	// again does not ask the forwarder anything.
+	mu.Lock()
+	n := len(forwarded)
+	mu.Unlock()
+	for _, tt := range tests {
+		addrs, err := r.LookupHost(ctx, tt.name)
+		if err != nil || !reflect.DeepEqual(addrs, tt.want) {
+			t.Errorf("LookupHost(%q) again = %v, %v; want %v", tt.name, addrs, err, tt.want)
+		}
+	}
+	mu.Lock()
+	if again := forwarded[n:]; len(again) > 0 {
+		t.Errorf("looking the names up again sent %v to the forwarder; want nothing", again)
+	}
+	mu.Unlock()
+	_, err := r.LookupHost(ctx, "x.nowhere.example.com.")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("LookupHost(x.nowhere.example.com.) error = %v; want not found", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range forwarded {
+		for _, tt := range tests {
+			if name == tt.name {
+				t.Errorf("%s sent to the forwarder", name)
+			}
+		}
+		if name == "x.nowhere.example.com." {
+			t.Errorf("%s sent to the forwarder", name)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Name resolution through a SOCKS5 proxy, with the RESOLVE and
+// RESOLVE_PTR commands that Tor adds to SOCKS5 (RFC 1928): see
+// socks-extensions.txt in the Tor specifications.
+
+package net
+
+import (
+	"context"
+	"errors"
+	"internal/itoa"
+	"io"
+	"net/netip"
+	"time"
+)
+
+const (
+	socks5Version = 5
+
+	socks5AuthNone = 0x00
+
+	socks5CmdResolve    = 0xf0
+	socks5CmdResolvePTR = 0xf1
+
+	socks5AddrIPv4   = 1
+	socks5AddrDomain = 3
+	socks5AddrIPv6   = 4
+
+	socks5ReplySucceeded       = 0
+	socks5ReplyHostUnreachable = 4 // what Tor replies for names that do not exist
+
+	// socks5Timeout bounds a lookup through the proxy when the
+	// context has no deadline. Resolving over Tor takes a few
+	// round trips across the network.
+	socks5Timeout = 30 * time.Second
+)
+
+// errSOCKS5Unsupported is returned by the lookups that cannot be made
+// through a SOCKS5 proxy.
+var errSOCKS5Unsupported = errors.New("lookup not supported through a SOCKS5 proxy")
+
+var errSOCKS5InvalidReply = errors.New("invalid SOCKS5 reply")
+
+var socks5Replies = [...]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5 reports whether r resolves names through a SOCKS5 proxy.
+func (r *Resolver) socks5() bool {
+	return r != nil && r.SOCKS5Proxy != ""
+}
+
+// socks5Unsupported returns the error of a lookup for name that cannot
+// be made through the SOCKS5 proxy of r.
+func (r *Resolver) socks5Unsupported(name string) error {
+	return &DNSError{Err: errSOCKS5Unsupported.Error(), Name: name, Server: r.SOCKS5Proxy, UnwrapErr: errSOCKS5Unsupported}
+}
+
+// socks5LookupIP asks the SOCKS5 proxy of r for the address of host.
+// The proxy returns a single address, of either family.
+func (r *Resolver) socks5LookupIP(ctx context.Context, network, host string) ([]IPAddr, error) {
+	if len(host) > 255 {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+	}
+	req := append([]byte{socks5AddrDomain, byte(len(host))}, host...)
+	atyp, addr, err := r.socks5RoundTrip(ctx, socks5CmdResolve, req)
+	if err != nil {
+		return nil, r.socks5Error(host, err)
+	}
+	var ip IP
+	switch atyp {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip = IP(addr)
+	default:
+		return nil, r.socks5Error(host, errSOCKS5InvalidReply)
+	}
+	switch ipVersion(network) {
+	case '4':
+		if ip.To4() == nil {
+			return nil, r.socks5Error(host, errNoSuchHost)
+		}
+	case '6':
+		if ip.To4() != nil {
+			return nil, r.socks5Error(host, errNoSuchHost)
+		}
+	}
+	return []IPAddr{{IP: ip}}, nil
+}
+
+// socks5LookupAddr asks the SOCKS5 proxy of r for the name of addr.
+func (r *Resolver) socks5LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, &DNSError{Err: "unrecognized address", Name: addr}
+	}
+	var req []byte
+	if ip.Is4() {
+		a := ip.As4()
+		req = append([]byte{socks5AddrIPv4}, a[:]...)
+	} else {
+		a := ip.As16()
+		req = append([]byte{socks5AddrIPv6}, a[:]...)
+	}
+	atyp, name, err := r.socks5RoundTrip(ctx, socks5CmdResolvePTR, req)
+	if err != nil {
+		return nil, r.socks5Error(addr, err)
+	}
+	if atyp != socks5AddrDomain {
+		return nil, r.socks5Error(addr, errSOCKS5InvalidReply)
+	}
+	return []string{absDomainName(string(name))}, nil
+}
+
+// socks5Error returns the DNSError for a lookup for name that failed
+// with err.
+func (r *Resolver) socks5Error(name string, err error) error {
+	if err == errNoSuchHost {
+		return &DNSError{Err: err.Error(), Name: name, Server: r.SOCKS5Proxy, IsNotFound: true, UnwrapErr: err}
+	}
+	return &DNSError{
+		Err:         err.Error(),
+		Name:        name,
+		Server:      r.SOCKS5Proxy,
+		IsTimeout:   isTimeoutError(err),
+		IsTemporary: err != errSOCKS5InvalidReply,
+		UnwrapErr:   err,
+	}
+}
+
+// isTimeoutError reports whether err is a timeout.
+func isTimeoutError(err error) bool {
+	t, ok := err.(timeout)
+	return ok && t.Timeout()
+}
+
+// socks5RoundTrip sends the request cmd for the address req, which
+// starts with its address type, to the SOCKS5 proxy of r, and returns
+// the address type and address of the reply.
+func (r *Resolver) socks5RoundTrip(ctx context.Context, cmd byte, req []byte) (atyp byte, addr []byte, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, socks5Timeout)
+		defer cancel()
+	}
+	release, err := r.acquireQuerySlot(ctx)
+	if err != nil {
+		return 0, nil, mapErr(err)
+	}
+	defer release()
+	c, err := r.dial(ctx, "tcp", r.SOCKS5Proxy)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer c.Close()
+	if d, ok := ctx.Deadline(); ok {
+		c.SetDeadline(d)
+	}
+	// Unblock the reads and writes below when ctx is canceled.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = mapErr(ctx.Err())
+		}
+	}()
+
+	// Offer no authentication, the only method supported.
+	msg := []byte{socks5Version, 1, socks5AuthNone}
+	msg = append(msg, socks5Version, cmd, 0)
+	msg = append(msg, req...)
+	msg = append(msg, 0, 0) // port
+	var b [4]byte
+	if _, err := c.Write(msg[:3]); err != nil {
+		return 0, nil, err
+	}
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return 0, nil, err
+	}
+	if b[0] != socks5Version {
+		return 0, nil, errors.New("unexpected SOCKS protocol version " + itoa.Itoa(int(b[0])))
+	}
+	if b[1] != socks5AuthNone {
+		return 0, nil, errors.New("SOCKS5 proxy requires authentication")
+	}
+	if _, err := c.Write(msg[3:]); err != nil {
+		return 0, nil, err
+	}
+	if _, err := io.ReadFull(c, b[:4]); err != nil {
+		return 0, nil, err
+	}
+	if b[0] != socks5Version {
+		return 0, nil, errors.New("unexpected SOCKS protocol version " + itoa.Itoa(int(b[0])))
+	}
+	switch rep := b[1]; {
+	case rep == socks5ReplySucceeded:
+	case rep == socks5ReplyHostUnreachable:
+		return 0, nil, errNoSuchHost
+	case int(rep) < len(socks5Replies):
+		return 0, nil, errors.New(socks5Replies[rep])
+	default:
+		return 0, nil, errors.New("unknown SOCKS5 reply " + itoa.Itoa(int(rep)))
+	}
+	atyp = b[3]
+	var n int
+	switch atyp {
+	case socks5AddrIPv4:
+		n = IPv4len
+	case socks5AddrIPv6:
+		n = IPv6len
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(c, b[:1]); err != nil {
+			return 0, nil, err
+		}
+		n = int(b[0])
+	default:
+		return 0, nil, errSOCKS5InvalidReply
+	}
+	addr = make([]byte, n+2) // with the port
+	if _, err := io.ReadFull(c, addr); err != nil {
+		return 0, nil, err
+	}
+	return atyp, addr[:n], nil
+}
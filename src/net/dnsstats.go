@@ -0,0 +1,104 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DNSStats holds counters of the work done by the resolvers of the
+// process since it started. It is meant for monitoring: for example,
+// it may be published with expvar.Func(func() any { return net.ReadDNSStats() }).
+type DNSStats struct {
+	// Queries is the number of DNS queries sent by Go's resolver,
+	// retries included.
+	Queries uint64
+
+	// Retries is the number of queries sent again, to the same or
+	// another server, after an earlier query for the same name
+	// and type failed.
+	Retries uint64
+
+	// TCPFallbacks is the number of queries sent again over TCP
+	// because the UDP response was truncated.
+	TCPFallbacks uint64
+
+	// CgoFallbacks is the number of lookups that failed in Go's
+	// resolver and were tried again with the native one.
+	CgoFallbacks uint64
+
+	// HostsCacheHits and HostsCacheMisses count the lookups that
+	// used the cached contents of the hosts file, and those that had
+	// to read the file again.
+	HostsCacheHits   uint64
+	HostsCacheMisses uint64
+
+	// Servers holds the counters of each DNS server queried,
+	// keyed by its address.
+	Servers map[string]DNSServerStats
+}
+
+// DNSServerStats holds the counters of a single DNS server.
+type DNSServerStats struct {
+	// Queries is the number of queries sent to the server.
+	Queries uint64
+
+	// Errors is the number of those queries that failed with a
+	// network error, a timeout, or a response reporting a failure
+	// other than a nonexistent name.
+	Errors uint64
+}
+
+// dnsStats holds the counters returned by ReadDNSStats.
+var dnsStats struct {
+	queries          atomic.Uint64
+	retries          atomic.Uint64
+	tcpFallbacks     atomic.Uint64
+	cgoFallbacks     atomic.Uint64
+	hostsCacheHits   atomic.Uint64
+	hostsCacheMisses atomic.Uint64
+
+	mu      sync.Mutex
+	servers map[string]*DNSServerStats // guarded by mu
+}
+
+// ReadDNSStats returns a snapshot of the resolver counters.
+func ReadDNSStats() DNSStats {
+	s := DNSStats{
+		Queries:          dnsStats.queries.Load(),
+		Retries:          dnsStats.retries.Load(),
+		TCPFallbacks:     dnsStats.tcpFallbacks.Load(),
+		CgoFallbacks:     dnsStats.cgoFallbacks.Load(),
+		HostsCacheHits:   dnsStats.hostsCacheHits.Load(),
+		HostsCacheMisses: dnsStats.hostsCacheMisses.Load(),
+		Servers:          make(map[string]DNSServerStats),
+	}
+	dnsStats.mu.Lock()
+	for server, ss := range dnsStats.servers {
+		s.Servers[server] = *ss
+	}
+	dnsStats.mu.Unlock()
+	return s
+}
+
+// countServerQuery counts a query sent to server, and an error if
+// failed is set.
+func countServerQuery(server string, failed bool) {
+	dnsStats.mu.Lock()
+	defer dnsStats.mu.Unlock()
+	if dnsStats.servers == nil {
+		dnsStats.servers = make(map[string]*DNSServerStats)
+	}
+	ss := dnsStats.servers[server]
+	if ss == nil {
+		ss = new(DNSServerStats)
+		dnsStats.servers[server] = ss
+	}
+	ss.Queries++
+	if failed {
+		ss.Errors++
+	}
+}
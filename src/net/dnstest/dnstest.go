@@ -0,0 +1,224 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dnstest provides utilities for testing code that looks up
+// names in the DNS, without touching the network.
+package dnstest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCNAMEs is the length of the chains of CNAME records that a Server
+// follows in its answers.
+const maxCNAMEs = 8
+
+// A Server answers DNS queries in-process from the records of a zone,
+// as an authoritative server for it would. It serves the Resolvers
+// returned by its Resolver method, and is safe for concurrent use.
+//
+// Names without records of their own but with records below them,
+// such as "example.com." when only "www.example.com." has records,
+// exist without data. Other names do not exist. CNAME records are
+// followed within the zone. Wildcard records and DNSSEC are not
+// supported.
+type Server struct {
+	records map[string][]dnsmessage.Resource // by lower-cased owner name
+	names   map[string]bool                  // owner names and their ancestors, lower cased
+}
+
+// NewServer returns a Server answering from zone, the text of a zone
+// file in the master file format of RFC 1035, as in
+//
+//	$ORIGIN example.com.
+//	$TTL 300
+//	@	IN SOA ns1 hostmaster 1 7200 900 1209600 300
+//	www	IN A 192.0.2.1
+//		IN AAAA 2001:db8::1
+//	mail	IN MX 10 mx.example.net.
+//
+// Records of types A, AAAA, CNAME, MX, NS, PTR, SOA, SRV and TXT are
+// supported, as are the $ORIGIN and $TTL directives, but not
+// $INCLUDE. Records of class other than IN are not supported.
+func NewServer(zone string) (*Server, error) {
+	rrs, err := parseZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		records: make(map[string][]dnsmessage.Resource),
+		names:   map[string]bool{".": true},
+	}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header.Name.String())
+		s.records[name] = append(s.records[name], rr)
+		for ; name != "."; name = parent(name) {
+			s.names[name] = true
+		}
+	}
+	return s, nil
+}
+
+// NewServerFromMap returns a Server answering from records, which maps
+// absolute domain names to their records, each in the format of a line
+// of a zone file without the owner name, as in
+//
+//	map[string][]string{
+//		"www.example.com.": {"A 192.0.2.1", "AAAA 2001:db8::1"},
+//		"example.com.":     {"MX 10 mail.example.com."},
+//	}
+//
+// Names in the records must be absolute. See NewServer for the
+// supported record types.
+func NewServerFromMap(records map[string][]string) (*Server, error) {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var zone strings.Builder
+	for _, name := range names {
+		for _, rr := range records[name] {
+			zone.WriteString(name)
+			zone.WriteByte(' ')
+			zone.WriteString(rr)
+			zone.WriteByte('\n')
+		}
+	}
+	return NewServer(zone.String())
+}
+
+// Resolver returns a Resolver that sends its queries to s. It uses Go's
+// built-in DNS resolver, without the search list of the system, so
+// that names are looked up as they are given. The hosts file of the
+// system is still consulted first, and names such as "localhost" are
+// still resolved without any query.
+func (s *Server) Resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		NoSearch: true,
+		Dial:     s.dial,
+	}
+}
+
+// dial returns a connection to s over which a Resolver sends its
+// queries, in the framing of DNS over TCP whatever network it asks for.
+func (s *Server) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	c, sc := net.Pipe()
+	go s.serve(sc)
+	return c, nil
+}
+
+// serve answers the queries sent over c until it is closed.
+func (s *Server) serve(c net.Conn) {
+	defer c.Close()
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(c, hdr[:]); err != nil {
+			return
+		}
+		b := make([]byte, int(hdr[0])<<8|int(hdr[1]))
+		if _, err := io.ReadFull(c, b); err != nil {
+			return
+		}
+		var q dnsmessage.Message
+		if err := q.Unpack(b); err != nil {
+			return
+		}
+		r := s.answer(q)
+		resp, err := r.AppendPack([]byte{0, 0})
+		if err != nil {
+			return
+		}
+		l := len(resp) - 2
+		resp[0], resp[1] = byte(l>>8), byte(l)
+		if _, err := c.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response of s to query q.
+func (s *Server) answer(q dnsmessage.Message) dnsmessage.Message {
+	r := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   q.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: q.Questions,
+	}
+	if q.OpCode != 0 || len(q.Questions) != 1 {
+		r.RCode = dnsmessage.RCodeNotImplemented
+		return r
+	}
+	question := q.Questions[0]
+	if question.Class != dnsmessage.ClassINET {
+		r.RCode = dnsmessage.RCodeRefused
+		return r
+	}
+	name := question.Name
+	for i := 0; ; i++ {
+		rrs := s.records[strings.ToLower(name.String())]
+		var cname *dnsmessage.Resource
+		found := false
+		for _, rr := range rrs {
+			switch {
+			case rr.Header.Type == question.Type || question.Type == dnsmessage.TypeALL:
+				rr.Header.Name = name
+				r.Answers = append(r.Answers, rr)
+				found = true
+			case rr.Header.Type == dnsmessage.TypeCNAME:
+				rr := rr
+				cname = &rr
+			}
+		}
+		if found || cname == nil || i == maxCNAMEs {
+			break
+		}
+		cname.Header.Name = name
+		r.Answers = append(r.Answers, *cname)
+		name = cname.Body.(*dnsmessage.CNAMEResource).CNAME
+	}
+	if len(r.Answers) == 0 || r.Answers[len(r.Answers)-1].Header.Type == dnsmessage.TypeCNAME {
+		if !s.names[strings.ToLower(name.String())] && len(r.Answers) == 0 {
+			r.RCode = dnsmessage.RCodeNameError
+		}
+		if soa, ok := s.soa(name.String()); ok {
+			r.Authorities = append(r.Authorities, soa)
+		}
+	}
+	return r
+}
+
+// soa returns the SOA record of the zone holding name, if any.
+func (s *Server) soa(name string) (dnsmessage.Resource, bool) {
+	for name = strings.ToLower(name); ; name = parent(name) {
+		for _, rr := range s.records[name] {
+			if rr.Header.Type == dnsmessage.TypeSOA {
+				return rr, true
+			}
+		}
+		if name == "." {
+			return dnsmessage.Resource{}, false
+		}
+	}
+}
+
+// parent returns the parent domain of the absolute name, which must not
+// be the root.
+func parent(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 && i+1 < len(name) {
+		return name[i+1:]
+	}
+	return "."
+}
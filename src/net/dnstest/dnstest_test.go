@@ -0,0 +1,159 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnstest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const testZone = `
+$ORIGIN example.com.
+$TTL 300
+@	IN SOA ns1 hostmaster (
+		2022010101 ; serial
+		7200 900 1209600 300 )
+	IN NS ns1
+	IN MX 10 mail
+	IN TXT "v=spf1 -all" "second \"string\""
+ns1	IN A 192.0.2.53
+www	600 IN A 192.0.2.1
+	IN AAAA 2001:db8::1
+alias	IN CNAME www
+mail	IN A 192.0.2.25
+_ldap._tcp	IN SRV 0 5 389 ldap.example.net.
+host.sub	IN A 192.0.2.2
+`
+
+func TestServer(t *testing.T) {
+	s, err := NewServer(testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s.Resolver()
+	ctx := context.Background()
+
+	addrs, err := r.LookupHost(ctx, "www.example.com")
+	sort.Strings(addrs)
+	if want := []string{"192.0.2.1", "2001:db8::1"}; err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Errorf("LookupHost(www.example.com) = %v, %v; want %v", addrs, err, want)
+	}
+	addrs, err = r.LookupHost(ctx, "ALIAS.example.com")
+	sort.Strings(addrs)
+	if want := []string{"192.0.2.1", "2001:db8::1"}; err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Errorf("LookupHost(ALIAS.example.com) = %v, %v; want %v", addrs, err, want)
+	}
+	if cname, err := r.LookupCNAME(ctx, "alias.example.com"); err != nil || cname != "www.example.com." {
+		t.Errorf("LookupCNAME(alias.example.com) = %q, %v; want www.example.com.", cname, err)
+	}
+	if mxs, err := r.LookupMX(ctx, "example.com"); err != nil || len(mxs) != 1 || *mxs[0] != (net.MX{Host: "mail.example.com.", Pref: 10}) {
+		t.Errorf("LookupMX(example.com) = %v, %v; want mail.example.com. 10", mxs, err)
+	}
+	if txts, err := r.LookupTXT(ctx, "example.com"); err != nil || !reflect.DeepEqual(txts, []string{"v=spf1 -allsecond \"string\""}) {
+		t.Errorf("LookupTXT(example.com) = %q, %v", txts, err)
+	}
+	if _, srvs, err := r.LookupSRV(ctx, "ldap", "tcp", "example.com"); err != nil || len(srvs) != 1 || *srvs[0] != (net.SRV{Target: "ldap.example.net.", Port: 389, Weight: 5}) {
+		t.Errorf("LookupSRV(ldap, tcp, example.com) = %v, %v", srvs, err)
+	}
+
+	for _, name := range []string{"missing.example.com", "sub.example.com", "www.example.org"} {
+		addrs, err := r.LookupHost(ctx, name)
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("LookupHost(%s) = %v, %v; want not found", name, addrs, err)
+		}
+	}
+}
+
+func TestServerAnswer(t *testing.T) {
+	s, err := NewServer(testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		typ     dnsmessage.Type
+		rcode   dnsmessage.RCode
+		answers int
+		soa     bool
+	}{
+		{"www.example.com.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, 1, false},
+		{"alias.example.com.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, 2, false},
+		{"alias.example.com.", dnsmessage.TypeMX, dnsmessage.RCodeSuccess, 1, true},
+		{"sub.example.com.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, 0, true},
+		{"missing.example.com.", dnsmessage.TypeA, dnsmessage.RCodeNameError, 0, true},
+		{"example.org.", dnsmessage.TypeA, dnsmessage.RCodeNameError, 0, false},
+	}
+	for _, tt := range tests {
+		q := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(tt.name), Type: tt.typ, Class: dnsmessage.ClassINET}}}
+		r := s.answer(q)
+		if r.RCode != tt.rcode || len(r.Answers) != tt.answers || (len(r.Authorities) == 1) != tt.soa {
+			t.Errorf("%s %v: rcode %v, %d answers, %d authorities; want %v, %d answers, SOA %v", tt.name, tt.typ, r.RCode, len(r.Answers), len(r.Authorities), tt.rcode, tt.answers, tt.soa)
+		}
+	}
+}
+
+func TestNewServerFromMap(t *testing.T) {
+	s, err := NewServerFromMap(map[string][]string{
+		"db.internal.":  {"A 10.0.0.5", "AAAA fd00::5"},
+		"api.internal.": {"CNAME db.internal."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := s.Resolver().LookupNetIP(context.Background(), "ip4", "api.internal")
+	if err != nil || len(ips) != 1 || ips[0].Unmap().String() != "10.0.0.5" {
+		t.Errorf("LookupNetIP(ip4, api.internal) = %v, %v; want [10.0.0.5]", ips, err)
+	}
+
+	if _, err := NewServerFromMap(map[string][]string{"bad.internal.": {"A 2001:db8::1"}}); err == nil {
+		t.Error("NewServerFromMap accepted an IPv6 address in an A record")
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	rrs, err := parseZone(testZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 11 {
+		t.Fatalf("got %d records; want 11", len(rrs))
+	}
+	soa, ok := rrs[0].Body.(*dnsmessage.SOAResource)
+	if !ok || rrs[0].Header.Name.String() != "example.com." || soa.Serial != 2022010101 || soa.MinTTL != 300 || soa.MBox.String() != "hostmaster.example.com." {
+		t.Errorf("SOA record = %v", rrs[0])
+	}
+	if h := rrs[5].Header; h.Name.String() != "www.example.com." || h.Type != dnsmessage.TypeA || h.TTL != 600 {
+		t.Errorf("www A record header = %v", h)
+	}
+	if h := rrs[6].Header; h.Name.String() != "www.example.com." || h.Type != dnsmessage.TypeAAAA || h.TTL != 300 {
+		t.Errorf("www AAAA record header = %v", h)
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	for _, zone := range []string{
+		"www A 192.0.2.1\n",                    // relative name without $ORIGIN
+		"www.example. A 192.0.2.1 192.0.2.2\n", // too many fields
+		"www.example. A 2001:db8::1\n",         // not IPv4
+		"www.example. AAAA 192.0.2.1\n",        // not IPv6
+		"www.example. MX mail.example.\n",      // no preference
+		"www.example. HINFO cpu os\n",          // unsupported type
+		"www.example. TXT \"unterminated\n",    // unterminated string
+		"example. SOA ns. mbox. ( 1 2 3 4 5\n", // unbalanced parenthesis
+		"$INCLUDE other.zone\n",                // unsupported directive
+		"\tA 192.0.2.1\n",                      // no owner
+	} {
+		if _, err := parseZone(zone); err == nil {
+			t.Errorf("parseZone(%q) succeeded; want error", zone)
+		}
+	}
+}
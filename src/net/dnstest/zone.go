@@ -0,0 +1,348 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnstest
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// types maps the names of the supported record types to their types.
+var types = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// defaultTTL is the TTL of the records of a zone that gives none,
+// neither with the records nor with a $TTL directive.
+const defaultTTL = 3600
+
+// A token is a field of an entry of a zone file.
+type token struct {
+	text   string
+	quoted bool // a "character-string" in quotes
+}
+
+// An entry is a logical line of a zone file, which parentheses may
+// spread over several lines.
+type entry struct {
+	line   int     // the line on which the entry starts
+	blank  bool    // the entry starts with a space, leaving the owner out
+	tokens []token // the fields of the entry
+}
+
+// splitEntries splits the text of a zone file into its entries,
+// dropping comments and blank lines.
+func splitEntries(zone string) ([]entry, error) {
+	var entries []entry
+	var e entry
+	var tok strings.Builder
+	inToken, quoted := false, false
+	depth := 0
+	line := 1
+	e.line = line
+	endToken := func() {
+		if inToken {
+			e.tokens = append(e.tokens, token{text: tok.String(), quoted: quoted})
+			tok.Reset()
+			inToken, quoted = false, false
+		}
+	}
+	endEntry := func() {
+		if len(e.tokens) > 0 {
+			entries = append(entries, e)
+		}
+		e = entry{line: line}
+	}
+	for i := 0; i < len(zone); i++ {
+		c := zone[i]
+		switch {
+		case quoted && c == '"':
+			e.tokens = append(e.tokens, token{text: tok.String(), quoted: true})
+			tok.Reset()
+			inToken, quoted = false, false
+		case quoted && c == '\\' && i+1 < len(zone):
+			i++
+			tok.WriteByte(zone[i])
+		case quoted:
+			if c == '\n' {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+			}
+			tok.WriteByte(c)
+		case c == '"':
+			endToken()
+			inToken, quoted = true, true
+		case c == ';':
+			for i+1 < len(zone) && zone[i+1] != '\n' {
+				i++
+			}
+		case c == '(':
+			endToken()
+			depth++
+		case c == ')':
+			endToken()
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parenthesis", line)
+			}
+			depth--
+		case c == '\n':
+			endToken()
+			line++
+			if depth == 0 {
+				endEntry()
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+			if len(e.tokens) == 0 && !inToken && e.line == line && (i == 0 || zone[i-1] == '\n') {
+				e.blank = true
+			}
+			endToken()
+		default:
+			inToken = true
+			tok.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parenthesis", line)
+	}
+	endToken()
+	endEntry()
+	return entries, nil
+}
+
+// parseZone parses a zone file in the master file format of RFC 1035,
+// section 5.
+func parseZone(zone string) ([]dnsmessage.Resource, error) {
+	entries, err := splitEntries(zone)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dnsmessage.Resource
+	origin := ""
+	ttl, haveTTL := uint32(defaultTTL), false
+	owner := ""
+	for _, e := range entries {
+		f := e.tokens
+		switch strings.ToUpper(f[0].text) {
+		case "$ORIGIN":
+			if len(f) != 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN takes a domain name", e.line)
+			}
+			if origin, err = absName(f[1].text, origin); err != nil {
+				return nil, fmt.Errorf("line %d: %v", e.line, err)
+			}
+			continue
+		case "$TTL":
+			if len(f) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL takes a TTL", e.line)
+			}
+			if ttl, err = parseUint32(f[1].text); err != nil {
+				return nil, fmt.Errorf("line %d: %v", e.line, err)
+			}
+			haveTTL = true
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("line %d: %s is not supported", e.line, f[0].text)
+		}
+
+		if !e.blank {
+			if f[0].text == "@" {
+				if origin == "" {
+					return nil, fmt.Errorf("line %d: @ without $ORIGIN", e.line)
+				}
+				owner = origin
+			} else if owner, err = absName(f[0].text, origin); err != nil {
+				return nil, fmt.Errorf("line %d: %v", e.line, err)
+			}
+			f = f[1:]
+		} else if owner == "" {
+			return nil, fmt.Errorf("line %d: no owner name", e.line)
+		}
+
+		// The TTL and class, both optional, come in either order.
+		// Without $TTL, a record's TTL is that of the record before.
+		rrTTL, explicitTTL := ttl, false
+		for i := 0; i < 2 && len(f) > 0; i++ {
+			if strings.EqualFold(f[0].text, "IN") {
+				f = f[1:]
+			} else if n, err := parseUint32(f[0].text); err == nil {
+				rrTTL, explicitTTL = n, true
+				if !haveTTL {
+					ttl = n
+				}
+				f = f[1:]
+			}
+		}
+		if len(f) == 0 {
+			return nil, fmt.Errorf("line %d: no record type", e.line)
+		}
+		name, err := dnsmessage.NewName(owner)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", e.line, err)
+		}
+		typ := strings.ToUpper(f[0].text)
+		body, err := parseRData(typ, f[1:], origin)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s record: %v", e.line, typ, err)
+		}
+		if soa, ok := body.(*dnsmessage.SOAResource); ok && !haveTTL && !explicitTTL {
+			rrTTL = soa.MinTTL
+		}
+		rrs = append(rrs, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: types[typ], Class: dnsmessage.ClassINET, TTL: rrTTL},
+			Body:   body,
+		})
+	}
+	return rrs, nil
+}
+
+// parseRData parses the fields of a record of type typ that follow
+// its type.
+func parseRData(typ string, f []token, origin string) (dnsmessage.ResourceBody, error) {
+	want := map[string]int{"A": 1, "AAAA": 1, "CNAME": 1, "NS": 1, "PTR": 1, "MX": 2, "SRV": 4, "SOA": 7}
+	if n, ok := want[typ]; ok && len(f) != n {
+		return nil, fmt.Errorf("%d fields, want %d", len(f), n)
+	}
+	names := func(f []token) ([]dnsmessage.Name, error) {
+		var ns []dnsmessage.Name
+		for _, t := range f {
+			s, err := absName(t.text, origin)
+			if err != nil {
+				return nil, err
+			}
+			n, err := dnsmessage.NewName(s)
+			if err != nil {
+				return nil, err
+			}
+			ns = append(ns, n)
+		}
+		return ns, nil
+	}
+	numbers := func(f []token) ([]uint32, error) {
+		var ns []uint32
+		for _, t := range f {
+			n, err := parseUint32(t.text)
+			if err != nil {
+				return nil, err
+			}
+			ns = append(ns, n)
+		}
+		return ns, nil
+	}
+	switch typ {
+	case "A", "AAAA":
+		ip, err := netip.ParseAddr(f[0].text)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "A" {
+			if !ip.Is4() {
+				return nil, errors.New("not an IPv4 address")
+			}
+			return &dnsmessage.AResource{A: ip.As4()}, nil
+		}
+		if !ip.Is6() || ip.Is4In6() {
+			return nil, errors.New("not an IPv6 address")
+		}
+		return &dnsmessage.AAAAResource{AAAA: ip.As16()}, nil
+	case "CNAME", "NS", "PTR":
+		ns, err := names(f)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "CNAME":
+			return &dnsmessage.CNAMEResource{CNAME: ns[0]}, nil
+		case "NS":
+			return &dnsmessage.NSResource{NS: ns[0]}, nil
+		}
+		return &dnsmessage.PTRResource{PTR: ns[0]}, nil
+	case "MX":
+		pref, err := parseUint16(f[0].text)
+		if err != nil {
+			return nil, err
+		}
+		ns, err := names(f[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.MXResource{Pref: pref, MX: ns[0]}, nil
+	case "SRV":
+		var v [3]uint16
+		for i := range v {
+			n, err := parseUint16(f[i].text)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+		ns, err := names(f[3:])
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.SRVResource{Priority: v[0], Weight: v[1], Port: v[2], Target: ns[0]}, nil
+	case "TXT":
+		if len(f) == 0 {
+			return nil, errors.New("no strings")
+		}
+		var txt []string
+		for _, t := range f {
+			if len(t.text) > 255 {
+				return nil, errors.New("string longer than 255 bytes")
+			}
+			txt = append(txt, t.text)
+		}
+		return &dnsmessage.TXTResource{TXT: txt}, nil
+	case "SOA":
+		ns, err := names(f[:2])
+		if err != nil {
+			return nil, err
+		}
+		v, err := numbers(f[2:])
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.SOAResource{NS: ns[0], MBox: ns[1], Serial: v[0], Refresh: v[1], Retry: v[2], Expire: v[3], MinTTL: v[4]}, nil
+	}
+	return nil, errors.New("unsupported record type")
+}
+
+// absName returns name made absolute, relative to origin unless it
+// ends in a dot.
+func absName(name, origin string) (string, error) {
+	switch {
+	case strings.HasSuffix(name, "."):
+		return name, nil
+	case origin == "":
+		return "", fmt.Errorf("relative name %q without $ORIGIN", name)
+	case origin == ".":
+		return name + ".", nil
+	}
+	return name + "." + origin, nil
+}
+
+func parseUint32(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err
+}
+
+func parseUint16(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	return uint16(n), err
+}
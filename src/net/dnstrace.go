@@ -0,0 +1,121 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"context"
+	"time"
+)
+
+// DNSTrace is a set of hooks run at the stages of the lookups made by
+// Go's built-in resolver with a context from WithDNSTrace. Any hook
+// may be nil. Hooks may be called concurrently from several
+// goroutines, as when the A and AAAA queries of a name are sent in
+// parallel.
+//
+// Lookups for the same host that are in flight at the same time are
+// made only once, so only the hooks of the first caller are run.
+type DNSTrace struct {
+	// QueryStart is called before a query is sent to a server.
+	QueryStart func(DNSQueryStartInfo)
+
+	// QueryDone is called when a query has been answered, or has
+	// failed.
+	QueryDone func(DNSQueryDoneInfo)
+
+	// Retry is called before a query for a name is sent again, to
+	// the same or another server, after the previous query failed
+	// with err.
+	Retry func(info DNSQueryStartInfo, err error)
+
+	// TCPFallback is called when a truncated UDP response from
+	// server makes the query for name be sent again over TCP.
+	TCPFallback func(name, server string)
+
+	// CgoFallback is called when the lookup of host failed in Go's
+	// resolver with err and is tried again with the native one.
+	CgoFallback func(host string, err error)
+}
+
+// DNSQueryStartInfo describes a query passed to DNSTrace hooks.
+type DNSQueryStartInfo struct {
+	Name    string // the name queried, rooted
+	Type    uint16 // the resource record type queried, such as 28 for AAAA
+	Server  string // the address of the server
+	Network string // "udp" or "tcp", or "" before the transport is chosen
+}
+
+// DNSQueryDoneInfo describes the outcome of a query passed to
+// DNSTrace.QueryDone.
+type DNSQueryDoneInfo struct {
+	Name    string
+	Type    uint16
+	Server  string
+	Network string
+
+	// RCode is the response code of the answer, such as 3 for a
+	// nonexistent name. It is zero if Err is set.
+	RCode int
+
+	// Truncated reports whether the answer was truncated.
+	Truncated bool
+
+	// Duration is the time from QueryStart to QueryDone.
+	Duration time.Duration
+
+	// Err is the network or protocol error that made the query
+	// fail, if any. A response reporting a failure is not an
+	// error here.
+	Err error
+}
+
+type dnsTraceKey struct{}
+
+// WithDNSTrace returns a copy of ctx that runs the hooks of trace
+// during the lookups made with it, replacing any trace attached to
+// ctx before.
+func WithDNSTrace(ctx context.Context, trace *DNSTrace) context.Context {
+	return context.WithValue(ctx, dnsTraceKey{}, trace)
+}
+
+// ContextDNSTrace returns the DNSTrace attached to ctx, or nil if
+// there is none.
+func ContextDNSTrace(ctx context.Context) *DNSTrace {
+	trace, _ := ctx.Value(dnsTraceKey{}).(*DNSTrace)
+	return trace
+}
+
+// The methods below run the hook of the same name, if t and the hook
+// are not nil.
+
+func (t *DNSTrace) queryStart(info DNSQueryStartInfo) {
+	if t != nil && t.QueryStart != nil {
+		t.QueryStart(info)
+	}
+}
+
+func (t *DNSTrace) queryDone(info DNSQueryDoneInfo) {
+	if t != nil && t.QueryDone != nil {
+		t.QueryDone(info)
+	}
+}
+
+func (t *DNSTrace) retry(info DNSQueryStartInfo, err error) {
+	if t != nil && t.Retry != nil {
+		t.Retry(info, err)
+	}
+}
+
+func (t *DNSTrace) tcpFallback(name, server string) {
+	if t != nil && t.TCPFallback != nil {
+		t.TCPFallback(name, server)
+	}
+}
+
+func (t *DNSTrace) cgoFallback(host string, err error) {
+	if t != nil && t.CgoFallback != nil {
+		t.CgoFallback(host, err)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// Zone transfers: see RFC 5936 (AXFR) and RFC 1995 (IXFR).
+
+package net
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTypeIXFR is the query type of incremental zone transfers,
+// which the dnsmessage package does not know about.
+const dnsTypeIXFR dnsmessage.Type = 251
+
+// rcodeNotAuth is the response code sent by servers that are not
+// authoritative for the zone or refuse to transfer it to the client.
+const rcodeNotAuth dnsmessage.RCode = 9
+
+var errZoneTransferRefused = errors.New("zone transfer refused")
+
+// transferZone implements Resolver.TransferZone.
+func (r *Resolver) transferZone(ctx context.Context, t *ZoneTransfer) ([][]byte, error) {
+	zone := ensureRooted(t.Zone)
+	if !isDomainName(zone) {
+		return nil, &DNSError{Err: "invalid zone name", Name: t.Zone}
+	}
+	if err := reservedNameError(zone); err != nil {
+		return nil, err
+	}
+	n, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return nil, &DNSError{Err: "invalid zone name", Name: t.Zone}
+	}
+	q := dnsmessage.Question{Name: n, Type: dnsmessage.TypeAXFR, Class: dnsmessage.ClassINET}
+	if t.Incremental {
+		q.Type = dnsTypeIXFR
+	}
+
+	id := uint16(randInt())
+	b := dnsmessage.NewBuilder(make([]byte, 2, 514), dnsmessage.Header{ID: id})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+	}
+	if err := b.Question(q); err != nil {
+		return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+	}
+	if t.Incremental {
+		// The client's version of the zone is described by an SOA
+		// record in the authority section. Only its serial matters.
+		root := dnsmessage.MustNewName(".")
+		if err := b.StartAuthorities(); err != nil {
+			return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+		}
+		rh := dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET}
+		if err := b.SOAResource(rh, dnsmessage.SOAResource{NS: root, MBox: root, Serial: t.Serial}); err != nil {
+			return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+	}
+	msg = msg[2:]
+	if t.Sign != nil {
+		if msg, err = t.Sign(msg); err != nil {
+			return nil, &DNSError{Err: err.Error(), Name: t.Zone}
+		}
+	}
+	req := make([]byte, 2+len(msg))
+	req[0], req[1] = byte(len(msg)>>8), byte(len(msg))
+	copy(req[2:], msg)
+
+	cfg := r.dnsConfig()
+	timeout, _ := cfg.queryLimits(ctx)
+	servers := []string{t.Server}
+	if t.Server == "" {
+		off := cfg.serverOffset()
+		all := cfg.serversFor(ensureRooted(t.Zone))
+		servers = make([]string, len(all))
+		for i := range servers {
+			servers[i] = all[(off+uint32(i))%uint32(len(all))]
+		}
+	}
+	var lastErr error
+	for _, server := range servers {
+		msgs, err := r.transferZoneFrom(ctx, server, id, q, req, t, timeout)
+		if err == nil {
+			return msgs, nil
+		}
+		lastErr = exchangeError(err, t.Zone, server)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// transferZoneFrom sends the zone transfer request req, with the given
+// ID and question, to server and reads the response messages until the
+// end of the transfer. Each message must arrive within timeout.
+func (r *Resolver) transferZoneFrom(ctx context.Context, server string, id uint16, q dnsmessage.Question, req []byte, t *ZoneTransfer, timeout time.Duration) ([][]byte, error) {
+	release, err := r.acquireQuerySlot(ctx)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	defer release()
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	c, err := r.dial(dialCtx, "tcp", server)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if d, ok := ctx.Deadline(); ok {
+		c.SetWriteDeadline(d)
+	}
+	if _, err := c.Write(req); err != nil {
+		return nil, mapErr(err)
+	}
+
+	var (
+		msgs    [][]byte
+		serial  uint32 // serial of the zone being transferred
+		records int    // number of answer records seen so far
+		soas    int    // number of SOA records seen with the new serial
+		ixfr    bool   // the response is incremental, not a whole zone
+	)
+	for {
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		c.SetReadDeadline(deadline)
+		b, err := readStreamMessage(c)
+		if err != nil {
+			return nil, mapErr(err)
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(b)
+		if err != nil {
+			return nil, errCannotUnmarshalDNSMessage
+		}
+		if !h.Response || h.ID != id {
+			return nil, errInvalidDNSResponse
+		}
+		// Only the first message must repeat the question.
+		for {
+			rq, err := p.Question()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return nil, errCannotUnmarshalDNSMessage
+			}
+			if !checkResponse(id, q, h, rq) {
+				return nil, errInvalidDNSResponse
+			}
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			if h.RCode == dnsmessage.RCodeRefused || h.RCode == rcodeNotAuth {
+				return nil, errZoneTransferRefused
+			}
+			return nil, errServerMisbehaving
+		}
+		if t.Verify != nil {
+			if err := t.Verify(b); err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, b)
+
+		for {
+			rh, err := p.AnswerHeader()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return nil, errCannotUnmarshalDNSMessage
+			}
+			records++
+			if rh.Type != dnsmessage.TypeSOA {
+				if records == 1 {
+					// A transfer starts with the zone's SOA record.
+					return nil, errInvalidDNSResponse
+				}
+				if err := p.SkipAnswer(); err != nil {
+					return nil, errCannotUnmarshalDNSMessage
+				}
+				continue
+			}
+			soa, err := p.SOAResource()
+			if err != nil {
+				return nil, errCannotUnmarshalDNSMessage
+			}
+			switch {
+			case records == 1:
+				serial = soa.Serial
+				if t.Incremental && int32(serial-t.Serial) <= 0 {
+					// The client's version is up to date, so the
+					// response is this SOA record alone.
+					// Serials wrap around, see RFC 1982.
+					return msgs, nil
+				}
+			case records == 2:
+				// An incremental response continues with the SOA
+				// record of the client's version, a whole zone
+				// with any other record.
+				ixfr = t.Incremental && soa.Serial != serial
+			}
+			if soa.Serial != serial {
+				continue
+			}
+			soas++
+			// A whole zone ends with its SOA record repeated. An
+			// incremental response also repeats the new SOA record
+			// before the last set of additions.
+			if !ixfr && soas == 2 || soas == 3 {
+				return msgs, nil
+			}
+		}
+	}
+}
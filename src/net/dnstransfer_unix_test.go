@@ -0,0 +1,183 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// zoneTransferServer returns a Dial function for a fake name server
+// that answers a zone transfer with one message per element of
+// answers, using rcode.
+func zoneTransferServer(t *testing.T, rcode dnsmessage.RCode, answers ...[]dnsmessage.Resource) func(context.Context, string, string) (Conn, error) {
+	return func(_ context.Context, network, _ string) (Conn, error) {
+		if network != "tcp" {
+			t.Errorf("zone transfer over %s; want tcp", network)
+		}
+		c, s := Pipe()
+		go func() {
+			defer s.Close()
+			b, err := readStreamMessage(s)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var q dnsmessage.Message
+			if err := q.Unpack(b); err != nil {
+				t.Error(err)
+				return
+			}
+			if len(answers) == 0 {
+				answers = [][]dnsmessage.Resource{nil}
+			}
+			for i, rrs := range answers {
+				m := dnsmessage.Message{
+					Header:  dnsmessage.Header{ID: q.ID, Response: true, Authoritative: true, RCode: rcode},
+					Answers: rrs,
+				}
+				if i == 0 {
+					m.Questions = q.Questions
+				}
+				b, err := m.Pack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := s.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...)); err != nil {
+					return
+				}
+			}
+			io.Copy(io.Discard, s)
+		}()
+		return c, nil
+	}
+}
+
+func zoneSOA(serial uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET},
+		Body: &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns.example.com."),
+			MBox:   dnsmessage.MustNewName("hostmaster.example.com."),
+			Serial: serial,
+		},
+	}
+}
+
+func zoneA(name string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+	}
+}
+
+func TestTransferZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer ZoneTransfer
+		answers  [][]dnsmessage.Resource
+		msgs     int
+	}{
+		{
+			name:     "axfr",
+			transfer: ZoneTransfer{Zone: "example.com"},
+			answers: [][]dnsmessage.Resource{
+				{zoneSOA(3), zoneA("a.example.com.")},
+				{zoneA("b.example.com."), zoneSOA(3)},
+			},
+			msgs: 2,
+		},
+		{
+			name:     "ixfr up to date",
+			transfer: ZoneTransfer{Zone: "example.com", Incremental: true, Serial: 3},
+			answers:  [][]dnsmessage.Resource{{zoneSOA(3)}},
+			msgs:     1,
+		},
+		{
+			name:     "ixfr",
+			transfer: ZoneTransfer{Zone: "example.com", Incremental: true, Serial: 1},
+			answers: [][]dnsmessage.Resource{
+				{zoneSOA(3), zoneSOA(1), zoneA("a.example.com."), zoneSOA(2), zoneA("b.example.com.")},
+				{zoneSOA(2), zoneSOA(3), zoneA("c.example.com."), zoneSOA(3)},
+			},
+			msgs: 2,
+		},
+		{
+			name:     "ixfr as whole zone",
+			transfer: ZoneTransfer{Zone: "example.com", Incremental: true, Serial: 1},
+			answers: [][]dnsmessage.Resource{
+				{zoneSOA(3), zoneA("a.example.com."), zoneSOA(3)},
+			},
+			msgs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{PreferGo: true, Dial: zoneTransferServer(t, dnsmessage.RCodeSuccess, tt.answers...)}
+			tt.transfer.Server = "192.0.2.53:53"
+			var signed, verified int
+			tt.transfer.Sign = func(msg []byte) ([]byte, error) {
+				signed++
+				return msg, nil
+			}
+			tt.transfer.Verify = func(msg []byte) error {
+				verified++
+				return nil
+			}
+			msgs, err := r.TransferZone(context.Background(), &tt.transfer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != tt.msgs {
+				t.Errorf("got %d messages; want %d", len(msgs), tt.msgs)
+			}
+			if signed != 1 || verified != tt.msgs {
+				t.Errorf("signed %d queries and verified %d responses; want 1 and %d", signed, verified, tt.msgs)
+			}
+		})
+	}
+}
+
+func TestTransferZoneErrors(t *testing.T) {
+	r := &Resolver{PreferGo: true, Dial: zoneTransferServer(t, dnsmessage.RCodeRefused)}
+	_, err := r.TransferZone(context.Background(), &ZoneTransfer{Zone: "example.com", Server: "192.0.2.53:53"})
+	if de, ok := err.(*DNSError); !ok || de.Err != errZoneTransferRefused.Error() {
+		t.Errorf("TransferZone error = %v; want %v", err, errZoneTransferRefused)
+	}
+
+	errBadSig := errors.New("bad signature")
+	r = &Resolver{PreferGo: true, Dial: zoneTransferServer(t, dnsmessage.RCodeSuccess, []dnsmessage.Resource{zoneSOA(1), zoneSOA(1)})}
+	_, err = r.TransferZone(context.Background(), &ZoneTransfer{
+		Zone:   "example.com",
+		Server: "192.0.2.53:53",
+		Verify: func([]byte) error { return errBadSig },
+	})
+	if de, ok := err.(*DNSError); !ok || de.Err != errBadSig.Error() {
+		t.Errorf("TransferZone error = %v; want %v", err, errBadSig)
+	}
+
+	r = &Resolver{PreferGo: true, Dial: zoneTransferServer(t, dnsmessage.RCodeSuccess, []dnsmessage.Resource{zoneA("a.example.com.")})}
+	_, err = r.TransferZone(context.Background(), &ZoneTransfer{Zone: "example.com", Server: "192.0.2.53:53"})
+	if de, ok := err.(*DNSError); !ok || de.Err != errInvalidDNSResponse.Error() {
+		t.Errorf("TransferZone error = %v; want %v", err, errInvalidDNSResponse)
+	}
+
+	// Reserved names are not asked for.
+	_, err = r.TransferZone(context.Background(), &ZoneTransfer{Zone: "hidden.onion", Server: "192.0.2.53:53"})
+	if !errors.Is(err, ErrOnionName) {
+		t.Errorf("TransferZone(hidden.onion) error = %v; want %v", err, ErrOnionName)
+	}
+	_, err = r.TransferZone(context.Background(), &ZoneTransfer{Zone: "invalid", Server: "192.0.2.53:53"})
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("TransferZone(invalid) error = %v; want not found", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// dnsUDPIdleTimeout is how long a pooled UDP socket is kept open
+// without queries in flight.
+const dnsUDPIdleTimeout = 10 * time.Second
+
+// A dnsUDPPool holds the connected UDP sockets that the queries of a
+// Resolver with UDPConnsPerServer set share.
+type dnsUDPPool struct {
+	mu      sync.Mutex
+	conns   map[string][]*dnsUDPConn // by server; guarded by mu
+	dialing map[string]int           // sockets being dialed, by server; guarded by mu
+	dialed  chan struct{}            // closed when a dial ends; guarded by mu
+	next    uint                     // guarded by mu
+}
+
+// A dnsUDPConn is a UDP socket connected to a server, on which several
+// queries may be in flight. Its read loop passes each response to the
+// query with the same ID.
+type dnsUDPConn struct {
+	c Conn
+
+	mu      sync.Mutex
+	pending map[uint16]chan []byte // guarded by mu
+	closed  bool                   // guarded by mu
+	err     error                  // why the read loop stopped; guarded by mu
+	done    chan struct{}          // closed when the read loop stops
+}
+
+// getUDPPool returns the pool of r, making it if needed.
+func (r *Resolver) getUDPPool() *dnsUDPPool {
+	r.udpPoolOnce.Do(func() {
+		r.udpPool = &dnsUDPPool{conns: make(map[string][]*dnsUDPConn), dialing: make(map[string]int), dialed: make(chan struct{})}
+	})
+	return r.udpPool
+}
+
+// poolUDP reports whether r shares UDP sockets among its queries.
+func (r *Resolver) poolUDP() bool {
+	return r != nil && r.UDPConnsPerServer > 0 && r.Dial == nil
+}
+
+// get returns one of the sockets to server, dialing a new one while
+// there are fewer than r.UDPConnsPerServer. The dial happens without
+// holding pool.mu, so that a slow one, such as one binding the socket
+// to an interface, does not hold up the queries to other servers.
+// Queries that find all the sockets to server still being dialed wait
+// for one of them.
+func (pool *dnsUDPPool) get(ctx context.Context, r *Resolver, server string) (*dnsUDPConn, error) {
+	for {
+		pool.mu.Lock()
+		conns := pool.conns[server]
+		if len(conns)+pool.dialing[server] < r.UDPConnsPerServer {
+			break
+		}
+		if len(conns) > 0 {
+			pool.next++
+			uc := conns[pool.next%uint(len(conns))]
+			pool.mu.Unlock()
+			return uc, nil
+		}
+		dialed := pool.dialed
+		pool.mu.Unlock()
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	pool.dialing[server]++
+	pool.mu.Unlock()
+
+	c, err := r.dial(ctx, "udp", server)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.dialing[server]--; pool.dialing[server] == 0 {
+		delete(pool.dialing, server)
+	}
+	close(pool.dialed)
+	pool.dialed = make(chan struct{})
+	if err != nil {
+		return nil, err
+	}
+	uc := &dnsUDPConn{c: c, pending: make(map[uint16]chan []byte), done: make(chan struct{})}
+	pool.conns[server] = append(pool.conns[server], uc)
+	go uc.readLoop(pool, server)
+	return uc, nil
+}
+
+// remove drops uc from the sockets to server.
+func (pool *dnsUDPPool) remove(server string, uc *dnsUDPConn) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	conns := pool.conns[server]
+	for i, c := range conns {
+		if c == uc {
+			conns = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(pool.conns, server)
+	} else {
+		pool.conns[server] = conns
+	}
+}
+
+// closeAll closes the sockets of the pool.
+func (pool *dnsUDPPool) closeAll() {
+	pool.mu.Lock()
+	var conns []*dnsUDPConn
+	for _, cs := range pool.conns {
+		conns = append(conns, cs...)
+	}
+	pool.mu.Unlock()
+	for _, uc := range conns {
+		uc.c.Close()
+		<-uc.done
+	}
+}
+
+// register makes the responses with ID *id be passed on the returned
+// channel. If *id is already in use on uc, it is replaced with a free
+// random ID. It reports false if uc is closed.
+func (uc *dnsUDPConn) register(id *uint16) (chan []byte, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.closed {
+		return nil, false
+	}
+	for uc.pending[*id] != nil {
+		*id = uint16(randInt())
+	}
+	// Forged responses may arrive before the real one, so make room
+	// for a few.
+	ch := make(chan []byte, 4)
+	uc.pending[*id] = ch
+	return ch, true
+}
+
+func (uc *dnsUDPConn) unregister(id uint16) {
+	uc.mu.Lock()
+	delete(uc.pending, id)
+	uc.mu.Unlock()
+}
+
+// readErr returns the error that stopped the read loop of uc.
+func (uc *dnsUDPConn) readErr() error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	return uc.err
+}
+
+// readLoop passes the packets read from uc to the queries waiting for
+// them, until uc fails, is closed, or stays idle for dnsUDPIdleTimeout.
+func (uc *dnsUDPConn) readLoop(pool *dnsUDPPool, server string) {
+	defer close(uc.done)
+	b := make([]byte, 65535)
+	for {
+		uc.c.SetReadDeadline(time.Now().Add(dnsUDPIdleTimeout))
+		n, err := uc.c.Read(b)
+		if err != nil {
+			uc.mu.Lock()
+			if nerr, ok := err.(Error); ok && nerr.Timeout() && len(uc.pending) > 0 {
+				// Queries in flight have deadlines of their own.
+				uc.mu.Unlock()
+				continue
+			}
+			uc.closed = true
+			uc.err = err
+			uc.mu.Unlock()
+			pool.remove(server, uc)
+			uc.c.Close()
+			return
+		}
+		if n < 2 {
+			continue
+		}
+		uc.mu.Lock()
+		ch := uc.pending[uint16(b[0])<<8|uint16(b[1])]
+		uc.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- append([]byte(nil), b[:n]...):
+			default:
+			}
+		}
+	}
+}
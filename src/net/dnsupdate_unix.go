@@ -0,0 +1,194 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// Dynamic updates: see RFC 2136.
+
+package net
+
+import (
+	"context"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// opcodeUpdate is the opcode of DNS UPDATE messages.
+const opcodeUpdate dnsmessage.OpCode = 5
+
+// Response codes specific to DNS UPDATE, which the dnsmessage package
+// does not know about. See RFC 2136, section 2.2.
+const (
+	rcodeYXDomain dnsmessage.RCode = 6
+	rcodeYXRRSet  dnsmessage.RCode = 7
+	rcodeNXRRSet  dnsmessage.RCode = 8
+	rcodeNotZone  dnsmessage.RCode = 10
+)
+
+// update implements Resolver.Update.
+func (r *Resolver) update(ctx context.Context, u *DNSUpdate) error {
+	zone := ensureRooted(u.Zone)
+	if !isDomainName(zone) {
+		return &DNSError{Err: "invalid zone name", Name: u.Zone}
+	}
+	n, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return &DNSError{Err: "invalid zone name", Name: u.Zone}
+	}
+	// The zone section has the same format as the question section.
+	q := dnsmessage.Question{Name: n, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}
+	id := uint16(randInt())
+	msg, err := newUpdateMessage(id, q, u)
+	if err != nil {
+		return &DNSError{Err: err.Error(), Name: u.Zone}
+	}
+	if u.Sign != nil {
+		if msg, err = u.Sign(msg); err != nil {
+			return &DNSError{Err: err.Error(), Name: u.Zone}
+		}
+	}
+	tcpReq := make([]byte, 2+len(msg))
+	tcpReq[0], tcpReq[1] = byte(len(msg)>>8), byte(len(msg))
+	copy(tcpReq[2:], msg)
+	req := &dnsRequest{id: id, q: q, udp: tcpReq[2:], tcp: tcpReq, maxSize: maxDNSPacketSize}
+
+	servers := []string{u.Server}
+	if u.Server == "" {
+		if servers, err = r.primaryServers(ctx, zone); err != nil {
+			return err
+		}
+	}
+	cfg := r.dnsConfig()
+	timeout, _ := cfg.queryLimits(ctx)
+	var lastErr error
+	for _, server := range servers {
+		// Updates are not retried on the same server: if the response
+		// was lost, the update may have been applied already.
+		_, h, resp, _, err := r.roundTrip(ctx, server, req, timeout, cfg.useTCP)
+		if err != nil {
+			lastErr = exchangeError(err, u.Zone, server)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if u.Verify != nil {
+			if err := u.Verify(resp); err != nil {
+				return &DNSError{Err: err.Error(), Name: u.Zone, Server: server}
+			}
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return &DNSError{Err: updateError(h.RCode), Name: u.Zone, Server: server}
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// newUpdateMessage returns the update u, with the given ID and zone
+// section, in wire format.
+func newUpdateMessage(id uint16, q dnsmessage.Question, u *DNSUpdate) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{ID: id, OpCode: opcodeUpdate})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	// Prerequisites go in the answer section, and updates in the
+	// authority section.
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, rr := range u.Prerequisites {
+		if err := addUpdateRecord(&b, rr); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAuthorities(); err != nil {
+		return nil, err
+	}
+	for _, rr := range u.Updates {
+		if err := addUpdateRecord(&b, rr); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// addUpdateRecord adds rr to the current section of b.
+func addUpdateRecord(b *dnsmessage.Builder, rr DNSRecord) error {
+	name, err := dnsmessage.NewName(ensureRooted(rr.Name))
+	if err != nil {
+		return err
+	}
+	class := dnsmessage.Class(rr.Class)
+	if class == 0 {
+		class = dnsmessage.ClassINET
+	}
+	h := dnsmessage.ResourceHeader{Name: name, Class: class, TTL: rr.TTL}
+	return b.UnknownResource(h, dnsmessage.UnknownResource{Type: dnsmessage.Type(rr.Type), Data: rr.Data})
+}
+
+// primaryServers returns the addresses of the primary name server of
+// zone, as named in its SOA record. See RFC 2136, section 4.
+func (r *Resolver) primaryServers(ctx context.Context, zone string) ([]string, error) {
+	p, server, err := r.lookup(ctx, zone, dnsmessage.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	var primary string
+	for primary == "" {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return nil, &DNSError{Err: "zone has no SOA record", Name: zone, Server: server}
+		}
+		if err != nil {
+			return nil, &DNSError{Err: errCannotUnmarshalDNSMessage.Error(), Name: zone, Server: server}
+		}
+		if h.Type != dnsmessage.TypeSOA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, &DNSError{Err: errCannotUnmarshalDNSMessage.Error(), Name: zone, Server: server}
+			}
+			continue
+		}
+		soa, err := p.SOAResource()
+		if err != nil {
+			return nil, &DNSError{Err: errCannotUnmarshalDNSMessage.Error(), Name: zone, Server: server}
+		}
+		primary = soa.NS.String()
+	}
+	addrs, err := r.LookupNetIP(ctx, "ip", primary)
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]string, len(addrs))
+	for i, addr := range addrs {
+		servers[i] = JoinHostPort(addr.String(), "53")
+	}
+	return servers, nil
+}
+
+// updateError returns the error message for an update rejected with
+// rcode.
+func updateError(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeNameError:
+		return "update prerequisite failed: name not in use"
+	case rcodeYXDomain:
+		return "update prerequisite failed: name in use"
+	case rcodeYXRRSet:
+		return "update prerequisite failed: RRset exists"
+	case rcodeNXRRSet:
+		return "update prerequisite failed: RRset does not exist"
+	case rcodeNotAuth:
+		return "server not authoritative for zone"
+	case rcodeNotZone:
+		return "name not in zone"
+	case dnsmessage.RCodeRefused:
+		return "update refused"
+	}
+	return errServerMisbehaving.Error()
+}
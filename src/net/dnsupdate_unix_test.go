@@ -0,0 +1,110 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package net
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// classNone is the NONE class of DNS UPDATE prerequisites and updates.
+const classNone dnsmessage.Class = 254
+
+func TestResolverUpdate(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+	var (
+		mu      sync.Mutex
+		updates []dnsmessage.Message
+	)
+	fake := fakeDNSServer{rh: func(_, s string, q dnsmessage.Message, _ time.Time) (dnsmessage.Message, error) {
+		m := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, OpCode: q.OpCode, Response: true},
+			Questions: q.Questions,
+		}
+		if q.OpCode != opcodeUpdate {
+			// Only the zone's SOA record and its primary server
+			// are looked up.
+			switch name := q.Questions[0].Name; {
+			case q.Questions[0].Type == dnsmessage.TypeSOA && name.String() == "example.com.":
+				m.Answers = []dnsmessage.Resource{zoneSOA(1)}
+			case q.Questions[0].Type == dnsmessage.TypeA && name.String() == "ns.example.com.":
+				m.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 53}},
+				}}
+			}
+			return m, nil
+		}
+		if s != "192.0.2.53:53" {
+			t.Errorf("update sent to %s; want 192.0.2.53:53", s)
+		}
+		mu.Lock()
+		updates = append(updates, q)
+		mu.Unlock()
+		if len(q.Answers) > 0 && q.Answers[0].Header.Class == dnsmessage.ClassINET {
+			// Refuse value-dependent prerequisites.
+			m.RCode = rcodeNXRRSet
+		}
+		return m, nil
+	}}
+	r := &Resolver{PreferGo: true, Dial: fake.DialContext}
+
+	var signed, verified int
+	u := &DNSUpdate{
+		Zone: "example.com",
+		Prerequisites: []DNSRecord{
+			{Name: "host.example.com", Type: uint16(dnsmessage.TypeAAAA), Class: uint16(classNone)},
+		},
+		Updates: []DNSRecord{
+			{Name: "host.example.com", Type: uint16(dnsmessage.TypeA), Class: uint16(dnsmessage.ClassANY)},
+			{Name: "host.example.com", Type: uint16(dnsmessage.TypeA), TTL: 300, Data: []byte{192, 0, 2, 1}},
+		},
+		Sign: func(msg []byte) ([]byte, error) {
+			signed++
+			return msg, nil
+		},
+		Verify: func(msg []byte) error {
+			verified++
+			return nil
+		},
+	}
+	if err := r.Update(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	if signed != 1 || verified != 1 {
+		t.Errorf("signed %d updates and verified %d responses; want 1 and 1", signed, verified)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates; want 1", len(updates))
+	}
+	m := updates[0]
+	if got := m.Questions[0]; got.Name.String() != "example.com." || got.Type != dnsmessage.TypeSOA {
+		t.Errorf("zone section = %v; want example.com. SOA", got)
+	}
+	if len(m.Answers) != 1 || m.Answers[0].Header.Class != classNone || m.Answers[0].Header.Type != dnsmessage.TypeAAAA {
+		t.Errorf("prerequisite section = %v; want one NONE AAAA record", m.Answers)
+	}
+	if len(m.Authorities) != 2 || m.Authorities[0].Header.Class != dnsmessage.ClassANY || m.Authorities[1].Header.Class != dnsmessage.ClassINET || m.Authorities[1].Header.TTL != 300 {
+		t.Errorf("update section = %v; want delete A RRset, then add A record", m.Authorities)
+	}
+
+	u = &DNSUpdate{
+		Zone:   "example.com",
+		Server: "192.0.2.53:53",
+		Prerequisites: []DNSRecord{
+			{Name: "host.example.com", Type: uint16(dnsmessage.TypeA), Data: []byte{192, 0, 2, 2}},
+		},
+	}
+	err := r.Update(context.Background(), u)
+	if de, ok := err.(*DNSError); !ok || de.Err != updateError(rcodeNXRRSet) {
+		t.Errorf("Update error = %v; want %q", err, updateError(rcodeNXRRSet))
+	}
+}
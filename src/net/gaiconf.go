@@ -0,0 +1,177 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/bytealg"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// gaiConfPath is the configuration with which the GNU C library's
+// getaddrinfo sorts addresses: see gai.conf(5).
+var gaiConfPath = "/etc/gai.conf"
+
+// gaiConf represents the state of the machine's /etc/gai.conf file,
+// which replaces parts of the policy table of RFC 6724.
+type gaiConf struct {
+	precedence policyTable // nil for that of RFC 6724; only Precedence is set
+	label      policyTable // nil for that of RFC 6724; only Label is set
+	scopev4    []gaiScope  // IPv4 scopes, in front of the default ones
+	reload     bool        // the file is to be checked for changes
+	mtime      time.Time   // time of gai.conf modification
+}
+
+// A gaiScope is the scope of the IPv4 addresses in a prefix.
+type gaiScope struct {
+	prefix netip.Prefix
+	scope  scope
+}
+
+var gaiConfig struct {
+	sync.Mutex
+	conf        *gaiConf
+	lastChecked time.Time
+}
+
+// systemGAIConf returns the parsed gai.conf file, read when it is first
+// needed and, if it says "reload yes", again after it changes.
+func systemGAIConf() *gaiConf {
+	gaiConfig.Lock()
+	defer gaiConfig.Unlock()
+	now := clockNow()
+	if c := gaiConfig.conf; c != nil {
+		if !c.reload || gaiConfig.lastChecked.After(now.Add(-5*time.Second)) {
+			return c
+		}
+		gaiConfig.lastChecked = now
+		if fi, err := os.Stat(gaiConfPath); err == nil && fi.ModTime().Equal(c.mtime) {
+			return c
+		}
+	}
+	gaiConfig.conf = parseGAIConf(gaiConfPath)
+	gaiConfig.lastChecked = now
+	return gaiConfig.conf
+}
+
+// parseGAIConf parses the gai.conf file. As with the C library, any
+// label lines replace the default label table, and any precedence
+// lines the default precedence table. Lines that fail to parse are
+// ignored.
+func parseGAIConf(filename string) *gaiConf {
+	conf := new(gaiConf)
+	file, err := open(filename)
+	if err != nil {
+		return conf
+	}
+	defer file.close()
+	if fi, err := file.file.Stat(); err == nil {
+		conf.mtime = fi.ModTime()
+	}
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		if f[0] == "reload" {
+			conf.reload = f[1] == "yes" || f[1] == "true"
+			continue
+		}
+		if len(f) < 3 {
+			continue
+		}
+		v, n, ok := dtoi(f[2])
+		if !ok || n != len(f[2]) || v > 255 {
+			continue
+		}
+		switch f[0] {
+		case "label", "precedence":
+			p, ok := gaiParsePrefix(f[1])
+			if !ok || !p.Addr().Is6() {
+				continue
+			}
+			ent := policyTableEntry{Prefix: p}
+			if f[0] == "label" {
+				ent.Label = uint8(v)
+				conf.label = append(conf.label, ent)
+			} else {
+				ent.Precedence = uint8(v)
+				conf.precedence = append(conf.precedence, ent)
+			}
+		case "scopev4":
+			p, ok := gaiParsePrefix(f[1])
+			if !ok {
+				continue
+			}
+			if a := p.Addr(); a.Is4In6() {
+				if p.Bits() < 96 {
+					continue
+				}
+				p = netip.PrefixFrom(a.Unmap(), p.Bits()-96)
+			} else if !a.Is4() {
+				continue
+			}
+			conf.scopev4 = append(conf.scopev4, gaiScope{prefix: p, scope: scope(v)})
+		}
+	}
+	// Longer prefixes first, as Classify wants.
+	for _, t := range []policyTable{conf.precedence, conf.label} {
+		sort.SliceStable(t, func(i, j int) bool { return t[i].Prefix.Bits() > t[j].Prefix.Bits() })
+	}
+	sort.SliceStable(conf.scopev4, func(i, j int) bool {
+		return conf.scopev4[i].prefix.Bits() > conf.scopev4[j].prefix.Bits()
+	})
+	return conf
+}
+
+// gaiParsePrefix parses an address with an optional prefix length,
+// which defaults to the length of the address.
+func gaiParsePrefix(s string) (netip.Prefix, bool) {
+	if bytealg.IndexByteString(s, '/') < 0 {
+		a, err := netip.ParseAddr(s)
+		if err != nil || a.Zone() != "" {
+			return netip.Prefix{}, false
+		}
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return p.Masked(), true
+}
+
+// attrOf returns the scope, precedence and label of ip under the
+// policy of c, which may be nil for that of RFC 6724.
+func (c *gaiConf) attrOf(ip netip.Addr) ipAttr {
+	if !ip.IsValid() {
+		return ipAttr{}
+	}
+	attr := ipAttrOf(ip)
+	if c == nil {
+		return attr
+	}
+	if c.precedence != nil {
+		attr.Precedence = c.precedence.Classify(ip).Precedence
+	}
+	if c.label != nil {
+		attr.Label = c.label.Classify(ip).Label
+	}
+	if ip4 := ip.Unmap(); ip4.Is4() {
+		for _, s := range c.scopev4 {
+			if s.prefix.Contains(ip4) {
+				attr.Scope = s.scope
+				break
+			}
+		}
+	}
+	return attr
+}
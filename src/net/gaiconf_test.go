@@ -0,0 +1,70 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseGAIConf(t *testing.T) {
+	c := parseGAIConf("testdata/gai.conf")
+	if len(c.precedence) != 5 || len(c.label) != 9 || c.reload {
+		t.Fatalf("got %d precedence and %d label entries, reload %v; want 5, 9, false", len(c.precedence), len(c.label), c.reload)
+	}
+	for _, tab := range []policyTable{c.precedence, c.label} {
+		for i := 1; i < len(tab); i++ {
+			if tab[i-1].Prefix.Bits() < tab[i].Prefix.Bits() {
+				t.Errorf("%v sorted before %v", tab[i-1].Prefix, tab[i].Prefix)
+			}
+		}
+	}
+	wantScopes := []gaiScope{
+		{netip.MustParsePrefix("192.168.0.0/16"), scopeSiteLocal},
+		{netip.MustParsePrefix("10.0.0.0/8"), scopeSiteLocal},
+	}
+	if !reflect.DeepEqual(c.scopev4, wantScopes) {
+		t.Errorf("scopev4 = %v; want %v", c.scopev4, wantScopes)
+	}
+
+	for _, tt := range []struct {
+		ip   string
+		want ipAttr
+	}{
+		{"192.0.2.1", ipAttr{Scope: scopeGlobal, Precedence: 100, Label: 4}},
+		{"10.1.2.3", ipAttr{Scope: scopeSiteLocal, Precedence: 100, Label: 4}},
+		{"2001:db8:1::1", ipAttr{Scope: scopeGlobal, Precedence: 40, Label: 8}},
+		{"2001:0:1::1", ipAttr{Scope: scopeGlobal, Precedence: 40, Label: 7}},
+		{"2001:db8:2::1", ipAttr{Scope: scopeGlobal, Precedence: 40, Label: 1}},
+		{"::1", ipAttr{Scope: scopeLinkLocal, Precedence: 50, Label: 0}},
+		{"fd00::1", ipAttr{Scope: scopeGlobal, Precedence: 40, Label: 6}},
+	} {
+		if got := c.attrOf(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("attrOf(%s) = %+v; want %+v", tt.ip, got, tt.want)
+		}
+	}
+
+	if c := parseGAIConf("testdata/nonexistent"); c.precedence != nil || c.label != nil || c.scopev4 != nil {
+		t.Errorf("missing file parsed as %+v", c)
+	}
+}
+
+func TestSortByGAIConf(t *testing.T) {
+	in := []IPAddr{{IP: ParseIP("2001:db8::1")}, {IP: ParseIP("192.0.2.1")}}
+	srcs := []netip.Addr{netip.MustParseAddr("2001:db8::2"), netip.MustParseAddr("192.0.2.2")}
+
+	addrs := append([]IPAddr(nil), in...)
+	sortByRFC6724withSrcs(addrs, append([]netip.Addr(nil), srcs...), nil)
+	if !reflect.DeepEqual(addrs, in) {
+		t.Errorf("default policy: got %v; want %v", addrs, in)
+	}
+
+	addrs = append([]IPAddr(nil), in...)
+	sortByRFC6724withSrcs(addrs, append([]netip.Addr(nil), srcs...), parseGAIConf("testdata/gai.conf"))
+	if want := []IPAddr{in[1], in[0]}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("gai.conf preferring IPv4: got %v; want %v", addrs, want)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package net
+
+import (
+	"syscall"
+
+	"golang.org/x/net/route"
+)
+
+// osDefaultRoutes returns the default routes of the routing table, read
+// with the route sysctl.
+func osDefaultRoutes() []defaultRoute {
+	rib, err := route.FetchRIB(syscall.AF_UNSPEC, route.RIBTypeRoute, 0)
+	if err != nil {
+		return nil
+	}
+	msgs, err := route.ParseRIB(route.RIBTypeRoute, rib)
+	if err != nil {
+		return nil
+	}
+	var routes []defaultRoute
+	for _, m := range msgs {
+		rm, ok := m.(*route.RouteMessage)
+		if !ok || rm.Flags&syscall.RTF_GATEWAY == 0 || len(rm.Addrs) <= syscall.RTAX_GATEWAY {
+			continue
+		}
+		if !isZeroRouteAddr(rm.Addrs[syscall.RTAX_DST]) {
+			continue
+		}
+		if len(rm.Addrs) > syscall.RTAX_NETMASK && rm.Addrs[syscall.RTAX_NETMASK] != nil && !isZeroRouteAddr(rm.Addrs[syscall.RTAX_NETMASK]) {
+			continue
+		}
+		var rt defaultRoute
+		switch sa := rm.Addrs[syscall.RTAX_GATEWAY].(type) {
+		case *route.Inet4Addr:
+			rt.gateway.IP = IPv4(sa.IP[0], sa.IP[1], sa.IP[2], sa.IP[3])
+		case *route.Inet6Addr:
+			rt.gateway.IP = make(IP, IPv6len)
+			copy(rt.gateway.IP, sa.IP[:])
+			if sa.ZoneID != 0 {
+				rt.gateway.Zone = zoneCache.name(sa.ZoneID)
+			}
+		default:
+			continue
+		}
+		if rt.gateway.IP.IsUnspecified() {
+			continue
+		}
+		routes = append(routes, rt)
+	}
+	return routes
+}
+
+// isZeroRouteAddr reports whether a is an IPv4 or IPv6 address, or a
+// mask, of all zeros.
+func isZeroRouteAddr(a route.Addr) bool {
+	switch a := a.(type) {
+	case *route.Inet4Addr:
+		return a.IP == [4]byte{}
+	case *route.Inet6Addr:
+		return a.IP == [16]byte{}
+	}
+	return false
+}
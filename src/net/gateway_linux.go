@@ -0,0 +1,154 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/goarch"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The routing tables as the proc file system shows them, read when
+// netlink cannot be used.
+var (
+	procNetRoute     = "/proc/net/route"
+	procNetIPv6Route = "/proc/net/ipv6_route"
+)
+
+// rtfGateway is the RTF_GATEWAY flag of a route through a gateway.
+const rtfGateway = 0x2
+
+// osDefaultRoutes returns the default routes of the main routing table.
+func osDefaultRoutes() []defaultRoute {
+	routes, err := netlinkDefaultRoutes()
+	if err != nil {
+		return procDefaultRoutes()
+	}
+	return routes
+}
+
+// netlinkDefaultRoutes asks the kernel for the default routes of the
+// main routing table over netlink.
+func netlinkDefaultRoutes() ([]defaultRoute, error) {
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	var routes []defaultRoute
+loop:
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.NLMSG_DONE:
+			break loop
+		case syscall.RTM_NEWROUTE:
+			if len(m.Data) < syscall.SizeofRtMsg {
+				continue
+			}
+			rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+			if rtm.Dst_len != 0 || rtm.Table != syscall.RT_TABLE_MAIN || rtm.Type != syscall.RTN_UNICAST {
+				continue
+			}
+			attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+			if err != nil {
+				return nil, os.NewSyscallError("parsenetlinkrouteattr", err)
+			}
+			var rt defaultRoute
+			var oif int
+			for _, a := range attrs {
+				switch a.Attr.Type {
+				case syscall.RTA_GATEWAY:
+					rt.gateway.IP = copyIP(a.Value)
+				case syscall.RTA_PREFSRC:
+					rt.src = copyIP(a.Value)
+				case syscall.RTA_OIF:
+					if len(a.Value) == 4 {
+						oif = int(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+					}
+				}
+			}
+			if len(rt.gateway.IP) != IPv4len && len(rt.gateway.IP) != IPv6len {
+				continue
+			}
+			if rt.gateway.IP.IsLinkLocalUnicast() && len(rt.gateway.IP) == IPv6len {
+				rt.gateway.Zone = zoneCache.name(oif)
+			}
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+// procDefaultRoutes reads the default routes from the routing tables
+// in procNetRoute and procNetIPv6Route.
+func procDefaultRoutes() []defaultRoute {
+	var routes []defaultRoute
+	if file, err := open(procNetRoute); err == nil {
+		for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+			// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+			// eth0  00000000    0102A8C0 0003  0      0   100    00000000
+			f := getFields(line)
+			if len(f) < 8 || f[1] != "00000000" || f[7] != "00000000" {
+				continue
+			}
+			flags, _, ok := xtoi(f[3])
+			gw, ok1 := parseHexBytes(f[2], IPv4len)
+			if !ok || !ok1 || flags&rtfGateway == 0 {
+				continue
+			}
+			// The address is printed as a number in host byte order.
+			if !goarch.BigEndian {
+				gw[0], gw[1], gw[2], gw[3] = gw[3], gw[2], gw[1], gw[0]
+			}
+			ip := IPv4(gw[0], gw[1], gw[2], gw[3])
+			if ip.IsUnspecified() {
+				continue
+			}
+			routes = append(routes, defaultRoute{gateway: IPAddr{IP: ip}})
+		}
+		file.close()
+	}
+	if file, err := open(procNetIPv6Route); err == nil {
+		for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+			// Destination PrefixLen Source PrefixLen NextHop Metric RefCnt Use Flags Iface
+			f := getFields(line)
+			if len(f) < 10 || f[1] != "00" || f[0] != "00000000000000000000000000000000" {
+				continue
+			}
+			flags, _, ok := xtoi(f[8])
+			gw, ok1 := parseHexBytes(f[4], IPv6len)
+			if !ok || !ok1 || flags&rtfGateway == 0 || IP(gw).IsUnspecified() {
+				continue
+			}
+			a := IPAddr{IP: IP(gw)}
+			if a.IP.IsLinkLocalUnicast() {
+				a.Zone = f[9]
+			}
+			routes = append(routes, defaultRoute{gateway: a})
+		}
+		file.close()
+	}
+	return routes
+}
+
+// parseHexBytes parses s, n bytes as 2n hexadecimal digits.
+func parseHexBytes(s string, n int) ([]byte, bool) {
+	if len(s) != 2*n {
+		return nil, false
+	}
+	b := make([]byte, n)
+	for i := range b {
+		d, j, ok := xtoi(s[2*i : 2*i+2])
+		if !ok || j != 2 {
+			return nil, false
+		}
+		b[i] = byte(d)
+	}
+	return b, true
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/goarch"
+	"reflect"
+	"testing"
+)
+
+func TestProcDefaultRoutes(t *testing.T) {
+	if goarch.BigEndian {
+		t.Skip("testdata/proc-net-route is in little endian byte order")
+	}
+	defer func(route, route6 string) {
+		procNetRoute, procNetIPv6Route = route, route6
+	}(procNetRoute, procNetIPv6Route)
+	procNetRoute = "testdata/proc-net-route"
+	procNetIPv6Route = "testdata/proc-net-ipv6_route"
+
+	routes := procDefaultRoutes()
+	want := []defaultRoute{
+		{gateway: IPAddr{IP: IPv4(192, 168, 2, 1)}},
+		{gateway: IPAddr{IP: IPv4(192, 168, 2, 1)}},
+		{gateway: IPAddr{IP: ParseIP("fe80::1"), Zone: "eth0"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("procDefaultRoutes() = %v; want %v", routes, want)
+	}
+}
+
+func TestNetlinkDefaultRoutes(t *testing.T) {
+	routes, err := netlinkDefaultRoutes()
+	if err != nil {
+		t.Skipf("netlink unavailable: %v", err)
+	}
+	for _, rt := range routes {
+		if rt.gateway.IP == nil || rt.gateway.IP.IsUnspecified() {
+			t.Errorf("default route without a gateway: %+v", rt)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package net
+
+// osDefaultRoutes returns no routes: the Go resolver only answers the
+// names of the myhostname source on systems whose routing tables it
+// reads.
+func osDefaultRoutes() []defaultRoute { return nil }
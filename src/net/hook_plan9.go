@@ -6,4 +6,11 @@ package net
 
 import "time"
 
-var testHookDialChannel = func() { time.Sleep(time.Millisecond) } // see golang.org/issue/5349
+var (
+	testHookDialChannel = func() { time.Sleep(time.Millisecond) } // see golang.org/issue/5349
+
+	testHookHostsPath = ndbLocalPath
+
+	// Plan 9 has no protocols file; protocols are known to /net/cs.
+	testHookProtocolsPath = ""
+)
@@ -12,9 +12,17 @@ var (
 	testHookDialChannel  = func() {} // for golang.org/issue/5349
 	testHookCanceledDial = func() {} // for golang.org/issue/16523
 
+	testHookHostsPath     = "/etc/hosts"
+	testHookProtocolsPath = "/etc/protocols"
+
 	// Placeholders for socket system calls.
 	socketFunc        func(int, int, int) (int, error)  = syscall.Socket
 	connectFunc       func(int, syscall.Sockaddr) error = syscall.Connect
 	listenFunc        func(int, int) error              = syscall.Listen
 	getsockoptIntFunc func(int, int, int) (int, error)  = syscall.GetsockoptInt
+
+	// Placeholders for cgo resolver calls made when Go's
+	// resolver is combined with cgo.
+	cgoLookupHostFunc = cgoLookupHost
+	cgoLookupIPFunc   = cgoLookupIP
 )
@@ -13,9 +13,23 @@ import (
 var (
 	testHookDialChannel = func() { time.Sleep(time.Millisecond) } // see golang.org/issue/5349
 
+	testHookHostsPath     = etcFilePath("hosts")
+	testHookProtocolsPath = etcFilePath("protocol")
+
 	// Placeholders for socket system calls.
 	socketFunc    func(int, int, int) (syscall.Handle, error)                                                 = syscall.Socket
 	wsaSocketFunc func(int32, int32, int32, *syscall.WSAProtocolInfo, uint32, uint32) (syscall.Handle, error) = windows.WSASocket
 	connectFunc   func(syscall.Handle, syscall.Sockaddr) error                                                = syscall.Connect
 	listenFunc    func(syscall.Handle, int) error                                                             = syscall.Listen
 )
+
+// etcFilePath returns the path of the named Windows database file,
+// such as the hosts file, which lives in the system directory rather
+// than in /etc.
+func etcFilePath(name string) string {
+	root, _ := syscall.Getenv("SystemRoot")
+	if root == "" {
+		root = `C:\Windows`
+	}
+	return root + `\System32\drivers\etc\` + name
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import "internal/bytealg"
+
+const hostConfPath = "/etc/host.conf"
+
+// hostConf represents the state of the machine's /etc/host.conf file,
+// from which older C libraries take the order of host lookups instead
+// of from nsswitch.conf.
+type hostConf struct {
+	order []string // services of the order keyword, e.g. "hosts", "bind"
+	trim  bool     // domains are trimmed from the names found
+	err   error    // any error encountered opening the file
+}
+
+// parseHostConf parses the host.conf file, described in host.conf(5).
+func parseHostConf(filename string) *hostConf {
+	file, err := open(filename)
+	if err != nil {
+		return &hostConf{err: err}
+	}
+	defer file.close()
+	conf := new(hostConf)
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "order":
+			conf.order = nil
+			for _, v := range f[1:] {
+				for _, s := range splitAtBytes(v, ",;:") {
+					conf.order = append(conf.order, s)
+				}
+			}
+		case "trim":
+			conf.trim = true
+		}
+	}
+	return conf
+}
+
+// lookupOrder returns the host lookup order set by c, or
+// fallbackOrder if the C library has to be left to follow it.
+func (c *hostConf) lookupOrder(fallbackOrder hostLookupOrder) hostLookupOrder {
+	if c == nil || c.err != nil {
+		return hostLookupFilesDNS
+	}
+	if c.trim {
+		return fallbackOrder
+	}
+	var order []string
+	for _, s := range c.order {
+		if s != "hosts" && s != "bind" {
+			// e.g. "nis"
+			return fallbackOrder
+		}
+		if len(order) == 0 || len(order) == 1 && order[0] != s {
+			order = append(order, s)
+		}
+	}
+	switch len(order) {
+	case 0:
+		return hostLookupFilesDNS
+	case 1:
+		if order[0] == "hosts" {
+			return hostLookupFiles
+		}
+		return hostLookupDNS
+	}
+	if order[0] == "hosts" {
+		return hostLookupFilesDNS
+	}
+	return hostLookupDNSFiles
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestParseHostConf(t *testing.T) {
+	for _, tt := range []struct {
+		file  string
+		order []string
+		trim  bool
+	}{
+		{"testdata/host.conf", []string{"bind", "hosts"}, false},
+		{"testdata/host-trim.conf", []string{"hosts", "nis", "bind"}, true},
+	} {
+		c := parseHostConf(tt.file)
+		if c.err != nil || !reflect.DeepEqual(c.order, tt.order) || c.trim != tt.trim {
+			t.Errorf("parseHostConf(%s) = %+v; want order %v, trim %v", tt.file, c, tt.order, tt.trim)
+		}
+	}
+}
+
+func TestHostConfLookupOrder(t *testing.T) {
+	for _, tt := range []struct {
+		c    *hostConf
+		want hostLookupOrder
+	}{
+		{nil, hostLookupFilesDNS},
+		{&hostConf{err: fs.ErrNotExist}, hostLookupFilesDNS},
+		{&hostConf{}, hostLookupFilesDNS},
+		{&hostConf{order: []string{"hosts"}}, hostLookupFiles},
+		{&hostConf{order: []string{"bind"}}, hostLookupDNS},
+		{&hostConf{order: []string{"hosts", "bind"}}, hostLookupFilesDNS},
+		{&hostConf{order: []string{"bind", "hosts", "bind"}}, hostLookupDNSFiles},
+		{&hostConf{order: []string{"hosts", "nis"}}, hostLookupCgo},
+		{&hostConf{order: []string{"hosts", "bind"}, trim: true}, hostLookupCgo},
+	} {
+		if got := tt.c.lookupOrder(hostLookupCgo); got != tt.want {
+			t.Errorf("%+v.lookupOrder = %v; want %v", tt.c, got, tt.want)
+		}
+	}
+}
@@ -6,7 +6,9 @@ package net
 
 import (
 	"internal/bytealg"
+	"internal/godebug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -48,54 +50,195 @@ var hosts struct {
 	// We don't support old-classful IP address notation.
 	byAddr map[string][]string
 
-	expire time.Time
-	path   string
-	mtime  time.Time
-	size   int64
+	// bySuffix holds the entries of wildcard names, such as *.test,
+	// by the domain under the asterisk, lower cased, as in "test.".
+	// It is only filled with GODEBUG=netdnshostswildcard=1; otherwise
+	// wildcard names are ordinary names, as in the C library.
+	bySuffix map[string]byName
+
+	expire   time.Time
+	paths    []string
+	stats    []hostsFileStat // of the files in paths
+	wildcard bool            // whether bySuffix was filled
+
+	// changed is set by the file watchers, if any, or by
+	// FlushHostsCache, when the files may have changed. It makes
+	// the next lookup read the files again without waiting for the
+	// cache to expire.
+	changed    atomic.Bool
+	watchPaths []string // files being watched
+	stopWatch  []func() // stop the watches on watchPaths
 }
 
-func readHosts() {
-	now := time.Now()
-	hp := testHookHostsPath
+// A hostsFileStat records the modification time and size of a hosts
+// file when it was read; err is set if it could not be read.
+type hostsFileStat struct {
+	mtime time.Time
+	size  int64
+	err   error
+}
 
-	if now.Before(hosts.expire) && hosts.path == hp && len(hosts.byName) > 0 {
-		return
+var hostsPathsOverride atomic.Pointer[[]string] // set by SetHostsPaths
+
+// SetHostsPaths sets the hosts files consulted by Go's built-in
+// resolver, in place of the system's, such as /etc/hosts. The files
+// are read in order, and the entries of a name or address in a file
+// replace those from the files before it, so that a base file can be
+// followed by files with overrides. Files that do not exist are
+// skipped. Calling SetHostsPaths with no paths restores the system's
+// file. The new files are read by the next lookup.
+func SetHostsPaths(paths ...string) {
+	paths = append([]string(nil), paths...)
+	hostsPathsOverride.Store(&paths)
+}
+
+// hostsPaths returns the hosts files to read.
+func hostsPaths() []string {
+	if p := hostsPathsOverride.Load(); p != nil && len(*p) > 0 {
+		return *p
 	}
-	mtime, size, err := stat(hp)
-	if err == nil && hosts.path == hp && hosts.mtime.Equal(mtime) && hosts.size == size {
-		hosts.expire = now.Add(cacheMaxAge)
-		return
+	return []string{testHookHostsPath}
+}
+
+// FlushHostsCache drops the cached contents of the hosts file, such as
+// /etc/hosts, so that the next lookup reads the file again. On Linux,
+// changes to the file are noticed as soon as they are made; elsewhere
+// the cache is only checked against the file every few seconds, and
+// FlushHostsCache makes a change show up right away.
+func FlushHostsCache() {
+	hosts.changed.Store(true)
+}
+
+// watchHosts replaces any existing watches with ones on the named
+// files. It must be called with hosts locked.
+func watchHosts(names []string) {
+	for _, stop := range hosts.stopWatch {
+		stop()
+	}
+	hosts.stopWatch = nil
+	hosts.watchPaths = names
+	for _, name := range names {
+		if stop, ok := watchFile(name, func() { hosts.changed.Store(true) }); ok {
+			hosts.stopWatch = append(hosts.stopWatch, stop)
+		}
 	}
+}
 
-	hs := make(map[string]byName)
-	is := make(map[string][]string)
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hostsWildcard reports whether host names of the form *.domain in the
+// hosts file match all the names under domain, as requested with
+// GODEBUG=netdnshostswildcard=1.
+func hostsWildcard() bool {
+	return godebug.Get("netdnshostswildcard") == "1"
+}
+
+func readHosts() {
+	now := clockNow()
+	paths := hostsPaths()
+	wildcard := hostsWildcard()
+	if !equalPaths(paths, hosts.watchPaths) {
+		watchHosts(paths)
+	}
 
-	var file *file
-	if file, _ = open(hp); file == nil {
+	changed := hosts.changed.Swap(false) || hosts.wildcard != wildcard || !equalPaths(paths, hosts.paths)
+	if !changed && now.Before(hosts.expire) && (len(hosts.byName) > 0 || len(hosts.bySuffix) > 0) {
+		dnsStats.hostsCacheHits.Add(1)
 		return
 	}
-	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
-		if i := bytealg.IndexByteString(line, '#'); i >= 0 {
-			// Discard comments.
-			line = line[0:i]
+	stats := make([]hostsFileStat, len(paths))
+	same := !changed
+	for i, hp := range paths {
+		st := &stats[i]
+		st.mtime, st.size, st.err = stat(hp)
+		if same && ((st.err != nil) != (hosts.stats[i].err != nil) || !hosts.stats[i].mtime.Equal(st.mtime) || hosts.stats[i].size != st.size) {
+			same = false
 		}
-		f := getFields(line)
-		if len(f) < 2 {
+	}
+	if same {
+		dnsStats.hostsCacheHits.Add(1)
+		hosts.expire = now.Add(cacheMaxAge)
+		return
+	}
+	dnsStats.hostsCacheMisses.Add(1)
+
+	var hs map[string]byName
+	var is map[string][]string
+	var ws map[string]byName
+	read := false
+	for _, hp := range paths {
+		fhs, fis, fws, ok := readHostsFile(hp, wildcard)
+		if !ok {
 			continue
 		}
-		addr := parseLiteralIP(f[0])
-		if addr == "" {
+		if !read {
+			hs, is, ws, read = fhs, fis, fws, true
 			continue
 		}
+		// The entries of later files replace those before them.
+		for k, v := range fhs {
+			hs[k] = v
+		}
+		for k, v := range fis {
+			is[k] = v
+		}
+		for k, v := range fws {
+			if ws == nil {
+				ws = make(map[string]byName)
+			}
+			ws[k] = v
+		}
+	}
+	if !read {
+		return
+	}
+	// Update the data cache.
+	hosts.expire = now.Add(cacheMaxAge)
+	hosts.paths = paths
+	hosts.byName = hs
+	hosts.byAddr = is
+	hosts.bySuffix = ws
+	hosts.stats = stats
+	hosts.wildcard = wildcard
+}
 
+// readHostsFile reads the entries of the hosts file hp, by name, by
+// address and, if wildcard is set, by the domain of wildcard names. It
+// reports false if the file cannot be read.
+func readHostsFile(hp string, wildcard bool) (hs map[string]byName, is map[string][]string, ws map[string]byName, ok bool) {
+	hs = make(map[string]byName)
+	is = make(map[string][]string)
+
+	add := func(addr string, names []string) {
 		var canonical string
-		for i := 1; i < len(f); i++ {
-			name := absDomainName(f[i])
-			h := []byte(f[i])
+		for _, n := range names {
+			name := absDomainName(n)
+			h := []byte(n)
 			lowerASCIIBytes(h)
 			key := absDomainName(string(h))
 
-			if i == 1 {
+			if wildcard && len(key) > 2 && key[0] == '*' && key[1] == '.' {
+				// Wildcard names match no name of their own, so
+				// they are neither canonical names nor names of addr.
+				if ws == nil {
+					ws = make(map[string]byName)
+				}
+				v := ws[key[2:]]
+				ws[key[2:]] = byName{addrs: append(v.addrs, addr)}
+				continue
+			}
+
+			if canonical == "" {
 				canonical = key
 			}
 
@@ -115,14 +258,38 @@ func readHosts() {
 			}
 		}
 	}
-	// Update the data cache.
-	hosts.expire = now.Add(cacheMaxAge)
-	hosts.path = hp
-	hosts.byName = hs
-	hosts.byAddr = is
-	hosts.mtime = mtime
-	hosts.size = size
-	file.close()
+
+	if hp == ndbLocalPath {
+		// On Plan 9, the host names are those of the network
+		// database.
+		entries, err := readNdb(hp)
+		if err != nil {
+			return nil, nil, nil, false
+		}
+		ndbHosts(entries, add)
+	} else {
+		var file *file
+		if file, _ = open(hp); file == nil {
+			return nil, nil, nil, false
+		}
+		for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+			if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+				// Discard comments.
+				line = line[0:i]
+			}
+			f := getFields(line)
+			if len(f) < 2 {
+				continue
+			}
+			addr := parseLiteralIP(f[0])
+			if addr == "" {
+				continue
+			}
+			add(addr, f[1:])
+		}
+		file.close()
+	}
+	return hs, is, ws, true
 }
 
 // lookupStaticHost looks up the addresses and the cannonical name for the given host from /etc/hosts.
@@ -130,17 +297,31 @@ func lookupStaticHost(host string) ([]string, string) {
 	hosts.Lock()
 	defer hosts.Unlock()
 	readHosts()
-	if len(hosts.byName) != 0 {
+	if len(hosts.byName) != 0 || len(hosts.bySuffix) != 0 {
 		if hasUpperCase(host) {
 			lowerHost := []byte(host)
 			lowerASCIIBytes(lowerHost)
 			host = string(lowerHost)
 		}
-		if byName, ok := hosts.byName[absDomainName(host)]; ok {
+		host = absDomainName(host)
+		if byName, ok := hosts.byName[host]; ok {
 			ipsCp := make([]string, len(byName.addrs))
 			copy(ipsCp, byName.addrs)
 			return ipsCp, byName.canonicalName
 		}
+		// The wildcard name of the longest domain above host wins.
+		for suffix := host; len(hosts.bySuffix) != 0; {
+			i := bytealg.IndexByteString(suffix, '.')
+			if i < 0 || i == len(suffix)-1 {
+				break
+			}
+			suffix = suffix[i+1:]
+			if byName, ok := hosts.bySuffix[suffix]; ok {
+				ipsCp := make([]string, len(byName.addrs))
+				copy(ipsCp, byName.addrs)
+				return ipsCp, host
+			}
+		}
 	}
 	return nil, ""
 }
@@ -5,9 +5,13 @@
 package net
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 type staticHostEntry struct {
@@ -174,6 +178,123 @@ func TestHostCacheModification(t *testing.T) {
 	testStaticAddr(t, testHookHostsPath, ent)
 }
 
+func TestHostsCacheFlush(t *testing.T) {
+	defer func(orig string) {
+		testHookHostsPath = orig
+		hosts.Lock()
+		watchHosts(hostsPaths())
+		hosts.Unlock()
+	}(testHookHostsPath)
+
+	name := filepath.Join(t.TempDir(), "hosts")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Keep the modification time, so that only the watcher or
+		// FlushHostsCache can tell that the file changed.
+		mtime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testHookHostsPath = name
+
+	write("192.0.2.1 host.test\n")
+	testStaticHost(t, name, staticHostEntry{"host.test", []string{"192.0.2.1"}})
+
+	write("192.0.2.2 host.test\n")
+	FlushHostsCache()
+	testStaticHost(t, name, staticHostEntry{"host.test", []string{"192.0.2.2"}})
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	// The watcher notices changes without a flush.
+	write("192.0.2.3 host.test\n")
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if addrs, _ := lookupStaticHost("host.test"); len(addrs) == 1 && addrs[0] == "192.0.2.3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("change to hosts file not noticed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLookupStaticHostWildcard(t *testing.T) {
+	defer func(orig string) { testHookHostsPath = orig }(testHookHostsPath)
+	testHookHostsPath = "testdata/wildcard-hosts"
+
+	tests := []struct {
+		name      string
+		addrs     []string
+		canonical string
+	}{
+		{"exact.test", []string{"127.0.0.2"}, "exact.test."},
+		{"app.test", []string{"127.0.0.1", "::1"}, "app.test."},
+		{"API.App.Test.", []string{"127.0.0.1", "::1"}, "api.app.test."},
+		{"a.dev.test", []string{"127.0.0.3"}, "a.dev.test."},
+		{"a.b.dev.test", []string{"127.0.0.3"}, "a.b.dev.test."},
+		{"test", nil, ""},
+		{"app.example", nil, ""},
+	}
+
+	t.Setenv("GODEBUG", "netdnshostswildcard=1")
+	for _, tt := range tests {
+		addrs, canonical := lookupStaticHost(tt.name)
+		if !reflect.DeepEqual(addrs, tt.addrs) || canonical != tt.canonical {
+			t.Errorf("lookupStaticHost(%q) = %v, %q; want %v, %q", tt.name, addrs, canonical, tt.addrs, tt.canonical)
+		}
+	}
+	if names := lookupStaticAddr("127.0.0.3"); len(names) != 0 {
+		t.Errorf("lookupStaticAddr(127.0.0.3) = %v; want no names", names)
+	}
+
+	// Without the setting, wildcard names only match themselves.
+	t.Setenv("GODEBUG", "")
+	if addrs, _ := lookupStaticHost("app.test"); addrs != nil {
+		t.Errorf("lookupStaticHost(app.test) = %v; want none", addrs)
+	}
+	if addrs, _ := lookupStaticHost("*.test"); !reflect.DeepEqual(addrs, []string{"127.0.0.1", "::1"}) {
+		t.Errorf("lookupStaticHost(*.test) = %v; want [127.0.0.1 ::1]", addrs)
+	}
+}
+
+func TestSetHostsPaths(t *testing.T) {
+	defer SetHostsPaths()
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "hosts")
+	tenant := filepath.Join(dir, "hosts.tenant")
+	if err := os.WriteFile(base, []byte("127.0.0.1 localhost\n192.0.2.1 db.internal cache.internal\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tenant, []byte("192.0.2.2 db.internal\n192.0.2.3 api.internal\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetHostsPaths(base, filepath.Join(dir, "missing"), tenant)
+
+	for _, ent := range []staticHostEntry{
+		{"localhost", []string{"127.0.0.1"}},
+		{"db.internal", []string{"192.0.2.2"}},
+		{"cache.internal", []string{"192.0.2.1"}},
+		{"api.internal", []string{"192.0.2.3"}},
+	} {
+		testStaticHost(t, tenant, ent)
+	}
+	testStaticAddr(t, tenant, staticHostEntry{"192.0.2.1", []string{"db.internal", "cache.internal"}})
+	testStaticAddr(t, tenant, staticHostEntry{"192.0.2.2", []string{"db.internal"}})
+
+	// Without paths, the system's file is read again.
+	SetHostsPaths()
+	if addrs, _ := lookupStaticHost("api.internal"); addrs != nil {
+		t.Errorf("lookupStaticHost(api.internal) = %v after SetHostsPaths(); want none", addrs)
+	}
+}
+
 var lookupStaticHostAliasesTest = []struct {
 	lookup, res string
 }{
@@ -0,0 +1,124 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/bytealg"
+	"internal/itoa"
+	"io"
+	"net/netip"
+)
+
+// A HostsEntry is a line of a hosts file, such as /etc/hosts: an
+// address followed by the names of the host, the first of which is its
+// canonical name and the others its aliases.
+//
+// A line without an entry, either blank or holding only a comment, has
+// the zero Addr and no names, so that a file can be written back with
+// its comments.
+type HostsEntry struct {
+	Addr          netip.Addr
+	CanonicalName string
+	Aliases       []string
+
+	// Comment is the text following the '#' that starts a comment
+	// on the line, if any, without the '#'.
+	Comment string
+}
+
+// String returns e as a line of a hosts file, without the newline.
+func (e HostsEntry) String() string {
+	var b []byte
+	if e.Addr.IsValid() {
+		b = e.Addr.AppendTo(b)
+		b = append(b, '\t')
+		b = append(b, e.CanonicalName...)
+		for _, a := range e.Aliases {
+			b = append(b, ' ')
+			b = append(b, a...)
+		}
+		if e.Comment != "" {
+			b = append(b, '\t')
+		}
+	}
+	if e.Comment != "" {
+		b = append(b, '#')
+		b = append(b, e.Comment...)
+	}
+	return string(b)
+}
+
+// ParseHosts parses a hosts file in the format of /etc/hosts, in which
+// each line holds an IP address and one or more host names separated by
+// spaces or tabs, and '#' starts a comment running to the end of the
+// line.
+//
+// As the resolver does, ParseHosts skips the lines it cannot parse,
+// such as those with an invalid address or without names. It returns
+// the entries of the other lines along with a *ParseError for the
+// first line skipped, if any.
+func ParseHosts(r io.Reader) ([]HostsEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []HostsEntry
+	var perr error
+	for n := 1; len(data) > 0; n++ {
+		line := data
+		if i := bytealg.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		e, ok := parseHostsLine(string(line))
+		if !ok {
+			if perr == nil {
+				perr = &ParseError{Type: "hosts file line " + itoa.Itoa(n), Text: string(line)}
+			}
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, perr
+}
+
+// parseHostsLine parses a line of a hosts file.
+func parseHostsLine(line string) (e HostsEntry, ok bool) {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+		line, e.Comment = line[:i], line[i+1:]
+	}
+	f := getFields(line)
+	if len(f) == 0 {
+		return e, true
+	}
+	if len(f) < 2 {
+		return e, false
+	}
+	addr, err := netip.ParseAddr(f[0])
+	if err != nil {
+		return e, false
+	}
+	e.Addr = addr
+	e.CanonicalName = f[1]
+	if len(f) > 2 {
+		e.Aliases = f[2:]
+	}
+	return e, true
+}
+
+// FormatHosts returns entries as a hosts file that ParseHosts parses
+// back into the same entries.
+func FormatHosts(entries []HostsEntry) []byte {
+	var b []byte
+	for _, e := range entries {
+		b = append(b, e.String()...)
+		b = append(b, '\n')
+	}
+	return b
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	f, err := os.Open("testdata/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := ParseHosts(f)
+	want := []HostsEntry{
+		{Addr: netip.MustParseAddr("255.255.255.255"), CanonicalName: "broadcasthost"},
+		{Addr: netip.MustParseAddr("127.0.0.2"), CanonicalName: "odin"},
+		{Addr: netip.MustParseAddr("127.0.0.3"), CanonicalName: "odin", Comment: " inline comment "},
+		{Addr: netip.MustParseAddr("::2"), CanonicalName: "odin"},
+		{Addr: netip.MustParseAddr("127.1.1.1"), CanonicalName: "thor"},
+		{Comment: " aliases"},
+		{Addr: netip.MustParseAddr("127.1.1.2"), CanonicalName: "ullr", Aliases: []string{"ullrhost"}},
+		{Addr: netip.MustParseAddr("fe80::1%lo0"), CanonicalName: "localhost"},
+		{Comment: " Bogus entries that must be ignored."},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseHosts = %v; want %v", entries, want)
+	}
+	perr, ok := err.(*ParseError)
+	if !ok || perr.Type != "hosts file line 10" || perr.Text != "123.123.123\tloki" {
+		t.Errorf("ParseHosts error = %v; want invalid hosts file line 10", err)
+	}
+
+	// The entries survive a round trip.
+	b := FormatHosts(entries)
+	again, err := ParseHosts(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ParseHosts(FormatHosts(...)) failed: %v\n%s", err, b)
+	}
+	if !reflect.DeepEqual(again, entries) {
+		t.Errorf("ParseHosts(FormatHosts(...)) = %v; want %v", again, entries)
+	}
+}
+
+func TestHostsEntryString(t *testing.T) {
+	tests := []struct {
+		e    HostsEntry
+		want string
+	}{
+		{HostsEntry{}, ""},
+		{HostsEntry{Comment: " comment"}, "# comment"},
+		{HostsEntry{Addr: netip.MustParseAddr("192.0.2.1"), CanonicalName: "host.example", Aliases: []string{"host", "h"}}, "192.0.2.1\thost.example host h"},
+		{HostsEntry{Addr: netip.MustParseAddr("2001:db8::1"), CanonicalName: "host6", Comment: "v6"}, "2001:db8::1\thost6\t#v6"},
+	}
+	for _, tt := range tests {
+		if got := tt.e.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q; want %q", tt.e, got, tt.want)
+		}
+	}
+
+	entries, err := ParseHosts(strings.NewReader("192.0.2.1 a b\r\n\r\n# c\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(FormatHosts(entries)), "192.0.2.1\ta b\n\n# c\n"; got != want {
+		t.Errorf("FormatHosts = %q; want %q", got, want)
+	}
+}
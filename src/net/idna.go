@@ -0,0 +1,343 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Conversion of internationalized domain names to and from the ASCII
+// names sent in DNS queries: see RFC 5890, RFC 5891 and, for Punycode,
+// RFC 3492.
+//
+// The net package cannot depend on the Unicode tables of package
+// unicode and golang.org/x/net/idna, so the mapping and checks below
+// only cover what can be done without them: see Resolver.StrictIDNA.
+
+package net
+
+import (
+	"errors"
+	"internal/bytealg"
+	"unicode/utf8"
+)
+
+var errInvalidIDN = errors.New("invalid internationalized domain name")
+
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+
+	acePrefix = "xn--"
+)
+
+// idnaToASCII returns name with its U-labels converted to A-labels, as
+// sent in DNS queries. Names that are all ASCII are returned as is,
+// unless strict is set and one of their A-labels is not valid.
+func idnaToASCII(name string, strict bool) (string, error) {
+	if isASCIIString(name) && !strict {
+		return name, nil
+	}
+	if !utf8.ValidString(name) {
+		return "", errInvalidIDN
+	}
+	if !strict {
+		name = idnaMapDots(name)
+	}
+	var b []byte
+	for len(name) > 0 {
+		label := name
+		dot := false
+		if i := bytealg.IndexByteString(name, '.'); i >= 0 {
+			label, name, dot = name[:i], name[i+1:], true
+		} else {
+			name = ""
+		}
+		if hasACEPrefix(label) {
+			if strict {
+				u, err := punyDecode(label[len(acePrefix):])
+				if err != nil || !validULabel(u) || !stringsEqualFold(punyEncode(u), label[len(acePrefix):]) {
+					return "", errInvalidIDN
+				}
+			}
+			b = append(b, label...)
+		} else if isASCIIString(label) {
+			b = append(b, label...)
+		} else {
+			u := []rune(label)
+			if !strict {
+				for i, r := range u {
+					u[i] = idnaLower(r)
+				}
+			}
+			if !validULabel(u) {
+				return "", errInvalidIDN
+			}
+			a := acePrefix + punyEncode(u)
+			if len(a) > 63 {
+				return "", errInvalidIDN
+			}
+			b = append(b, a...)
+		}
+		if dot {
+			b = append(b, '.')
+		}
+	}
+	return string(b), nil
+}
+
+// idnaToUnicode returns name with its A-labels converted to U-labels,
+// for display. Labels that do not decode to a valid U-label are left
+// as they are.
+func idnaToUnicode(name string) string {
+	var b []byte
+	for len(name) > 0 {
+		label := name
+		dot := false
+		if i := bytealg.IndexByteString(name, '.'); i >= 0 {
+			label, name, dot = name[:i], name[i+1:], true
+		} else {
+			name = ""
+		}
+		if hasACEPrefix(label) {
+			puny := []byte(label[len(acePrefix):])
+			lowerASCIIBytes(puny)
+			if u, err := punyDecode(string(puny)); err == nil && validULabel(u) {
+				label = string(u)
+			}
+		}
+		b = append(b, label...)
+		if dot {
+			b = append(b, '.')
+		}
+	}
+	return string(b)
+}
+
+// idnaMapDots replaces the full stops that IDNA treats as label
+// separators with ASCII dots.
+func idnaMapDots(name string) string {
+	var b []byte
+	for i, r := range name {
+		switch r {
+		case 0x3002, 0xff0e, 0xff61: // ideographic, fullwidth and halfwidth full stops
+			if b == nil {
+				b = append(b, name[:i]...)
+			}
+			b = append(b, '.')
+		default:
+			if b != nil {
+				b = utf8.AppendRune(b, r)
+			}
+		}
+	}
+	if b == nil {
+		return name
+	}
+	return string(b)
+}
+
+// idnaLower maps the uppercase ASCII and Latin-1 letters to lowercase.
+func idnaLower(r rune) rune {
+	switch {
+	case 'A' <= r && r <= 'Z',
+		0xc0 <= r && r <= 0xde && r != 0xd7: // but the multiplication sign
+		return r + 0x20
+	}
+	return r
+}
+
+// validULabel reports whether label is a valid U-label: one with at
+// least one code point that is not ASCII, and only code points allowed
+// in U-labels. Without the IDNA tables, only the code points known to
+// be disallowed without them are rejected: uppercase ASCII and Latin-1
+// letters, ASCII and Latin-1 symbols, controls, spaces, punctuation,
+// private use and noncharacters, and those needing a mapping such as
+// fullwidth forms.
+func validULabel(label []rune) bool {
+	n := len(label)
+	if n == 0 || label[0] == '-' || label[n-1] == '-' ||
+		n >= 4 && label[2] == '-' && label[3] == '-' {
+		return false
+	}
+	ascii := true
+	for _, r := range label {
+		if r >= utf8.RuneSelf {
+			ascii = false
+		}
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '-':
+		case r < 0xdf, // ASCII, C1 controls, Latin-1 symbols and capitals
+			r == 0xf7,                  // division sign
+			0x2000 <= r && r <= 0x206f, // general punctuation
+			0x3000 <= r && r <= 0x303f, // CJK symbols and punctuation
+			0xd800 <= r && r <= 0xf8ff, // surrogates and private use
+			0xfdd0 <= r && r <= 0xfdef, // noncharacters
+			0xfe00 <= r && r <= 0xfe0f, // variation selectors
+			0xff00 <= r && r <= 0xffef, // halfwidth and fullwidth forms
+			r&0xfffe == 0xfffe,         // noncharacters
+			r >= 0xf0000:               // private use planes
+			return false
+		}
+	}
+	// Labels of ASCII characters only are not U-labels.
+	return !ascii
+}
+
+// punyEncode returns the Punycode encoding of label, without the ACE
+// prefix.
+func punyEncode(label []rune) string {
+	var out []byte
+	for _, r := range label {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	b := len(out)
+	h := b
+	if b > 0 {
+		out = append(out, '-')
+	}
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h < len(label) {
+		m := rune(utf8.MaxRune + 1)
+		for _, r := range label {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range label {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+// punyDecode returns the code points encoded in s, the Punycode of a
+// label without its ACE prefix.
+func punyDecode(s string) ([]rune, error) {
+	var out []rune
+	if i := last(s, '-'); i >= 0 {
+		for j := 0; j < i; j++ {
+			if s[j] >= utf8.RuneSelf {
+				return nil, errInvalidIDN
+			}
+			out = append(out, rune(s[j]))
+		}
+		s = s[i+1:]
+	}
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for pos := 0; pos < len(s); {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos == len(s) {
+				return nil, errInvalidIDN
+			}
+			digit, ok := punyDigitValue(s[pos])
+			pos++
+			if !ok || digit > (1<<30-i)/w {
+				return nil, errInvalidIDN
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if w > 1<<30 {
+				return nil, errInvalidIDN
+			}
+		}
+		bias = punyAdapt(i-oldi, len(out)+1, oldi == 0)
+		n += rune(i / (len(out) + 1))
+		i %= len(out) + 1
+		if n > utf8.MaxRune || n < punyInitialN || len(out) >= 63 {
+			return nil, errInvalidIDN
+		}
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = n
+		i++
+	}
+	return out, nil
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyDigitValue(c byte) (int, bool) {
+	switch {
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a'), true
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A'), true
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
+
+func hasACEPrefix(label string) bool {
+	return len(label) >= len(acePrefix) && stringsEqualFold(label[:len(acePrefix)], acePrefix)
+}
+
+func isASCIIString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
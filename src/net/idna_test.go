@@ -0,0 +1,87 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import "testing"
+
+// Samples from RFC 3492, section 7.1.
+var punycodeTests = []struct {
+	label, puny string
+}{
+	{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+	{"Hello-Another-Way-それぞれの場所", "Hello-Another-Way--fc4qua05auwb3674vfr0b"},
+	{"MajiでKoiする5秒前", "MajiKoi5-783gue6qz075azm5e"},
+	{"bücher", "bcher-kva"},
+}
+
+func TestPunycode(t *testing.T) {
+	for _, tt := range punycodeTests {
+		if got := punyEncode([]rune(tt.label)); got != tt.puny {
+			t.Errorf("punyEncode(%q) = %q; want %q", tt.label, got, tt.puny)
+		}
+		got, err := punyDecode(tt.puny)
+		if err != nil || string(got) != tt.label {
+			t.Errorf("punyDecode(%q) = %q, %v; want %q", tt.puny, string(got), err, tt.label)
+		}
+	}
+	for _, s := range []string{"99999999999", "a-!", "abc-é"} {
+		if got, err := punyDecode(s); err == nil {
+			t.Errorf("punyDecode(%q) = %q; want error", s, string(got))
+		}
+	}
+}
+
+var idnaToASCIITests = []struct {
+	name   string
+	strict bool
+	want   string // "" for an error
+}{
+	{"example.com.", false, "example.com."},
+	{"bücher.example", false, "xn--bcher-kva.example"},
+	{"bücher.example.", true, "xn--bcher-kva.example."},
+	{"Bücher.EXAMPLE.", false, "xn--bcher-kva.EXAMPLE."},
+	{"BÜCHER.example", false, "xn--bcher-kva.example"},
+	{"例え。テスト", false, "xn--r8jz45g.xn--zckzah"},
+	{"xn--bcher-kva.example", true, "xn--bcher-kva.example"},
+
+	{"Bücher.example", true, ""},      // capital letter
+	{"例え。テスト", true, ""},              // ideographic full stop
+	{"bü-cher!.example", false, ""},   // symbol
+	{"ab--ü.example", false, ""},      // hyphens in the third and fourth positions
+	{"-bücher.example", false, ""},    // leading hyphen
+	{"ｂüｃｈｅｒ.example", false, ""},     // fullwidth forms
+	{"xn--abc-.example", true, ""},    // ASCII only
+	{"\xffbücher.example", false, ""}, // invalid UTF-8
+}
+
+func TestIDNAToASCII(t *testing.T) {
+	for _, tt := range idnaToASCIITests {
+		got, err := idnaToASCII(tt.name, tt.strict)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("idnaToASCII(%q, %v) = %q; want error", tt.name, tt.strict, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("idnaToASCII(%q, %v) = %q, %v; want %q", tt.name, tt.strict, got, err, tt.want)
+		}
+	}
+}
+
+func TestIDNAToUnicode(t *testing.T) {
+	for _, tt := range []struct {
+		name, want string
+	}{
+		{"xn--bcher-kva.example.", "bücher.example."},
+		{"XN--BCHER-KVA.example", "bücher.example"},
+		{"xn--r8jz45g.xn--zckzah", "例え.テスト"},
+		{"xn--abc-.example", "xn--abc-.example"},
+		{"xn--99999999999.example", "xn--99999999999.example"},
+		{"example.com", "example.com"},
+	} {
+		if got := idnaToUnicode(tt.name); got != tt.want {
+			t.Errorf("idnaToUnicode(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
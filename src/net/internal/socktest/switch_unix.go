@@ -10,6 +10,9 @@ package socktest
 type Sockets map[int]Status
 
 func (sw *Switch) sockso(s int) *Status {
+	// Close may be called for descriptors that are not sockets
+	// before any socket has been opened.
+	sw.once.Do(sw.init)
 	sw.smu.RLock()
 	defer sw.smu.RUnlock()
 	so, ok := sw.sotab[s]
@@ -125,6 +125,23 @@ func (addrs addrList) partition(strategy func(Addr) bool) (primaries, fallbacks
 	return
 }
 
+// withIPv4First returns addrs with its IPv4 addresses first. The order
+// of the addresses of each family is kept.
+func (addrs addrList) withIPv4First() addrList {
+	sorted := make(addrList, 0, len(addrs))
+	for _, addr := range addrs {
+		if isIPv4(addr) {
+			sorted = append(sorted, addr)
+		}
+	}
+	for _, addr := range addrs {
+		if !isIPv4(addr) {
+			sorted = append(sorted, addr)
+		}
+	}
+	return sorted
+}
+
 // filterAddrList applies a filter to a list of IP addresses,
 // yielding a list of Addr objects. Known filters are nil, ipv4only,
 // and ipv6only. It returns every address when the filter is nil.
@@ -246,6 +263,17 @@ func JoinHostPort(host, port string) string {
 // family addresses. The result contains at least one address when
 // error is nil.
 func (r *Resolver) internetAddrList(ctx context.Context, net, addr string) (addrList, error) {
+	addrs, err := r.internetAddrListPartial(ctx, net, addr)
+	if len(addrs) > 0 {
+		err = nil
+	}
+	return addrs, err
+}
+
+// internetAddrListPartial is internetAddrList, but returns the
+// addresses found along with any partial error of the lookup, as
+// requested by Resolver.PartialErrors.
+func (r *Resolver) internetAddrListPartial(ctx context.Context, net, addr string) (addrList, error) {
 	var (
 		err        error
 		host, port string
@@ -286,7 +314,7 @@ func (r *Resolver) internetAddrList(ctx context.Context, net, addr string) (addr
 
 	// Try as a literal IP address, then as a DNS name.
 	ips, err := r.lookupIPAddr(ctx, net, host)
-	if err != nil {
+	if err != nil && len(ips) == 0 {
 		return nil, err
 	}
 	// Issue 18806: if the machine has halfway configured
@@ -304,7 +332,11 @@ func (r *Resolver) internetAddrList(ctx context.Context, net, addr string) (addr
 	if net != "" && net[len(net)-1] == '6' {
 		filter = ipv6only
 	}
-	return filterAddrList(filter, ips, inetaddr, host)
+	addrs, ferr := filterAddrList(filter, ips, inetaddr, host)
+	if ferr != nil {
+		return nil, ferr
+	}
+	return addrs, err
 }
 
 func loopbackIP(net string) IP {
@@ -248,6 +248,23 @@ func TestAddrList(t *testing.T) {
 	}
 }
 
+func TestAddrListWithIPv4First(t *testing.T) {
+	addrs := addrList{
+		&TCPAddr{IP: ParseIP("2001:db8::1")},
+		&TCPAddr{IP: IPv4(192, 0, 2, 1)},
+		&TCPAddr{IP: ParseIP("2001:db8::2")},
+		&TCPAddr{IP: IPv4(192, 0, 2, 2)},
+	}
+	want := addrList{addrs[1], addrs[3], addrs[0], addrs[2]}
+	if got := addrs.withIPv4First(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	primaries, fallbacks := addrs.withIPv4First().partition(isIPv4)
+	if !reflect.DeepEqual(primaries, want[:2]) || !reflect.DeepEqual(fallbacks, want[2:]) {
+		t.Errorf("partitioned into %v and %v; want %v and %v", primaries, fallbacks, want[:2], want[2:])
+	}
+}
+
 func TestAddrListPartition(t *testing.T) {
 	addrs := addrList{
 		&IPAddr{IP: ParseIP("fe80::"), Zone: "eth0"},
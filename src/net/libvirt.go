@@ -0,0 +1,378 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// The "libvirt" and "libvirt_guest" sources of nsswitch.conf, which
+// resolve the names of virtual machines from the leases that libvirt's
+// dnsmasq instances record: see src/nss/libvirt_nss.c in libvirt.
+
+package net
+
+import (
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// libvirtLeaseDir holds a .status file of leases for each virtual
+// network of libvirt and a .macs file of the MAC addresses of the
+// guests on it.
+var libvirtLeaseDir = "/var/lib/libvirt/dnsmasq"
+
+// A libvirtLease is an entry of a .status file.
+type libvirtLease struct {
+	ip, mac, hostname string
+	expiry            int64 // seconds since the epoch; 0 if it never expires
+}
+
+// readLibvirtLeases returns the leases in the .status files of dir.
+func readLibvirtLeases(dir string) []libvirtLease {
+	var leases []libvirtLease
+	for _, v := range readLibvirtJSON(dir, ".status") {
+		for _, e := range jsonArray(v) {
+			o, _ := e.(map[string]any)
+			l := libvirtLease{
+				ip:       jsonString(o["ip-address"]),
+				mac:      jsonString(o["mac-address"]),
+				hostname: jsonString(o["hostname"]),
+			}
+			if n, ok := o["expiry-time"].(jsonNumber); ok {
+				l.expiry, _ = n.int64()
+			}
+			if l.ip != "" {
+				leases = append(leases, l)
+			}
+		}
+	}
+	return leases
+}
+
+// readLibvirtMACs returns the MAC addresses of the guests named domain
+// in the .macs files of dir.
+func readLibvirtMACs(dir, domain string) []string {
+	var macs []string
+	for _, v := range readLibvirtJSON(dir, ".macs") {
+		for _, e := range jsonArray(v) {
+			o, _ := e.(map[string]any)
+			if !stringsEqualFold(jsonString(o["domain"]), domain) {
+				continue
+			}
+			for _, m := range jsonArray(o["macs"]) {
+				if s := jsonString(m); s != "" {
+					macs = append(macs, s)
+				}
+			}
+		}
+	}
+	return macs
+}
+
+// readLibvirtJSON returns the JSON values of the files in dir whose
+// names end in suffix. Files that fail to parse are skipped.
+func readLibvirtJSON(dir, suffix string) []any {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var vals []any
+	for _, e := range entries {
+		if e.IsDir() || !stringsHasSuffix(e.Name(), suffix) {
+			continue
+		}
+		b, err := os.ReadFile(dir + "/" + e.Name())
+		if err != nil {
+			continue
+		}
+		if v, ok := parseJSON(b); ok {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// libvirtLookupIP returns the addresses for network that the leases in
+// dir, current at now, give name, along with its canonical name. With
+// guest set, as for the libvirt_guest source, name is the name of a
+// guest, whose leases are found by its MAC addresses; otherwise it is
+// the host name that a guest sent with its DHCP request.
+func libvirtLookupIP(dir string, guest bool, network, name string, now time.Time) (addrs []IPAddr, canonical string) {
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	var macs []string
+	if guest {
+		if macs = readLibvirtMACs(dir, name); len(macs) == 0 {
+			return nil, ""
+		}
+	}
+	for _, l := range readLibvirtLeases(dir) {
+		if l.expiry != 0 && l.expiry < now.Unix() {
+			continue
+		}
+		if guest {
+			found := false
+			for _, m := range macs {
+				if stringsEqualFold(l.mac, m) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		} else if !stringsEqualFold(l.hostname, name) {
+			continue
+		}
+		ip, zone := parseIPZone(l.ip)
+		if ip == nil {
+			continue
+		}
+		switch ipVersion(network) {
+		case '4':
+			if ip.To4() == nil {
+				continue
+			}
+		case '6':
+			if ip.To4() != nil {
+				continue
+			}
+		}
+		addrs = append(addrs, IPAddr{IP: ip, Zone: zone})
+	}
+	if len(addrs) == 0 {
+		return nil, ""
+	}
+	return addrs, ensureRooted(name)
+}
+
+// A jsonNumber is a JSON number as it appears in the text.
+type jsonNumber string
+
+// int64 returns n as an integer, if it is one.
+func (n jsonNumber) int64() (int64, bool) {
+	s := string(n)
+	neg := s != "" && s[0] == '-'
+	if neg {
+		s = s[1:]
+	}
+	if s == "" {
+		return 0, false
+	}
+	var v int64
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' || v > (1<<63-1)/10 {
+			return 0, false
+		}
+		v = v*10 + int64(s[i]-'0')
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
+
+func jsonArray(v any) []any {
+	a, _ := v.([]any)
+	return a
+}
+
+func jsonString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// parseJSON parses b as a JSON value. Objects are returned as
+// map[string]any, arrays as []any, numbers as jsonNumber, and strings,
+// booleans and null as string, bool and nil.
+func parseJSON(b []byte) (any, bool) {
+	d := jsonDecoder{b: b}
+	v, ok := d.value(0)
+	d.space()
+	return v, ok && d.off == len(b)
+}
+
+// jsonMaxDepth bounds the nesting of JSON values.
+const jsonMaxDepth = 64
+
+type jsonDecoder struct {
+	b   []byte
+	off int
+}
+
+func (d *jsonDecoder) space() {
+	for d.off < len(d.b) {
+		switch d.b[d.off] {
+		case ' ', '\t', '\r', '\n':
+			d.off++
+		default:
+			return
+		}
+	}
+}
+
+// literal consumes s if the input continues with it.
+func (d *jsonDecoder) literal(s string) bool {
+	if len(d.b)-d.off < len(s) || string(d.b[d.off:d.off+len(s)]) != s {
+		return false
+	}
+	d.off += len(s)
+	return true
+}
+
+func (d *jsonDecoder) value(depth int) (any, bool) {
+	d.space()
+	if d.off >= len(d.b) || depth > jsonMaxDepth {
+		return nil, false
+	}
+	switch c := d.b[d.off]; {
+	case c == '{':
+		d.off++
+		o := make(map[string]any)
+		d.space()
+		if d.literal("}") {
+			return o, true
+		}
+		for {
+			d.space()
+			k, ok := d.string()
+			if !ok {
+				return nil, false
+			}
+			d.space()
+			if !d.literal(":") {
+				return nil, false
+			}
+			if o[k], ok = d.value(depth + 1); !ok {
+				return nil, false
+			}
+			d.space()
+			if d.literal("}") {
+				return o, true
+			}
+			if !d.literal(",") {
+				return nil, false
+			}
+		}
+	case c == '[':
+		d.off++
+		a := []any{}
+		d.space()
+		if d.literal("]") {
+			return a, true
+		}
+		for {
+			v, ok := d.value(depth + 1)
+			if !ok {
+				return nil, false
+			}
+			a = append(a, v)
+			d.space()
+			if d.literal("]") {
+				return a, true
+			}
+			if !d.literal(",") {
+				return nil, false
+			}
+		}
+	case c == '"':
+		return d.string()
+	case c == '-' || '0' <= c && c <= '9':
+		start := d.off
+		for d.off < len(d.b) && isJSONNumberByte(d.b[d.off]) {
+			d.off++
+		}
+		return jsonNumber(d.b[start:d.off]), true
+	case d.literal("true"):
+		return true, true
+	case d.literal("false"):
+		return false, true
+	case d.literal("null"):
+		return nil, true
+	}
+	return nil, false
+}
+
+// isJSONNumberByte reports whether c may be part of a JSON number.
+func isJSONNumberByte(c byte) bool {
+	return '0' <= c && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func (d *jsonDecoder) string() (string, bool) {
+	if !d.literal(`"`) {
+		return "", false
+	}
+	var s []byte
+	for d.off < len(d.b) {
+		c := d.b[d.off]
+		d.off++
+		switch {
+		case c == '"':
+			return string(s), true
+		case c < ' ':
+			return "", false
+		case c != '\\':
+			s = append(s, c)
+			continue
+		}
+		if d.off >= len(d.b) {
+			return "", false
+		}
+		c = d.b[d.off]
+		d.off++
+		switch c {
+		case '"', '\\', '/':
+			s = append(s, c)
+		case 'b':
+			s = append(s, '\b')
+		case 'f':
+			s = append(s, '\f')
+		case 'n':
+			s = append(s, '\n')
+		case 'r':
+			s = append(s, '\r')
+		case 't':
+			s = append(s, '\t')
+		case 'u':
+			r, ok := d.hex4()
+			if !ok {
+				return "", false
+			}
+			if 0xd800 <= r && r < 0xdc00 && d.literal(`\u`) {
+				// A surrogate pair.
+				r2, ok := d.hex4()
+				if !ok {
+					return "", false
+				}
+				r = 0x10000 + (r-0xd800)<<10 + (r2 - 0xdc00)
+			}
+			s = utf8.AppendRune(s, r)
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func (d *jsonDecoder) hex4() (rune, bool) {
+	if len(d.b)-d.off < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range d.b[d.off : d.off+4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	d.off += 4
+	return r, true
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLibvirtLookupIP(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	tests := []struct {
+		guest         bool
+		network, name string
+		addrs         []IPAddr
+		canonical     string
+	}{
+		{false, "ip", "fedora", []IPAddr{{IP: ParseIP("192.168.122.45")}, {IP: ParseIP("fd00:122::45")}}, "fedora."},
+		{false, "ip4", "FEDORA.", []IPAddr{{IP: ParseIP("192.168.122.45")}}, "FEDORA."},
+		{false, "ip6", "fedora", []IPAddr{{IP: ParseIP("fd00:122::45")}}, "fedora."},
+		{false, "ip", "fedora-vm", nil, ""},
+		{false, "ip", "debian", nil, ""}, // expired
+		{true, "ip", "fedora-vm", []IPAddr{{IP: ParseIP("192.168.122.45")}, {IP: ParseIP("fd00:122::45")}}, "fedora-vm."},
+		{true, "ip", "fedora", nil, ""},
+		{true, "ip", "debian-vm", nil, ""},
+	}
+	for _, tt := range tests {
+		addrs, canonical := libvirtLookupIP("testdata/libvirt", tt.guest, tt.network, tt.name, now)
+		if !reflect.DeepEqual(addrs, tt.addrs) || canonical != tt.canonical {
+			t.Errorf("libvirtLookupIP(%v, %q, %q) = %v, %q; want %v, %q", tt.guest, tt.network, tt.name, addrs, canonical, tt.addrs, tt.canonical)
+		}
+	}
+	if addrs, _ := libvirtLookupIP("testdata/nonexistent", false, "ip", "fedora", now); addrs != nil {
+		t.Errorf("lookup in a missing directory = %v", addrs)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+		ok   bool
+	}{
+		{`{"a": [1, -2.5e3, true, false, null], "b": {}}`, map[string]any{
+			"a": []any{jsonNumber("1"), jsonNumber("-2.5e3"), true, false, nil},
+			"b": map[string]any{},
+		}, true},
+		{` "é😀\n\"" `, "é😀\n\"", true},
+		{`[]`, []any{}, true},
+		{`[1,]`, nil, false},
+		{`{"a" 1}`, nil, false},
+		{`"unterminated`, nil, false},
+		{`[1] 2`, nil, false},
+		{"\"a\tb\"", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseJSON([]byte(tt.in))
+		if ok != tt.ok || ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJSON(%q) = %#v, %v; want %#v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// Link-Local Multicast Name Resolution: see RFC 4795.
+
+package net
+
+import (
+	"context"
+	"internal/bytealg"
+	"runtime"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// llmnrEnabled reports whether Go's resolver uses LLMNR. Only
+	// Windows relies on it for resolving the names of peers.
+	llmnrEnabled = runtime.GOOS == "windows"
+
+	llmnrPort = 5355
+
+	// llmnrTimeout is how long to wait for responses to a query.
+	// See RFC 4795, section 7.
+	llmnrTimeout = time.Second
+)
+
+var (
+	llmnrGroup4 = &UDPAddr{IP: IPv4(224, 0, 0, 252), Port: llmnrPort}
+	llmnrGroup6 = &UDPAddr{IP: IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0, 0x03}, Port: llmnrPort}
+)
+
+// useLLMNR reports whether Go's resolver should fall back to LLMNR to
+// resolve name after DNS failed to. As on Windows itself, only
+// single-label names are resolved with LLMNR.
+func useLLMNR(name string) bool {
+	if !llmnrEnabled {
+		return false
+	}
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	return name != "" && bytealg.IndexByteString(name, '.') < 0
+}
+
+// llmnrLookupIP looks up the addresses of name for network using LLMNR,
+// querying over IPv4 and IPv6 in parallel.
+func llmnrLookupIP(ctx context.Context, network, name string) ([]IPAddr, error) {
+	type query struct {
+		network string
+		group   *UDPAddr
+		qtypes  []dnsmessage.Type
+	}
+	queries := []query{
+		{"udp4", llmnrGroup4, []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}},
+		{"udp6", llmnrGroup6, []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}},
+	}
+	switch ipVersion(network) {
+	case '4':
+		queries[0].qtypes = queries[0].qtypes[:1]
+		queries[1].qtypes = queries[1].qtypes[:1]
+	case '6':
+		queries[0].qtypes = queries[0].qtypes[1:]
+		queries[1].qtypes = queries[1].qtypes[1:]
+	}
+
+	ch := make(chan []IPAddr, len(queries))
+	for _, q := range queries {
+		go func(q query) {
+			// Failures, such as a missing IPv6 stack, only mean
+			// that fewer addresses are found.
+			c, err := ListenPacket(q.network, ":0")
+			if err != nil {
+				ch <- nil
+				return
+			}
+			defer c.Close()
+			addrs, _ := llmnrQuery(ctx, c, q.group, name, q.qtypes)
+			ch <- addrs
+		}(q)
+	}
+	var addrs []IPAddr
+	for range queries {
+		addrs = append(addrs, <-ch...)
+	}
+	if len(addrs) == 0 {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	}
+	sortByRFC6724(addrs)
+	return addrs, nil
+}
+
+// llmnrQuery sends LLMNR queries for name, one for each of qtypes, on c
+// to dst, and returns the addresses in the responses. It waits for
+// responses until each query got one, or llmnrTimeout elapses.
+func llmnrQuery(ctx context.Context, c PacketConn, dst Addr, name string, qtypes []dnsmessage.Type) ([]IPAddr, error) {
+	n, err := dnsmessage.NewName(ensureRooted(name))
+	if err != nil {
+		return nil, errCannotMarshalDNSMessage
+	}
+	pending := make(map[uint16]dnsmessage.Question)
+	for _, qtype := range qtypes {
+		q := dnsmessage.Question{Name: n, Type: qtype, Class: dnsmessage.ClassINET}
+		id := uint16(randInt())
+		m := dnsmessage.Message{Header: dnsmessage.Header{ID: id}, Questions: []dnsmessage.Question{q}}
+		b, err := m.Pack()
+		if err != nil {
+			return nil, errCannotMarshalDNSMessage
+		}
+		if _, err := c.WriteTo(b, dst); err != nil {
+			return nil, err
+		}
+		pending[id] = q
+	}
+
+	deadline := time.Now().Add(llmnrTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetReadDeadline(deadline)
+
+	var addrs []IPAddr
+	b := make([]byte, 9194) // see RFC 4795, section 2.1
+	for len(pending) > 0 {
+		nr, _, err := c.ReadFrom(b)
+		if err != nil {
+			// Most likely the deadline: return what we have.
+			break
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(b[:nr])
+		if err != nil {
+			continue
+		}
+		q, ok := pending[h.ID]
+		if !ok {
+			continue
+		}
+		rq, err := p.Question()
+		if err != nil || !checkResponse(h.ID, q, h, rq) || h.RCode != dnsmessage.RCodeSuccess {
+			continue
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			continue
+		}
+		delete(pending, h.ID)
+	loop:
+		for {
+			ah, err := p.AnswerHeader()
+			if err != nil {
+				break
+			}
+			switch ah.Type {
+			case dnsmessage.TypeA:
+				a, err := p.AResource()
+				if err != nil {
+					break loop
+				}
+				addrs = append(addrs, IPAddr{IP: IP(a.A[:])})
+			case dnsmessage.TypeAAAA:
+				aaaa, err := p.AAAAResource()
+				if err != nil {
+					break loop
+				}
+				addrs = append(addrs, IPAddr{IP: IP(aaaa.AAAA[:])})
+			default:
+				if err := p.SkipAnswer(); err != nil {
+					break loop
+				}
+			}
+		}
+	}
+	return addrs, nil
+}
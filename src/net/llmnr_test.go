@@ -0,0 +1,84 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestUseLLMNR(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"peer", true},
+		{"peer.", true},
+		{"peer.example.com", false},
+		{"", false},
+	} {
+		if got := useLLMNR(tt.name); got != (tt.want && llmnrEnabled) {
+			t.Errorf("useLLMNR(%q) = %v; want %v", tt.name, got, tt.want && llmnrEnabled)
+		}
+	}
+}
+
+func TestLLMNRQuery(t *testing.T) {
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 is not supported")
+	}
+	responder := newLocalPacketListener(t, "udp4")
+	done := make(chan struct{})
+	defer func() {
+		responder.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		b := make([]byte, 512)
+		for {
+			n, from, err := responder.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var q dnsmessage.Message
+			if err := q.Unpack(b[:n]); err != nil || len(q.Questions) != 1 {
+				t.Errorf("bad LLMNR query: %v", err)
+				return
+			}
+			m := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, Response: true},
+				Questions: q.Questions,
+			}
+			if q.Questions[0].Type == dnsmessage.TypeA && q.Questions[0].Name.String() == "peer." {
+				m.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 30},
+					Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 9}},
+				}}
+			}
+			resp, err := m.Pack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			responder.WriteTo(resp, from)
+		}
+	}()
+
+	c := newLocalPacketListener(t, "udp4")
+	defer c.Close()
+	addrs, err := llmnrQuery(context.Background(), c, responder.LocalAddr(), "peer", []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []IPAddr{{IP: IPv4(192, 0, 2, 9).To4()}}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("llmnrQuery = %v; want %v", addrs, want)
+	}
+}
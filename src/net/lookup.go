@@ -7,10 +7,16 @@ package net
 import (
 	"context"
 	"errors"
+	"internal/itoa"
 	"internal/nettrace"
 	"internal/singleflight"
 	"net/netip"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"golang.org/x/net/dns/dnsmessage"
 )
@@ -21,7 +27,8 @@ import (
 //
 // See https://www.iana.org/assignments/protocol-numbers
 //
-// On Unix, this map is augmented by readProtocols via lookupProtocol.
+// On Unix, the entries of /etc/protocols, read by lookupProtocol, take
+// precedence over those of this map.
 var protocols = map[string]int{
 	"icmp":      1,
 	"igmp":      2,
@@ -35,7 +42,9 @@ var protocols = map[string]int{
 //
 // See https://www.iana.org/assignments/service-names-port-numbers
 //
-// On Unix, this map is augmented by readServices via goLookupPort.
+// On Unix, the entries of /etc/services, read by goLookupPort, take
+// precedence over those of this map, and the entries added with
+// AddServices over both.
 var services = map[string]map[string]int{
 	"udp": {
 		"domain": 53,
@@ -89,6 +98,12 @@ func lookupPortMap(network, service string) (port int, error error) {
 		network = "udp"
 	}
 
+	servicesDB.Lock()
+	port, ok := lookupServicesDB(network, service, true)
+	servicesDB.Unlock()
+	if ok {
+		return port, nil
+	}
 	if m, ok := services[network]; ok {
 		var lowerService [maxPortBufSize]byte
 		n := copy(lowerService[:], service)
@@ -100,6 +115,77 @@ func lookupPortMap(network, service string) (port int, error error) {
 	return 0, &AddrError{Err: "unknown port", Addr: network + "/" + service}
 }
 
+// isLocalhost reports whether h, without a trailing dot, is localhost,
+// a name under it, or localhost.localdomain or a name under that.
+func isLocalhost(h string) bool {
+	return stringsEqualFold(h, "localhost") || stringsEqualFold(h, "localhost.localdomain") || stringsHasSuffixFold(h, ".localhost") || stringsHasSuffixFold(h, ".localhost.localdomain")
+}
+
+// isInvalidName reports whether h, rooted or not, is invalid or a name
+// under it, which RFC 6761 reserves for names that are known not to
+// exist.
+func isInvalidName(h string) bool {
+	if stringsHasSuffix(h, ".") {
+		h = h[:len(h)-1]
+	}
+	return stringsEqualFold(h, "invalid") || stringsHasSuffixFold(h, ".invalid")
+}
+
+// isTestingName reports whether h, rooted or not, is under test or
+// example, the domains RFC 6761 reserves for testing and documentation,
+// which have no use in the global DNS.
+func isTestingName(h string) bool {
+	if stringsHasSuffix(h, ".") {
+		h = h[:len(h)-1]
+	}
+	return stringsEqualFold(h, "test") || stringsHasSuffixFold(h, ".test") ||
+		stringsEqualFold(h, "example") || stringsHasSuffixFold(h, ".example")
+}
+
+// isOnionName reports whether h, rooted or not, is onion or a name
+// under it, the names of Tor onion services (RFC 7686).
+func isOnionName(h string) bool {
+	if stringsHasSuffix(h, ".") {
+		h = h[:len(h)-1]
+	}
+	return stringsEqualFold(h, "onion") || stringsHasSuffixFold(h, ".onion")
+}
+
+// reservedNameError returns the error for a query about name, rooted or
+// not, that is never sent to name servers: ErrOnionName for the names
+// of onion services (RFC 7686), and not found for those under invalid
+// (RFC 6761). It returns nil for the other names.
+func reservedNameError(name string) error {
+	switch {
+	case isOnionName(name):
+		return &DNSError{Err: ErrOnionName.Error(), Name: name, IsNotFound: true, UnwrapErr: ErrOnionName}
+	case isInvalidName(name):
+		return &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	}
+	return nil
+}
+
+// localhostAddrs returns the loopback addresses for network if host is
+// one of the localhost names, which RFC 6761 reserves for the loopback
+// addresses: they are answered without consulting the hosts file, DNS
+// or the system's resolver.
+func localhostAddrs(network, host string) ([]IPAddr, bool) {
+	if stringsHasSuffix(host, ".") {
+		host = host[:len(host)-1]
+	}
+	if !isLocalhost(host) {
+		return nil, false
+	}
+	var addrs []IPAddr
+	if ipVersion(network) != '6' {
+		addrs = append(addrs, IPAddr{IP: IPv4(127, 0, 0, 1)})
+	}
+	if ipVersion(network) != '4' {
+		addrs = append(addrs, IPAddr{IP: IPv6loopback})
+	}
+	return addrs, true
+}
+
 // ipVersion returns the provided network's IP version: '4', '6' or 0
 // if network does not end in a '4' or '6' byte.
 func ipVersion(network string) byte {
@@ -136,6 +222,17 @@ type Resolver struct {
 	// with resolvers that process AAAA queries incorrectly.
 	StrictErrors bool
 
+	// PartialErrors makes LookupIPAddr, LookupIP and LookupNetIP
+	// report the failure of one of the A and AAAA queries of a host
+	// whose other query found addresses, when StrictErrors is not
+	// set. The addresses found are then returned along with the
+	// *DNSError of the failed query, whose Type tells which family
+	// was lost, so that a failed IPv6 lookup can be told from the
+	// absence of IPv6 addresses. Other lookups, and dials, use the
+	// addresses and ignore such errors. PartialErrors only affects
+	// Go's built-in resolver.
+	PartialErrors bool
+
 	// Dial optionally specifies an alternate dialer for use by
 	// Go's built-in DNS resolver to make TCP and UDP connections
 	// to DNS services. The host in the address parameter will
@@ -149,18 +246,624 @@ type Resolver struct {
 	// If nil, the default dialer is used.
 	Dial func(ctx context.Context, network, address string) (Conn, error)
 
+	// CgoFallback causes host and address lookups to be tried with
+	// Go's built-in resolver first, as with PreferGo, and retried
+	// with the native (cgo) resolver only if that fails. It is
+	// equivalent to setting GODEBUG=netdns=go+cgo, but scoped to
+	// just this resolver. CgoFallback is ignored on Windows and
+	// Plan 9, and the retry is skipped when cgo is not available.
+	CgoFallback bool
+
+	// CgoRetryOnServerFailure causes host and address lookups that
+	// fail in Go's built-in resolver because the DNS server answered
+	// with SERVFAIL, REFUSED or another server failure code to be
+	// retried with the native (cgo) resolver. Unlike CgoFallback it
+	// does not imply PreferGo, and other failures, such as a name
+	// that does not exist or a timeout, are reported immediately.
+	// CgoRetryOnServerFailure is ignored on Windows and Plan 9, and
+	// the retry is skipped when cgo is not available.
+	CgoRetryOnServerFailure bool
+
+	// RaceCgo causes host and address lookups to be issued through
+	// Go's built-in resolver and the native (cgo) resolver at the
+	// same time. The first successful answer is returned and the
+	// other lookup is cancelled; if both fail, the error from Go's
+	// resolver is returned. This trades extra DNS traffic for lower
+	// latency. RaceCgo implies PreferGo for all other lookups.
+	// It is ignored on Windows and Plan 9, and without cgo only Go's
+	// resolver is used.
+	RaceCgo bool
+
+	// ConfigPath optionally specifies the resolv.conf file used by
+	// Go's built-in DNS resolver for lookups made through this
+	// Resolver, instead of the process-wide file (see
+	// SetResolvConfPath). Setting it implies PreferGo, because the
+	// native resolver cannot be pointed at another file. The parsed
+	// file is shared by the Resolvers naming it, and dropped once
+	// none has used it for several minutes.
+	// ConfigPath is ignored on Windows and Plan 9.
+	ConfigPath string
+
+	// Servers optionally specifies the name servers queried by Go's
+	// built-in DNS resolver for lookups made through this Resolver,
+	// taking precedence over those listed in resolv.conf or set by
+	// SetDNSConfig. A zero port means port 53. Setting it implies
+	// PreferGo, because the native resolver cannot be told to use
+	// other servers.
+	Servers []netip.AddrPort
+
+	// Search optionally specifies the domain suffixes tried by Go's
+	// built-in DNS resolver for names made through this Resolver,
+	// replacing the search list of resolv.conf or SetDNSConfig.
+	// This allows, for example, avoiding the many suffixes of a
+	// Kubernetes pod's configuration for lookups of external names.
+	// Setting it implies PreferGo.
+	Search []string
+
+	// Ndots optionally specifies the number of dots a name looked
+	// up through this Resolver must contain to be tried as an
+	// absolute name before the search list is applied, replacing
+	// the ndots option of resolv.conf or SetDNSConfig. If zero, the
+	// configured value is used. A negative value means no dots are
+	// needed, so that every name is first tried as is. Values above
+	// 15 are treated as 15. Setting it implies PreferGo.
+	Ndots int
+
+	// NoSearch causes Go's built-in DNS resolver to treat every name
+	// looked up through this Resolver as rooted, as if it ended in a
+	// dot, so that neither the search list nor ndots apply. It takes
+	// precedence over Search and Ndots. Setting it implies PreferGo.
+	NoSearch bool
+
+	// ParallelSearch causes Go's built-in DNS resolver to query all
+	// the names produced by the search list at once, instead of one
+	// after the other. The answer for the first name in search order
+	// that exists is still the one returned, but a lookup no longer
+	// waits for each preceding name to fail in turn. This cuts the
+	// latency of lookups that go through long search lists, as in
+	// Kubernetes pods, at the cost of more queries. Setting it
+	// implies PreferGo.
+	ParallelSearch bool
+
+	// EDNSPayloadSize is the UDP payload size, in bytes, that Go's
+	// built-in DNS resolver advertises in the EDNS0 record of its
+	// queries (RFC 6891), and thus the largest UDP response it
+	// accepts before falling back to TCP. If zero, 1232 bytes is
+	// used, as recommended by DNS Flag Day 2020. Values below 512
+	// are treated as 512. Setting it implies PreferGo.
+	EDNSPayloadSize uint16
+
+	// EDNSOptions lists EDNS0 options, such as Client Subnet
+	// (RFC 7871) or Padding (RFC 7830), that Go's built-in DNS
+	// resolver adds to every query. Setting it implies PreferGo.
+	EDNSOptions []EDNSOption
+
+	// DNSCookies causes Go's built-in DNS resolver to send DNS
+	// cookies (RFC 7873) with its queries, and to discard responses
+	// that echo a wrong client cookie. This protects against
+	// off-path spoofing and helps servers that rate-limit clients
+	// without cookies. The cookies learned are kept by each
+	// Resolver, and not shared with the others or with its clones.
+	// Setting it implies PreferGo.
+	DNSCookies bool
+
+	// DialTimeout, if not zero, bounds the time Go's built-in DNS
+	// resolver spends connecting to a server, such as the TCP
+	// handshake of a query over TCP, or a call to Dial. It is taken
+	// out of the timeout of the query, which otherwise bounds the
+	// connection and the exchange together, so that a server that
+	// does not accept connections is given up on sooner in favor of
+	// the next one. Setting it implies PreferGo.
+	DialTimeout time.Duration
+
+	// QNAMEMinimization keeps the names looked up by Go's built-in
+	// DNS resolver from its name servers, for use with forwarding
+	// servers that are only partly trusted (RFC 9156). The servers
+	// are asked for the NS records of the domains above each name,
+	// one label at a time from the top-level domain down, and the
+	// query for the name itself goes to the name servers of the
+	// closest zone found, as do those for the names its CNAME
+	// records lead to. The names of those name servers, which are
+	// public, are looked up in full. The zones found are remembered
+	// for as long as the TTLs of their NS records allow, at most an
+	// hour, so that only the first lookup in a zone costs the extra
+	// queries. As the queries for names bypass the forwarding
+	// servers, names in zones whose name servers cannot be reached
+	// directly, such as those of split-horizon or internal zones,
+	// fail to resolve. Setting it implies PreferGo.
+	QNAMEMinimization bool
+
+	// MaxConcurrentQueries, if positive, limits the number of
+	// queries Go's built-in DNS resolver has outstanding at a time
+	// for lookups made through this Resolver, so that bursts of
+	// lookups do not overwhelm small forwarders, such as the embedded
+	// DNS server of Docker. Further queries wait for one to finish,
+	// and the wait counts towards their timeout. Zone transfers and
+	// the requests sent to SOCKS5Proxy count as queries too, each
+	// holding its slot until it is done. The limit is read when the
+	// first query is sent and must not be changed after.
+	// Setting it implies PreferGo.
+	MaxConcurrentQueries int
+
+	// UDPPortMin and UDPPortMax optionally restrict the local ports
+	// from which Go's built-in DNS resolver sends queries over UDP,
+	// for firewalls that only allow certain ranges. Each query uses
+	// a random port in the range, skipping ports already in use.
+	// If UDPPortMin is zero, the system picks the port. If UDPPortMax
+	// is less than UDPPortMin, all queries are sent from UDPPortMin.
+	// The range has no effect when Dial is set. Setting it implies
+	// PreferGo.
+	UDPPortMin, UDPPortMax uint16
+
+	// UDPConnsPerServer, if positive, makes Go's built-in DNS
+	// resolver send its queries over UDP on up to that many sockets
+	// to each server, shared by all the queries in flight and kept
+	// open between lookups, instead of on a new socket per query.
+	// Responses are matched to their queries by ID. This saves
+	// system calls and local ports for resolvers sending many
+	// queries, at the cost of using the same few ports for longer.
+	// Sockets idle for a while are closed. The A and AAAA queries of
+	// a lookup may then share a socket even with the
+	// single-request-reopen option of resolv.conf, which asks for a
+	// fresh one for each. It has no effect when Dial is set. Setting
+	// it implies PreferGo.
+	UDPConnsPerServer int
+
+	// Interface, if not empty, is the name of the network interface,
+	// such as "wlan0", to which Go's built-in DNS resolver binds the
+	// sockets it sends queries on, with SO_BINDTODEVICE, so that the
+	// queries of multi-homed hosts leave through that interface
+	// whatever the routing table says. It is only supported on Linux
+	// and Android, where binding may need privileges, and has no
+	// effect when Dial is set. Setting it implies PreferGo.
+	Interface string
+
+	// NetworkHandle, if not zero, is the handle of the Android
+	// network, as returned by android.net.Network.getNetworkHandle,
+	// through which Go's built-in DNS resolver sends its queries,
+	// with android_setsocknetwork. The name servers are still those
+	// of the configuration; see ConfigPath and Servers. It needs
+	// Android 6.0 or later and a program built with cgo, and has no
+	// effect when Dial is set. Setting it implies PreferGo.
+	NetworkHandle uint64
+
+	// SOCKS5Proxy, if not empty, is the address of a SOCKS5 proxy,
+	// such as Tor's "127.0.0.1:9050", that resolves names for this
+	// Resolver, so that they are never resolved locally. It must be
+	// an IP address and port, and the proxy must accept clients
+	// without authentication. Address lookups (and the lookups of
+	// Dialers using this Resolver) send the proxy the RESOLVE
+	// command, and LookupAddr its RESOLVE_PTR command, both of
+	// which Tor adds to SOCKS5; the proxy returns a single address
+	// per name. Neither the hosts file nor DNS servers are used,
+	// and the other lookups, such as LookupMX, fail. The proxy is
+	// dialed with Dial if it is set.
+	SOCKS5Proxy string
+
+	// NamePolicy, if not nil, is called with the name of each lookup
+	// made through this Resolver, by Go's resolver or the native
+	// one, before the lookup starts, so that applications can
+	// restrict which names are resolved. It returns the name to
+	// look up instead, which may be name itself or an IP address,
+	// or an error that makes the lookup fail. A non-DNSError error
+	// is wrapped in a DNSError. For LookupAddr, name is the address;
+	// for LookupSRV and LookupTLSA, it is the domain name, without
+	// the service and protocol labels. Internationalized names are
+	// passed in their ASCII form (see StrictIDNA). NamePolicy is not
+	// called for IP addresses given to the address lookups, nor for
+	// Exchange, TransferZone and Update, which send messages built
+	// by the caller.
+	NamePolicy func(ctx context.Context, name string) (string, error)
+
+	// StrictIDNA turns off the lenient mapping of internationalized
+	// domain names, such as "bücher.example", before their labels
+	// are converted to the "xn--" ASCII form sent in DNS queries.
+	// By default, ASCII and Latin-1 capitals are lowercased and the
+	// ideographic full stop is read as a dot. With StrictIDNA, names
+	// needing that mapping fail to resolve instead, as do names with
+	// "xn--" labels that are not the exact encoding of a label that
+	// passes the checks below. Either way, only the checks of
+	// IDNA2008 (RFC 5890) that need no Unicode tables are made: on
+	// hyphens, and on the few ranges of symbols, punctuation,
+	// controls and noncharacters that the package knows about. Names
+	// are not normalized, and other capitals and disallowed
+	// characters are neither mapped nor rejected, so StrictIDNA does
+	// not ensure that a name is valid IDNA2008.
+	StrictIDNA bool
+
+	// UnicodeNames makes LookupAddr return the names it finds with
+	// their "xn--" labels converted to Unicode, for display.
+	UnicodeNames bool
+
+	// LocalTestNames makes Go's built-in DNS resolver answer the
+	// names under test and example, which RFC 6761 reserves for
+	// testing and documentation, as not found instead of sending
+	// their queries to the name servers of the system, so that the
+	// names of development environments do not leak to the global
+	// DNS. The queries directed elsewhere, by Dial, Servers or
+	// ConfigPath, or by a resolver of their own for the domain, such
+	// as a file in /etc/resolver on macOS or a Name Resolution Policy
+	// Table rule on Windows, are still sent, and the hosts file still
+	// applies. By default, these names are queried like any other,
+	// which local name servers such as dnsmasq may answer. Setting it
+	// implies PreferGo.
+	LocalTestNames bool
+
+	// AddrQueries sets how Go's built-in DNS resolver sends the A
+	// and AAAA queries of a lookup for the addresses of both
+	// families. By default both are sent at the same time, and both
+	// answers are waited for. Setting it implies PreferGo.
+	AddrQueries AddrQueryMode
+
+	// Backoff, if not nil, paces the retries of Go's built-in DNS
+	// resolver. Before each query for a name and type but the first,
+	// it is called with the server about to be queried and the
+	// number of queries for the same name and type sent to that
+	// server before. It returns how long to wait before sending the
+	// query, or false to skip the server. If nil, queries are sent
+	// back to back. See ExponentialBackoff.
+	Backoff func(server string, attempt int) (delay time.Duration, ok bool)
+
+	// NameValidation sets which names Go's built-in DNS resolver
+	// accepts to look up. Names it rejects are reported as not
+	// found without any query being sent. Setting it implies
+	// PreferGo.
+	NameValidation NameValidationMode
+
+	// KeepMalformedRecords makes LookupCNAME, LookupMX, LookupNS,
+	// LookupSRV, LookupNAPTR and LookupAddr return the records that
+	// hold invalid domain names, such as targets with characters
+	// other than letters, digits, hyphens and underscores, instead of
+	// dropping them. Such records are still reported by the error
+	// returned alongside them, which wraps a *MalformedRecordsError
+	// listing the invalid names.
+	KeepMalformedRecords bool
+
+	// ValidateName, if not nil, replaces NameValidation: Go's
+	// built-in DNS resolver only looks up the names, in
+	// presentation format, for which it returns true. Names must
+	// still fit in a DNS message. Setting it implies PreferGo.
+	ValidateName func(name string) bool
+
+	// SRVOrder sets how LookupSRV orders the records it returns. By
+	// default, they are sorted by priority, and those of the same
+	// priority shuffled by weight, as RFC 2782 describes.
+	SRVOrder SRVOrderMode
+
+	// SRVRand, if not nil, replaces the source of the random numbers
+	// with which LookupSRV shuffles records by weight: it returns a
+	// number in [0, n). Tests can set it to make the order of the
+	// records predictable.
+	SRVRand func(n int) int
+
 	// lookupGroup merges LookupIPAddr calls together for lookups for the same
 	// host. The lookupGroup key is the LookupIPAddr.host argument.
 	// The return values are ([]IPAddr, error).
 	lookupGroup singleflight.Group
 
+	// udpPool holds the UDP sockets shared when UDPConnsPerServer
+	// is set. It is made by getUDPPool.
+	udpPoolOnce sync.Once
+	udpPool     *dnsUDPPool
+
+	// overridden caches the configuration that withOverrides last
+	// derived from the system one, so that lookups share its server
+	// offset, which the rotate option advances.
+	overridden atomic.Pointer[overriddenDNSConfig]
+
+	// cookies maps the addresses of the servers queried with
+	// DNSCookies set, in host:port form, to the *dnsCookie holding
+	// the cookies exchanged with each.
+	cookies sync.Map
+
+	// zoneCuts caches the zone cuts found when QNAMEMinimization
+	// is set.
+	zoneCuts zoneCutCache
+
+	// querySlots bounds the queries in flight when
+	// MaxConcurrentQueries is set. It is made by getQuerySlots.
+	querySlotsOnce sync.Once
+	querySlots     chan struct{}
+
 	// TODO(bradfitz): optional interface impl override hook
 	// TODO(bradfitz): Timeout time.Duration?
 }
 
-func (r *Resolver) preferGo() bool     { return r != nil && r.PreferGo }
+func (r *Resolver) preferGo() bool {
+	return r != nil && (r.PreferGo || r.goOnly() || r.cgoFallback() || r.raceCgo())
+}
+
+// goOnly reports whether r has settings that only Go's built-in
+// resolver supports, and which therefore imply PreferGo.
+func (r *Resolver) goOnly() bool {
+	return r.configPath() != "" ||
+		len(r.Servers) > 0 ||
+		len(r.Search) > 0 ||
+		r.Ndots != 0 ||
+		r.NoSearch ||
+		r.ParallelSearch ||
+		r.EDNSPayloadSize != 0 ||
+		len(r.EDNSOptions) > 0 ||
+		r.DNSCookies ||
+		r.DialTimeout != 0 ||
+		r.MaxConcurrentQueries > 0 ||
+		r.QNAMEMinimization ||
+		r.UDPPortMin != 0 ||
+		r.UDPConnsPerServer > 0 ||
+		r.LocalTestNames ||
+		r.Interface != "" ||
+		r.NetworkHandle != 0 ||
+		r.AddrQueries != AddrQueryParallel ||
+		r.NameValidation != NameValidationDefault ||
+		r.ValidateName != nil
+}
+
+// An AddrQueryMode sets how Go's built-in DNS resolver asks for the
+// IPv4 (A) and IPv6 (AAAA) addresses of a host.
+type AddrQueryMode int
+
+const (
+	// AddrQueryParallel sends the A and AAAA queries at the same
+	// time and waits for both answers.
+	AddrQueryParallel AddrQueryMode = iota
+
+	// AddrQuerySerial sends the AAAA query only once the A query is
+	// answered, as the single-request option of resolv.conf does,
+	// for servers that mishandle simultaneous queries.
+	AddrQuerySerial
+
+	// AddrQueryPreferIPv4 and AddrQueryPreferIPv6 send both queries
+	// at the same time, but once the query of the preferred family
+	// is answered with addresses, the lookup returns without waiting
+	// for the other one, which is canceled.
+	AddrQueryPreferIPv4
+	AddrQueryPreferIPv6
+
+	// AddrQueryFirstAnswer sends both queries at the same time and
+	// returns the addresses of whichever query is first answered
+	// with addresses, canceling the other one.
+	AddrQueryFirstAnswer
+)
+
+// An SRVOrderMode sets how LookupSRV orders SRV records.
+type SRVOrderMode int
+
+const (
+	// SRVOrderWeighted sorts the records by priority, and shuffles
+	// those of the same priority by weight, so that clients spread
+	// their load over the servers as RFC 2782 describes.
+	SRVOrderWeighted SRVOrderMode = iota
+
+	// SRVOrderSorted sorts the records by priority and then by
+	// weight, both ascending, keeping the order of the response for
+	// those that are equal.
+	SRVOrderSorted
+
+	// SRVOrderNone keeps the records in the order of the response,
+	// as the zone or the server ordered them.
+	SRVOrderNone
+)
+
+// A NameValidationMode sets which names Go's built-in DNS resolver
+// accepts to look up.
+type NameValidationMode int
+
+const (
+	// NameValidationDefault accepts names made of letters, digits,
+	// hyphens and underscores, such as "_sip._tcp.example.com",
+	// with at least one label that is not all digits.
+	NameValidationDefault NameValidationMode = iota
+
+	// NameValidationStrict only accepts host names as defined by
+	// RFC 952 and RFC 1123: labels of letters, digits and hyphens
+	// that neither start nor end with a hyphen, and a last label
+	// that is not all digits.
+	NameValidationStrict
+
+	// NameValidationPermissive accepts any name that fits in a DNS
+	// message: labels of 1 to 63 bytes, of any value but the dot,
+	// adding up to at most 253 bytes.
+	NameValidationPermissive
+)
+
+// validName reports whether Go's built-in resolver may look up name.
+func (r *Resolver) validName(name string) bool {
+	if r == nil {
+		return isDomainName(name)
+	}
+	if r.ValidateName != nil {
+		return isWireDomainName(name) && r.ValidateName(name)
+	}
+	switch r.NameValidation {
+	case NameValidationStrict:
+		return isHostName(name)
+	case NameValidationPermissive:
+		return isWireDomainName(name)
+	}
+	return isDomainName(name)
+}
+
+// addrQueryDone reports whether a lookup for the addresses of both
+// families can stop once an answer to a query of type qtype, with
+// addresses if found is set, arrives.
+func (r *Resolver) addrQueryDone(qtype dnsmessage.Type, found bool) bool {
+	if r == nil || !found {
+		return false
+	}
+	switch r.AddrQueries {
+	case AddrQueryPreferIPv4:
+		return qtype == dnsmessage.TypeA
+	case AddrQueryPreferIPv6:
+		return qtype == dnsmessage.TypeAAAA
+	case AddrQueryFirstAnswer:
+		return true
+	}
+	return false
+}
+
+// An EDNSOption is an option carried in the EDNS0 record of a DNS
+// message, as defined by RFC 6891.
+type EDNSOption struct {
+	Code uint16 // option code, as registered with IANA
+	Data []byte // option data, in wire format
+}
+
 func (r *Resolver) strictErrors() bool { return r != nil && r.StrictErrors }
 
+// lookupName returns the name to look up for name: name with its
+// U-labels converted to A-labels, then as rewritten by r.NamePolicy.
+// It returns the error that makes the lookup fail, if any, which is
+// ErrOnionName for the names of onion services unless r resolves names
+// through a SOCKS5 proxy.
+func (r *Resolver) lookupName(ctx context.Context, name string) (string, error) {
+	asciiName, err := idnaToASCII(name, r != nil && r.StrictIDNA)
+	if err != nil {
+		return "", &DNSError{Err: err.Error(), Name: name, IsNotFound: true, UnwrapErr: err}
+	}
+	name = asciiName
+	if r != nil && r.NamePolicy != nil {
+		newName, err := r.NamePolicy(ctx, name)
+		if err != nil {
+			if _, ok := err.(*DNSError); ok {
+				return "", err
+			}
+			return "", &DNSError{Err: err.Error(), Name: name, UnwrapErr: err}
+		}
+		if newName == "" {
+			return "", &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+		}
+		name = newName
+	}
+	if isOnionName(name) && !r.socks5() {
+		return "", &DNSError{Err: ErrOnionName.Error(), Name: name, IsNotFound: true, UnwrapErr: ErrOnionName}
+	}
+	return name, nil
+}
+
+// ExponentialBackoff returns a function for Resolver.Backoff that
+// fails over to another server at once, but waits base before querying
+// a server a second time, and twice as long before each later time,
+// up to max if it is positive. Each wait is shortened by a random
+// amount of up to half, so that clients that failed together do not
+// retry together. If budget is positive, at most budget queries for
+// a name and type are sent to each server.
+func ExponentialBackoff(base, max time.Duration, budget int) func(server string, attempt int) (time.Duration, bool) {
+	return func(server string, attempt int) (time.Duration, bool) {
+		if budget > 0 && attempt >= budget {
+			return 0, false
+		}
+		if attempt == 0 || base <= 0 {
+			return 0, true
+		}
+		d := base
+		for i := 1; i < attempt && d < 1<<61; i++ {
+			d *= 2
+		}
+		if max > 0 && d > max {
+			d = max
+		}
+		// Draw the jitter from 64 bits: d/2 may not fit in an int.
+		rnd := uint64(fastrandu())<<32 | uint64(uint32(fastrandu()))
+		return d - time.Duration(rnd%uint64(d/2+1)), true
+	}
+}
+
+func (r *Resolver) partialErrors() bool { return r != nil && r.PartialErrors && !r.StrictErrors }
+
+// cgoFallback reports whether r.CgoFallback is set on a system that
+// supports it.
+func (r *Resolver) cgoFallback() bool {
+	return r != nil && r.CgoFallback && runtime.GOOS != "windows" && runtime.GOOS != "plan9"
+}
+
+// raceCgo reports whether r.RaceCgo is set on a system that supports
+// it.
+func (r *Resolver) raceCgo() bool {
+	return r != nil && r.RaceCgo && runtime.GOOS != "windows" && runtime.GOOS != "plan9"
+}
+
+// configPath returns r.ConfigPath on systems where the Go resolver
+// reads a resolv.conf file, and the empty string otherwise.
+func (r *Resolver) configPath() string {
+	if r == nil || runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		return ""
+	}
+	return r.ConfigPath
+}
+
+// Clone returns a new Resolver with the same settings as r, modified
+// by opts. It allows deriving a Resolver from a shared one, such as
+// DefaultResolver, without modifying the original while others use it.
+// A nil r is cloned as a zero Resolver.
+func (r *Resolver) Clone(opts ...ResolverOption) *Resolver {
+	c := new(Resolver)
+	if r != nil {
+		c.PreferGo = r.PreferGo
+		c.StrictErrors = r.StrictErrors
+		c.PartialErrors = r.PartialErrors
+		c.Dial = r.Dial
+		c.CgoFallback = r.CgoFallback
+		c.CgoRetryOnServerFailure = r.CgoRetryOnServerFailure
+		c.RaceCgo = r.RaceCgo
+		c.ConfigPath = r.ConfigPath
+		c.Servers = append([]netip.AddrPort(nil), r.Servers...)
+		c.Search = append([]string(nil), r.Search...)
+		c.Ndots = r.Ndots
+		c.NoSearch = r.NoSearch
+		c.ParallelSearch = r.ParallelSearch
+		c.EDNSPayloadSize = r.EDNSPayloadSize
+		c.EDNSOptions = append([]EDNSOption(nil), r.EDNSOptions...)
+		c.DNSCookies = r.DNSCookies
+		c.DialTimeout = r.DialTimeout
+		c.MaxConcurrentQueries = r.MaxConcurrentQueries
+		c.QNAMEMinimization = r.QNAMEMinimization
+		c.UDPPortMin = r.UDPPortMin
+		c.UDPPortMax = r.UDPPortMax
+		c.UDPConnsPerServer = r.UDPConnsPerServer
+		c.Interface = r.Interface
+		c.NetworkHandle = r.NetworkHandle
+		c.SOCKS5Proxy = r.SOCKS5Proxy
+		c.NamePolicy = r.NamePolicy
+		c.StrictIDNA = r.StrictIDNA
+		c.UnicodeNames = r.UnicodeNames
+		c.LocalTestNames = r.LocalTestNames
+		c.AddrQueries = r.AddrQueries
+		c.Backoff = r.Backoff
+		c.NameValidation = r.NameValidation
+		c.ValidateName = r.ValidateName
+		c.KeepMalformedRecords = r.KeepMalformedRecords
+		c.SRVOrder = r.SRVOrder
+		c.SRVRand = r.SRVRand
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// A ResolverOption changes a setting of a Resolver made by Clone.
+type ResolverOption func(*Resolver)
+
+// WithPreferGo returns a ResolverOption that sets PreferGo.
+func WithPreferGo(preferGo bool) ResolverOption {
+	return func(r *Resolver) { r.PreferGo = preferGo }
+}
+
+// WithStrictErrors returns a ResolverOption that sets StrictErrors.
+func WithStrictErrors(strict bool) ResolverOption {
+	return func(r *Resolver) { r.StrictErrors = strict }
+}
+
+// WithDial returns a ResolverOption that sets Dial.
+func WithDial(dial func(ctx context.Context, network, address string) (Conn, error)) ResolverOption {
+	return func(r *Resolver) { r.Dial = dial }
+}
+
+// WithConfigPath returns a ResolverOption that sets ConfigPath.
+func WithConfigPath(path string) ResolverOption {
+	return func(r *Resolver) { r.ConfigPath = path }
+}
+
 func (r *Resolver) getLookupGroup() *singleflight.Group {
 	if r == nil {
 		return &DefaultResolver.lookupGroup
@@ -188,6 +891,33 @@ func (r *Resolver) LookupHost(ctx context.Context, host string) (addrs []string,
 	if ip, _ := parseIPZone(host); ip != nil {
 		return []string{host}, nil
 	}
+	if r.socks5() {
+		// lookupIPAddr applies the name policy.
+		ips, err := r.lookupIPAddr(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		addrs = make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+		return addrs, nil
+	}
+	if host, err = r.lookupName(ctx, host); err != nil {
+		return nil, err
+	}
+	if ip, _ := parseIPZone(host); ip != nil {
+		return []string{host}, nil
+	}
+	if ips, ok := localhostAddrs("ip", host); ok {
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+		return addrs, nil
+	}
+	if isInvalidName(host) {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+	}
 	return r.lookupHost(ctx, host)
 }
 
@@ -229,8 +959,8 @@ func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]IP, er
 	if host == "" {
 		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
 	}
-	addrs, err := r.internetAddrList(ctx, afnet, host)
-	if err != nil {
+	addrs, err := r.internetAddrListPartial(ctx, afnet, host)
+	if err != nil && len(addrs) == 0 {
 		return nil, err
 	}
 
@@ -238,7 +968,7 @@ func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]IP, er
 	for _, addr := range addrs {
 		ips = append(ips, addr.(*IPAddr).IP)
 	}
-	return ips, nil
+	return ips, err
 }
 
 // LookupNetIP looks up host using the local resolver.
@@ -251,7 +981,7 @@ func (r *Resolver) LookupNetIP(ctx context.Context, network, host string) ([]net
 	// version at the edge. But for now (2021-10-20), this is a wrapper around
 	// the old way.
 	ips, err := r.LookupIP(ctx, network, host)
-	if err != nil {
+	if err != nil && len(ips) == 0 {
 		return nil, err
 	}
 	ret := make([]netip.Addr, 0, len(ips))
@@ -260,9 +990,139 @@ func (r *Resolver) LookupNetIP(ctx context.Context, network, host string) ([]net
 			ret = append(ret, a)
 		}
 	}
+	return ret, err
+}
+
+// LookupNetIPFamilies looks up host using the local resolver, querying
+// only for the address families listed in families, each of which must
+// be "ip4" or "ip6". The returned addresses are grouped by family in
+// the order given, so that, for example, families "ip6", "ip4" returns
+// all of host's IPv6 addresses before its IPv4 addresses. Within a
+// family, addresses keep the order chosen by the resolver. A family
+// listed more than once counts from its first place.
+//
+// With no families, LookupNetIPFamilies is equivalent to LookupNetIP
+// with network "ip".
+func (r *Resolver) LookupNetIPFamilies(ctx context.Context, host string, families ...string) ([]netip.Addr, error) {
+	var want4, want6 bool
+	order := make([]string, 0, 2) // families without duplicates
+	for _, family := range families {
+		switch family {
+		case "ip4":
+			if !want4 {
+				order = append(order, family)
+			}
+			want4 = true
+		case "ip6":
+			if !want6 {
+				order = append(order, family)
+			}
+			want6 = true
+		default:
+			return nil, UnknownNetworkError(family)
+		}
+	}
+	network := "ip"
+	if len(order) == 1 {
+		network = order[0]
+	}
+	addrs, err := r.LookupNetIP(ctx, network, host)
+	if err != nil || network != "ip" || len(order) == 0 {
+		return addrs, err
+	}
+	ret := make([]netip.Addr, 0, len(addrs))
+	for _, family := range order {
+		for _, addr := range addrs {
+			if addr.Unmap().Is4() == (family == "ip4") {
+				ret = append(ret, addr)
+			}
+		}
+	}
 	return ret, nil
 }
 
+// An AddrTTL is an IP address along with the TTL of the DNS record
+// it was found in.
+type AddrTTL struct {
+	Addr netip.Addr
+
+	// TTL is the time to live of the DNS record, as reported by the
+	// server. When the server is a caching resolver, this is the
+	// time left until its cached copy expires. It is zero for
+	// addresses that did not come from Go's built-in DNS resolver.
+	TTL time.Duration
+}
+
+// LookupNetIPTTL is like LookupNetIP, but also returns the TTL of each
+// address, for callers that cache lookup results themselves.
+//
+// TTLs are only known for addresses obtained by Go's built-in DNS
+// resolver. Addresses found in the hosts file, returned by the native
+// (cgo) resolver, or given as IP literals have a zero TTL.
+func (r *Resolver) LookupNetIPTTL(ctx context.Context, network, host string) ([]AddrTTL, error) {
+	afnet, _, err := parseNetwork(ctx, network, false)
+	if err != nil {
+		return nil, err
+	}
+	switch afnet {
+	case "ip", "ip4", "ip6":
+	default:
+		return nil, UnknownNetworkError(network)
+	}
+	if host == "" {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+	}
+	var addrs []AddrTTL
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []AddrTTL{{Addr: ip}}
+	} else if r.socks5() {
+		ips, err := r.lookupIPAddr(ctx, afnet, host)
+		if err != nil {
+			return nil, err
+		}
+		addrs = addrsWithoutTTL(ips)
+	} else {
+		if host, err = r.lookupName(ctx, host); err != nil {
+			return nil, err
+		}
+		if ip, err := netip.ParseAddr(host); err == nil {
+			addrs = []AddrTTL{{Addr: ip}}
+		} else if ips, ok := localhostAddrs(afnet, host); ok {
+			addrs = addrsWithoutTTL(ips)
+		} else if isInvalidName(host) {
+			return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+		} else if addrs, err = r.lookupNetIPTTL(ctx, afnet, host); err != nil {
+			return nil, err
+		}
+	}
+	// As in LookupIP, only keep addresses of the requested family.
+	filtered := addrs[:0]
+	for _, a := range addrs {
+		switch {
+		case afnet == "ip4" && !a.Addr.Unmap().Is4(),
+			afnet == "ip6" && (!a.Addr.Is6() || a.Addr.Is4In6()):
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+	if len(filtered) == 0 {
+		return nil, &AddrError{Err: errNoSuitableAddress.Error(), Addr: host}
+	}
+	return filtered, nil
+}
+
+// addrsWithoutTTL converts addrs, found by a lookup that does not
+// report TTLs, to AddrTTLs.
+func addrsWithoutTTL(addrs []IPAddr) []AddrTTL {
+	ret := make([]AddrTTL, 0, len(addrs))
+	for _, addr := range addrs {
+		if a, ok := netip.AddrFromSlice(addr.IP); ok {
+			ret = append(ret, AddrTTL{Addr: a})
+		}
+	}
+	return ret
+}
+
 // onlyValuesCtx is a context that uses an underlying context
 // for value lookup if the underlying context hasn't yet expired.
 type onlyValuesCtx struct {
@@ -290,6 +1150,53 @@ func withUnexpiredValuesPreserved(lookupCtx context.Context) context.Context {
 	return &onlyValuesCtx{Context: context.Background(), lookupValues: lookupCtx}
 }
 
+// LookupOptions holds settings that apply to individual lookups made
+// by Go's built-in DNS resolver, as attached to a context by
+// WithLookupOptions.
+type LookupOptions struct {
+	// Timeout is how long to wait for a reply from a server to each
+	// query. If zero, the timeout from the configuration, usually
+	// resolv.conf, is used.
+	Timeout time.Duration
+
+	// Attempts is the number of times each server is queried before
+	// giving up. If zero, the configured value is used.
+	Attempts int
+
+	// DialTimeout, if not zero, replaces the DialTimeout of the
+	// Resolver.
+	DialTimeout time.Duration
+}
+
+type lookupOptionsKey struct{}
+
+// WithLookupOptions returns a copy of ctx that makes lookups done with
+// it use opts, for example to fail fast in health checks while batch
+// jobs keep the more tolerant defaults. The options only affect Go's
+// built-in resolver, not the native (cgo) one.
+func WithLookupOptions(ctx context.Context, opts LookupOptions) context.Context {
+	return context.WithValue(ctx, lookupOptionsKey{}, &opts)
+}
+
+// dialTimeout returns the time that connecting to a server may take
+// for queries made with ctx, or zero if it is only bounded by the
+// timeout of the query.
+func (r *Resolver) dialTimeout(ctx context.Context) time.Duration {
+	if opts := lookupOptions(ctx); opts != nil && opts.DialTimeout != 0 {
+		return opts.DialTimeout
+	}
+	if r == nil {
+		return 0
+	}
+	return r.DialTimeout
+}
+
+// lookupOptions returns the LookupOptions attached to ctx, if any.
+func lookupOptions(ctx context.Context) *LookupOptions {
+	opts, _ := ctx.Value(lookupOptionsKey{}).(*LookupOptions)
+	return opts
+}
+
 // lookupIPAddr looks up host using the local resolver and particular network.
 // It returns a slice of that host's IPv4 and IPv6 addresses.
 func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IPAddr, error) {
@@ -301,6 +1208,19 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 	if ip, zone := parseIPZone(host); ip != nil {
 		return []IPAddr{{IP: ip, Zone: zone}}, nil
 	}
+	host, err := r.lookupName(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if ip, zone := parseIPZone(host); ip != nil {
+		return []IPAddr{{IP: ip, Zone: zone}}, nil
+	}
+	if addrs, ok := localhostAddrs(network, host); ok {
+		return addrs, nil
+	}
+	if isInvalidName(host) {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+	}
 	trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
 	if trace != nil && trace.DNSStart != nil {
 		trace.DNSStart(host)
@@ -309,6 +1229,9 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 	// can be overridden by tests. This is needed by net/http, so it
 	// uses a context key instead of unexported variables.
 	resolverFunc := r.lookupIP
+	if r.socks5() {
+		resolverFunc = r.socks5LookupIP
+	}
 	if alt, _ := ctx.Value(nettrace.LookupIPAltResolverKey{}).(func(context.Context, string, string) ([]IPAddr, error)); alt != nil {
 		resolverFunc = alt
 	}
@@ -321,6 +1244,10 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 	lookupGroupCtx, lookupGroupCancel := context.WithCancel(withUnexpiredValuesPreserved(ctx))
 
 	lookupKey := network + "\000" + host
+	if opts := lookupOptions(ctx); opts != nil {
+		// Don't merge lookups that use different options.
+		lookupKey += "\000" + itoa.Itoa(int(opts.Timeout)) + "\000" + itoa.Itoa(opts.Attempts)
+	}
 	dnsWaitGroup.Add(1)
 	ch := r.getLookupGroup().DoChan(lookupKey, func() (any, error) {
 		return testHookLookupIP(lookupGroupCtx, resolverFunc, network, host)
@@ -351,6 +1278,7 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 			Err:       mapErr(ctxErr).Error(),
 			Name:      host,
 			IsTimeout: ctxErr == context.DeadlineExceeded,
+			UnwrapErr: mapErr(ctxErr),
 		}
 		if trace != nil && trace.DNSDone != nil {
 			trace.DNSDone(nil, false, err)
@@ -372,6 +1300,7 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 					Err:       err.Error(),
 					Name:      host,
 					IsTimeout: isTimeout,
+					UnwrapErr: err,
 				}
 			}
 		}
@@ -384,18 +1313,19 @@ func (r *Resolver) lookupIPAddr(ctx context.Context, network, host string) ([]IP
 }
 
 // lookupIPReturn turns the return values from singleflight.Do into
-// the return values from LookupIP.
+// the return values from LookupIP. The addresses are kept along with
+// err if it is a partial error; see Resolver.PartialErrors.
 func lookupIPReturn(addrsi any, err error, shared bool) ([]IPAddr, error) {
-	if err != nil {
+	addrs, _ := addrsi.([]IPAddr)
+	if len(addrs) == 0 && err != nil {
 		return nil, err
 	}
-	addrs := addrsi.([]IPAddr)
 	if shared {
 		clone := make([]IPAddr, len(addrs))
 		copy(clone, addrs)
 		addrs = clone
 	}
-	return addrs, nil
+	return addrs, err
 }
 
 // ipAddrsEface returns an empty interface slice of addrs.
@@ -426,8 +1356,9 @@ func (r *Resolver) LookupPort(ctx context.Context, network, service string) (por
 		default:
 			return 0, &AddrError{Err: "unknown network", Addr: network}
 		}
-		port, err = r.lookupPort(ctx, network, service)
-		if err != nil {
+		if p, ok := lookupServicesOverride(network, service); ok {
+			port = p
+		} else if port, err = r.lookupPort(ctx, network, service); err != nil {
 			return 0, err
 		}
 	}
@@ -469,13 +1400,24 @@ func LookupCNAME(host string) (cname string, err error) {
 // address records.
 //
 // The returned canonical name is validated to be a properly
-// formatted presentation-format domain name.
+// formatted presentation-format domain name. If it is not, an error
+// is returned, along with the name if r.KeepMalformedRecords is set.
 func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	host, err := r.lookupName(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if r.socks5() {
+		return "", r.socks5Unsupported(host)
+	}
 	cname, err := r.lookupCNAME(ctx, host)
 	if err != nil {
 		return "", err
 	}
 	if !isDomainName(cname) {
+		if r.keepMalformedRecords() {
+			return cname, r.malformedError(host, []string{cname})
+		}
 		return "", &DNSError{Err: errMalformedDNSRecordsDetail, Name: host}
 	}
 	return cname, nil
@@ -502,7 +1444,7 @@ func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err err
 // LookupSRV tries to resolve an SRV query of the given service,
 // protocol, and domain name. The proto is "tcp" or "udp".
 // The returned records are sorted by priority and randomized
-// by weight within a priority.
+// by weight within a priority, unless r.SRVOrder says otherwise.
 //
 // LookupSRV constructs the DNS name to look up following RFC 2782.
 // That is, it looks up _service._proto.name. To accommodate services
@@ -512,8 +1454,16 @@ func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err err
 // The returned service names are validated to be properly
 // formatted presentation-format domain names. If the response contains
 // invalid names, those records are filtered out and an error
-// will be returned alongside the remaining results, if any.
+// will be returned alongside the remaining results, if any, or along
+// with all the records if r.KeepMalformedRecords is set.
 func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*SRV, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if r.socks5() {
+		return "", nil, r.socks5Unsupported(name)
+	}
 	cname, addrs, err := r.lookupSRV(ctx, service, proto, name)
 	if err != nil {
 		return "", nil, err
@@ -522,21 +1472,44 @@ func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (
 		return "", nil, &DNSError{Err: "SRV header name is invalid", Name: name}
 	}
 	filteredAddrs := make([]*SRV, 0, len(addrs))
+	var malformed []string
 	for _, addr := range addrs {
 		if addr == nil {
 			continue
 		}
 		if !isDomainName(addr.Target) {
-			continue
+			malformed = append(malformed, addr.Target)
+			if !r.keepMalformedRecords() {
+				continue
+			}
 		}
 		filteredAddrs = append(filteredAddrs, addr)
 	}
-	if len(addrs) != len(filteredAddrs) {
-		return cname, filteredAddrs, &DNSError{Err: errMalformedDNSRecordsDetail, Name: name}
+	r.sortSRV(filteredAddrs)
+	if len(addrs) != len(filteredAddrs) || malformed != nil {
+		return cname, filteredAddrs, r.malformedError(name, malformed)
 	}
 	return cname, filteredAddrs, nil
 }
 
+// sortSRV orders srvs as r.SRVOrder says.
+func (r *Resolver) sortSRV(srvs []*SRV) {
+	order, randn := SRVOrderWeighted, randIntn
+	if r != nil {
+		order = r.SRVOrder
+		if r.SRVRand != nil {
+			randn = r.SRVRand
+		}
+	}
+	switch order {
+	case SRVOrderSorted:
+		sort.Stable(byPriorityWeight(srvs))
+	case SRVOrderNone:
+	default:
+		byPriorityWeight(srvs).sort(randn)
+	}
+}
+
 // LookupMX returns the DNS MX records for the given domain name sorted by preference.
 //
 // The returned mail server names are validated to be properly
@@ -555,24 +1528,36 @@ func LookupMX(name string) ([]*MX, error) {
 // The returned mail server names are validated to be properly
 // formatted presentation-format domain names. If the response contains
 // invalid names, those records are filtered out and an error
-// will be returned alongside the remaining results, if any.
+// will be returned alongside the remaining results, if any, or along
+// with all the records if r.KeepMalformedRecords is set.
 func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*MX, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.socks5() {
+		return nil, r.socks5Unsupported(name)
+	}
 	records, err := r.lookupMX(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 	filteredMX := make([]*MX, 0, len(records))
+	var malformed []string
 	for _, mx := range records {
 		if mx == nil {
 			continue
 		}
 		if !isDomainName(mx.Host) {
-			continue
+			malformed = append(malformed, mx.Host)
+			if !r.keepMalformedRecords() {
+				continue
+			}
 		}
 		filteredMX = append(filteredMX, mx)
 	}
-	if len(records) != len(filteredMX) {
-		return filteredMX, &DNSError{Err: errMalformedDNSRecordsDetail, Name: name}
+	if len(records) != len(filteredMX) || malformed != nil {
+		return filteredMX, r.malformedError(name, malformed)
 	}
 	return filteredMX, nil
 }
@@ -595,24 +1580,36 @@ func LookupNS(name string) ([]*NS, error) {
 // The returned name server names are validated to be properly
 // formatted presentation-format domain names. If the response contains
 // invalid names, those records are filtered out and an error
-// will be returned alongside the remaining results, if any.
+// will be returned alongside the remaining results, if any, or along
+// with all the records if r.KeepMalformedRecords is set.
 func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*NS, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.socks5() {
+		return nil, r.socks5Unsupported(name)
+	}
 	records, err := r.lookupNS(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 	filteredNS := make([]*NS, 0, len(records))
+	var malformed []string
 	for _, ns := range records {
 		if ns == nil {
 			continue
 		}
 		if !isDomainName(ns.Host) {
-			continue
+			malformed = append(malformed, ns.Host)
+			if !r.keepMalformedRecords() {
+				continue
+			}
 		}
 		filteredNS = append(filteredNS, ns)
 	}
-	if len(records) != len(filteredNS) {
-		return filteredNS, &DNSError{Err: errMalformedDNSRecordsDetail, Name: name}
+	if len(records) != len(filteredNS) || malformed != nil {
+		return filteredNS, r.malformedError(name, malformed)
 	}
 	return filteredNS, nil
 }
@@ -622,14 +1619,115 @@ func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*NS, error) {
 // LookupTXT uses context.Background internally; to specify the context, use
 // Resolver.LookupTXT.
 func LookupTXT(name string) ([]string, error) {
-	return DefaultResolver.lookupTXT(context.Background(), name)
+	return DefaultResolver.LookupTXT(context.Background(), name)
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
 func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.socks5() {
+		return nil, r.socks5Unsupported(name)
+	}
 	return r.lookupTXT(ctx, name)
 }
 
+// LookupNAPTR returns the DNS NAPTR records for the given domain name,
+// sorted by order and then by preference.
+//
+// The returned replacement names are validated to be properly
+// formatted presentation-format domain names. If the response contains
+// invalid names, those records are filtered out and an error
+// will be returned alongside the remaining results, if any.
+//
+// LookupNAPTR uses context.Background internally; to specify the context, use
+// Resolver.LookupNAPTR.
+func LookupNAPTR(name string) ([]*NAPTR, error) {
+	return DefaultResolver.LookupNAPTR(context.Background(), name)
+}
+
+// LookupNAPTR returns the DNS NAPTR records for the given domain name,
+// sorted by order and then by preference.
+//
+// The returned replacement names are validated to be properly
+// formatted presentation-format domain names. If the response contains
+// invalid names, those records are filtered out and an error
+// will be returned alongside the remaining results, if any, or along
+// with all the records if r.KeepMalformedRecords is set.
+func (r *Resolver) LookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.socks5() {
+		return nil, r.socks5Unsupported(name)
+	}
+	records, err := r.lookupNAPTR(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*NAPTR, 0, len(records))
+	var malformed []string
+	for _, rr := range records {
+		if rr == nil {
+			continue
+		}
+		if !isDomainName(rr.Replacement) {
+			malformed = append(malformed, rr.Replacement)
+			if !r.keepMalformedRecords() {
+				continue
+			}
+		}
+		filtered = append(filtered, rr)
+	}
+	if len(records) != len(filtered) || malformed != nil {
+		return filtered, r.malformedError(name, malformed)
+	}
+	return filtered, nil
+}
+
+// LookupTLSA returns the DNS TLSA records used for DANE (RFC 6698)
+// with the given service, protocol, and domain name. The proto is
+// "tcp", "udp", or "sctp".
+//
+// LookupTLSA constructs the DNS name to look up following RFC 6698.
+// That is, it looks up _service._proto.name, where service is usually
+// a port number, as in _25._tcp.mail.example.com.
+//
+// LookupTLSA does not validate the DNSSEC signatures of the returned
+// records; callers that rely on them for authentication must ensure
+// that they come from a validating resolver.
+//
+// LookupTLSA uses context.Background internally; to specify the context, use
+// Resolver.LookupTLSA.
+func LookupTLSA(service, proto, name string) ([]*TLSA, error) {
+	return DefaultResolver.LookupTLSA(context.Background(), service, proto, name)
+}
+
+// LookupTLSA returns the DNS TLSA records used for DANE (RFC 6698)
+// with the given service, protocol, and domain name. The proto is
+// "tcp", "udp", or "sctp".
+//
+// LookupTLSA constructs the DNS name to look up following RFC 6698.
+// That is, it looks up _service._proto.name, where service is usually
+// a port number, as in _25._tcp.mail.example.com.
+//
+// LookupTLSA does not validate the DNSSEC signatures of the returned
+// records; callers that rely on them for authentication must ensure
+// that they come from a validating resolver.
+func (r *Resolver) LookupTLSA(ctx context.Context, service, proto, name string) ([]*TLSA, error) {
+	name, err := r.lookupName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.socks5() {
+		return nil, r.socks5Unsupported(name)
+	}
+	return r.lookupTLSA(ctx, service, proto, name)
+}
+
 // LookupAddr performs a reverse lookup for the given address, returning a list
 // of names mapping to that address.
 //
@@ -651,20 +1749,39 @@ func LookupAddr(addr string) (names []string, err error) {
 //
 // The returned names are validated to be properly formatted presentation-format
 // domain names. If the response contains invalid names, those records are filtered
-// out and an error will be returned alongside the remaining results, if any.
+// out and an error will be returned alongside the remaining results, if any, or
+// along with all the names if r.KeepMalformedRecords is set.
 func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
-	names, err := r.lookupAddr(ctx, addr)
+	addr, err := r.lookupName(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if r.socks5() {
+		names, err = r.socks5LookupAddr(ctx, addr)
+	} else {
+		names, err = r.lookupAddr(ctx, addr)
+	}
 	if err != nil {
 		return nil, err
 	}
 	filteredNames := make([]string, 0, len(names))
+	var malformed []string
 	for _, name := range names {
 		if isDomainName(name) {
+			if r != nil && r.UnicodeNames {
+				name = idnaToUnicode(name)
+			}
 			filteredNames = append(filteredNames, name)
+		} else {
+			malformed = append(malformed, name)
+			if r.keepMalformedRecords() {
+				filteredNames = append(filteredNames, name)
+			}
 		}
 	}
-	if len(names) != len(filteredNames) {
-		return filteredNames, &DNSError{Err: errMalformedDNSRecordsDetail, Name: addr}
+	if malformed != nil {
+		return filteredNames, r.malformedError(addr, malformed)
 	}
 	return filteredNames, nil
 }
@@ -674,21 +1791,82 @@ func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error
 // results which have had the malformed records filtered out.
 var errMalformedDNSRecordsDetail = "DNS response contained records which contain invalid names"
 
+// A MalformedRecordsError lists the invalid domain names of the
+// records that a lookup by a Resolver with KeepMalformedRecords returned
+// despite them. The DNSError that the lookup returns along with the
+// records wraps it, so that errors.As finds it.
+type MalformedRecordsError struct {
+	Names []string
+}
+
+func (e *MalformedRecordsError) Error() string { return errMalformedDNSRecordsDetail }
+
+func (r *Resolver) keepMalformedRecords() bool {
+	return r != nil && r.KeepMalformedRecords
+}
+
+// malformedError returns the error of a lookup for name whose response
+// held records that were dropped, or that had the invalid names
+// malformed. The names are only reported when the records are kept.
+func (r *Resolver) malformedError(name string, malformed []string) *DNSError {
+	err := &DNSError{Err: errMalformedDNSRecordsDetail, Name: name}
+	if r.keepMalformedRecords() && len(malformed) > 0 {
+		err.UnwrapErr = &MalformedRecordsError{Names: malformed}
+	}
+	return err
+}
+
+// acquireQuerySlot waits until r has fewer than MaxConcurrentQueries
+// queries outstanding, or ctx is done. It returns the function that
+// frees the slot taken once the query is answered.
+func (r *Resolver) acquireQuerySlot(ctx context.Context) (release func(), err error) {
+	slots := r.getQuerySlots()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getQuerySlots returns the semaphore bounding the queries of r, making
+// it if needed, or nil if their number is not limited.
+func (r *Resolver) getQuerySlots() chan struct{} {
+	if r == nil {
+		return nil
+	}
+	r.querySlotsOnce.Do(func() {
+		if r.MaxConcurrentQueries > 0 {
+			r.querySlots = make(chan struct{}, r.MaxConcurrentQueries)
+		}
+	})
+	return r.querySlots
+}
+
 // dial makes a new connection to the provided server (which must be
-// an IP address) with the provided network type, using either r.Dial
-// (if both r and r.Dial are non-nil) or else Dialer.DialContext.
+// an IP address, or the path of a Unix socket) with the provided
+// network type, using either r.Dial (if both r and r.Dial are non-nil)
+// or else Dialer.DialContext.
 func (r *Resolver) dial(ctx context.Context, network, server string) (Conn, error) {
 	// Calling Dial here is scary -- we have to be sure not to
 	// dial a name that will require a DNS lookup, or Dial will
 	// call back here to translate it. The DNS config parser has
 	// already checked that all the cfg.servers are IP
-	// addresses, which Dial will use without a DNS lookup.
+	// addresses or socket paths, which Dial will use without a
+	// DNS lookup.
 	var c Conn
 	var err error
-	if r != nil && r.Dial != nil {
+	if isUnixSocketServer(server) {
+		c, err = r.dialUnix(ctx, network, server)
+	} else if r != nil && r.Dial != nil {
 		c, err = r.Dial(ctx, network, server)
+	} else if network == "udp" && r != nil && r.UDPPortMin != 0 {
+		c, err = r.dialUDPPortRange(ctx, server)
 	} else {
-		var d Dialer
+		d := r.dialer()
 		c, err = d.DialContext(ctx, network, server)
 	}
 	if err != nil {
@@ -697,6 +1875,197 @@ func (r *Resolver) dial(ctx context.Context, network, server string) (Conn, erro
 	return c, nil
 }
 
+// dialer returns the Dialer for the sockets that r opens itself to
+// send queries, which binds them to r.Interface and r.NetworkHandle.
+func (r *Resolver) dialer() Dialer {
+	var d Dialer
+	if r == nil || r.Interface == "" && r.NetworkHandle == 0 {
+		return d
+	}
+	iface, handle := r.Interface, r.NetworkHandle
+	d.Control = func(network, address string, c syscall.RawConn) error {
+		var err error
+		cerr := c.Control(func(fd uintptr) {
+			if iface != "" {
+				if err = bindToDevice(fd, iface); err != nil {
+					return
+				}
+			}
+			if handle != 0 {
+				err = setSocketNetwork(fd, handle)
+			}
+		})
+		if cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return d
+}
+
+// isUnixSocketServer reports whether server is the path of a Unix
+// socket rather than a host:port address.
+func isUnixSocketServer(server string) bool {
+	return len(server) > 0 && server[0] == '/'
+}
+
+// dialUnix dials the name server listening on the Unix socket at path.
+// Queries that would be sent over UDP use a datagram socket, bound to
+// a random abstract address so that the server can reply, on systems
+// that have such addresses, and a stream socket elsewhere.
+func (r *Resolver) dialUnix(ctx context.Context, network, path string) (Conn, error) {
+	var d Dialer
+	if network == "udp" && (runtime.GOOS == "linux" || runtime.GOOS == "android") {
+		network = "unixgram"
+		d.LocalAddr = &UnixAddr{Name: "@go-dns-" + itoa.Uitoa(uint(randInt())), Net: network}
+	} else {
+		network = "unix"
+	}
+	if r != nil && r.Dial != nil {
+		return r.Dial(ctx, network, path)
+	}
+	return d.DialContext(ctx, network, path)
+}
+
+// dialUDPPortRange dials server over UDP from a random local port
+// between r.UDPPortMin and r.UDPPortMax. If the port is taken, it
+// tries a few others before giving up.
+func (r *Resolver) dialUDPPortRange(ctx context.Context, server string) (c Conn, err error) {
+	min, max := int(r.UDPPortMin), int(r.UDPPortMax)
+	if max < min {
+		max = min
+	}
+	for tries := 0; tries < 5; tries++ {
+		d := r.dialer()
+		d.LocalAddr = &UDPAddr{Port: min + randIntn(max-min+1)}
+		if c, err = d.DialContext(ctx, "udp", server); err == nil || min == max || ctx.Err() != nil {
+			break
+		}
+	}
+	return c, err
+}
+
+// Exchange sends the DNS query msg, in wire format (RFC 1035), to the
+// name servers used by Go's built-in resolver and returns the first
+// response, also in wire format. It allows querying record types that
+// have no dedicated lookup method.
+//
+// The query is sent with the same server order, rotation, attempts,
+// timeouts and fallback to TCP for truncated responses as other
+// lookups, but the response is not interpreted: a response reporting
+// an error, such as a name that does not exist, is returned as is.
+// msg must contain exactly one question. Its ID is replaced by a
+// random one while in flight, and restored in the response.
+func (r *Resolver) Exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	if r.socks5() {
+		return nil, r.socks5Unsupported("")
+	}
+	return r.exchangeRaw(ctx, msg)
+}
+
+// A ZoneTransfer describes a zone transfer made by
+// Resolver.TransferZone.
+type ZoneTransfer struct {
+	// Zone is the name of the zone to transfer.
+	Zone string
+
+	// Incremental requests an incremental zone transfer (IXFR,
+	// RFC 1995) of the changes made since the version of the zone
+	// with serial number Serial. Otherwise, the whole zone is
+	// transferred (AXFR, RFC 5936).
+	Incremental bool
+	Serial      uint32
+
+	// Server is the address, in host:port form, of the name server to
+	// transfer the zone from. The host must be an IP address. If
+	// Server is empty, the name servers used by Go's built-in resolver
+	// are tried in turn.
+	Server string
+
+	// Sign, if not nil, is called with the query in wire format before
+	// it is sent, and returns it signed with a TSIG record (RFC 8945).
+	Sign func(msg []byte) ([]byte, error)
+
+	// Verify, if not nil, is called with each response message in wire
+	// format, in the order they are received, and returns an error if
+	// the message's TSIG record is missing or invalid, which aborts
+	// the transfer.
+	Verify func(msg []byte) error
+}
+
+// TransferZone transfers the zone described by t over TCP and returns
+// the response messages, in wire format, making up the transfer. The
+// messages are not interpreted beyond what is needed to find the end
+// of the transfer: each carries part of the zone's records in its
+// answer section, starting and ending with the zone's SOA record.
+//
+// An incremental transfer may also consist of the current SOA record
+// alone, if the zone has not changed since version Serial, or of the
+// whole zone, if the server cannot provide the changes.
+func (r *Resolver) TransferZone(ctx context.Context, t *ZoneTransfer) ([][]byte, error) {
+	if r.socks5() {
+		return nil, r.socks5Unsupported(t.Zone)
+	}
+	return r.transferZone(ctx, t)
+}
+
+// A DNSRecord is a DNS resource record, as used in DNSUpdate.
+type DNSRecord struct {
+	Name  string
+	Type  uint16
+	Class uint16 // zero means IN
+	TTL   uint32
+	Data  []byte // RDATA in wire format, with uncompressed names
+}
+
+// A DNSUpdate describes a dynamic update (RFC 2136) sent by
+// Resolver.Update.
+type DNSUpdate struct {
+	// Zone is the name of the zone to update.
+	Zone string
+
+	// Prerequisites are conditions on the current contents of the
+	// zone that must all hold for the update to be applied, encoded
+	// as in RFC 2136, section 2.4. With class ANY (255), a record
+	// requires the RRset of its type to exist, or the name to be in
+	// use if the type is ANY. With class NONE (254), it requires the
+	// opposite. With class IN, it requires the RRset of its type to
+	// consist of exactly the given records.
+	Prerequisites []DNSRecord
+
+	// Updates are the changes to make to the zone, encoded as in
+	// RFC 2136, section 2.5. A record with class IN is added. With
+	// class ANY (255), a record deletes the RRset of its type, or all
+	// the RRsets of its name if the type is ANY. With class NONE (254),
+	// it deletes the record with the same type and data.
+	Updates []DNSRecord
+
+	// Server is the address, in host:port form, of the name server to
+	// send the update to. The host must be an IP address. If Server is
+	// empty, the update is sent to the primary name server named in
+	// the zone's SOA record.
+	Server string
+
+	// Sign, if not nil, is called with the update in wire format before
+	// it is sent, and returns it signed with a TSIG record (RFC 8945).
+	Sign func(msg []byte) ([]byte, error)
+
+	// Verify, if not nil, is called with the response in wire format
+	// and returns an error if its TSIG record is missing or invalid.
+	Verify func(msg []byte) error
+}
+
+// Update sends the dynamic update u and reports whether the server
+// applied it. If the server rejects the update, for example because a
+// prerequisite does not hold, the returned error is a *DNSError
+// describing the reason.
+func (r *Resolver) Update(ctx context.Context, u *DNSUpdate) error {
+	if r.socks5() {
+		return r.socks5Unsupported(u.Zone)
+	}
+	return r.update(ctx, u)
+}
+
 // goLookupSRV returns the SRV records for a target name, built either
 // from its component service ("sip"), protocol ("tcp"), and name
 // ("example.com."), or from name directly (if service and proto are
@@ -705,7 +2074,7 @@ func (r *Resolver) dial(ctx context.Context, network, server string) (Conn, erro
 // In either case, the returned target name ("_sip._tcp.example.com.")
 // is also returned on success.
 //
-// The records are sorted by weight.
+// The records are in the order of the response; LookupSRV sorts them.
 func (r *Resolver) goLookupSRV(ctx context.Context, service, proto, name string) (target string, srvs []*SRV, err error) {
 	if service == "" && proto == "" {
 		target = name
@@ -752,7 +2121,6 @@ func (r *Resolver) goLookupSRV(ctx context.Context, service, proto, name string)
 		}
 		srvs = append(srvs, &SRV{Target: srv.Target.String(), Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
 	}
-	byPriorityWeight(srvs).sort()
 	return cname.String(), srvs, nil
 }
 
@@ -898,6 +2266,105 @@ func (r *Resolver) goLookupTXT(ctx context.Context, name string) ([]string, erro
 	return txts, nil
 }
 
+// goLookupNAPTR returns the NAPTR records for name.
+func (r *Resolver) goLookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	p, server, err := r.lookup(ctx, name, dnsTypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+	var naptrs []*NAPTR
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, &DNSError{
+				Err:    "cannot unmarshal DNS message",
+				Name:   name,
+				Server: server,
+			}
+		}
+		if h.Type != dnsTypeNAPTR {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, &DNSError{
+					Err:    "cannot unmarshal DNS message",
+					Name:   name,
+					Server: server,
+				}
+			}
+			continue
+		}
+		rr, err := p.UnknownResource()
+		if err != nil {
+			return nil, &DNSError{
+				Err:    "cannot unmarshal DNS message",
+				Name:   name,
+				Server: server,
+			}
+		}
+		naptr, ok := parseNAPTR(rr.Data)
+		if !ok {
+			return nil, &DNSError{
+				Err:    "cannot unmarshal DNS message",
+				Name:   name,
+				Server: server,
+			}
+		}
+		naptrs = append(naptrs, naptr)
+	}
+	byOrderPref(naptrs).sort()
+	return naptrs, nil
+}
+
+// goLookupTLSA returns the TLSA records for _service._proto.name.
+func (r *Resolver) goLookupTLSA(ctx context.Context, service, proto, name string) ([]*TLSA, error) {
+	target := "_" + service + "._" + proto + "." + name
+	p, server, err := r.lookup(ctx, target, dnsTypeTLSA)
+	if err != nil {
+		return nil, err
+	}
+	var tlsas []*TLSA
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, &DNSError{
+				Err:    "cannot unmarshal DNS message",
+				Name:   target,
+				Server: server,
+			}
+		}
+		if h.Type != dnsTypeTLSA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, &DNSError{
+					Err:    "cannot unmarshal DNS message",
+					Name:   target,
+					Server: server,
+				}
+			}
+			continue
+		}
+		rr, err := p.UnknownResource()
+		if err != nil || len(rr.Data) < 3 {
+			return nil, &DNSError{
+				Err:    "cannot unmarshal DNS message",
+				Name:   target,
+				Server: server,
+			}
+		}
+		tlsas = append(tlsas, &TLSA{
+			Usage:        rr.Data[0],
+			Selector:     rr.Data[1],
+			MatchingType: rr.Data[2],
+			Data:         rr.Data[3:],
+		})
+	}
+	return tlsas, nil
+}
+
 func parseCNAMEFromResources(resources []dnsmessage.Resource) (string, error) {
 	if len(resources) == 0 {
 		return "", errors.New("no CNAME record received")
@@ -23,6 +23,10 @@ func (*Resolver) lookupIP(ctx context.Context, network, host string) (addrs []IP
 	return nil, syscall.ENOPROTOOPT
 }
 
+func (*Resolver) lookupNetIPTTL(ctx context.Context, network, host string) (addrs []AddrTTL, err error) {
+	return nil, syscall.ENOPROTOOPT
+}
+
 func (*Resolver) lookupPort(ctx context.Context, network, service string) (port int, err error) {
 	return goLookupPort(network, service)
 }
@@ -43,6 +47,14 @@ func (*Resolver) lookupNS(ctx context.Context, name string) (nss []*NS, err erro
 	return nil, syscall.ENOPROTOOPT
 }
 
+func (*Resolver) lookupTLSA(ctx context.Context, service, proto, name string) (tlsas []*TLSA, err error) {
+	return nil, syscall.ENOPROTOOPT
+}
+
+func (*Resolver) lookupNAPTR(ctx context.Context, name string) (naptrs []*NAPTR, err error) {
+	return nil, syscall.ENOPROTOOPT
+}
+
 func (*Resolver) lookupTXT(ctx context.Context, name string) (txts []string, err error) {
 	return nil, syscall.ENOPROTOOPT
 }
@@ -56,3 +68,31 @@ func (*Resolver) lookupAddr(ctx context.Context, addr string) (ptrs []string, er
 func concurrentThreadsLimit() int {
 	return 500
 }
+
+func (*Resolver) exchangeRaw(ctx context.Context, msg []byte) ([]byte, error) {
+	return nil, syscall.ENOPROTOOPT
+}
+
+func (*Resolver) transferZone(ctx context.Context, t *ZoneTransfer) ([][]byte, error) {
+	return nil, syscall.ENOPROTOOPT
+}
+
+func (*Resolver) update(ctx context.Context, u *DNSUpdate) error {
+	return syscall.ENOPROTOOPT
+}
+
+func systemDNSConfig() *DNSConfig {
+	return nil
+}
+
+// ReloadResolverConfig has no effect: there is no resolver to configure.
+func ReloadResolverConfig() {}
+
+// FlushResolverConfig has no effect: there is no resolver to configure.
+func FlushResolverConfig() {}
+
+// FlushDNSCache has no effect: there is no resolver to flush.
+func FlushDNSCache() {}
+
+// SetDNSDebugLogger has no effect: there is no resolver to debug.
+func SetDNSDebugLogger(f func(msg string, kv ...string)) {}
@@ -148,7 +148,7 @@ func (*Resolver) lookupHost(ctx context.Context, host string) (addrs []string, e
 	// host names in local network (e.g. from /lib/ndb/local)
 	lines, err := queryCS(ctx, "net", host, "1")
 	if err != nil {
-		dnsError := &DNSError{Err: err.Error(), Name: host}
+		dnsError := &DNSError{Err: err.Error(), Name: host, UnwrapErr: err}
 		if stringsHasSuffix(err.Error(), "dns failure") {
 			dnsError.Err = errNoSuchHost.Error()
 			dnsError.IsNotFound = true
@@ -186,14 +186,10 @@ func (r *Resolver) preferGoOverPlan9() bool {
 	conf := systemConf()
 	order := conf.hostLookupOrder(r, "") // name is unused
 
-	// TODO(bradfitz): for now we only permit use of the PreferGo
-	// implementation when there's a non-nil Resolver with a
-	// non-nil Dialer. This is a sign that they the code is trying
-	// to use their DNS-speaking net.Conn (such as an in-memory
-	// DNS cache) and they don't want to actually hit the network.
-	// Once we add support for looking the default DNS servers
-	// from plan9, though, then we can relax this.
-	return order != hostLookupCgo && r != nil && r.Dial != nil
+	// The Go resolver takes its name servers and search domains
+	// from the network database, and host names from its system
+	// entries, as the Plan 9 services do.
+	return order != hostLookupCgo
 }
 
 func (r *Resolver) lookupIP(ctx context.Context, network, host string) (addrs []IPAddr, err error) {
@@ -214,6 +210,17 @@ func (r *Resolver) lookupIP(ctx context.Context, network, host string) (addrs []
 	return
 }
 
+func (r *Resolver) lookupNetIPTTL(ctx context.Context, network, host string) ([]AddrTTL, error) {
+	if r.preferGoOverPlan9() {
+		return r.goLookupIPTTL(ctx, network, host, systemConf().hostLookupOrder(r, host))
+	}
+	addrs, err := r.lookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	return addrsWithoutTTL(addrs), nil
+}
+
 func (*Resolver) lookupPort(ctx context.Context, network, service string) (port int, err error) {
 	switch network {
 	case "tcp4", "tcp6":
@@ -291,7 +298,6 @@ func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (
 		addrs = append(addrs, &SRV{absDomainName(f[5]), uint16(port), uint16(priority), uint16(weight)})
 		cname = absDomainName(f[0])
 	}
-	byPriorityWeight(addrs).sort()
 	return
 }
 
@@ -334,6 +340,18 @@ func (r *Resolver) lookupNS(ctx context.Context, name string) (ns []*NS, err err
 	return
 }
 
+func (r *Resolver) lookupTLSA(ctx context.Context, service, proto, name string) ([]*TLSA, error) {
+	// ndb/dns does not know about TLSA records, so always use
+	// the Go resolver.
+	return r.goLookupTLSA(ctx, service, proto, name)
+}
+
+func (r *Resolver) lookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	// ndb/dns does not know about NAPTR records, so always use
+	// the Go resolver.
+	return r.goLookupNAPTR(ctx, name)
+}
+
 func (r *Resolver) lookupTXT(ctx context.Context, name string) (txt []string, err error) {
 	if r.preferGoOverPlan9() {
 		return r.goLookupTXT(ctx, name)
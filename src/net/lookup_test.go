@@ -8,8 +8,11 @@ package net
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"internal/nettrace"
 	"internal/testenv"
+	"io"
 	"net/netip"
 	"reflect"
 	"runtime"
@@ -17,6 +20,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -1406,3 +1410,444 @@ func TestDNSTimeout(t *testing.T) {
 	checkErr(err2)
 	cancel()
 }
+
+func TestResolverClone(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (Conn, error) {
+		return nil, errNoSuitableAddress
+	}
+
+	// Give every exported field a non-zero value, so that Clone is
+	// caught if it forgets a newly added one.
+	orig := new(Resolver)
+	v := reflect.ValueOf(orig).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f, sf := v.Field(i), v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.String:
+			f.SetString("test")
+		case reflect.Int, reflect.Int64:
+			f.SetInt(1)
+		case reflect.Uint16, reflect.Uint64:
+			f.SetUint(1)
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Func:
+			switch sf.Name {
+			case "Dial":
+				f.Set(reflect.ValueOf(dial))
+			case "Backoff":
+				f.Set(reflect.ValueOf(ExponentialBackoff(time.Second, time.Minute, 3)))
+			case "ValidateName":
+				f.Set(reflect.ValueOf(func(string) bool { return true }))
+			case "SRVRand":
+				f.Set(reflect.ValueOf(func(n int) int { return 0 }))
+			case "NamePolicy":
+				f.Set(reflect.ValueOf(func(ctx context.Context, name string) (string, error) { return name, nil }))
+			default:
+				t.Fatalf("unexpected func field %s; update test", sf.Name)
+			}
+		default:
+			t.Fatalf("unexpected kind %v of field %s; update test", f.Kind(), sf.Name)
+		}
+	}
+
+	c := orig.Clone()
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		got, want := cv.Field(i), v.Field(i)
+		if sf.Type.Kind() == reflect.Func {
+			if got.Pointer() != want.Pointer() {
+				t.Errorf("Clone did not copy %s", sf.Name)
+			}
+		} else if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+			t.Errorf("Clone copied %s = %v; want %v", sf.Name, got, want)
+		}
+	}
+
+	c = orig.Clone(WithPreferGo(false), WithStrictErrors(false), WithDial(nil), WithConfigPath(""))
+	if c.PreferGo || c.StrictErrors || c.Dial != nil || c.ConfigPath != "" {
+		t.Errorf("options not applied: %+v", c)
+	}
+	if !orig.PreferGo || !orig.StrictErrors || orig.Dial == nil || orig.ConfigPath == "" {
+		t.Errorf("Clone modified the original: %+v", orig)
+	}
+
+	if c := (*Resolver)(nil).Clone(WithPreferGo(true)); !c.PreferGo || c.StrictErrors {
+		t.Errorf("nil Resolver clone = %+v; want only PreferGo set", c)
+	}
+}
+
+func TestResolverUDPPortRange(t *testing.T) {
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 is not supported")
+	}
+	// Find a local port that is likely free.
+	ln, err := ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.LocalAddr().(*UDPAddr).Port
+	ln.Close()
+	if port == 65535 {
+		t.Skip("no room for a port range")
+	}
+
+	r := &Resolver{UDPPortMin: uint16(port)}
+	if !r.preferGo() {
+		t.Error("UDPPortMin does not imply PreferGo")
+	}
+	c, err := r.dial(context.Background(), "udp", "127.0.0.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.LocalAddr().(*UDPAddr).Port; got != port {
+		t.Errorf("query sent from port %d; want %d", got, port)
+	}
+
+	// With the only port of the range taken, dialing fails.
+	if _, err := r.dial(context.Background(), "udp", "127.0.0.1:53"); err == nil {
+		t.Error("dial succeeded with the only port of the range in use")
+	}
+
+	// Otherwise another port of the range is picked.
+	r.UDPPortMax = r.UDPPortMin + 1
+	for i := 0; i < 10; i++ {
+		c2, err := r.dial(context.Background(), "udp", "127.0.0.1:53")
+		if err != nil {
+			// The other port may have been taken by someone else.
+			t.Skipf("dial in port range: %v", err)
+		}
+		got := c2.LocalAddr().(*UDPAddr).Port
+		c2.Close()
+		if got != port+1 {
+			t.Fatalf("query sent from port %d; want %d", got, port+1)
+		}
+	}
+}
+
+func TestResolverInterface(t *testing.T) {
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 is not supported")
+	}
+	ifi := loopbackInterface()
+	if ifi == nil {
+		t.Skip("no loopback interface")
+	}
+
+	r := &Resolver{Interface: ifi.Name}
+	if !r.preferGo() {
+		t.Error("Interface does not imply PreferGo")
+	}
+	c, err := r.dial(context.Background(), "udp", "127.0.0.1:53")
+	switch runtime.GOOS {
+	case "linux", "android":
+	default:
+		if err == nil {
+			c.Close()
+			t.Errorf("binding to %s succeeded on %s", ifi.Name, runtime.GOOS)
+		}
+		return
+	}
+	if errors.Is(err, syscall.EPERM) {
+		t.Skipf("binding to %s: %v", ifi.Name, err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	r.Interface = "nosuchif0"
+	if c, err := r.dial(context.Background(), "udp", "127.0.0.1:53"); err == nil {
+		c.Close()
+		t.Errorf("binding to %s succeeded", r.Interface)
+	}
+}
+
+// serveSOCKS5Resolve answers the RESOLVE and RESOLVE_PTR requests made
+// on the connections accepted by ln with the records in names, which
+// maps names to addresses and addresses to names.
+func serveSOCKS5Resolve(ln Listener, names map[string]string) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		func() {
+			defer c.Close()
+			b := make([]byte, 262)
+			// Greeting: version, methods.
+			if _, err := io.ReadFull(c, b[:2]); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(c, b[:b[1]]); err != nil {
+				return
+			}
+			c.Write([]byte{5, 0})
+			// Request: version, command, reserved, address type.
+			if _, err := io.ReadFull(c, b[:4]); err != nil {
+				return
+			}
+			cmd, atyp := b[1], b[3]
+			var query string
+			switch atyp {
+			case 1, 4:
+				n := 4
+				if atyp == 4 {
+					n = 16
+				}
+				if _, err := io.ReadFull(c, b[:n+2]); err != nil {
+					return
+				}
+				ip, _ := netip.AddrFromSlice(b[:n])
+				query = ip.String()
+			case 3:
+				if _, err := io.ReadFull(c, b[:1]); err != nil {
+					return
+				}
+				n := int(b[0])
+				if _, err := io.ReadFull(c, b[:n+2]); err != nil {
+					return
+				}
+				query = string(b[:n])
+			}
+			answer, ok := names[query]
+			if !ok || cmd != 0xf0 && cmd != 0xf1 {
+				c.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			resp := []byte{5, 0, 0}
+			if cmd == 0xf1 {
+				resp = append(resp, 3, byte(len(answer)))
+				resp = append(resp, answer...)
+			} else if ip := netip.MustParseAddr(answer); ip.Is4() {
+				resp = append(resp, 1)
+				resp = append(resp, ip.AsSlice()...)
+			} else {
+				resp = append(resp, 4)
+				resp = append(resp, ip.AsSlice()...)
+			}
+			c.Write(append(resp, 0, 0))
+		}()
+	}
+}
+
+func TestResolverSOCKS5Proxy(t *testing.T) {
+	if !testableNetwork("tcp4") {
+		t.Skip("tcp4 is not supported")
+	}
+	ln, err := Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveSOCKS5Resolve(ln, map[string]string{
+			"v4.onion":  "192.0.2.1",
+			"v6.onion":  "2001:db8::1",
+			"192.0.2.1": "v4.onion",
+		})
+	}()
+	defer func() {
+		ln.Close()
+		<-done
+	}()
+
+	r := &Resolver{SOCKS5Proxy: ln.Addr().String()}
+	ctx := context.Background()
+	if addrs, err := r.LookupHost(ctx, "v4.onion"); err != nil || !reflect.DeepEqual(addrs, []string{"192.0.2.1"}) {
+		t.Errorf("LookupHost(v4.onion) = %v, %v; want [192.0.2.1]", addrs, err)
+	}
+	if addrs, err := r.LookupNetIP(ctx, "ip6", "v6.onion"); err != nil || len(addrs) != 1 || addrs[0] != netip.MustParseAddr("2001:db8::1") {
+		t.Errorf("LookupNetIP(ip6, v6.onion) = %v, %v; want [2001:db8::1]", addrs, err)
+	}
+	if addrs, err := r.LookupNetIP(ctx, "ip4", "v6.onion"); err == nil {
+		t.Errorf("LookupNetIP(ip4, v6.onion) = %v; want error", addrs)
+	}
+	if names, err := r.LookupAddr(ctx, "192.0.2.1"); err != nil || !reflect.DeepEqual(names, []string{"v4.onion."}) {
+		t.Errorf("LookupAddr(192.0.2.1) = %v, %v; want [v4.onion.]", names, err)
+	}
+
+	// Names that do not exist are not found.
+	_, err = r.LookupHost(ctx, "missing.example")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound || de.Server != r.SOCKS5Proxy {
+		t.Errorf("LookupHost(missing.example) error = %#v; want not found by %s", err, r.SOCKS5Proxy)
+	}
+
+	// Other lookups fail without reaching the proxy.
+	if _, err := r.LookupMX(ctx, "v4.onion"); !errors.Is(err, errSOCKS5Unsupported) {
+		t.Errorf("LookupMX error = %v; want %v", err, errSOCKS5Unsupported)
+	}
+
+	// Requests to the proxy count towards MaxConcurrentQueries.
+	r = &Resolver{SOCKS5Proxy: ln.Addr().String(), MaxConcurrentQueries: 1}
+	release, err := r.acquireQuerySlot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = r.LookupHost(tctx, "v4.onion")
+	if de, ok := err.(*DNSError); !ok || !de.IsTimeout {
+		t.Errorf("LookupHost(v4.onion) with no query slot free: error = %v; want timeout", err)
+	}
+}
+
+func TestResolverNamePolicy(t *testing.T) {
+	errDenied := errors.New("denied by policy")
+	var mu sync.Mutex
+	var names []string
+	r := &Resolver{
+		NamePolicy: func(ctx context.Context, name string) (string, error) {
+			mu.Lock()
+			names = append(names, name)
+			mu.Unlock()
+			switch {
+			case name == "alias.internal":
+				return "127.0.0.1", nil
+			case name == "gone.internal":
+				return "", nil
+			case strings.HasSuffix(name, ".internal"):
+				return name, nil
+			}
+			return "", errDenied
+		},
+	}
+	ctx := context.Background()
+
+	for _, name := range []string{"example.com", "example.com."} {
+		_, err := r.LookupHost(ctx, name)
+		if _, ok := err.(*DNSError); !ok || !errors.Is(err, errDenied) {
+			t.Errorf("LookupHost(%q) error = %v; want DNSError wrapping %v", name, err, errDenied)
+		}
+	}
+	if _, err := r.LookupMX(ctx, "example.com"); !errors.Is(err, errDenied) {
+		t.Errorf("LookupMX error = %v; want %v", err, errDenied)
+	}
+	if _, err := r.LookupAddr(ctx, "192.0.2.1"); !errors.Is(err, errDenied) {
+		t.Errorf("LookupAddr error = %v; want %v", err, errDenied)
+	}
+	if _, err := (&Dialer{Resolver: r}).DialContext(ctx, "tcp", "example.com:80"); !errors.Is(err, errDenied) {
+		t.Errorf("Dial error = %v; want %v", err, errDenied)
+	}
+	_, err := r.LookupIPAddr(ctx, "gone.internal")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("LookupIPAddr(gone.internal) error = %v; want not found", err)
+	}
+
+	// A name may be rewritten to an address.
+	addrs, err := r.LookupHost(ctx, "alias.internal")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1"}) {
+		t.Errorf("LookupHost(alias.internal) = %v, %v; want [127.0.0.1]", addrs, err)
+	}
+	ips, err := r.LookupNetIP(ctx, "ip4", "alias.internal")
+	if err != nil || len(ips) != 1 || ips[0].Unmap() != netip.MustParseAddr("127.0.0.1") {
+		t.Errorf("LookupNetIP(alias.internal) = %v, %v; want [127.0.0.1]", ips, err)
+	}
+	ttls, err := r.LookupNetIPTTL(ctx, "ip", "alias.internal")
+	if err != nil || len(ttls) != 1 || ttls[0].Addr != netip.MustParseAddr("127.0.0.1") {
+		t.Errorf("LookupNetIPTTL(alias.internal) = %v, %v; want [127.0.0.1]", ttls, err)
+	}
+
+	// Addresses are not passed to the policy.
+	mu.Lock()
+	names = nil
+	mu.Unlock()
+	if _, err := r.LookupHost(ctx, "192.0.2.1"); err != nil {
+		t.Error(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) != 0 {
+		t.Errorf("policy called with %q for an address", names)
+	}
+}
+
+func TestLookupLocalhostRFC6761(t *testing.T) {
+	r := &Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			t.Errorf("unexpected dial of %s %s", network, address)
+			return nil, errors.New("no DNS for localhost names")
+		},
+	}
+	ctx := context.WithValue(context.Background(), nettrace.LookupIPAltResolverKey{}, func(ctx context.Context, network, host string) ([]IPAddr, error) {
+		t.Errorf("unexpected lookup of %s %s", network, host)
+		return nil, errors.New("no lookups for localhost names")
+	})
+
+	for _, name := range []string{"localhost", "LOCALHOST.", "foo.localhost", "bar.foo.localhost.", "localhost.localdomain", "foo.localhost.localdomain"} {
+		addrs, err := r.LookupHost(ctx, name)
+		if err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1", "::1"}) {
+			t.Errorf("LookupHost(%q) = %v, %v; want [127.0.0.1 ::1]", name, addrs, err)
+		}
+		ips, err := r.LookupIPAddr(ctx, name)
+		if err != nil || len(ips) != 2 || !ips[0].IP.Equal(IPv4(127, 0, 0, 1)) || !ips[1].IP.Equal(IPv6loopback) {
+			t.Errorf("LookupIPAddr(%q) = %v, %v; want [127.0.0.1 ::1]", name, ips, err)
+		}
+		ip4, err := r.LookupNetIP(ctx, "ip4", name)
+		if err != nil || len(ip4) != 1 || ip4[0].Unmap() != netip.MustParseAddr("127.0.0.1") {
+			t.Errorf("LookupNetIP(ip4, %q) = %v, %v; want [127.0.0.1]", name, ip4, err)
+		}
+		ip6, err := r.LookupNetIP(ctx, "ip6", name)
+		if err != nil || len(ip6) != 1 || ip6[0] != netip.IPv6Loopback() {
+			t.Errorf("LookupNetIP(ip6, %q) = %v, %v; want [::1]", name, ip6, err)
+		}
+	}
+
+	// Names that merely contain localhost are not special.
+	for _, name := range []string{"localhost.example", "notlocalhost"} {
+		if _, ok := localhostAddrs("ip", name); ok {
+			t.Errorf("localhostAddrs(%q) matched", name)
+		}
+	}
+}
+
+func TestLookupOnionName(t *testing.T) {
+	r := &Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			t.Errorf("unexpected dial of %s %s", network, address)
+			return nil, errors.New("no DNS for onion names")
+		},
+		// The policy may not rewrite a name to an onion name either.
+		NamePolicy: func(ctx context.Context, name string) (string, error) {
+			if name == "alias.internal" {
+				return "hidden.onion", nil
+			}
+			return name, nil
+		},
+	}
+	ctx := context.Background()
+	check := func(what string, err error) {
+		t.Helper()
+		if !errors.Is(err, ErrOnionName) || errors.Is(err, ErrNXDomain) {
+			t.Errorf("%s error = %v; want %v", what, err, ErrOnionName)
+		}
+	}
+	for _, name := range []string{"duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion", "www.example.ONION.", "onion", "alias.internal"} {
+		_, err := r.LookupHost(ctx, name)
+		check("LookupHost("+name+")", err)
+		_, err = r.LookupNetIP(ctx, "ip", name)
+		check("LookupNetIP("+name+")", err)
+		_, err = r.LookupTXT(ctx, name)
+		check("LookupTXT("+name+")", err)
+		_, err = (&Dialer{Resolver: r}).DialContext(ctx, "tcp", JoinHostPort(name, "80"))
+		check("Dial("+name+")", err)
+	}
+
+	// The package-level functions refuse them too.
+	_, err := LookupTXT("www.example.onion")
+	check("package LookupTXT", err)
+}
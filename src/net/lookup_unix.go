@@ -8,48 +8,16 @@ package net
 
 import (
 	"context"
-	"internal/bytealg"
-	"sync"
+	"runtime"
 	"syscall"
 )
 
-var onceReadProtocols sync.Once
-
-// readProtocols loads contents of /etc/protocols into protocols map
-// for quick access.
-func readProtocols() {
-	file, err := open("/etc/protocols")
-	if err != nil {
-		return
-	}
-	defer file.close()
-
-	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
-		// tcp    6   TCP    # transmission control protocol
-		if i := bytealg.IndexByteString(line, '#'); i >= 0 {
-			line = line[0:i]
-		}
-		f := getFields(line)
-		if len(f) < 2 {
-			continue
-		}
-		if proto, _, ok := dtoi(f[1]); ok {
-			if _, ok := protocols[f[0]]; !ok {
-				protocols[f[0]] = proto
-			}
-			for _, alias := range f[2:] {
-				if _, ok := protocols[alias]; !ok {
-					protocols[alias] = proto
-				}
-			}
-		}
-	}
-}
-
 // lookupProtocol looks up IP protocol name in /etc/protocols and
 // returns correspondent protocol number.
 func lookupProtocol(_ context.Context, name string) (int, error) {
-	onceReadProtocols.Do(readProtocols)
+	if proto, ok := lookupProtocolFile(name); ok {
+		return proto, nil
+	}
 	return lookupProtocolMap(name)
 }
 
@@ -62,23 +30,128 @@ func (r *Resolver) lookupHost(ctx context.Context, host string) (addrs []string,
 		// cgo not available (or netgo); fall back to Go's DNS resolver
 		order = hostLookupFilesDNS
 	}
-	return r.goLookupHostOrder(ctx, host, order)
+	if r.raceCgo() {
+		return raceWithCgo(ctx, func(ctx context.Context) ([]string, error) {
+			return r.goLookupHostOrder(ctx, host, order)
+		}, func(ctx context.Context) ([]string, error, bool) {
+			return cgoLookupHostFunc(ctx, host)
+		})
+	}
+	addrs, err = r.goLookupHostOrder(ctx, host, order)
+	if err != nil && r.retryWithCgo(ctx, host, err) {
+		if cgoAddrs, cgoErr, ok := cgoLookupHostFunc(ctx, host); ok && cgoErr == nil {
+			return cgoAddrs, nil
+		}
+	}
+	return addrs, err
 }
 
 func (r *Resolver) lookupIP(ctx context.Context, network, host string) (addrs []IPAddr, err error) {
+	if r.raceCgo() {
+		return raceWithCgo(ctx, func(ctx context.Context) ([]IPAddr, error) {
+			return r.goLookupIP(ctx, network, host)
+		}, func(ctx context.Context) ([]IPAddr, error, bool) {
+			return cgoLookupIPFunc(ctx, network, host)
+		})
+	}
 	if r.preferGo() {
-		return r.goLookupIP(ctx, network, host)
+		addrs, err = r.goLookupIP(ctx, network, host)
+	} else {
+		order := systemConf().hostLookupOrder(r, host)
+		if order == hostLookupCgo {
+			if addrs, err, ok := cgoLookupIP(ctx, network, host); ok {
+				return addrs, err
+			}
+			// cgo not available (or netgo); fall back to Go's DNS resolver
+			order = hostLookupFilesDNS
+		}
+		addrs, _, err = r.goLookupIPCNAMEOrder(ctx, network, host, order)
+	}
+	if len(addrs) == 0 && err != nil && r.retryWithCgo(ctx, host, err) {
+		if cgoAddrs, cgoErr, ok := cgoLookupIPFunc(ctx, network, host); ok && cgoErr == nil {
+			return cgoAddrs, nil
+		}
 	}
+	return addrs, err
+}
+
+func (r *Resolver) lookupNetIPTTL(ctx context.Context, network, host string) ([]AddrTTL, error) {
 	order := systemConf().hostLookupOrder(r, host)
-	if order == hostLookupCgo {
+	if !r.preferGo() && order == hostLookupCgo {
 		if addrs, err, ok := cgoLookupIP(ctx, network, host); ok {
-			return addrs, err
+			if err != nil {
+				return nil, err
+			}
+			return addrsWithoutTTL(addrs), nil
 		}
 		// cgo not available (or netgo); fall back to Go's DNS resolver
 		order = hostLookupFilesDNS
 	}
-	ips, _, err := r.goLookupIPCNAMEOrder(ctx, network, host, order)
-	return ips, err
+	return r.goLookupIPTTL(ctx, network, host, order)
+}
+
+// retryWithCgo reports whether a lookup of host that failed in Go's
+// resolver with err should be retried with cgo, as requested by
+// Resolver.CgoFallback, GODEBUG=netdns=go+cgo or, for server failures
+// only, Resolver.CgoRetryOnServerFailure. If cgo fails as well, the
+// error from Go's resolver is reported.
+func (r *Resolver) retryWithCgo(ctx context.Context, host string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	retry := r.cgoFallback() || systemConf().cgoFallback ||
+		r != nil && r.CgoRetryOnServerFailure && isServerFailure(err)
+	if retry {
+		dnsStats.cgoFallbacks.Add(1)
+		ContextDNSTrace(ctx).cgoFallback(host, err)
+	}
+	return retry
+}
+
+// raceWithCgo runs goLookup and cgoLookup concurrently and returns the
+// first successful result, cancelling the other lookup. If neither
+// succeeds, or cgo is not available, the result of goLookup is
+// returned.
+func raceWithCgo[T any](ctx context.Context, goLookup func(context.Context) (T, error), cgoLookup func(context.Context) (T, error, bool)) (T, error) {
+	type result struct {
+		val T
+		err error
+		ok  bool // lookup completed successfully
+		cgo bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan result, 2)
+	go func() {
+		val, err := goLookup(ctx)
+		ch <- result{val, err, err == nil, false}
+	}()
+	go func() {
+		val, err, completed := cgoLookup(ctx)
+		ch <- result{val, err, completed && err == nil, true}
+	}()
+
+	var goRes result
+	for i := 0; i < 2; i++ {
+		res := <-ch
+		if res.ok {
+			return res.val, nil
+		}
+		if !res.cgo {
+			goRes = res
+		}
+	}
+	return goRes.val, goRes.err
+}
+
+// isServerFailure reports whether err is a DNS error caused by the
+// server answering with an unexpected response code, such as SERVFAIL
+// or REFUSED, as opposed to the name not existing or the server not
+// answering at all.
+func isServerFailure(err error) bool {
+	dnsErr, ok := err.(*DNSError)
+	return ok && !dnsErr.IsNotFound && dnsErr.RCode != 0 && dnsErr.RCode != rcodeNameError
 }
 
 func (r *Resolver) lookupPort(ctx context.Context, network, service string) (int, error) {
@@ -106,19 +179,59 @@ func (r *Resolver) lookupCNAME(ctx context.Context, name string) (string, error)
 	return r.goLookupCNAME(ctx, name)
 }
 
+// nativeRecordLookups reports whether r looks up DNS records other than
+// addresses and names with the system resolver. That is only done on
+// Darwin, where programs are expected not to send DNS queries of their
+// own, and where the libSystem resolver is reached without cgo.
+func (r *Resolver) nativeRecordLookups() bool {
+	return (runtime.GOOS == "darwin" || runtime.GOOS == "ios") && !r.preferGo() && systemConf().canUseCgo()
+}
+
 func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (string, []*SRV, error) {
+	if r.nativeRecordLookups() {
+		target := name
+		if service != "" || proto != "" {
+			target = "_" + service + "._" + proto + "." + name
+		}
+		if cname, srvs, err, ok := cgoLookupSRV(ctx, target); ok {
+			return cname, srvs, err
+		}
+	}
 	return r.goLookupSRV(ctx, service, proto, name)
 }
 
 func (r *Resolver) lookupMX(ctx context.Context, name string) ([]*MX, error) {
+	if r.nativeRecordLookups() {
+		if mxs, err, ok := cgoLookupMX(ctx, name); ok {
+			return mxs, err
+		}
+	}
 	return r.goLookupMX(ctx, name)
 }
 
 func (r *Resolver) lookupNS(ctx context.Context, name string) ([]*NS, error) {
+	if r.nativeRecordLookups() {
+		if nss, err, ok := cgoLookupNS(ctx, name); ok {
+			return nss, err
+		}
+	}
 	return r.goLookupNS(ctx, name)
 }
 
+func (r *Resolver) lookupTLSA(ctx context.Context, service, proto, name string) ([]*TLSA, error) {
+	return r.goLookupTLSA(ctx, service, proto, name)
+}
+
+func (r *Resolver) lookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	return r.goLookupNAPTR(ctx, name)
+}
+
 func (r *Resolver) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.nativeRecordLookups() {
+		if txts, err, ok := cgoLookupTXT(ctx, name); ok {
+			return txts, err
+		}
+	}
 	return r.goLookupTXT(ctx, name)
 }
 
@@ -9,6 +9,7 @@ import (
 	"internal/syscall/windows"
 	"os"
 	"runtime"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -58,7 +59,7 @@ func lookupProtocol(ctx context.Context, name string) (int, error) {
 				return proto, nil
 			}
 
-			dnsError := &DNSError{Err: r.err.Error(), Name: name}
+			dnsError := &DNSError{Err: r.err.Error(), Name: name, UnwrapErr: r.err}
 			if r.err == errNoSuchHost {
 				dnsError.IsNotFound = true
 			}
@@ -95,7 +96,6 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 	if r.preferGoOverWindows() {
 		return r.goLookupIP(ctx, network, name)
 	}
-	// TODO(bradfitz,brainman): use ctx more. See TODO below.
 
 	var family int32 = syscall.AF_UNSPEC
 	switch ipVersion(network) {
@@ -105,6 +105,10 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 		family = syscall.AF_INET6
 	}
 
+	if windows.LoadGetAddrInfoExCancel() == nil {
+		return getAddrInfoEx(ctx, family, name)
+	}
+
 	getaddr := func() ([]IPAddr, error) {
 		acquireThread()
 		defer releaseThread()
@@ -116,12 +120,12 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 		var result *syscall.AddrinfoW
 		name16p, err := syscall.UTF16PtrFromString(name)
 		if err != nil {
-			return nil, &DNSError{Name: name, Err: err.Error()}
+			return nil, &DNSError{Name: name, Err: err.Error(), UnwrapErr: err}
 		}
 		e := syscall.GetAddrInfoW(name16p, nil, &hints, &result)
 		if e != nil {
 			err := winError("getaddrinfow", e)
-			dnsError := &DNSError{Err: err.Error(), Name: name}
+			dnsError := &DNSError{Err: err.Error(), Name: name, UnwrapErr: err}
 			if err == errNoSuchHost {
 				dnsError.IsNotFound = true
 			}
@@ -130,18 +134,11 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 		defer syscall.FreeAddrInfoW(result)
 		addrs := make([]IPAddr, 0, 5)
 		for ; result != nil; result = result.Next {
-			addr := unsafe.Pointer(result.Addr)
-			switch result.Family {
-			case syscall.AF_INET:
-				a := (*syscall.RawSockaddrInet4)(addr).Addr
-				addrs = append(addrs, IPAddr{IP: copyIP(a[:])})
-			case syscall.AF_INET6:
-				a := (*syscall.RawSockaddrInet6)(addr).Addr
-				zone := zoneCache.name(int((*syscall.RawSockaddrInet6)(addr).Scope_id))
-				addrs = append(addrs, IPAddr{IP: copyIP(a[:]), Zone: zone})
-			default:
+			addr, ok := sockaddrToIPAddr(result.Family, unsafe.Pointer(result.Addr))
+			if !ok {
 				return nil, &DNSError{Err: syscall.EWINDOWS.Error(), Name: name}
 			}
+			addrs = append(addrs, addr)
 		}
 		return addrs, nil
 	}
@@ -164,14 +161,9 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 	case r := <-ch:
 		return r.addrs, r.err
 	case <-ctx.Done():
-		// TODO(bradfitz,brainman): cancel the ongoing
-		// GetAddrInfoW? It would require conditionally using
-		// GetAddrInfoEx with lpOverlapped, which requires
-		// Windows 8 or newer. I guess we'll need oldLookupIP,
-		// newLookupIP, and newerLookUP.
-		//
-		// For now we just let it finish and write to the
-		// buffered channel.
+		// Before Windows 8, GetAddrInfoW cannot be cancelled,
+		// so we just let it finish and write to the buffered
+		// channel.
 		return nil, &DNSError{
 			Name:      name,
 			Err:       ctx.Err().Error(),
@@ -180,6 +172,142 @@ func (r *Resolver) lookupIP(ctx context.Context, network, name string) ([]IPAddr
 	}
 }
 
+// sockaddrToIPAddr returns the address in the socket address at addr
+// of the given family, as found in the results of GetAddrInfoW.
+func sockaddrToIPAddr(family int32, addr unsafe.Pointer) (IPAddr, bool) {
+	switch family {
+	case syscall.AF_INET:
+		a := (*syscall.RawSockaddrInet4)(addr).Addr
+		return IPAddr{IP: copyIP(a[:])}, true
+	case syscall.AF_INET6:
+		a := (*syscall.RawSockaddrInet6)(addr).Addr
+		zone := zoneCache.name(int((*syscall.RawSockaddrInet6)(addr).Scope_id))
+		return IPAddr{IP: copyIP(a[:]), Zone: zone}, true
+	}
+	return IPAddr{}, false
+}
+
+// An addrInfoExOp is an asynchronous GetAddrInfoExW call. Its memory
+// is passed to Windows, which writes to it until the call completes.
+type addrInfoExOp struct {
+	o      syscall.Overlapped
+	name   *uint16
+	hints  windows.AddrinfoExW
+	result *windows.AddrinfoExW
+	handle syscall.Handle
+	err    syscall.Errno
+	done   chan struct{}
+}
+
+// addrInfoExOps holds the pending GetAddrInfoExW calls, keyed by the
+// address of their overlapped structure, which is all the completion
+// routine gets. The map also keeps their memory alive.
+var addrInfoExOps struct {
+	once     sync.Once
+	callback uintptr
+	mu       sync.Mutex
+	m        map[uintptr]*addrInfoExOp
+}
+
+// addrInfoExComplete is the completion routine of GetAddrInfoExW.
+func addrInfoExComplete(err, bytes, o uintptr) uintptr {
+	addrInfoExOps.mu.Lock()
+	op := addrInfoExOps.m[o]
+	delete(addrInfoExOps.m, o)
+	addrInfoExOps.mu.Unlock()
+	if op != nil {
+		op.err = syscall.Errno(err)
+		close(op.done)
+	}
+	return 0
+}
+
+// getAddrInfoEx looks up the addresses of name with an asynchronous
+// GetAddrInfoExW call, which is cancelled if ctx is done before it
+// completes. Unlike GetAddrInfoW, it does not tie up a thread while
+// waiting for an answer.
+func getAddrInfoEx(ctx context.Context, family int32, name string) ([]IPAddr, error) {
+	name16p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, &DNSError{Name: name, Err: err.Error(), UnwrapErr: err}
+	}
+	addrInfoExOps.once.Do(func() {
+		addrInfoExOps.callback = syscall.NewCallback(addrInfoExComplete)
+		addrInfoExOps.m = make(map[uintptr]*addrInfoExOp)
+	})
+	op := &addrInfoExOp{
+		name: name16p,
+		hints: windows.AddrinfoExW{
+			Family:   family,
+			Socktype: syscall.SOCK_STREAM,
+			Protocol: syscall.IPPROTO_IP,
+		},
+		done: make(chan struct{}),
+	}
+	key := uintptr(unsafe.Pointer(&op.o))
+	addrInfoExOps.mu.Lock()
+	addrInfoExOps.m[key] = op
+	addrInfoExOps.mu.Unlock()
+
+	e := windows.GetAddrInfoExW(op.name, nil, windows.NS_ALL, nil, &op.hints, &op.result, nil, &op.o, addrInfoExOps.callback, &op.handle)
+	if e == syscall.ERROR_IO_PENDING {
+		select {
+		case <-op.done:
+		case <-ctx.Done():
+			// The completion routine still runs, with
+			// WSA_E_CANCELLED unless the call won the race.
+			windows.GetAddrInfoExCancel(&op.handle)
+			<-op.done
+			if op.result != nil {
+				windows.FreeAddrInfoExW(op.result)
+			}
+			return nil, &DNSError{
+				Name:      name,
+				Err:       ctx.Err().Error(),
+				IsTimeout: ctx.Err() == context.DeadlineExceeded,
+			}
+		}
+		e = nil
+		if op.err != 0 {
+			e = op.err
+		}
+	} else {
+		// The call completed synchronously.
+		addrInfoExOps.mu.Lock()
+		delete(addrInfoExOps.m, key)
+		addrInfoExOps.mu.Unlock()
+	}
+	if e != nil {
+		err := winError("getaddrinfoexw", e)
+		dnsError := &DNSError{Err: err.Error(), Name: name, UnwrapErr: err}
+		if err == errNoSuchHost {
+			dnsError.IsNotFound = true
+		}
+		return nil, dnsError
+	}
+	defer windows.FreeAddrInfoExW(op.result)
+	addrs := make([]IPAddr, 0, 5)
+	for result := op.result; result != nil; result = result.Next {
+		addr, ok := sockaddrToIPAddr(result.Family, unsafe.Pointer(result.Addr))
+		if !ok {
+			return nil, &DNSError{Err: syscall.EWINDOWS.Error(), Name: name}
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func (r *Resolver) lookupNetIPTTL(ctx context.Context, network, name string) ([]AddrTTL, error) {
+	if r.preferGoOverWindows() {
+		return r.goLookupIPTTL(ctx, network, name, systemConf().hostLookupOrder(r, name))
+	}
+	addrs, err := r.lookupIP(ctx, network, name)
+	if err != nil {
+		return nil, err
+	}
+	return addrsWithoutTTL(addrs), nil
+}
+
 func (r *Resolver) lookupPort(ctx context.Context, network, service string) (int, error) {
 	if r.preferGoOverWindows() {
 		return lookupPortMap(network, service)
@@ -207,7 +335,7 @@ func (r *Resolver) lookupPort(ctx context.Context, network, service string) (int
 			return port, nil
 		}
 		err := winError("getaddrinfow", e)
-		dnsError := &DNSError{Err: err.Error(), Name: network + "/" + service}
+		dnsError := &DNSError{Err: err.Error(), Name: network + "/" + service, UnwrapErr: err}
 		if err == errNoSuchHost {
 			dnsError.IsNotFound = true
 		}
@@ -233,18 +361,14 @@ func (r *Resolver) lookupCNAME(ctx context.Context, name string) (string, error)
 	if r.preferGoOverWindows() {
 		return r.goLookupCNAME(ctx, name)
 	}
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(name, syscall.DNS_TYPE_CNAME, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, name, syscall.DNS_TYPE_CNAME)
 	// windows returns DNS_INFO_NO_RECORDS if there are no CNAME-s
 	if errno, ok := e.(syscall.Errno); ok && errno == syscall.DNS_INFO_NO_RECORDS {
 		// if there are no aliases, the canonical name is the input name
 		return absDomainName(name), nil
 	}
 	if e != nil {
-		return "", &DNSError{Err: winError("dnsquery", e).Error(), Name: name}
+		return "", dnsQueryError(name, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -257,19 +381,15 @@ func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (
 	if r.preferGoOverWindows() {
 		return r.goLookupSRV(ctx, service, proto, name)
 	}
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
 	var target string
 	if service == "" && proto == "" {
 		target = name
 	} else {
 		target = "_" + service + "._" + proto + "." + name
 	}
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(target, syscall.DNS_TYPE_SRV, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, target, syscall.DNS_TYPE_SRV)
 	if e != nil {
-		return "", nil, &DNSError{Err: winError("dnsquery", e).Error(), Name: target}
+		return "", nil, dnsQueryError(target, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -278,7 +398,6 @@ func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (
 		v := (*syscall.DNSSRVData)(unsafe.Pointer(&p.Data[0]))
 		srvs = append(srvs, &SRV{absDomainName(syscall.UTF16ToString((*[256]uint16)(unsafe.Pointer(v.Target))[:])), v.Port, v.Priority, v.Weight})
 	}
-	byPriorityWeight(srvs).sort()
 	return absDomainName(target), srvs, nil
 }
 
@@ -286,13 +405,9 @@ func (r *Resolver) lookupMX(ctx context.Context, name string) ([]*MX, error) {
 	if r.preferGoOverWindows() {
 		return r.goLookupMX(ctx, name)
 	}
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(name, syscall.DNS_TYPE_MX, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, name, syscall.DNS_TYPE_MX)
 	if e != nil {
-		return nil, &DNSError{Err: winError("dnsquery", e).Error(), Name: name}
+		return nil, dnsQueryError(name, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -309,13 +424,9 @@ func (r *Resolver) lookupNS(ctx context.Context, name string) ([]*NS, error) {
 	if r.preferGoOverWindows() {
 		return r.goLookupNS(ctx, name)
 	}
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(name, syscall.DNS_TYPE_NS, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, name, syscall.DNS_TYPE_NS)
 	if e != nil {
-		return nil, &DNSError{Err: winError("dnsquery", e).Error(), Name: name}
+		return nil, dnsQueryError(name, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -327,17 +438,23 @@ func (r *Resolver) lookupNS(ctx context.Context, name string) ([]*NS, error) {
 	return nss, nil
 }
 
+func (r *Resolver) lookupTLSA(ctx context.Context, service, proto, name string) ([]*TLSA, error) {
+	// DnsQuery does not decode TLSA records, so always use the Go resolver.
+	return r.goLookupTLSA(ctx, service, proto, name)
+}
+
+func (r *Resolver) lookupNAPTR(ctx context.Context, name string) ([]*NAPTR, error) {
+	// DnsQuery does not decode NAPTR records, so always use the Go resolver.
+	return r.goLookupNAPTR(ctx, name)
+}
+
 func (r *Resolver) lookupTXT(ctx context.Context, name string) ([]string, error) {
 	if r.preferGoOverWindows() {
 		return r.goLookupTXT(ctx, name)
 	}
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(name, syscall.DNS_TYPE_TEXT, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, name, syscall.DNS_TYPE_TEXT)
 	if e != nil {
-		return nil, &DNSError{Err: winError("dnsquery", e).Error(), Name: name}
+		return nil, dnsQueryError(name, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -357,18 +474,13 @@ func (r *Resolver) lookupAddr(ctx context.Context, addr string) ([]string, error
 	if r.preferGoOverWindows() {
 		return r.goLookupPTR(ctx, addr)
 	}
-
-	// TODO(bradfitz): finish ctx plumbing. Nothing currently depends on this.
-	acquireThread()
-	defer releaseThread()
 	arpa, err := reverseaddr(addr)
 	if err != nil {
 		return nil, err
 	}
-	var rec *syscall.DNSRecord
-	e := syscall.DnsQuery(arpa, syscall.DNS_TYPE_PTR, 0, nil, &rec, nil)
+	rec, e := dnsQuery(ctx, arpa, syscall.DNS_TYPE_PTR)
 	if e != nil {
-		return nil, &DNSError{Err: winError("dnsquery", e).Error(), Name: addr}
+		return nil, dnsQueryError(addr, e)
 	}
 	defer syscall.DnsRecordListFree(rec, 1)
 
@@ -380,6 +492,130 @@ func (r *Resolver) lookupAddr(ctx context.Context, addr string) ([]string, error
 	return ptrs, nil
 }
 
+// A dnsQueryOp is an asynchronous DnsQueryEx call. Its memory is
+// passed to Windows, which writes to it until the call completes.
+type dnsQueryOp struct {
+	req    windows.DNSQueryRequest
+	res    windows.DNSQueryResult
+	cancel windows.DNSQueryCancel
+	done   chan struct{}
+}
+
+// dnsQueryOps holds the pending DnsQueryEx calls, keyed by the query
+// context passed to the completion callback. The map also keeps their
+// memory alive.
+var dnsQueryOps struct {
+	once     sync.Once
+	callback uintptr
+	mu       sync.Mutex
+	next     uintptr
+	m        map[uintptr]*dnsQueryOp
+}
+
+// dnsQueryComplete is the completion callback of DnsQueryEx.
+func dnsQueryComplete(id, results uintptr) uintptr {
+	dnsQueryOps.mu.Lock()
+	op := dnsQueryOps.m[id]
+	delete(dnsQueryOps.m, id)
+	dnsQueryOps.mu.Unlock()
+	if op != nil {
+		close(op.done)
+	}
+	return 0
+}
+
+// dnsQuery looks up the records of type qtype for name, like
+// syscall.DnsQuery. Where DnsQueryEx is available, the query runs
+// asynchronously and is cancelled if ctx is done before it completes,
+// in which case the error is ctx.Err().
+func dnsQuery(ctx context.Context, name string, qtype uint16) (*syscall.DNSRecord, error) {
+	if windows.LoadDnsQueryEx() != nil {
+		acquireThread()
+		defer releaseThread()
+		var rec *syscall.DNSRecord
+		err := syscall.DnsQuery(name, qtype, 0, nil, &rec, nil)
+		return rec, err
+	}
+
+	name16p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	dnsQueryOps.once.Do(func() {
+		dnsQueryOps.callback = syscall.NewCallback(dnsQueryComplete)
+		dnsQueryOps.m = make(map[uintptr]*dnsQueryOp)
+	})
+	op := &dnsQueryOp{done: make(chan struct{})}
+	dnsQueryOps.mu.Lock()
+	dnsQueryOps.next++
+	id := dnsQueryOps.next
+	dnsQueryOps.m[id] = op
+	dnsQueryOps.mu.Unlock()
+	op.req = windows.DNSQueryRequest{
+		Version:                 windows.DNS_QUERY_REQUEST_VERSION1,
+		QueryName:               name16p,
+		QueryType:               qtype,
+		QueryCompletionCallback: dnsQueryOps.callback,
+		QueryContext:            id,
+	}
+	op.res.Version = windows.DNS_QUERY_RESULTS_VERSION1
+
+	e := windows.DnsQueryEx(&op.req, &op.res, &op.cancel)
+	if e != windows.DNS_REQUEST_PENDING {
+		// The query completed synchronously.
+		dnsQueryOps.mu.Lock()
+		delete(dnsQueryOps.m, id)
+		dnsQueryOps.mu.Unlock()
+	} else {
+		select {
+		case <-op.done:
+		case <-ctx.Done():
+			// The callback still runs once the query is
+			// cancelled.
+			windows.DnsCancelQuery(&op.cancel)
+			<-op.done
+			e = ctx.Err()
+		}
+		if e == windows.DNS_REQUEST_PENDING {
+			e = nil
+			if op.res.QueryStatus != 0 {
+				e = syscall.Errno(op.res.QueryStatus)
+			}
+		}
+	}
+	if e != nil {
+		if op.res.QueryRecords != nil {
+			syscall.DnsRecordListFree(op.res.QueryRecords, 1)
+		}
+		return nil, e
+	}
+	return op.res.QueryRecords, nil
+}
+
+// dnsQueryError returns the error for a failed dnsQuery for name.
+func dnsQueryError(name string, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return &DNSError{Err: err.Error(), Name: name, IsTimeout: err == context.DeadlineExceeded, UnwrapErr: err}
+	}
+	dnsErr := &DNSError{Err: winError("dnsquery", err).Error(), Name: name}
+	switch err {
+	case _DNS_ERROR_RCODE_SERVER_FAILURE:
+		dnsErr.RCode = rcodeServerFailure
+	case _DNS_ERROR_RCODE_NAME_ERROR:
+		dnsErr.RCode = rcodeNameError
+		dnsErr.IsNotFound = true
+	case syscall.Errno(syscall.DNS_INFO_NO_RECORDS):
+		dnsErr.IsNotFound = true
+	}
+	return dnsErr
+}
+
+// Errors returned by DnsQuery for the response codes of the same name.
+const (
+	_DNS_ERROR_RCODE_SERVER_FAILURE syscall.Errno = 9002
+	_DNS_ERROR_RCODE_NAME_ERROR     syscall.Errno = 9003
+)
+
 const dnsSectionMask = 0x0003
 
 // returns only results applicable to name and resolves CNAME entries
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"internal/syscall/windows"
 	"internal/testenv"
 	"os/exec"
 	"reflect"
@@ -17,8 +18,21 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"unsafe"
 )
 
+func TestDNSQueryRequestLayout(t *testing.T) {
+	// DnsQueryEx expects the C layout, in which QueryOptions is
+	// 8-byte aligned after the pointer-aligned QueryType.
+	var req windows.DNSQueryRequest
+	if off, want := unsafe.Offsetof(req.QueryOptions), 2*unsafe.Sizeof(uintptr(0))+8; off != want {
+		t.Errorf("QueryOptions offset = %d; want %d", off, want)
+	}
+	if size := unsafe.Sizeof(req); size%8 != 0 {
+		t.Errorf("DNSQueryRequest size = %d; want a multiple of 8", size)
+	}
+}
+
 var nslookupTestServers = []string{"mail.golang.com", "gmail.com"}
 var lookupTestIPs = []string{"8.8.8.8", "1.1.1.1"}
 
@@ -0,0 +1,102 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The addresses of the containers and virtual machines registered with
+// systemd-machined, as the mymachines source of nsswitch.conf finds
+// them: see systemd's org.freedesktop.machine1 interface.
+
+package net
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// machinedTimeout bounds a lookup.
+const machinedTimeout = 5 * time.Second
+
+// machinedLookupHost looks up the addresses of the machine name for
+// network by asking systemd-machined on the system bus.
+func machinedLookupHost(ctx context.Context, network, name string) ([]IPAddr, error) {
+	ctx, cancel := context.WithTimeout(ctx, machinedTimeout)
+	defer cancel()
+	c, err := dbusDialSystemBus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	var body dbusEncoder
+	body.string(name)
+	msgs := append(dbusHello(), dbusEncodeMessage(dbusMethodCall, 2, []dbusField{
+		{code: dbusFieldPath, sig: "o", value: "/org/freedesktop/machine1"},
+		{code: dbusFieldInterface, sig: "s", value: "org.freedesktop.machine1.Manager"},
+		{code: dbusFieldMember, sig: "s", value: "GetMachineAddresses"},
+		{code: dbusFieldDestination, sig: "s", value: "org.freedesktop.machine1"},
+	}, "s", body.b)...)
+	if _, err := c.Write(msgs); err != nil {
+		return nil, err
+	}
+
+	notFound := &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	for {
+		m, err := dbusReadMessage(c)
+		if err != nil {
+			return nil, err
+		}
+		if m.replySerial != 2 {
+			continue // e.g. the reply to Hello, or a signal
+		}
+		switch m.typ {
+		case dbusError:
+			if m.errorName == "org.freedesktop.machine1.NoSuchMachine" {
+				return nil, notFound
+			}
+			return nil, errors.New("machined: " + m.errorName)
+		case dbusMethodReturn:
+			if m.signature != "a(iay)" {
+				return nil, errors.New("machined: unexpected reply signature " + m.signature)
+			}
+			addrs, ok := machinedParseAddresses(m, network)
+			if !ok {
+				return nil, errors.New("machined: malformed reply")
+			}
+			if len(addrs) == 0 {
+				return nil, notFound
+			}
+			return addrs, nil
+		}
+	}
+}
+
+// machinedParseAddresses returns the addresses for network in the body of
+// a reply to GetMachineAddresses: an array of address families and
+// addresses.
+func machinedParseAddresses(m *dbusMessage, network string) (addrs []IPAddr, ok bool) {
+	d := dbusDecoder{b: m.body, big: m.big}
+	n := int(d.uint32())
+	d.align(8)
+	if d.bad || n > len(d.b)-d.off {
+		return nil, false
+	}
+	for end := d.off + n; d.off < end; {
+		d.align(8)
+		family := d.int32()
+		ip := d.byteArray()
+		if d.bad {
+			return nil, false
+		}
+		switch {
+		case family == 2 && len(ip) == IPv4len && ipVersion(network) != '6': // AF_INET
+			addrs = append(addrs, IPAddr{IP: IPv4(ip[0], ip[1], ip[2], ip[3])})
+		case family == 10 && len(ip) == IPv6len && ipVersion(network) != '4': // AF_INET6
+			addrs = append(addrs, IPAddr{IP: append(IP(nil), ip...)})
+		}
+	}
+	return addrs, true
+}
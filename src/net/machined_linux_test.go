@@ -0,0 +1,62 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// fakeMachined answers GetMachineAddresses as systemd-machined would,
+// knowing only the container web.
+func fakeMachined(m *dbusMessage, reply []dbusField) []byte {
+	d := dbusDecoder{b: m.body}
+	if m.member != "GetMachineAddresses" || d.string() != "web" {
+		return dbusErrorReply(reply, "org.freedesktop.machine1.NoSuchMachine")
+	}
+	var body dbusEncoder
+	body.uint32(0) // length of the array
+	body.align(8)
+	start := len(body.b)
+	for _, a := range []struct {
+		family int32
+		ip     []byte
+	}{
+		{2, []byte{10, 0, 0, 2}},
+		{10, ParseIP("fd00::2")},
+		{1, []byte("/run/x")}, // AF_UNIX, skipped
+	} {
+		body.align(8)
+		body.int32(a.family)
+		body.uint32(uint32(len(a.ip)))
+		body.b = append(body.b, a.ip...)
+	}
+	n := len(body.b) - start
+	body.b[0], body.b[1], body.b[2], body.b[3] = byte(n), byte(n>>8), byte(n>>16), byte(n>>24)
+	return dbusEncodeMessage(dbusMethodReturn, 3, reply, "a(iay)", body.b)
+}
+
+func TestMachinedLookupHost(t *testing.T) {
+	startFakeBus(t, fakeMachined)
+
+	for _, tt := range []struct {
+		network string
+		want    []IPAddr
+	}{
+		{"ip", []IPAddr{{IP: IPv4(10, 0, 0, 2)}, {IP: ParseIP("fd00::2")}}},
+		{"ip4", []IPAddr{{IP: IPv4(10, 0, 0, 2)}}},
+		{"ip6", []IPAddr{{IP: ParseIP("fd00::2")}}},
+	} {
+		addrs, err := machinedLookupHost(context.Background(), tt.network, "web.")
+		if err != nil || !reflect.DeepEqual(addrs, tt.want) {
+			t.Errorf("machinedLookupHost(%q) = %v, %v; want %v", tt.network, addrs, err, tt.want)
+		}
+	}
+	_, err := machinedLookupHost(context.Background(), "ip", "db")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound {
+		t.Errorf("got error %v for an unknown machine; want not found", err)
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !linux
+
+package net
+
+import "context"
+
+// machinedLookupHost is never called: systemd-machined only runs on
+// Linux.
+func machinedLookupHost(ctx context.Context, network, name string) ([]IPAddr, error) {
+	return nil, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+}
@@ -0,0 +1,370 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Multicast DNS responder: see RFC 6762, and RFC 6763 for
+// DNS-based service discovery.
+
+package net
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsPort = 5353
+
+	// mdnsCacheFlush is set in the class of records the responder
+	// owns exclusively, telling caches to drop any other records of
+	// the same name and type.
+	mdnsCacheFlush = 1 << 15
+
+	// mdnsUnicastResponse is set in the class of questions whose
+	// sender prefers a unicast response.
+	mdnsUnicastResponse = 1 << 15
+
+	// mdnsLegacyTTL is the largest TTL sent in responses to
+	// ordinary DNS resolvers querying from a port other than 5353.
+	mdnsLegacyTTL = 10
+)
+
+var (
+	mdnsGroup4 = &UDPAddr{IP: IPv4(224, 0, 0, 251), Port: mdnsPort}
+	mdnsGroup6 = &UDPAddr{IP: IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xfb}, Port: mdnsPort}
+)
+
+// An MDNSResponder announces a host name and services on the local
+// link using multicast DNS (RFC 6762), and answers queries for them,
+// making a program discoverable without a separate mDNS daemon.
+//
+// The responder does not probe for conflicting names before announcing
+// its own, so the names it uses must be known to be unique on the link.
+type MDNSResponder struct {
+	// Hostname is the name to answer for, which must be in the
+	// "local" domain, such as "myhost.local".
+	Hostname string
+
+	// Addrs are the addresses announced for Hostname. If empty, the
+	// unicast addresses of Interface, or of all interfaces if
+	// Interface is nil, are used, except loopback addresses.
+	Addrs []netip.Addr
+
+	// Services are the services announced using DNS-based service
+	// discovery (RFC 6763).
+	Services []MDNSService
+
+	// Interface is the interface to use. If nil, the system picks
+	// the interface to join the mDNS multicast groups on.
+	Interface *Interface
+
+	// TTL is the time to live of the records announced. If zero,
+	// two minutes is used.
+	TTL time.Duration
+}
+
+// An MDNSService is a service instance announced by an MDNSResponder.
+type MDNSService struct {
+	// Instance is the user-visible name of the service instance,
+	// such as "Office Printer". It must not contain dots.
+	Instance string
+
+	// Service is the service type and transport protocol, such as
+	// "_ipp._tcp".
+	Service string
+
+	// Port is the port the service listens on.
+	Port uint16
+
+	// Text holds the key=value pairs of the instance's TXT record.
+	Text []string
+}
+
+// Serve announces the responder's records on the local link and
+// answers queries for them, over IPv4 and IPv6 when available, until
+// ctx is done. It then withdraws the records and returns ctx.Err().
+func (r *MDNSResponder) Serve(ctx context.Context) error {
+	rrs, err := r.records()
+	if err != nil {
+		return err
+	}
+	var conns []*UDPConn
+	var groups []*UDPAddr
+	for _, g := range []struct {
+		network string
+		group   *UDPAddr
+	}{{"udp4", mdnsGroup4}, {"udp6", mdnsGroup6}} {
+		c, lerr := ListenMulticastUDP(g.network, r.Interface, g.group)
+		if lerr != nil {
+			err = lerr
+			continue
+		}
+		conns = append(conns, c)
+		groups = append(groups, g.group)
+	}
+	if len(conns) == 0 {
+		return err
+	}
+
+	announcement, err := mdnsAnnouncement(rrs)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(1)
+		go func(c *UDPConn, group *UDPAddr) {
+			defer wg.Done()
+			mdnsServe(c, group, rrs)
+		}(c, groups[i])
+	}
+
+	// Announce the records twice, one second apart.
+	// See RFC 6762, section 8.3.
+	for i, c := range conns {
+		c.WriteTo(announcement, groups[i])
+	}
+	t := time.NewTimer(time.Second)
+	select {
+	case <-t.C:
+		for i, c := range conns {
+			c.WriteTo(announcement, groups[i])
+		}
+	case <-ctx.Done():
+		t.Stop()
+	}
+	<-ctx.Done()
+
+	// Say goodbye by announcing the records with a zero TTL.
+	// See RFC 6762, section 10.1.
+	withdrawn := make([]dnsmessage.Resource, len(rrs))
+	copy(withdrawn, rrs)
+	for i := range withdrawn {
+		withdrawn[i].Header.TTL = 0
+	}
+	if goodbye, err := mdnsAnnouncement(withdrawn); err == nil {
+		for i, c := range conns {
+			c.WriteTo(goodbye, groups[i])
+		}
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// mdnsServe answers the queries read from c, which has joined the
+// multicast group, until reading fails.
+func mdnsServe(c *UDPConn, group *UDPAddr, rrs []dnsmessage.Resource) {
+	buf := make([]byte, 9000) // see RFC 6762, section 17
+	for {
+		n, from, err := c.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		legacy := from.Port != mdnsPort
+		resp, unicast, ok := mdnsAnswer(buf[:n], rrs, legacy)
+		if !ok {
+			continue
+		}
+		if unicast {
+			c.WriteTo(resp, from)
+		} else {
+			c.WriteTo(resp, group)
+		}
+	}
+}
+
+// records returns the resource records announced by r.
+func (r *MDNSResponder) records() ([]dnsmessage.Resource, error) {
+	hostname := ensureRooted(r.Hostname)
+	if !isDomainName(hostname) || !stringsHasSuffixFold(hostname, ".local.") {
+		return nil, &DNSError{Err: "host name is not in the local domain", Name: r.Hostname}
+	}
+	host, err := dnsmessage.NewName(hostname)
+	if err != nil {
+		return nil, err
+	}
+	ttl := uint32(120)
+	if r.TTL > 0 {
+		ttl = uint32(r.TTL / time.Second)
+	}
+	addrs := r.Addrs
+	if len(addrs) == 0 {
+		if addrs, err = r.interfaceAddrs(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Records unique to this responder have the cache-flush bit set.
+	unique := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET | mdnsCacheFlush, TTL: ttl}
+	}
+	shared := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+
+	var rrs []dnsmessage.Resource
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.Is4() {
+			rrs = append(rrs, dnsmessage.Resource{Header: unique(host, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: addr.As4()}})
+		} else {
+			rrs = append(rrs, dnsmessage.Resource{Header: unique(host, dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	meta := dnsmessage.MustNewName("_services._dns-sd._udp.local.")
+	types := make(map[string]bool)
+	for _, s := range r.Services {
+		typ, err := dnsmessage.NewName(s.Service + ".local.")
+		if err != nil {
+			return nil, err
+		}
+		inst, err := dnsmessage.NewName(s.Instance + "." + s.Service + ".local.")
+		if err != nil {
+			return nil, err
+		}
+		if !types[s.Service] {
+			types[s.Service] = true
+			rrs = append(rrs, dnsmessage.Resource{Header: shared(meta, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: typ}})
+		}
+		text := s.Text
+		if len(text) == 0 {
+			text = []string{""}
+		}
+		rrs = append(rrs,
+			dnsmessage.Resource{Header: shared(typ, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: inst}},
+			dnsmessage.Resource{Header: unique(inst, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: host, Port: s.Port}},
+			dnsmessage.Resource{Header: unique(inst, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: text}},
+		)
+	}
+	return rrs, nil
+}
+
+// interfaceAddrs returns the non-loopback unicast addresses of
+// r.Interface, or of all interfaces if it is nil.
+func (r *MDNSResponder) interfaceAddrs() ([]netip.Addr, error) {
+	var ifat []Addr
+	var err error
+	if r.Interface != nil {
+		ifat, err = r.Interface.Addrs()
+	} else {
+		ifat, err = InterfaceAddrs()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	for _, ifa := range ifat {
+		ipnet, ok := ifa.(*IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipnet.IP)
+		if ok && !addr.IsLoopback() && !addr.IsMulticast() {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs, nil
+}
+
+// mdnsAnnouncement returns an unsolicited response carrying rrs.
+func mdnsAnnouncement(rrs []dnsmessage.Resource) ([]byte, error) {
+	m := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: rrs,
+	}
+	return m.Pack()
+}
+
+// mdnsAnswer returns the response to the mDNS query msg from the
+// records rrs. It reports whether the response should be sent by
+// unicast to the sender rather than to the multicast group, and false
+// if there is nothing to answer. Queries from legacy resolvers, which
+// send from a port other than 5353, get a conventional DNS response.
+// See RFC 6762, section 6.7.
+func mdnsAnswer(msg []byte, rrs []dnsmessage.Resource, legacy bool) (resp []byte, unicast, ok bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Response || h.OpCode != 0 {
+		return nil, false, false
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, false, false
+	}
+	sent := make([]bool, len(rrs))
+	var answers, additionals []dnsmessage.Resource
+	for _, q := range qs {
+		if q.Class&mdnsUnicastResponse != 0 {
+			unicast = true
+		}
+		for i, rr := range rrs {
+			if !sent[i] && equalASCIIName(rr.Header.Name, q.Name) && (q.Type == rr.Header.Type || q.Type == dnsmessage.TypeALL) {
+				sent[i] = true
+				answers = append(answers, rr)
+			}
+		}
+	}
+	if len(answers) == 0 {
+		return nil, false, false
+	}
+
+	// Add the records a querier is likely to need next: the SRV and
+	// TXT records of service instances, and the host's addresses.
+	// See RFC 6763, section 12.
+	for i := 0; i < len(answers)+len(additionals); i++ {
+		var rr dnsmessage.Resource
+		if i < len(answers) {
+			rr = answers[i]
+		} else {
+			rr = additionals[i-len(answers)]
+		}
+		var target dnsmessage.Name
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			target = body.PTR
+		case *dnsmessage.SRVResource:
+			target = body.Target
+		default:
+			continue
+		}
+		for j, rr := range rrs {
+			if !sent[j] && rr.Header.Type != dnsmessage.TypePTR && equalASCIIName(rr.Header.Name, target) {
+				sent[j] = true
+				additionals = append(additionals, rr)
+			}
+		}
+	}
+
+	m := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	if legacy {
+		m.ID = h.ID
+		m.Questions = qs
+		for i := range m.Questions {
+			m.Questions[i].Class &^= mdnsUnicastResponse
+		}
+		for _, section := range [][]dnsmessage.Resource{answers, additionals} {
+			for i := range section {
+				section[i].Header.Class &^= mdnsCacheFlush
+				if section[i].Header.TTL > mdnsLegacyTTL {
+					section[i].Header.TTL = mdnsLegacyTTL
+				}
+			}
+		}
+	}
+	resp, err = m.Pack()
+	if err != nil {
+		return nil, false, false
+	}
+	return resp, unicast || legacy, true
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func mdnsQuery(t *testing.T, id uint16, name string, typ dnsmessage.Type, class dnsmessage.Class) []byte {
+	m := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: class}},
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMDNSAnswer(t *testing.T) {
+	r := &MDNSResponder{
+		Hostname: "printer.local",
+		Addrs:    []netip.Addr{netip.MustParseAddr("192.0.2.7")},
+		Services: []MDNSService{{Instance: "Office Printer", Service: "_ipp._tcp", Port: 631, Text: []string{"rp=ipp/print"}}},
+	}
+	rrs, err := r.records()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		query       []byte
+		legacy      bool
+		unicast     bool
+		answers     []dnsmessage.Type
+		additionals []dnsmessage.Type
+	}{
+		{
+			name:    "address",
+			query:   mdnsQuery(t, 0, "PRINTER.local.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			answers: []dnsmessage.Type{dnsmessage.TypeA},
+		},
+		{
+			name:        "browse",
+			query:       mdnsQuery(t, 0, "_ipp._tcp.local.", dnsmessage.TypePTR, dnsmessage.ClassINET|mdnsUnicastResponse),
+			unicast:     true,
+			answers:     []dnsmessage.Type{dnsmessage.TypePTR},
+			additionals: []dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA},
+		},
+		{
+			name:    "service types",
+			query:   mdnsQuery(t, 0, "_services._dns-sd._udp.local.", dnsmessage.TypePTR, dnsmessage.ClassINET),
+			answers: []dnsmessage.Type{dnsmessage.TypePTR},
+		},
+		{
+			name:        "legacy",
+			query:       mdnsQuery(t, 0x1234, "Office Printer._ipp._tcp.local.", dnsmessage.TypeALL, dnsmessage.ClassINET),
+			legacy:      true,
+			unicast:     true,
+			answers:     []dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT},
+			additionals: []dnsmessage.Type{dnsmessage.TypeA},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, unicast, ok := mdnsAnswer(tt.query, rrs, tt.legacy)
+			if !ok {
+				t.Fatal("no answer")
+			}
+			if unicast != tt.unicast {
+				t.Errorf("unicast = %v; want %v", unicast, tt.unicast)
+			}
+			var m dnsmessage.Message
+			if err := m.Unpack(resp); err != nil {
+				t.Fatal(err)
+			}
+			if !m.Response || !m.Authoritative {
+				t.Errorf("header = %+v; want authoritative response", m.Header)
+			}
+			for _, section := range []struct {
+				name string
+				rrs  []dnsmessage.Resource
+				want []dnsmessage.Type
+			}{{"answers", m.Answers, tt.answers}, {"additionals", m.Additionals, tt.additionals}} {
+				var got []dnsmessage.Type
+				for _, rr := range section.rrs {
+					got = append(got, rr.Header.Type)
+					if tt.legacy && (rr.Header.TTL > mdnsLegacyTTL || rr.Header.Class != dnsmessage.ClassINET) {
+						t.Errorf("legacy response has %v", rr.Header)
+					}
+				}
+				if len(got) != len(section.want) {
+					t.Errorf("%s = %v; want %v", section.name, got, section.want)
+					continue
+				}
+				for i := range got {
+					if got[i] != section.want[i] {
+						t.Errorf("%s = %v; want %v", section.name, got, section.want)
+						break
+					}
+				}
+			}
+			if tt.legacy && (m.ID != 0x1234 || len(m.Questions) != 1) {
+				t.Errorf("legacy response has ID %#x and %d questions; want 0x1234 and 1", m.ID, len(m.Questions))
+			}
+		})
+	}
+
+	if _, _, ok := mdnsAnswer(mdnsQuery(t, 0, "other.local.", dnsmessage.TypeA, dnsmessage.ClassINET), rrs, false); ok {
+		t.Error("answered query for another name")
+	}
+	if _, err := (&MDNSResponder{Hostname: "printer.example.com"}).records(); err == nil {
+		t.Error("records for host outside the local domain succeeded; want error")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// The names that systemd's myhostname source of nsswitch.conf resolves:
+// localhost and the names under it, the host's own name, and _gateway
+// and _outbound. See nss-myhostname(8).
+
+package net
+
+import "context"
+
+var (
+	// myhostnameInterfaceAddrs returns the addresses of the host's
+	// interfaces; a variable for testing.
+	myhostnameInterfaceAddrs = InterfaceAddrs
+
+	// defaultRoutes returns the default routes of the host's routing
+	// tables; a variable for testing.
+	defaultRoutes = osDefaultRoutes
+)
+
+// A defaultRoute is a route to all destinations through a gateway.
+type defaultRoute struct {
+	gateway IPAddr
+	src     IP // the preferred source address, if the route has one
+}
+
+// myhostnameLookupIP returns the addresses of name for network, one of
+// the names resolved by the myhostname source.
+func myhostnameLookupIP(ctx context.Context, network, name string) ([]IPAddr, error) {
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	var addrs []IPAddr
+	switch {
+	case isLocalhost(name):
+		addrs = []IPAddr{{IP: IPv6loopback}, {IP: IPv4(127, 0, 0, 1)}}
+	case isGateway(name):
+		addrs = defaultGateways()
+	case isOutbound(name):
+		addrs = outboundAddrs(ctx)
+	default:
+		addrs = ownAddrs()
+		if len(addrs) == 0 {
+			addrs = []IPAddr{{IP: IPv4(127, 0, 0, 2)}, {IP: IPv6loopback}}
+		}
+	}
+	addrs = filterAddrs(addrs, network)
+	if len(addrs) == 0 {
+		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// filterAddrs returns the addresses of addrs that are of the family of
+// network.
+func filterAddrs(addrs []IPAddr, network string) []IPAddr {
+	var filtered []IPAddr
+	for _, a := range addrs {
+		is4 := a.IP.To4() != nil
+		switch ipVersion(network) {
+		case '4':
+			if !is4 {
+				continue
+			}
+		case '6':
+			if is4 {
+				continue
+			}
+		}
+		filtered = append(filtered, a)
+	}
+	return filtered
+}
+
+// ownAddrs returns the addresses of the host's interfaces that other
+// hosts can reach it at, leaving out loopback and link-local ones.
+func ownAddrs() []IPAddr {
+	ifat, err := myhostnameInterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var addrs []IPAddr
+	for _, ifa := range ifat {
+		ipnet, ok := ifa.(*IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() || ipnet.IP.IsLinkLocalMulticast() {
+			continue
+		}
+		addrs = append(addrs, IPAddr{IP: ipnet.IP})
+	}
+	sortByRFC6724(addrs)
+	return addrs
+}
+
+// defaultGateways returns the gateways of the default routes.
+func defaultGateways() []IPAddr {
+	var addrs []IPAddr
+	for _, rt := range defaultRoutes() {
+		addrs = appendUniqueAddr(addrs, rt.gateway)
+	}
+	return addrs
+}
+
+// outboundAddrs returns the local addresses that the default routes
+// leave from: their preferred source addresses or, for routes without
+// one, the addresses the kernel chooses for them.
+func outboundAddrs(ctx context.Context) []IPAddr {
+	var addrs []IPAddr
+	for _, rt := range defaultRoutes() {
+		if rt.src != nil {
+			addrs = appendUniqueAddr(addrs, IPAddr{IP: rt.src})
+			continue
+		}
+		// Connecting a UDP socket sends nothing but makes the kernel
+		// pick the source address of the route.
+		var d Dialer
+		c, err := d.DialContext(ctx, "udp", JoinHostPort(rt.gateway.String(), "53"))
+		if err != nil {
+			continue
+		}
+		if la, ok := c.LocalAddr().(*UDPAddr); ok {
+			addrs = appendUniqueAddr(addrs, IPAddr{IP: la.IP, Zone: la.Zone})
+		}
+		c.Close()
+	}
+	return addrs
+}
+
+func appendUniqueAddr(addrs []IPAddr, a IPAddr) []IPAddr {
+	for _, b := range addrs {
+		if b.IP.Equal(a.IP) && b.Zone == a.Zone {
+			return addrs
+		}
+	}
+	return append(addrs, a)
+}
+
+// isOwnHostname reports whether h is the host's own name.
+func isOwnHostname(h string) bool {
+	hn, err := cachedHostname()
+	return err == nil && hn != "" && stringsEqualFold(h, hn)
+}
+
+// myhostnameName reports whether h is one of the names that the
+// myhostname source resolves.
+func myhostnameName(h string) bool {
+	if stringsHasSuffix(h, ".") {
+		h = h[:len(h)-1]
+	}
+	return isLocalhost(h) || isGateway(h) || isOutbound(h) || isOwnHostname(h)
+}
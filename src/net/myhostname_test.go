@@ -0,0 +1,77 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMyhostnameLookupIP(t *testing.T) {
+	defer func(routes func() []defaultRoute, addrs func() ([]Addr, error), hostname func() (string, error)) {
+		defaultRoutes = routes
+		myhostnameInterfaceAddrs = addrs
+		getHostname = hostname
+		FlushHostnameCache()
+	}(defaultRoutes, myhostnameInterfaceAddrs, getHostname)
+	defaultRoutes = func() []defaultRoute {
+		return []defaultRoute{
+			{gateway: IPAddr{IP: IPv4(192, 168, 2, 1)}, src: IPv4(192, 168, 2, 10)},
+			{gateway: IPAddr{IP: IPv4(192, 168, 2, 1)}, src: IPv4(192, 168, 2, 10)},
+			{gateway: IPAddr{IP: ParseIP("fe80::1"), Zone: "eth0"}, src: ParseIP("2001:db8::10")},
+		}
+	}
+	getHostname = func() (string, error) { return "box.example", nil }
+	FlushHostnameCache()
+	ifat := []Addr{
+		&IPNet{IP: IPv4(127, 0, 0, 1), Mask: CIDRMask(8, 32)},
+		&IPNet{IP: IPv4(192, 168, 2, 10), Mask: CIDRMask(24, 32)},
+		&IPNet{IP: ParseIP("2001:db8::10"), Mask: CIDRMask(64, 128)},
+		&IPNet{IP: ParseIP("fe80::10"), Mask: CIDRMask(64, 128)},
+	}
+	myhostnameInterfaceAddrs = func() ([]Addr, error) { return ifat, nil }
+
+	tests := []struct {
+		network, name string
+		want          []IPAddr
+	}{
+		{"ip", "localhost", []IPAddr{{IP: IPv6loopback}, {IP: IPv4(127, 0, 0, 1)}}},
+		{"ip4", "app.localhost.", []IPAddr{{IP: IPv4(127, 0, 0, 1)}}},
+		{"ip", "_gateway", []IPAddr{{IP: IPv4(192, 168, 2, 1)}, {IP: ParseIP("fe80::1"), Zone: "eth0"}}},
+		{"ip6", "_Gateway", []IPAddr{{IP: ParseIP("fe80::1"), Zone: "eth0"}}},
+		{"ip", "_outbound", []IPAddr{{IP: IPv4(192, 168, 2, 10)}, {IP: ParseIP("2001:db8::10")}}},
+		{"ip4", "BOX.example", []IPAddr{{IP: IPv4(192, 168, 2, 10)}}},
+		{"ip6", "box.example", []IPAddr{{IP: ParseIP("2001:db8::10")}}},
+	}
+	for _, tt := range tests {
+		addrs, err := myhostnameLookupIP(context.Background(), tt.network, tt.name)
+		if err != nil {
+			t.Errorf("myhostnameLookupIP(%q, %q) failed: %v", tt.network, tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, tt.want) {
+			t.Errorf("myhostnameLookupIP(%q, %q) = %v; want %v", tt.network, tt.name, addrs, tt.want)
+		}
+	}
+
+	// Without addresses of its own, the host is found on loopback.
+	ifat = ifat[:1]
+	addrs, err := myhostnameLookupIP(context.Background(), "ip", "box.example")
+	if want := []IPAddr{{IP: IPv4(127, 0, 0, 2)}, {IP: IPv6loopback}}; err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Errorf("myhostnameLookupIP(ip, box.example) = %v, %v; want %v", addrs, err, want)
+	}
+
+	for _, name := range []string{"localhost", "x.localhost", "_gateway", "_outbound", "box.example."} {
+		if !myhostnameName(name) {
+			t.Errorf("myhostnameName(%q) = false; want true", name)
+		}
+	}
+	if myhostnameName("other.example") {
+		t.Error("myhostnameName(other.example) = true; want false")
+	}
+}
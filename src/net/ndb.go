@@ -0,0 +1,262 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Plan 9 network database files: see ndb(6).
+
+package net
+
+// ndbLocalPath is the network database of a Plan 9 system.
+var ndbLocalPath = "/lib/ndb/local"
+
+// An ndbTuple is an attribute=value pair of a network database entry.
+type ndbTuple struct {
+	attr, val string
+}
+
+// An ndbEntry is an entry of a network database: the tuples of a line
+// starting in the first column and of the indented lines following it.
+type ndbEntry []ndbTuple
+
+// values returns the values of the tuples of e with attribute attr.
+func (e ndbEntry) values(attr string) []string {
+	var vals []string
+	for _, t := range e {
+		if t.attr == attr {
+			vals = append(vals, t.val)
+		}
+	}
+	return vals
+}
+
+// has reports whether e has the tuple attr=val.
+func (e ndbEntry) has(attr, val string) bool {
+	for _, t := range e {
+		if t.attr == attr && t.val == val {
+			return true
+		}
+	}
+	return false
+}
+
+func isNdbSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// ndbParseLine appends the tuples of line to e. An attribute may lack a
+// value, and a value containing white space is quoted with double
+// quotes. A '#' starts a comment.
+func ndbParseLine(e ndbEntry, line string) ndbEntry {
+	for {
+		i := 0
+		for i < len(line) && isNdbSpace(line[i]) {
+			i++
+		}
+		line = line[i:]
+		if line == "" || line[0] == '#' {
+			return e
+		}
+		i = 0
+		for i < len(line) && !isNdbSpace(line[i]) && line[i] != '=' && line[i] != '#' {
+			i++
+		}
+		t := ndbTuple{attr: line[:i]}
+		line = line[i:]
+		if line != "" && line[0] == '=' {
+			line = line[1:]
+			if line != "" && line[0] == '"' {
+				line = line[1:]
+				i = 0
+				for i < len(line) && line[i] != '"' {
+					i++
+				}
+				t.val = line[:i]
+				if i < len(line) {
+					i++ // closing quote
+				}
+			} else {
+				i = 0
+				for i < len(line) && !isNdbSpace(line[i]) && line[i] != '#' {
+					i++
+				}
+				t.val = line[:i]
+			}
+			line = line[i:]
+		}
+		if t.attr != "" {
+			e = append(e, t)
+		}
+	}
+}
+
+// readNdbFile returns the entries of the network database file filename.
+func readNdbFile(filename string) ([]ndbEntry, error) {
+	file, err := open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.close()
+	var entries []ndbEntry
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		if line != "" && !isNdbSpace(line[0]) {
+			// A new entry, unless the line is blank or a comment.
+			if e := ndbParseLine(nil, line); len(e) > 0 {
+				entries = append(entries, e)
+			}
+			continue
+		}
+		if len(entries) > 0 {
+			entries[len(entries)-1] = ndbParseLine(entries[len(entries)-1], line)
+		}
+	}
+	return entries, nil
+}
+
+// readNdb returns the entries of the network database in filename. If
+// the file has a database entry, the database is made of the files
+// listed by its file tuples instead, which are read in order.
+func readNdb(filename string) ([]ndbEntry, error) {
+	entries, err := readNdbFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e[0].attr != "database" {
+			continue
+		}
+		var all []ndbEntry
+		for _, f := range e.values("file") {
+			if f == filename {
+				all = append(all, entries...)
+			} else if more, err := readNdbFile(f); err == nil {
+				all = append(all, more...)
+			}
+		}
+		return all, nil
+	}
+	return entries, nil
+}
+
+// ndbHosts calls add with each address of the systems in entries and
+// the host names of the system: the values of its dom tuples followed
+// by those of its sys tuples. Entries describing networks are skipped.
+func ndbHosts(entries []ndbEntry, add func(addr string, names []string)) {
+	for _, e := range entries {
+		if len(e.values("ipnet")) > 0 {
+			continue
+		}
+		var names []string
+	loop:
+		for _, n := range append(e.values("dom"), e.values("sys")...) {
+			for _, seen := range names {
+				if stringsEqualFold(n, seen) {
+					continue loop
+				}
+			}
+			names = append(names, n)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		for _, ip := range e.values("ip") {
+			if addr := parseLiteralIP(ip); addr != "" {
+				add(addr, names)
+			}
+		}
+	}
+}
+
+// ndbResolverConfig returns the name servers and search domains that the
+// dns and dnsdomain tuples set for the system named sysname. netNdb are
+// the entries of /net/ndb, which ipconfig(8) writes for the current
+// configuration, and local those of the network database. As ndb/dns
+// does, the servers and domains of the entries describing the system
+// come first, followed by those of the networks its addresses are on.
+func ndbResolverConfig(netNdb, local []ndbEntry, sysname string) (servers, search []string) {
+	mine := append([]ndbEntry(nil), netNdb...)
+	for _, e := range local {
+		if sysname != "" && e.has("sys", sysname) {
+			mine = append(mine, e)
+		}
+	}
+	var ips []IP
+	for _, e := range mine {
+		for _, v := range e.values("ip") {
+			if ip := ParseIP(v); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	for _, e := range local {
+		if len(e.values("ipnet")) > 0 && ndbNetContains(e, ips) {
+			mine = append(mine, e)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range mine {
+		for _, v := range e.values("dns") {
+			if ParseIP(v) == nil || seen[v] {
+				continue
+			}
+			seen[v] = true
+			servers = append(servers, JoinHostPort(v, "53"))
+		}
+		for _, v := range e.values("dnsdomain") {
+			if v == "" {
+				continue
+			}
+			v = ensureRooted(v)
+			if !seen[v] {
+				seen[v] = true
+				search = append(search, v)
+			}
+		}
+	}
+	return servers, search
+}
+
+// ndbNetContains reports whether the network described by the ip and
+// ipmask tuples of the ipnet entry e contains any of ips.
+func ndbNetContains(e ndbEntry, ips []IP) bool {
+	for _, v := range e.values("ip") {
+		n := ParseIP(v)
+		if n == nil {
+			continue
+		}
+		var mask IPMask
+		bits := IPv6len * 8
+		if n4 := n.To4(); n4 != nil {
+			n, bits = n4, IPv4len*8
+		}
+		for _, m := range e.values("ipmask") {
+			if len(m) > 1 && m[0] == '/' {
+				if ones, i, ok := dtoi(m[1:]); ok && i == len(m)-1 && ones <= bits {
+					mask = CIDRMask(ones, bits)
+				}
+			} else if ip := ParseIP(m); ip != nil {
+				if bits == IPv4len*8 {
+					ip = ip.To4()
+				}
+				mask = IPMask(ip)
+			}
+		}
+		if mask == nil {
+			if bits == IPv4len*8 {
+				mask = n.DefaultMask()
+			} else {
+				mask = CIDRMask(64, bits)
+			}
+		}
+		if mask == nil || len(mask) != len(n) {
+			continue
+		}
+		network := &IPNet{IP: n.Mask(mask), Mask: mask}
+		for _, ip := range ips {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
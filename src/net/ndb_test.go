@@ -0,0 +1,102 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNdbParseLine(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want ndbEntry
+	}{
+		{"", nil},
+		{"# comment", nil},
+		{"sys=gnot ip=10.0.0.1", ndbEntry{{"sys", "gnot"}, {"ip", "10.0.0.1"}}},
+		{"\tauth\tdom=gnot.example.com # comment", ndbEntry{{"auth", ""}, {"dom", "gnot.example.com"}}},
+		{`proto=il desc="internet link" port=17008`, ndbEntry{{"proto", "il"}, {"desc", "internet link"}, {"port", "17008"}}},
+		{`desc="unterminated`, ndbEntry{{"desc", "unterminated"}}},
+		{"database= =orphan ip=1#x", ndbEntry{{"database", ""}, {"ip", "1"}}},
+	} {
+		if got := ndbParseLine(nil, tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ndbParseLine(%q) = %v; want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestReadNdb(t *testing.T) {
+	entries, err := readNdb("testdata/ndb/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first []string
+	for _, e := range entries {
+		first = append(first, e[0].attr+"="+e[0].val)
+	}
+	want := []string{"database=", "ipnet=home", "ipnet=lab", "sys=gnot", "sys=terminal", "tcp=echo", "tcp=discard", "sys=localhost"}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("got entries starting with %v; want %v", first, want)
+	}
+	if got := entries[3].values("ip"); !reflect.DeepEqual(got, []string{"192.168.1.10", "2001:db8::10"}) {
+		t.Errorf("got ip values %v for gnot", got)
+	}
+	if _, err := readNdb("testdata/ndb/missing"); err == nil {
+		t.Error("readNdb of a missing file succeeded")
+	}
+}
+
+func TestNdbResolverConfig(t *testing.T) {
+	local, err := readNdb("testdata/ndb/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	netNdb, err := readNdb("testdata/ndb/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		netNdb  []ndbEntry
+		sysname string
+		servers []string
+		search  []string
+	}{
+		{netNdb, "gnot", []string{"192.168.1.2:53", "192.168.1.1:53"}, []string{"home.example.com."}},
+		{nil, "terminal", []string{"8.8.8.8:53", "192.168.1.1:53"}, []string{"example.org.", "home.example.com."}},
+		{nil, "unknown", nil, nil},
+	} {
+		servers, search := ndbResolverConfig(tt.netNdb, local, tt.sysname)
+		if !reflect.DeepEqual(servers, tt.servers) || !reflect.DeepEqual(search, tt.search) {
+			t.Errorf("ndbResolverConfig for %s = %v, %v; want %v, %v", tt.sysname, servers, search, tt.servers, tt.search)
+		}
+	}
+}
+
+func TestNdbHosts(t *testing.T) {
+	defer func(orig string) { testHookHostsPath = orig }(testHookHostsPath)
+	defer func(orig string) { ndbLocalPath = orig }(ndbLocalPath)
+	ndbLocalPath = "testdata/ndb/local"
+	testHookHostsPath = ndbLocalPath
+
+	for _, ent := range []staticHostEntry{
+		{"gnot", []string{"192.168.1.10", "2001:db8::10"}},
+		{"GNOT.home.example.com", []string{"192.168.1.10", "2001:db8::10"}},
+		{"terminal", []string{"192.168.1.11"}},
+		{"localhost", []string{"127.0.0.1"}},
+		{"home", nil},
+	} {
+		testStaticHost(t, testHookHostsPath, ent)
+	}
+	for _, ent := range []staticHostEntry{
+		{"192.168.1.10", []string{"gnot.home.example.com", "gnot"}},
+		{"127.0.0.1", []string{"localhost"}},
+	} {
+		testStaticAddr(t, testHookHostsPath, ent)
+	}
+	if _, canonical := lookupStaticHost("gnot"); canonical != "gnot.home.example.com." {
+		t.Errorf("got canonical name %q for gnot; want gnot.home.example.com.", canonical)
+	}
+}
@@ -55,7 +55,12 @@ when the RES_OPTIONS or HOSTALIASES environment variable is non-empty,
 when the ASR_CONFIG environment variable is non-empty (OpenBSD only),
 when /etc/resolv.conf or /etc/nsswitch.conf specify the use of features that the
 Go resolver does not implement, and when the name being looked up ends in .local
-or is an mDNS name.
+or is an mDNS name. On Linux, the Go resolver resolves .local names itself when
+/etc/nsswitch.conf lists an mdns source and the Avahi daemon is running, by
+asking the daemon over D-Bus. The libvirt and libvirt_guest sources of
+/etc/nsswitch.conf are implemented by reading the leases that libvirt records
+in /var/lib/libvirt/dnsmasq, and the mymachines source by asking
+systemd-machined for the addresses of its machines.
 
 The resolver decision can be overridden by setting the netdns value of the
 GODEBUG environment variable (see package runtime) to go or cgo, as in:
@@ -63,18 +68,99 @@ GODEBUG environment variable (see package runtime) to go or cgo, as in:
 	export GODEBUG=netdns=go    # force pure Go resolver
 	export GODEBUG=netdns=cgo   # force native resolver (cgo, win32)
 
+On Unix systems, setting netdns to go+cgo uses the pure Go resolver but
+retries failed host lookups with the cgo-based resolver, combining the
+efficiency of the former with the compatibility of the latter.
+
 The decision can also be forced while building the Go source tree
 by setting the netgo or netcgo build tag.
 
 A numeric netdns setting, as in GODEBUG=netdns=1, causes the resolver
-to print debugging information about its decisions.
+to print debugging information about its decisions. At level 2 and above,
+the outcome of each query sent by the Go resolver is printed as well,
+along with the file, line and token of the resolv.conf or nsswitch.conf
+setting that made a lookup go to the native resolver.
+Each message is a single line of space-separated key=value pairs, written to
+standard error unless SetDNSDebugLogger gives a function to pass them to.
 To force a particular resolver while also printing debugging information,
 join the two settings by a plus sign, as in GODEBUG=netdns=go+1.
 
-On Plan 9, the resolver always accesses /net/cs and /net/dns.
+The pure Go resolver reads its configuration from the file named by the
+RESOLV_CONF environment variable, if set, and from /etc/resolv.conf otherwise.
+Programs can choose a different file with SetResolvConfPath, or supply the
+configuration directly with SetDNSConfig. Likewise, SetHostsPaths makes the
+Go resolver take host names from one or more files in place of /etc/hosts.
+
+Like libc, the Go resolver uses at most the first three nameserver lines in
+/etc/resolv.conf. The netdnsservers GODEBUG setting changes that limit, as in
+GODEBUG=netdnsservers=5, or lifts it entirely with GODEBUG=netdnsservers=all.
+
+With GODEBUG=netdnshostswildcard=1, a host name of the form *.domain in
+/etc/hosts matches every name under domain that has no entry of its own,
+as in "127.0.0.1 *.test", which sends all the names ending in .test to the
+local machine. The entry of the longest matching domain wins. Without the
+setting, such names are ordinary names, as they are for the C library.
+
+As RFC 6761 requires, localhost, localhost.localdomain and the names under
+them always resolve to the loopback addresses, 127.0.0.1 and ::1, whichever
+resolver is used: neither the hosts file nor DNS is consulted for them.
+Likewise, the names under invalid are never found. The names under test and
+example, which are reserved for testing and documentation, are looked up
+like any other unless a Resolver's LocalTestNames field asks for them to be
+answered as not found.
+As RFC 7686 requires for the names of Tor onion services, those under onion
+are not resolved at all: their lookups fail with ErrOnionName, unless they
+are made through a Resolver's SOCKS5 proxy. Resolver.Exchange and
+Resolver.TransferZone refuse to send queries about onion names or the
+names under invalid as well.
+
+On Linux and the BSDs, the other names of the myhostname source of
+/etc/nsswitch.conf are answered by the Go resolver itself when /etc/hosts
+has no addresses for them: the host's own name resolves to the addresses
+of its interfaces, _gateway to the gateways of the default routes, read
+with netlink on Linux and with the route sysctl on the BSDs, and _outbound
+to the preferred source addresses of those routes.
+
+On Linux, with GODEBUG=netdnsnscd=1, the Go resolver first asks the name
+service cache daemon, nscd, for the addresses of a host. They then come
+from the same sources, such as sssd, as those the C library finds. This
+is not done for Resolvers whose settings, such as Servers or ConfigPath,
+depart from the system configuration, nor after SetDNSConfig or
+SetResolvConfPath.
+
+Like getaddrinfo with AI_ADDRCONFIG, the Go resolver only asks DNS for the
+IPv6 addresses of a host when the machine has an IPv6 address other than a
+loopback or link-local one, and likewise for IPv4 addresses. Setting
+GODEBUG=netdnsaddrconfig=0 makes it ask for both. On a machine with only IPv6
+addresses, if the network has a NAT64 gateway, found as described in RFC 7050,
+the Go resolver synthesizes IPv6 addresses for the hosts that only have IPv4
+ones.
+
+On macOS, unless the Go resolver is selected, MX, NS, SRV and TXT
+records are looked up with the system's res_search, which, like
+getaddrinfo, is called through libSystem even when cgo is disabled.
+The Go resolver takes its name servers and search list from the
+SystemConfiguration dynamic store rather than from /etc/resolv.conf, and
+sends queries for the domains that have resolvers of their own, such as
+those of VPNs or of the files in /etc/resolver described in
+resolver(5), to their name servers.
+
+On Android, which has no /etc/resolv.conf, the Go resolver takes its name
+servers from the net.dns1 to net.dns4 system properties.
+
+On Plan 9, the resolver always accesses /net/cs and /net/dns, unless
+the Go resolver is selected. The Go resolver then takes its name
+servers and search domains from the dns and dnsdomain attributes in
+/net/ndb and in the network database, /lib/ndb/local, and host names
+from the database entries of systems.
 
 On Windows, in Go 1.18.x and earlier, the resolver always used C
-library functions, such as GetAddrInfo and DnsQuery.
+library functions, such as GetAddrInfo and DnsQuery. When the Go
+resolver is used on Windows, it consults the hosts file in
+%SystemRoot%\System32\drivers\etc before DNS, and single-label names
+that DNS cannot resolve are looked up with LLMNR (RFC 4795), as Windows
+itself does. Queries for the namespaces of rules in the Name Resolution
+Policy Table that name DNS servers are sent to those servers.
 */
 package net
 
@@ -621,6 +707,35 @@ var (
 	errNoSuchHost = errors.New("no such host")
 )
 
+// Errors matched, with errors.Is, by the DNSError values that lookups
+// return for common outcomes, both from Go's built-in resolver and
+// from the native one.
+var (
+	// ErrNXDomain means that a server answered that the name looked
+	// up does not exist (NXDOMAIN). It is not matched by the other
+	// not-found errors, such as a name with no records of the type
+	// asked for, or a failure of the native resolver on Unix, which
+	// does not tell them apart; use DNSError.IsNotFound for those.
+	ErrNXDomain = errors.New("no such host")
+
+	// ErrServFail means that a server reported a failure to answer
+	// (SERVFAIL), or that the native resolver reported a temporary
+	// failure of name resolution, which is how it reports SERVFAIL.
+	ErrServFail = errors.New("server failure")
+
+	// ErrTruncated means that a response was truncated and could
+	// not be had in full over TCP either.
+	ErrTruncated = errors.New("truncated DNS response")
+
+	// ErrOnionName means that the name looked up is a Tor onion
+	// service name, one ending in .onion, which RFC 7686 keeps out
+	// of DNS. Such names are only resolved by Resolvers with a
+	// SOCKS5Proxy; the other lookups, whichever resolver they use,
+	// fail with this error, so that programs can tell them apart and
+	// connect to them through a Tor proxy instead.
+	ErrOnionName = errors.New("onion names are not resolved")
+)
+
 // DNSError represents a DNS lookup error.
 type DNSError struct {
 	Err         string // description of the error
@@ -629,6 +744,17 @@ type DNSError struct {
 	IsTimeout   bool   // if true, timed out; not all timeouts set this
 	IsTemporary bool   // if true, error is temporary; not all errors set this
 	IsNotFound  bool   // if true, host could not be found
+
+	// The fields below describe the query that failed, when the
+	// error comes from a query sent by Go's built-in resolver.
+	Type    uint16 // resource record type queried, such as 28 for AAAA
+	Class   uint16 // class queried, normally 1 for IN
+	RCode   int    // response code, such as 2 for SERVFAIL or 3 for NXDOMAIN; 0 if no response was received
+	Network string // transport of the query: "udp" or "tcp"
+
+	// UnwrapErr is the underlying error, such as the network error
+	// of a failed query, returned by Unwrap. It may be nil.
+	UnwrapErr error
 }
 
 func (e *DNSError) Error() string {
@@ -643,6 +769,30 @@ func (e *DNSError) Error() string {
 	return s
 }
 
+// Unwrap returns e.UnwrapErr, so that errors.Is and errors.As see the
+// cause of the failure, such as context.DeadlineExceeded or an
+// *OpError.
+func (e *DNSError) Unwrap() error { return e.UnwrapErr }
+
+// Is reports whether e matches target: ErrNXDomain if e.RCode is
+// NXDOMAIN, and ErrServFail if e.RCode is SERVFAIL. Other matches,
+// such as ErrTruncated, come from e.UnwrapErr.
+func (e *DNSError) Is(target error) bool {
+	switch target {
+	case ErrNXDomain:
+		return e.RCode == rcodeNameError
+	case ErrServFail:
+		return e.RCode == rcodeServerFailure
+	}
+	return false
+}
+
+// Response codes, as found in DNSError.RCode.
+const (
+	rcodeServerFailure = 2 // SERVFAIL
+	rcodeNameError     = 3 // NXDOMAIN
+)
+
 // Timeout reports whether the DNS lookup is known to have timed out.
 // This is not always known; a DNS lookup may fail due to a timeout
 // and return a DNSError for which Timeout returns false.
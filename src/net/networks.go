@@ -0,0 +1,84 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"errors"
+	"internal/bytealg"
+	"net/netip"
+)
+
+// networksPath is the networks database read by LookupNetworkByName.
+var networksPath = "/etc/networks"
+
+var errNoSuchNetwork = errors.New("no such network")
+
+// LookupNetworkByName returns the network prefix of the named network
+// in the networks database, /etc/networks, as getnetbyname does in the
+// C library. Names are matched without regard to case, and aliases are
+// matched as well as names.
+//
+// A network number given with fewer than four parts, as in "loopback
+// 127", names the network of that many leading bytes, and trailing zero
+// bytes do not count towards the prefix length, so that both "127" and
+// "127.0.0.0" give 127.0.0.0/8.
+func LookupNetworkByName(name string) (netip.Prefix, error) {
+	file, err := open(networksPath)
+	if err != nil {
+		return netip.Prefix{}, &DNSError{Err: err.Error(), Name: name, UnwrapErr: err}
+	}
+	defer file.close()
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		// loopback    127    localnet    # comment
+		if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		match := stringsEqualFold(f[0], name)
+		for _, alias := range f[2:] {
+			match = match || stringsEqualFold(alias, name)
+		}
+		if !match {
+			continue
+		}
+		if p, ok := parseNetworkNumber(f[1]); ok {
+			return p, nil
+		}
+	}
+	return netip.Prefix{}, &DNSError{Err: errNoSuchNetwork.Error(), Name: name, IsNotFound: true, UnwrapErr: errNoSuchNetwork}
+}
+
+// parseNetworkNumber parses the network number of an /etc/networks
+// entry, one to four dot-separated decimal bytes.
+func parseNetworkNumber(s string) (netip.Prefix, bool) {
+	var ip [4]byte
+	n := 0
+	for {
+		if n == len(ip) {
+			return netip.Prefix{}, false
+		}
+		d, i, ok := dtoi(s)
+		if !ok || d > 0xff {
+			return netip.Prefix{}, false
+		}
+		ip[n] = byte(d)
+		n++
+		s = s[i:]
+		if s == "" {
+			break
+		}
+		if s[0] != '.' {
+			return netip.Prefix{}, false
+		}
+		s = s[1:]
+	}
+	for n > 0 && ip[n-1] == 0 {
+		n--
+	}
+	return netip.PrefixFrom(netip.AddrFrom4(ip), 8*n), true
+}
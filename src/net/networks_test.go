@@ -0,0 +1,48 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestLookupNetworkByName(t *testing.T) {
+	defer func(orig string) { networksPath = orig }(networksPath)
+	networksPath = "testdata/networks"
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"default", "0.0.0.0/0"},
+		{"loopback", "127.0.0.0/8"},
+		{"localnet", "127.0.0.0/8"},
+		{"LOOPBACK", "127.0.0.0/8"},
+		{"link-local", "169.254.0.0/16"},
+		{"private", "192.168.0.0/16"},
+		{"lan2", "192.168.0.0/16"},
+		{"office", "10.1.2.0/24"},
+	}
+	for _, tt := range tests {
+		p, err := LookupNetworkByName(tt.name)
+		if err != nil {
+			t.Errorf("LookupNetworkByName(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if want := netip.MustParsePrefix(tt.want); p != want {
+			t.Errorf("LookupNetworkByName(%q) = %v; want %v", tt.name, p, want)
+		}
+	}
+
+	for _, name := range []string{"bogus", "comment", "missing"} {
+		_, err := LookupNetworkByName(name)
+		var dnsErr *DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("LookupNetworkByName(%q) error = %v; want not found", name, err)
+		}
+	}
+}
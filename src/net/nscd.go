@@ -0,0 +1,36 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Helpers for the protocols of the name service caching daemons, whose
+// messages hold integers in the byte order of the machine.
+
+package net
+
+import "internal/goarch"
+
+// nscdUint returns the native-endian unsigned integer of size bytes at
+// the start of b.
+func nscdUint(b []byte, size int) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		if goarch.BigEndian {
+			v = v<<8 | uint64(b[i])
+		} else {
+			v |= uint64(b[i]) << (8 * i)
+		}
+	}
+	return v
+}
+
+// nscdPutUint stores v as a native-endian unsigned integer of size bytes
+// at the start of b.
+func nscdPutUint(b []byte, size int, v uint64) {
+	for i := 0; i < size; i++ {
+		if goarch.BigEndian {
+			b[size-1-i] = byte(v >> (8 * i))
+		} else {
+			b[i] = byte(v >> (8 * i))
+		}
+	}
+}
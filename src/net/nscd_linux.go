@@ -0,0 +1,173 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The protocol of the GNU C library's nscd(8): see nscd/nscd-client.h
+// and nscd/nscd_getai.c in the glibc sources.
+
+package net
+
+import (
+	"context"
+	"internal/godebug"
+	"io"
+	"time"
+)
+
+const (
+	nscdVersion = 2  // NSCD_VERSION
+	nscdGetAI   = 14 // GETAI
+
+	// nscdAIHeaderLen is the size of ai_response_header: version,
+	// found, naddrs, addrslen, canonlen and error, all 32 bits.
+	nscdAIHeaderLen = 6 * 4
+
+	nscdAFInet  = 2  // AF_INET
+	nscdAFInet6 = 10 // AF_INET6
+
+	nscdTryAgain = 2 // TRY_AGAIN, in the error field
+
+	nscdTimeout     = time.Second
+	nscdMaxResponse = 64 << 10
+)
+
+// nscdSocketPath is where nscd listens.
+var nscdSocketPath = "/var/run/nscd/socket"
+
+// nscdLookupHost asks nscd for the addresses of name, as the C library
+// does before consulting the sources of nsswitch.conf, if the
+// netdnsnscd=1 GODEBUG setting is set. The daemon then answers with the
+// results of any source, such as sssd's. ok reports whether it answered;
+// it did with no addresses if it knows that name has none.
+func nscdLookupHost(ctx context.Context, network, name string) (addrs []IPAddr, canonical string, ok bool) {
+	if godebug.Get("netdnsnscd") != "1" {
+		return nil, "", false
+	}
+	resp, err := nscdRequestAI(ctx, name)
+	if err != nil {
+		return nil, "", false
+	}
+	found, ips, canonical, ok := nscdParseAIResponse(resp)
+	if !ok || found < 0 {
+		// Not caching hosts: look name up ourselves.
+		return nil, "", false
+	}
+	for _, ip := range ips {
+		switch ipVersion(network) {
+		case '4':
+			if ip.To4() == nil {
+				continue
+			}
+		case '6':
+			if len(ip) != IPv6len {
+				continue
+			}
+		}
+		addrs = append(addrs, IPAddr{IP: ip})
+	}
+	if canonical == "" {
+		canonical = name
+	}
+	return addrs, canonical, true
+}
+
+// nscdRequestAI sends nscd a GETAI request for name, and returns the
+// response.
+func nscdRequestAI(ctx context.Context, name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, nscdTimeout)
+	defer cancel()
+	var d Dialer
+	c, err := d.DialContext(ctx, "unix", nscdSocketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	// The request header, version, type and key length, all 32 bits,
+	// is followed by the key, with its NUL.
+	req := make([]byte, 12, 12+len(name)+1)
+	nscdPutUint(req, 4, nscdVersion)
+	nscdPutUint(req[4:], 4, nscdGetAI)
+	nscdPutUint(req[8:], 4, uint64(len(name)+1))
+	req = append(req, name...)
+	req = append(req, 0)
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, nscdAIHeaderLen)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	n := nscdAIDataLen(resp)
+	if n < 0 || n > nscdMaxResponse {
+		return nil, errNoSuchHost
+	}
+	resp = append(resp, make([]byte, n)...)
+	if _, err := io.ReadFull(c, resp[nscdAIHeaderLen:]); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// nscdAIDataLen returns the length of the data that follows the GETAI
+// response header h: the addresses, their families, one byte each, and
+// the canonical name.
+func nscdAIDataLen(h []byte) int {
+	if int32(nscdUint(h[4:], 4)) != 1 {
+		// Not found: no data.
+		return 0
+	}
+	naddrs := int32(nscdUint(h[8:], 4))
+	addrslen := int32(nscdUint(h[12:], 4))
+	canonlen := int32(nscdUint(h[16:], 4))
+	if naddrs < 0 || addrslen < 0 || canonlen < 0 {
+		return -1
+	}
+	return int(naddrs) + int(addrslen) + int(canonlen)
+}
+
+// nscdParseAIResponse parses a GETAI response. found is 1 if the host
+// was found, 0 if it doesn't exist, and -1 if nscd doesn't cache hosts;
+// a temporary failure reads as the latter.
+func nscdParseAIResponse(b []byte) (found int, addrs []IP, canonical string, ok bool) {
+	if len(b) < nscdAIHeaderLen || nscdUint(b, 4) != nscdVersion {
+		return 0, nil, "", false
+	}
+	found = int(int32(nscdUint(b[4:], 4)))
+	if found != 1 {
+		if found == 0 && nscdUint(b[20:], 4) == nscdTryAgain {
+			found = -1
+		}
+		return found, nil, "", true
+	}
+	n := nscdAIDataLen(b)
+	if n < 0 || len(b) != nscdAIHeaderLen+n {
+		return 0, nil, "", false
+	}
+	naddrs := int(nscdUint(b[8:], 4))
+	addrslen := int(nscdUint(b[12:], 4))
+	addrData := b[nscdAIHeaderLen : nscdAIHeaderLen+addrslen]
+	families := b[nscdAIHeaderLen+addrslen : nscdAIHeaderLen+addrslen+naddrs]
+	for _, fam := range families {
+		size := IPv4len
+		if fam == nscdAFInet6 {
+			size = IPv6len
+		} else if fam != nscdAFInet {
+			return 0, nil, "", false
+		}
+		if len(addrData) < size {
+			return 0, nil, "", false
+		}
+		addrs = append(addrs, IP(append([]byte(nil), addrData[:size]...)))
+		addrData = addrData[size:]
+	}
+	canon := b[nscdAIHeaderLen+addrslen+naddrs:]
+	for len(canon) > 0 && canon[len(canon)-1] == 0 {
+		canon = canon[:len(canon)-1]
+	}
+	return 1, addrs, string(canon), true
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// nscdAIResponse builds a GETAI response.
+func nscdAIResponse(found, errno int, addrs []IP, canonical string) []byte {
+	var data, families []byte
+	for _, ip := range addrs {
+		if ip4 := ip.To4(); ip4 != nil {
+			data = append(data, ip4...)
+			families = append(families, nscdAFInet)
+		} else {
+			data = append(data, ip...)
+			families = append(families, nscdAFInet6)
+		}
+	}
+	canon := []byte(canonical)
+	if canonical != "" {
+		canon = append(canon, 0)
+	}
+	b := make([]byte, nscdAIHeaderLen)
+	for i, v := range []int{nscdVersion, found, len(families), len(data), len(canon), errno} {
+		nscdPutUint(b[4*i:], 4, uint64(v))
+	}
+	if found != 1 {
+		return b
+	}
+	b = append(b, data...)
+	b = append(b, families...)
+	return append(b, canon...)
+}
+
+func TestNSCDParseAIResponse(t *testing.T) {
+	addrs := []IP{IPv4(192, 0, 2, 1).To4(), ParseIP("2001:db8::1")}
+	resp := nscdAIResponse(1, 0, addrs, "www.example.com")
+	found, got, canonical, ok := nscdParseAIResponse(resp)
+	if !ok || found != 1 || !reflect.DeepEqual(got, addrs) || canonical != "www.example.com" {
+		t.Errorf("got %d, %v, %q, %v; want 1, %v, www.example.com, true", found, got, canonical, ok, addrs)
+	}
+	for n := 0; n < len(resp); n++ {
+		if _, _, _, ok := nscdParseAIResponse(resp[:n]); ok {
+			t.Errorf("parsed response truncated to %d bytes", n)
+		}
+	}
+	for _, tt := range []struct {
+		found, errno int
+		want         int
+	}{
+		{0, 1, 0},             // HOST_NOT_FOUND
+		{0, nscdTryAgain, -1}, // TRY_AGAIN
+		{-1, 0, -1},           // hosts database disabled
+	} {
+		found, _, _, ok := nscdParseAIResponse(nscdAIResponse(tt.found, tt.errno, nil, ""))
+		if !ok || found != tt.want {
+			t.Errorf("found %d, error %d: got %d, %v; want %d, true", tt.found, tt.errno, found, ok, tt.want)
+		}
+	}
+}
+
+func TestNSCDLookupHost(t *testing.T) {
+	if !testableNetwork("unix") {
+		t.Skip("unix sockets not supported")
+	}
+	dir, err := os.MkdirTemp("", "nscd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(orig string) { nscdSocketPath = orig }(nscdSocketPath)
+	nscdSocketPath = filepath.Join(dir, "socket")
+	ln, err := Listen("unix", nscdSocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req := make([]byte, 12)
+			io.ReadFull(c, req)
+			key := make([]byte, nscdUint(req[8:], 4))
+			io.ReadFull(c, key)
+			var resp []byte
+			if string(key) == "host.example.com\x00" && nscdUint(req[4:], 4) == nscdGetAI {
+				resp = nscdAIResponse(1, 0, []IP{IPv4(192, 0, 2, 1), ParseIP("2001:db8::1")}, "www.example.com")
+			} else {
+				resp = nscdAIResponse(0, 1, nil, "")
+			}
+			c.Write(resp)
+			c.Close()
+		}
+	}()
+
+	t.Setenv("GODEBUG", "netdnsnscd=1")
+	addrs, canonical, ok := nscdLookupHost(context.Background(), "ip4", "host.example.com")
+	if !ok || canonical != "www.example.com" || len(addrs) != 1 || !addrs[0].IP.Equal(IPv4(192, 0, 2, 1)) {
+		t.Errorf("got %v, %q, %v; want [192.0.2.1], www.example.com, true", addrs, canonical, ok)
+	}
+	addrs, _, ok = nscdLookupHost(context.Background(), "ip", "missing.example.com")
+	if !ok || len(addrs) != 0 {
+		t.Errorf("got %v, %v for a missing host; want none, true", addrs, ok)
+	}
+
+	t.Setenv("GODEBUG", "")
+	if _, _, ok := nscdLookupHost(context.Background(), "ip", "host.example.com"); ok {
+		t.Error("nscd consulted without the netdnsnscd GODEBUG setting")
+	}
+}
+
+func TestResolverUseNSCD(t *testing.T) {
+	if resolvConfPath() != defaultResolvConfPath {
+		t.Skip("resolv.conf path overridden")
+	}
+	for _, r := range []*Resolver{nil, {}, {PreferGo: true}} {
+		if !r.useNSCD() {
+			t.Errorf("%+v does not use nscd", r)
+		}
+	}
+	for _, r := range []*Resolver{
+		{Dial: (&Dialer{}).DialContext},
+		{Servers: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:53")}},
+		{Search: []string{"example.com"}},
+		{ConfigPath: "testdata/resolv.conf"},
+		{NoSearch: true},
+		{LocalTestNames: true},
+		{QNAMEMinimization: true},
+	} {
+		if r.useNSCD() {
+			t.Errorf("%+v uses nscd", r)
+		}
+	}
+
+	SetDNSConfig(&DNSConfig{Servers: []string{"192.0.2.1"}})
+	defer SetDNSConfig(nil)
+	if (*Resolver)(nil).useNSCD() {
+		t.Error("nscd used with SetDNSConfig in effect")
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !freebsd && !linux
+
+package net
+
+import "context"
+
+// nscdLookupHost reports false: the Go resolver only consults the
+// caching daemons of FreeBSD and of the GNU C library.
+func nscdLookupHost(ctx context.Context, network, name string) (addrs []IPAddr, canonical string, ok bool) {
+	return nil, "", false
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The protocol of FreeBSD's nscd(8), and the form in which FreeBSD's C
+// library keeps the results of gethostbyname2 in its "hosts" cache:
+// see lib/libc/net/nscachedcli.c and lib/libc/net/gethostnamadr.c.
+
+package net
+
+import (
+	"internal/bytealg"
+	"internal/goarch"
+)
+
+const (
+	nscdBSDReadRequest = 3 // CET_READ_REQUEST
+
+	// nscdBSDResOptions are the resolver options that are part of
+	// the cache keys: the default RES_RECURSE, RES_DEFNAMES and
+	// RES_DNSRCH.
+	nscdBSDResOptions = 0x40 | 0x80 | 0x200
+
+	nscdBSDOpGetHostBy = 1 // op_id of host_id_func
+	nscdBSDLookupName  = 1 // nss_lt_name
+
+	nscdBSDAFInet  = 2  // AF_INET
+	nscdBSDAFInet6 = 28 // AF_INET6
+)
+
+// nscdBSDHostKey returns the key of the gethostbyname2 cache entry for
+// name in address family af: the resolver options (u_long), the
+// operation, the lookup type, the address family (ints) and name.
+func nscdBSDHostKey(name string, af int) []byte {
+	p := goarch.PtrSize
+	b := make([]byte, p+3*4+len(name)+1)
+	nscdPutUint(b, p, nscdBSDResOptions)
+	nscdPutUint(b[p:], 4, nscdBSDOpGetHostBy)
+	nscdPutUint(b[p+4:], 4, nscdBSDLookupName)
+	nscdPutUint(b[p+8:], 4, uint64(af))
+	copy(b[p+12:], name)
+	return b
+}
+
+// nscdBSDReadMessage returns the body of a read request for key in
+// the cache entry: the sizes (size_t) of the entry name and of the key,
+// followed by both.
+func nscdBSDReadMessage(entry string, key []byte) []byte {
+	p := goarch.PtrSize
+	b := make([]byte, 2*p, 2*p+len(entry)+len(key))
+	nscdPutUint(b, p, uint64(len(entry)))
+	nscdPutUint(b[p:], p, uint64(len(key)))
+	b = append(b, entry...)
+	return append(b, key...)
+}
+
+// nscdBSDParseHostent parses a struct hostent marshaled by the C library,
+// for a system with pointers of ptrSize bytes. The struct is followed by
+// the address that its data, which follows, had when it was marshaled,
+// against which its pointers are resolved. It returns the official name
+// and the addresses of the host.
+func nscdBSDParseHostent(b []byte, ptrSize int) (name string, addrs []IP, ok bool) {
+	p := ptrSize
+	// h_name, h_aliases, h_addrtype, h_length, h_addr_list.
+	hostentSize := 3*p + 8
+	if len(b) < hostentSize+p {
+		return "", nil, false
+	}
+	base := nscdUint(b[hostentSize:], p)
+	dataOff := uint64(hostentSize + p)
+	// at returns the offset in b of a pointer in the original data.
+	at := func(ptr uint64) (int, bool) {
+		if ptr < base || ptr-base >= uint64(len(b))-dataOff {
+			return 0, false
+		}
+		return int(ptr - base + dataOff), true
+	}
+
+	if hname := nscdUint(b, p); hname != 0 {
+		i, ok := at(hname)
+		if !ok {
+			return "", nil, false
+		}
+		n := bytealg.IndexByte(b[i:], 0)
+		if n < 0 {
+			return "", nil, false
+		}
+		name = string(b[i : i+n])
+	}
+	length := int(nscdUint(b[2*p+4:], 4))
+	if length != IPv4len && length != IPv6len {
+		return "", nil, false
+	}
+	list := nscdUint(b[2*p+8:], p)
+	if list == 0 {
+		return "", nil, false
+	}
+	i, ok := at(list)
+	if !ok {
+		return "", nil, false
+	}
+	for ; i+p <= len(b); i += p {
+		ptr := nscdUint(b[i:], p)
+		if ptr == 0 {
+			return name, addrs, len(addrs) > 0
+		}
+		j, ok := at(ptr)
+		if !ok || j+length > len(b) {
+			return "", nil, false
+		}
+		addrs = append(addrs, IP(append([]byte(nil), b[j:j+length]...)))
+	}
+	return "", nil, false
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"context"
+	"internal/goarch"
+	"io"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// nscdBSDCmsgcredSize is the size of struct cmsgcred, which the
+	// kernel fills in with the credentials of the sender.
+	nscdBSDCmsgcredSize = 84
+
+	// nscdBSDTimeout bounds how long a cache lookup may take before
+	// the other sources are consulted.
+	nscdBSDTimeout = time.Second
+
+	nscdBSDMaxResponse = 64 << 10
+)
+
+// nscdBSDSocketPath is where nscd(8) listens, as set by its
+// query-socket option.
+var nscdBSDSocketPath = "/var/run/nscd"
+
+// nscdLookupHost looks name up in the hosts cache of nscd(8), as the C
+// library does for the "cache" source that leads the hosts line of
+// nsswitch.conf. It reports whether the cache held the addresses of
+// name in each address family of network.
+func nscdLookupHost(ctx context.Context, network, name string) (addrs []IPAddr, canonical string, ok bool) {
+	srcs := getSystemNSS().sources["hosts"]
+	if len(srcs) == 0 || srcs[0].source != "cache" {
+		return nil, "", false
+	}
+	afs := []int{nscdBSDAFInet, nscdBSDAFInet6}
+	switch ipVersion(network) {
+	case '4':
+		afs = afs[:1]
+	case '6':
+		afs = afs[1:]
+	}
+	for _, af := range afs {
+		data, err := nscdBSDRead(ctx, "hosts", nscdBSDHostKey(name, af))
+		if err != nil {
+			return nil, "", false
+		}
+		hname, ips, ok := nscdBSDParseHostent(data, goarch.PtrSize)
+		if !ok {
+			return nil, "", false
+		}
+		if canonical == "" {
+			canonical = hname
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, IPAddr{IP: ip})
+		}
+	}
+	if canonical == "" {
+		canonical = name
+	}
+	return addrs, canonical, true
+}
+
+// nscdBSDRead returns the data that nscd caches for key in entry.
+func nscdBSDRead(ctx context.Context, entry string, key []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, nscdBSDTimeout)
+	defer cancel()
+	var d Dialer
+	c, err := d.DialContext(ctx, "unix", nscdBSDSocketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	// The request type goes along with the credentials of the
+	// process, which nscd checks.
+	oob := make([]byte, syscall.CmsgSpace(nscdBSDCmsgcredSize))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = syscall.SOL_SOCKET
+	h.Type = syscall.SCM_CREDS
+	h.SetLen(syscall.CmsgLen(nscdBSDCmsgcredSize))
+	typ := make([]byte, 4)
+	nscdPutUint(typ, 4, nscdBSDReadRequest)
+	if _, _, err := c.(*UnixConn).WriteMsgUnix(typ, oob, nil); err != nil {
+		return nil, err
+	}
+	if _, err := c.Write(nscdBSDReadMessage(entry, key)); err != nil {
+		return nil, err
+	}
+
+	// The response is an error code (int), then the size (size_t)
+	// of the data, which follows.
+	b := make([]byte, 4+goarch.PtrSize)
+	if _, err := io.ReadFull(c, b[:4]); err != nil {
+		return nil, err
+	}
+	if nscdUint(b, 4) != 0 {
+		return nil, errNoSuchHost
+	}
+	if _, err := io.ReadFull(c, b[4:]); err != nil {
+		return nil, err
+	}
+	n := nscdUint(b[4:], goarch.PtrSize)
+	if n > nscdBSDMaxResponse {
+		return nil, errNoSuchHost
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"internal/goarch"
+	"reflect"
+	"testing"
+)
+
+// marshalBSDHostent lays out a struct hostent as FreeBSD's C library
+// does for nscd, as if its data started at address base.
+func marshalBSDHostent(ptrSize int, base uint64, name string, aliases []string, addrs []IP) []byte {
+	p := ptrSize
+	hostentSize := 3*p + 8
+	b := make([]byte, hostentSize+p)
+	nscdPutUint(b[hostentSize:], p, base)
+	addr := func() uint64 { return base + uint64(len(b)-hostentSize-p) }
+	align := func() {
+		for len(b)%p != 0 {
+			b = append(b, 0)
+		}
+	}
+	ptr := func(v uint64) []byte {
+		s := make([]byte, p)
+		nscdPutUint(s, p, v)
+		return s
+	}
+
+	nscdPutUint(b, p, addr())
+	b = append(b, name...)
+	b = append(b, 0)
+
+	align()
+	nscdPutUint(b[p:], p, addr())
+	list := len(b)
+	b = append(b, make([]byte, (len(aliases)+1)*p)...)
+	for i, a := range aliases {
+		nscdPutUint(b[list+i*p:], p, addr())
+		b = append(b, a...)
+		b = append(b, 0)
+	}
+
+	length := len(addrs[0])
+	nscdPutUint(b[2*p:], 4, nscdBSDAFInet)
+	if length == IPv6len {
+		nscdPutUint(b[2*p:], 4, nscdBSDAFInet6)
+	}
+	nscdPutUint(b[2*p+4:], 4, uint64(length))
+	align()
+	nscdPutUint(b[2*p+8:], p, addr())
+	list = len(b)
+	b = append(b, make([]byte, (len(addrs)+1)*p)...)
+	for i, ip := range addrs {
+		copy(b[list+i*p:], ptr(addr()))
+		b = append(b, ip...)
+	}
+	return b
+}
+
+func TestNSCDBSDParseHostent(t *testing.T) {
+	for _, ptrSize := range []int{4, 8} {
+		for _, addrs := range [][]IP{
+			{IPv4(192, 0, 2, 1).To4(), IPv4(192, 0, 2, 2).To4()},
+			{ParseIP("2001:db8::1")},
+		} {
+			b := marshalBSDHostent(ptrSize, 0x10203040, "www.example.com", []string{"www"}, addrs)
+			name, got, ok := nscdBSDParseHostent(b, ptrSize)
+			if !ok || name != "www.example.com" || !reflect.DeepEqual(got, addrs) {
+				t.Errorf("ptrSize %d: got %q, %v, %v; want www.example.com, %v, true", ptrSize, name, got, ok, addrs)
+			}
+			for n := 0; n < len(b); n++ {
+				if _, _, ok := nscdBSDParseHostent(b[:n], ptrSize); ok {
+					t.Errorf("ptrSize %d: parsed hostent truncated to %d bytes", ptrSize, n)
+				}
+			}
+		}
+	}
+}
+
+func TestNSCDBSDMessages(t *testing.T) {
+	p := goarch.PtrSize
+	key := nscdBSDHostKey("example.com", nscdBSDAFInet6)
+	if len(key) != p+12+len("example.com")+1 ||
+		nscdUint(key, p) != nscdBSDResOptions ||
+		nscdUint(key[p:], 4) != nscdBSDOpGetHostBy ||
+		nscdUint(key[p+4:], 4) != nscdBSDLookupName ||
+		nscdUint(key[p+8:], 4) != nscdBSDAFInet6 ||
+		string(key[p+12:]) != "example.com\x00" {
+		t.Errorf("bad key %x", key)
+	}
+	msg := nscdBSDReadMessage("hosts", key)
+	if nscdUint(msg, p) != 5 || nscdUint(msg[p:], p) != uint64(len(key)) ||
+		string(msg[2*p:2*p+5]) != "hosts" || string(msg[2*p+5:]) != string(key) {
+		t.Errorf("bad read message %x", msg)
+	}
+}
@@ -7,9 +7,11 @@ package net
 import (
 	"errors"
 	"internal/bytealg"
+	"internal/itoa"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,11 +23,20 @@ var nssConfig nsswitchConfig
 
 type nsswitchConfig struct {
 	initOnce sync.Once // guards init of nsswitchConfig
+	path     string    // file to read; nssConfigPath if empty
 
 	// ch is used as a semaphore that only allows one lookup at a
 	// time to recheck nsswitch.conf
-	ch          chan struct{} // guards lastChecked and modTime
+	ch          chan struct{} // guards lastChecked and file
 	lastChecked time.Time     // last time nsswitch.conf was checked
+	file        os.FileInfo   // the file nssConf was read from; nil if none
+
+	// changed is set when the watcher reports that nsswitch.conf
+	// changed, and by FlushResolverConfig. It makes the next
+	// tryUpdate read the file again without waiting for the polling
+	// interval.
+	changed   atomic.Bool
+	stopWatch func() // stops the watch on path; nil if none
 
 	mu      sync.Mutex // protects nssConf
 	nssConf *nssConf
@@ -41,9 +52,16 @@ func getSystemNSS() *nssConf {
 
 // init initializes conf and is only called via conf.initOnce.
 func (conf *nsswitchConfig) init() {
-	conf.nssConf = parseNSSConfFile("/etc/nsswitch.conf")
-	conf.lastChecked = time.Now()
+	if conf.path == "" {
+		conf.path = nssConfigPath
+	}
+	conf.file, _ = os.Stat(conf.path)
+	conf.nssConf = parseNSSConfFile(conf.path)
+	conf.lastChecked = clockNow()
 	conf.ch = make(chan struct{}, 1)
+	if stop, ok := watchFile(conf.path, func() { conf.changed.Store(true) }); ok {
+		conf.stopWatch = stop
+	}
 }
 
 // tryUpdate tries to update conf.
@@ -56,21 +74,27 @@ func (conf *nsswitchConfig) tryUpdate() {
 	}
 	defer conf.releaseSema()
 
-	now := time.Now()
-	if conf.lastChecked.After(now.Add(-5 * time.Second)) {
+	// A change reported by the watcher is picked up right away;
+	// otherwise fall back to polling the file every few seconds.
+	changed := conf.changed.Swap(false)
+	now := clockNow()
+	if !changed && conf.lastChecked.After(now.Add(-5*time.Second)) {
 		return
 	}
 	conf.lastChecked = now
 
+	// Parse the file again only if it was modified or replaced.
+	file, _ := os.Stat(conf.path)
 	var mtime time.Time
-	if fi, err := os.Stat(nssConfigPath); err == nil {
-		mtime = fi.ModTime()
+	if file != nil {
+		mtime = file.ModTime()
 	}
-	if mtime.Equal(conf.nssConf.mtime) {
+	if !changed && mtime.Equal(conf.nssConf.mtime) && sameFile(file, conf.file) {
 		return
 	}
+	conf.file = file
 
-	nssConf := parseNSSConfFile(nssConfigPath)
+	nssConf := parseNSSConfFile(conf.path)
 	conf.mu.Lock()
 	conf.nssConf = nssConf
 	conf.mu.Unlock()
@@ -103,13 +127,48 @@ type nssConf struct {
 type nssSource struct {
 	source   string // e.g. "compat", "files", "mdns4_minimal"
 	criteria []nssCriterion
+	line     int // the line of nsswitch.conf holding the source
 }
 
-// standardCriteria reports all specified criteria have the default
-// status actions.
-func (s nssSource) standardCriteria() bool {
+// String returns s as written in nsswitch.conf, with its criteria
+// lower cased.
+func (s nssSource) String() string {
+	str := s.source
 	for i, crit := range s.criteria {
-		if !crit.standardStatusAction(i == len(s.criteria)-1) {
+		if i == 0 {
+			str += " ["
+		} else {
+			str += " "
+		}
+		if crit.negate {
+			str += "!"
+		}
+		str += crit.status + "=" + crit.action
+	}
+	if len(s.criteria) > 0 {
+		str += "]"
+	}
+	return str
+}
+
+// standardCriteria reports all specified criteria have the default
+// status actions. last is whether s is the last source in the list,
+// after which returning and continuing are the same.
+func (s nssSource) standardCriteria(last bool) bool {
+	for _, crit := range s.criteria {
+		if !crit.standardStatusAction(last) {
+			return false
+		}
+	}
+	return true
+}
+
+// continuesWhenUnavailable reports whether a lookup goes on with the
+// next source when s is unavailable.
+func (s nssSource) continuesWhenUnavailable() bool {
+	for _, crit := range s.criteria {
+		applies := (crit.status == "unavail") != crit.negate
+		if applies && crit.action != "continue" {
 			return false
 		}
 	}
@@ -124,12 +183,27 @@ type nssCriterion struct {
 	action string // e.g. "return", "continue" (lowercase)
 }
 
+// nssStatuses are the statuses that a source can report.
+var nssStatuses = [...]string{"success", "notfound", "unavail", "tryagain"}
+
 // standardStatusAction reports whether c is equivalent to not
-// specifying the criterion at all. last is whether this criteria is the
-// last in the list.
+// specifying the criterion at all. last is whether the source of c is
+// the last in the list.
 func (c nssCriterion) standardStatusAction(last bool) bool {
 	if c.negate {
-		return false
+		// The criterion applies to every status but c.status, as
+		// in glibc's "[!UNAVAIL=return]".
+		known := false
+		for _, status := range nssStatuses {
+			if status == c.status {
+				known = true
+				continue
+			}
+			if !(nssCriterion{status: status, action: c.action}).standardStatusAction(last) {
+				return false
+			}
+		}
+		return known
 	}
 	var def string
 	switch c.status {
@@ -147,6 +221,57 @@ func (c nssCriterion) standardStatusAction(last bool) bool {
 	return c.action == def
 }
 
+// An NSSConfig is a parsed nsswitch.conf file, which names the sources
+// of the system databases of the C library, such as the sources of host
+// names and addresses.
+type NSSConfig struct {
+	// Databases maps the name of each database, such as "hosts",
+	// to its sources in the order they are consulted.
+	Databases map[string][]NSSSource
+}
+
+// An NSSSource is a source of a database, with the criteria in brackets
+// that follow it.
+type NSSSource struct {
+	Name     string // e.g. "files", "dns", "mdns4_minimal"
+	Criteria []NSSCriterion
+}
+
+// An NSSCriterion is a criterion after a source: the action taken when
+// the source reports a status, or with Negate, any other status.
+type NSSCriterion struct {
+	Negate bool   // whether "!" was present
+	Status string // e.g. "success", "notfound", "unavail" (lowercase)
+	Action string // e.g. "return", "continue", "merge" (lowercase)
+}
+
+// ParseNSSConfig parses the nsswitch.conf file read from r, such as
+// /etc/nsswitch.conf. Files beyond the limits of the resolver, such as
+// those larger than 1MB or with lines longer than 8KB, are rejected
+// with a *ParseError.
+func ParseNSSConfig(r io.Reader) (*NSSConfig, error) {
+	conf := parseNSSConf(r)
+	if conf.err != nil {
+		return nil, conf.err
+	}
+	c := &NSSConfig{Databases: make(map[string][]NSSSource)}
+	for db, srcs := range conf.sources {
+		out := make([]NSSSource, len(srcs))
+		for i, src := range srcs {
+			out[i].Name = src.source
+			for _, crit := range src.criteria {
+				out[i].Criteria = append(out[i].Criteria, NSSCriterion{
+					Negate: crit.negate,
+					Status: crit.status,
+					Action: crit.action,
+				})
+			}
+		}
+		c.Databases[db] = out
+	}
+	return c, nil
+}
+
 func parseNSSConfFile(file string) *nssConf {
 	f, err := os.Open(file)
 	if err != nil {
@@ -164,12 +289,23 @@ func parseNSSConfFile(file string) *nssConf {
 }
 
 func parseNSSConf(r io.Reader) *nssConf {
-	slurp, err := readFull(r)
+	slurp, err := readFull(io.LimitReader(r, maxConfigSize+1))
 	if err != nil {
 		return &nssConf{err: err}
 	}
+	if len(slurp) > maxConfigSize {
+		return &nssConf{err: &ParseError{Type: "nsswitch.conf", Text: "file larger than " + itoa.Itoa(maxConfigSize) + " bytes"}}
+	}
 	conf := new(nssConf)
+	n := 0
+	invalid := func(reason string) error {
+		return &ParseError{Type: "nsswitch.conf line " + itoa.Itoa(n), Text: reason}
+	}
 	conf.err = foreachLine(slurp, func(line []byte) error {
+		n++
+		if len(line) > maxConfigLine {
+			return invalid("line longer than " + itoa.Itoa(maxConfigLine) + " bytes")
+		}
 		line = trimSpace(removeComment(line))
 		if len(line) == 0 {
 			return nil
@@ -206,14 +342,21 @@ func parseNSSConf(r io.Reader) *nssConf {
 				if err != nil {
 					return errors.New("invalid criteria: " + string(srcs[1:bclose]))
 				}
+				if len(criteria) > maxNSSCriteria {
+					return invalid("more than " + itoa.Itoa(maxNSSCriteria) + " criteria for source " + src)
+				}
 				srcs = srcs[bclose+1:]
 			}
+			if len(conf.sources[db]) == maxNSSSources {
+				return invalid("more than " + itoa.Itoa(maxNSSSources) + " sources for database " + db)
+			}
 			if conf.sources == nil {
 				conf.sources = make(map[string][]nssSource)
 			}
 			conf.sources[db] = append(conf.sources[db], nssSource{
 				source:   src,
 				criteria: criteria,
+				line:     n,
 			})
 		}
 		return nil
@@ -7,9 +7,12 @@
 package net
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 const ubuntuTrustyAvahi = `# /etc/nsswitch.conf
@@ -44,7 +47,7 @@ func TestParseNSSConf(t *testing.T) {
 			in:   "foo: a b",
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"foo": {{source: "a"}, {source: "b"}},
+					"foo": {{source: "a", line: 1}, {source: "b", line: 1}},
 				},
 			},
 		},
@@ -53,7 +56,7 @@ func TestParseNSSConf(t *testing.T) {
 			in:   "foo: a b\n",
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"foo": {{source: "a"}, {source: "b"}},
+					"foo": {{source: "a", line: 1}, {source: "b", line: 1}},
 				},
 			},
 		},
@@ -62,7 +65,7 @@ func TestParseNSSConf(t *testing.T) {
 			in:   "   foo:a    b    \n",
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"foo": {{source: "a"}, {source: "b"}},
+					"foo": {{source: "a", line: 1}, {source: "b", line: 1}},
 				},
 			},
 		},
@@ -71,7 +74,7 @@ func TestParseNSSConf(t *testing.T) {
 			in:   "   foo:a    b#c\n",
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"foo": {{source: "a"}, {source: "b"}},
+					"foo": {{source: "a", line: 1}, {source: "b", line: 1}},
 				},
 			},
 		},
@@ -80,7 +83,7 @@ func TestParseNSSConf(t *testing.T) {
 			in:   "   foo:a    b #c \n",
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"foo": {{source: "a"}, {source: "b"}},
+					"foo": {{source: "a", line: 1}, {source: "b", line: 1}},
 				},
 			},
 		},
@@ -90,9 +93,10 @@ func TestParseNSSConf(t *testing.T) {
 			want: &nssConf{
 				sources: map[string][]nssSource{
 					"foo": {
-						{source: "a"},
+						{source: "a", line: 1},
 						{
 							source: "b",
+							line:   1,
 							criteria: []nssCriterion{
 								{
 									negate: true,
@@ -105,7 +109,7 @@ func TestParseNSSConf(t *testing.T) {
 								},
 							},
 						},
-						{source: "c"},
+						{source: "c", line: 1},
 					},
 				},
 			},
@@ -117,13 +121,14 @@ func TestParseNSSConf(t *testing.T) {
 			in:   ubuntuTrustyAvahi,
 			want: &nssConf{
 				sources: map[string][]nssSource{
-					"passwd": {{source: "compat"}},
-					"group":  {{source: "compat"}},
-					"shadow": {{source: "compat"}},
+					"passwd": {{source: "compat", line: 7}},
+					"group":  {{source: "compat", line: 8}},
+					"shadow": {{source: "compat", line: 9}},
 					"hosts": {
-						{source: "files"},
+						{source: "files", line: 11},
 						{
 							source: "mdns4_minimal",
+							line:   11,
 							criteria: []nssCriterion{
 								{
 									negate: false,
@@ -132,28 +137,28 @@ func TestParseNSSConf(t *testing.T) {
 								},
 							},
 						},
-						{source: "dns"},
-						{source: "mdns4"},
+						{source: "dns", line: 11},
+						{source: "mdns4", line: 11},
 					},
-					"networks": {{source: "files"}},
+					"networks": {{source: "files", line: 12}},
 					"protocols": {
-						{source: "db"},
-						{source: "files"},
+						{source: "db", line: 14},
+						{source: "files", line: 14},
 					},
 					"services": {
-						{source: "db"},
-						{source: "files"},
+						{source: "db", line: 15},
+						{source: "files", line: 15},
 					},
 					"ethers": {
-						{source: "db"},
-						{source: "files"},
+						{source: "db", line: 16},
+						{source: "files", line: 16},
 					},
 					"rpc": {
-						{source: "db"},
-						{source: "files"},
+						{source: "db", line: 17},
+						{source: "files", line: 17},
 					},
 					"netgroup": {
-						{source: "nis"},
+						{source: "nis", line: 19},
 					},
 				},
 			},
@@ -167,3 +172,157 @@ func TestParseNSSConf(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNSSConfLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"long_line", "hosts: files dns # " + strings.Repeat("x", maxConfigLine) + "\n"},
+		{"many_sources", "hosts:" + strings.Repeat(" files", maxNSSSources+1) + "\n"},
+		{"many_criteria", "hosts: dns [" + strings.Repeat("notfound=return ", maxNSSCriteria+1) + "] files\n"},
+		{"large_file", strings.Repeat("hosts: files dns\n", maxConfigSize/17+1)},
+	}
+	for _, tt := range tests {
+		conf := parseNSSConf(strings.NewReader(tt.in))
+		if _, ok := conf.err.(*ParseError); !ok {
+			t.Errorf("%s: err = %v; want a *ParseError", tt.name, conf.err)
+		}
+	}
+
+	in := "hosts:" + strings.Repeat(" files", maxNSSSources) + " [" + strings.Repeat("notfound=return ", maxNSSCriteria) + "]\n"
+	if conf := parseNSSConf(strings.NewReader(in)); conf.err != nil || len(conf.sources["hosts"]) != maxNSSSources {
+		t.Errorf("at the limits: %d sources, err = %v; want %d sources", len(conf.sources["hosts"]), conf.err, maxNSSSources)
+	}
+}
+
+func TestParseNSSConfig(t *testing.T) {
+	got, err := ParseNSSConfig(strings.NewReader(ubuntuTrustyAvahi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NSSSource{
+		{Name: "files"},
+		{Name: "mdns4_minimal", Criteria: []NSSCriterion{{Status: "notfound", Action: "return"}}},
+		{Name: "dns"},
+		{Name: "mdns4"},
+	}
+	if !reflect.DeepEqual(got.Databases["hosts"], want) {
+		t.Errorf("hosts = %+v; want %+v", got.Databases["hosts"], want)
+	}
+	if len(got.Databases) != 10 {
+		t.Errorf("got %d databases; want 10", len(got.Databases))
+	}
+
+	got, err = ParseNSSConfig(strings.NewReader("hosts: files dns [!UNAVAIL=return]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crit := got.Databases["hosts"][1].Criteria; len(crit) != 1 || crit[0] != (NSSCriterion{Negate: true, Status: "unavail", Action: "return"}) {
+		t.Errorf("criteria = %+v", crit)
+	}
+
+	for _, in := range []string{"hosts files\n", "hosts: dns [NOTFOUND=return\n", "hosts: dns [NOTFOUND]\n"} {
+		if _, err := ParseNSSConfig(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseNSSConfig(%q) succeeded", in)
+		}
+	}
+}
+
+func TestNSSStandardCriteria(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		last bool
+		want bool
+	}{
+		{"SUCCESS=return", false, true},
+		{"NOTFOUND=return", false, false},
+		{"NOTFOUND=return", true, true},
+		{"!UNAVAIL=return", false, false},
+		{"!UNAVAIL=return", true, true},
+		{"!SUCCESS=continue", false, true},
+		{"!NOTFOUND=continue", false, false},
+		{"!BOGUS=continue", true, false},
+	} {
+		c, err := parseCriteria([]byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := nssSource{source: "dns", criteria: c}
+		if got := src.standardCriteria(tt.last); got != tt.want {
+			t.Errorf("standardCriteria of [%s], last %v = %v; want %v", tt.in, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestNSSConfigUpdate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "nsswitch.conf")
+	mtime := time.Now().Add(-time.Hour)
+	// replace replaces the file, keeping its mtime, so that only its
+	// identity tells that it changed.
+	replace := func(contents string) {
+		t.Helper()
+		tmp := filepath.Join(dir, "nsswitch.conf.tmp")
+		if err := os.WriteFile(tmp, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts := func(conf *nsswitchConfig) string {
+		conf.mu.Lock()
+		defer conf.mu.Unlock()
+		if srcs := conf.nssConf.sources["hosts"]; len(srcs) > 0 {
+			return srcs[0].source
+		}
+		return ""
+	}
+
+	replace("hosts: files\n")
+	conf := &nsswitchConfig{path: name}
+	conf.initOnce.Do(conf.init)
+	if conf.stopWatch != nil {
+		defer conf.stopWatch()
+	}
+	if got := hosts(conf); got != "files" {
+		t.Fatalf("hosts source = %q; want files", got)
+	}
+
+	// An unchanged file is not parsed again.
+	conf.changed.Store(false)
+	conf.lastChecked = time.Time{}
+	old := conf.nssConf
+	conf.tryUpdate()
+	if conf.nssConf != old {
+		t.Error("unchanged nsswitch.conf parsed again")
+	}
+
+	// A file replaced by another with the same mtime is.
+	replace("hosts: dns\n")
+	conf.lastChecked = time.Time{}
+	conf.tryUpdate()
+	if got := hosts(conf); got != "dns" {
+		t.Errorf("after replacing nsswitch.conf, hosts source = %q; want dns", got)
+	}
+
+	// With a watch, changes show up before the next polling check.
+	if conf.stopWatch == nil {
+		return
+	}
+	conf.lastChecked = time.Now().Add(time.Hour)
+	if err := os.WriteFile(name, []byte("hosts: mdns\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		conf.tryUpdate()
+		if hosts(conf) == "mdns" {
+			return
+		}
+	}
+	t.Errorf("after rewriting nsswitch.conf, hosts source = %q; want mdns", hosts(conf))
+}
@@ -14,6 +14,20 @@ import (
 	"time"
 )
 
+// Limits on the configuration files of the resolver, such as
+// resolv.conf and nsswitch.conf, so that a corrupt or hostile file
+// cannot make it allocate without bound. What goes beyond them is
+// dropped and reported with a *ParseError: in the netdns debugging
+// output for resolv.conf, whose other settings are still used, and as
+// the error of the whole file for nsswitch.conf.
+const (
+	maxConfigLine    = 8 << 10 // bytes in a line
+	maxConfigSize    = 1 << 20 // bytes in a file read whole, such as nsswitch.conf
+	maxSearchDomains = 64      // domains in the search list of resolv.conf
+	maxNSSSources    = 32      // sources of a database in nsswitch.conf
+	maxNSSCriteria   = 16      // criteria of a source in nsswitch.conf
+)
+
 type file struct {
 	file  *os.File
 	data  []byte
@@ -80,6 +94,15 @@ func stat(name string) (mtime time.Time, size int64, err error) {
 	return st.ModTime(), st.Size(), nil
 }
 
+// sameFile reports whether a and b describe the same file, or are both
+// nil.
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b)
+}
+
 // Count occurrences in s of any bytes in t.
 func countAnyByte(s string, t string) int {
 	n := 0
@@ -0,0 +1,117 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The protocols database, which maps IP protocol names to numbers.
+
+package net
+
+import (
+	"context"
+	"internal/bytealg"
+	"internal/itoa"
+	"sync"
+	"time"
+)
+
+// protocolsDB holds the entries of the protocols file, such as
+// /etc/protocols.
+var protocolsDB struct {
+	sync.Mutex
+
+	byName   map[string]int // lower cased names and aliases
+	byNumber map[int]string // the first name of each number
+	path     string
+	expire   time.Time
+	mtime    time.Time
+	size     int64
+}
+
+// LookupProtocolNumber returns the number of the named IP protocol,
+// such as 6 for "tcp", from the protocols database of the system, such
+// as /etc/protocols. Names are matched without regard to case, and
+// aliases are matched as well as names.
+func LookupProtocolNumber(name string) (int, error) {
+	return lookupProtocol(context.Background(), name)
+}
+
+// LookupProtocolName returns the name of IP protocol number, such as
+// "tcp" for 6, from the protocols database of the system, such as
+// /etc/protocols.
+func LookupProtocolName(number int) (string, error) {
+	protocolsDB.Lock()
+	readProtocols(testHookProtocolsPath)
+	name, ok := protocolsDB.byNumber[number]
+	protocolsDB.Unlock()
+	if ok {
+		return name, nil
+	}
+	for name, proto := range protocols {
+		if proto == number {
+			return name, nil
+		}
+	}
+	return "", &AddrError{Err: "unknown IP protocol specified", Addr: itoa.Itoa(number)}
+}
+
+// lookupProtocolFile looks up the number of the named IP protocol in
+// the protocols file.
+func lookupProtocolFile(name string) (int, bool) {
+	protocolsDB.Lock()
+	defer protocolsDB.Unlock()
+	readProtocols(testHookProtocolsPath)
+	proto, ok := protocolsDB.byName[toLowerASCII(name)]
+	return proto, ok
+}
+
+// readProtocols reads the protocols file at path into protocolsDB,
+// unless it was read less than cacheMaxAge ago or has not changed
+// since. It must be called with protocolsDB locked.
+func readProtocols(path string) {
+	now := clockNow()
+	if path == protocolsDB.path && now.Before(protocolsDB.expire) {
+		return
+	}
+	mtime, size, err := stat(path)
+	if err == nil && path == protocolsDB.path && protocolsDB.mtime.Equal(mtime) && protocolsDB.size == size {
+		protocolsDB.expire = now.Add(cacheMaxAge)
+		return
+	}
+	byName := make(map[string]int)
+	byNumber := make(map[int]string)
+	if file, err := open(path); err == nil {
+		for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+			// tcp    6   TCP    # transmission control protocol
+			if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+				line = line[0:i]
+			}
+			f := getFields(line)
+			if len(f) < 2 {
+				continue
+			}
+			proto, _, ok := dtoi(f[1])
+			if !ok {
+				continue
+			}
+			if _, ok := byNumber[proto]; !ok {
+				byNumber[proto] = f[0]
+			}
+			for i, name := range f {
+				if i == 1 { // f[1] was the number
+					continue
+				}
+				name = toLowerASCII(name)
+				if _, ok := byName[name]; !ok {
+					byName[name] = proto
+				}
+			}
+		}
+		file.close()
+	}
+	protocolsDB.byName = byName
+	protocolsDB.byNumber = byNumber
+	protocolsDB.path = path
+	protocolsDB.expire = now.Add(cacheMaxAge)
+	protocolsDB.mtime = mtime
+	protocolsDB.size = size
+}
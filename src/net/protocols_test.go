@@ -0,0 +1,39 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import "testing"
+
+func TestLookupProtocolNumber(t *testing.T) {
+	defer func(orig string) { testHookProtocolsPath = orig }(testHookProtocolsPath)
+	testHookProtocolsPath = "testdata/protocols"
+
+	for _, tt := range []struct {
+		name      string
+		number    int
+		canonical string
+	}{
+		{"tcp", 6, "tcp"},
+		{"TCP", 6, "tcp"},
+		{"gopher", 253, "gopher"},
+		{"Experimental", 253, "gopher"},
+		{"icmp", 1, "icmp"}, // from the built-in table
+	} {
+		number, err := LookupProtocolNumber(tt.name)
+		if err != nil || number != tt.number {
+			t.Errorf("LookupProtocolNumber(%q) = %d, %v; want %d", tt.name, number, err, tt.number)
+		}
+		name, err := LookupProtocolName(tt.number)
+		if err != nil || name != tt.canonical {
+			t.Errorf("LookupProtocolName(%d) = %q, %v; want %q", tt.number, name, err, tt.canonical)
+		}
+	}
+	if number, err := LookupProtocolNumber("bogus"); err == nil {
+		t.Errorf("LookupProtocolNumber(bogus) = %d; want error", number)
+	}
+	if name, err := LookupProtocolName(254); err == nil {
+		t.Errorf("LookupProtocolName(254) = %q; want error", name)
+	}
+}
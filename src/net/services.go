@@ -0,0 +1,218 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The services database, which maps service names to port numbers.
+
+package net
+
+import (
+	"internal/bytealg"
+	"internal/itoa"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A ServiceEntry is an entry of a services database, such as
+// /etc/services: the port number of a named service over a protocol.
+type ServiceEntry struct {
+	Name     string
+	Port     int
+	Protocol string // such as "tcp" or "udp"
+	Aliases  []string
+}
+
+var servicesPathOverride atomic.Pointer[string] // set by SetServicesPath
+
+// servicesDB holds the entries of the services file and those added
+// with AddServices.
+var servicesDB struct {
+	sync.Mutex
+
+	// The services file last read, by protocol and by name.
+	byProto map[string]map[string]int
+	path    string
+	expire  time.Time
+	mtime   time.Time
+	size    int64
+
+	// added holds the entries added with AddServices, by protocol
+	// and by name.
+	added map[string]map[string]int
+}
+
+// SetServicesPath sets the path of the services file consulted by
+// LookupPort, in place of the system's, such as /etc/services. The
+// file is used even when LookupPort would otherwise ask the C library,
+// which only knows of the system's file. An empty path removes the
+// override. As with the system's file, changes to the file are picked
+// up within a few seconds.
+func SetServicesPath(path string) {
+	servicesPathOverride.Store(&path)
+}
+
+// AddServices adds entries to those LookupPort finds, ahead of those of
+// the services file and of the system. Adding an entry for a name and
+// protocol that already has one replaces it.
+func AddServices(entries ...ServiceEntry) {
+	servicesDB.Lock()
+	defer servicesDB.Unlock()
+	if servicesDB.added == nil {
+		servicesDB.added = make(map[string]map[string]int)
+	}
+	for _, e := range entries {
+		addService(servicesDB.added, e.Protocol, e.Port, e.Name, e.Aliases...)
+	}
+}
+
+func addService(byProto map[string]map[string]int, proto string, port int, name string, aliases ...string) {
+	m, ok := byProto[proto]
+	if !ok {
+		m = make(map[string]int)
+		byProto[proto] = m
+	}
+	m[toLowerASCII(name)] = port
+	for _, alias := range aliases {
+		m[toLowerASCII(alias)] = port
+	}
+}
+
+// ParseServices parses a services file in the format of /etc/services,
+// in which each line holds the name of a service, its port number and
+// protocol, as in "80/tcp", and the aliases of the name, and '#' starts
+// a comment running to the end of the line.
+//
+// ParseServices skips the lines it cannot parse, and returns the
+// entries of the other lines along with a *ParseError for the first
+// line skipped, if any.
+func ParseServices(r io.Reader) ([]ServiceEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ServiceEntry
+	var perr error
+	for n := 1; len(data) > 0; n++ {
+		line := data
+		if i := bytealg.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		e, ok := parseServicesLine(string(line))
+		if !ok {
+			if perr == nil {
+				perr = &ParseError{Type: "services file line " + itoa.Itoa(n), Text: string(line)}
+			}
+			continue
+		}
+		if e.Name != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, perr
+}
+
+// parseServicesLine parses a line of a services file. Lines without an
+// entry, blank or holding only a comment, give an entry without a name.
+func parseServicesLine(line string) (e ServiceEntry, ok bool) {
+	// "http 80/tcp www www-http # World Wide Web HTTP"
+	if i := bytealg.IndexByteString(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	f := getFields(line)
+	if len(f) == 0 {
+		return e, true
+	}
+	if len(f) < 2 {
+		return e, false
+	}
+	portnet := f[1] // "80/tcp"
+	port, j, ok := dtoi(portnet)
+	if !ok || port <= 0 || port > 65535 || j >= len(portnet) || portnet[j] != '/' || j+1 == len(portnet) {
+		return e, false
+	}
+	e.Name = f[0]
+	e.Port = port
+	e.Protocol = portnet[j+1:] // "tcp"
+	if len(f) > 2 {
+		e.Aliases = f[2:]
+	}
+	return e, true
+}
+
+// readServices reads the services file at path into servicesDB, unless
+// it was read less than cacheMaxAge ago or has not changed since. It
+// must be called with servicesDB locked.
+func readServices(path string) {
+	now := clockNow()
+	if path == servicesDB.path && now.Before(servicesDB.expire) {
+		return
+	}
+	mtime, size, err := stat(path)
+	if err == nil && path == servicesDB.path && servicesDB.mtime.Equal(mtime) && servicesDB.size == size {
+		servicesDB.expire = now.Add(cacheMaxAge)
+		return
+	}
+	byProto := make(map[string]map[string]int)
+	if file, err := open(path); err == nil {
+		for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+			if e, ok := parseServicesLine(line); ok && e.Name != "" {
+				addService(byProto, e.Protocol, e.Port, e.Name, e.Aliases...)
+			}
+		}
+		file.close()
+	}
+	servicesDB.byProto = byProto
+	servicesDB.path = path
+	servicesDB.expire = now.Add(cacheMaxAge)
+	servicesDB.mtime = mtime
+	servicesDB.size = size
+}
+
+// lookupServicesDB looks up the port of service in the entries added
+// with AddServices and then, if file is set, in those of the services
+// file last read. It must be called with servicesDB locked.
+func lookupServicesDB(network, service string, file bool) (int, bool) {
+	switch network {
+	case "tcp4", "tcp6":
+		network = "tcp"
+	case "udp4", "udp6":
+		network = "udp"
+	}
+	service = toLowerASCII(service)
+	if port, ok := servicesDB.added[network][service]; ok {
+		return port, true
+	}
+	if file {
+		if port, ok := servicesDB.byProto[network][service]; ok {
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+// lookupServicesOverride looks up the port of service in the entries
+// added with AddServices and in the file set with SetServicesPath,
+// which take precedence over the system's services database.
+func lookupServicesOverride(network, service string) (int, bool) {
+	servicesDB.Lock()
+	defer servicesDB.Unlock()
+	p := servicesPathOverride.Load()
+	if p != nil && *p != "" {
+		readServices(*p)
+	}
+	return lookupServicesDB(network, service, p != nil && *p != "" && servicesDB.path == *p)
+}
+
+// toLowerASCII returns s with its ASCII letters lower cased.
+func toLowerASCII(s string) string {
+	if !hasUpperCase(s) {
+		return s
+	}
+	b := []byte(s)
+	lowerASCIIBytes(b)
+	return string(b)
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseServices(t *testing.T) {
+	f, err := os.Open("testdata/services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := ParseServices(f)
+	want := []ServiceEntry{
+		{Name: "gopher-admin", Port: 7070, Protocol: "tcp", Aliases: []string{"gadmin"}},
+		{Name: "gopher-admin", Port: 7071, Protocol: "udp"},
+		{Name: "metrics", Port: 9100, Protocol: "tcp", Aliases: []string{"Exporter"}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseServices = %v; want %v", entries, want)
+	}
+	perr, ok := err.(*ParseError)
+	if !ok || perr.Type != "services file line 5" {
+		t.Errorf("ParseServices error = %v; want invalid services file line 5", err)
+	}
+}
+
+func TestSetServicesPath(t *testing.T) {
+	defer func() {
+		SetServicesPath("")
+		servicesDB.Lock()
+		servicesDB.added = nil
+		servicesDB.Unlock()
+	}()
+	SetServicesPath("testdata/services")
+	AddServices(ServiceEntry{Name: "metrics", Port: 9200, Protocol: "tcp"})
+
+	tests := []struct {
+		network, service string
+		port             int
+	}{
+		{"tcp", "gopher-admin", 7070},
+		{"tcp4", "GADMIN", 7070},
+		{"udp", "gopher-admin", 7071},
+		{"tcp", "exporter", 9100},
+		{"tcp", "metrics", 9200}, // added entries come first
+	}
+	for _, tt := range tests {
+		port, err := LookupPort(tt.network, tt.service)
+		if err != nil || port != tt.port {
+			t.Errorf("LookupPort(%q, %q) = %d, %v; want %d", tt.network, tt.service, port, err, tt.port)
+		}
+	}
+	if port, err := LookupPort("tcp", "bogus"); err == nil {
+		t.Errorf("LookupPort(tcp, bogus) = %d; want error", port)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+// NetBIOS name queries, as made by Samba's "wins" source of
+// nsswitch.conf: see RFC 1001 and RFC 1002.
+
+package net
+
+import (
+	"context"
+	"internal/bytealg"
+	"time"
+)
+
+const (
+	netbiosNSPort = 137
+
+	// netbiosNameLen is the length of a NetBIOS name, whose last
+	// byte is a suffix giving the type of the name.
+	netbiosNameLen = 16
+
+	netbiosTypeNB   = 0x20 // NB resource records
+	netbiosFlagRD   = 0x0100
+	netbiosFlagB    = 0x0010 // broadcast
+	netbiosResponse = 0x8000
+
+	// winsTimeout is how long to wait for responses to a query.
+	winsTimeout = time.Second
+)
+
+// smbConfPath is the configuration of Samba, which names the WINS
+// servers.
+var smbConfPath = "/etc/samba/smb.conf"
+
+// isNetBIOSName reports whether name, without any trailing dot, can be
+// a NetBIOS name: a single label of at most 15 bytes.
+func isNetBIOSName(name string) bool {
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	return name != "" && len(name) < netbiosNameLen && bytealg.IndexByteString(name, '.') < 0
+}
+
+// winsServers returns the WINS servers in the global section of the
+// Samba configuration file.
+func winsServers(filename string) []string {
+	file, err := open(filename)
+	if err != nil {
+		return nil
+	}
+	defer file.close()
+	var servers []string
+	global := true
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		line = string(trimSpace([]byte(line)))
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			global = stringsEqualFold(line, "[global]")
+			continue
+		}
+		eq := bytealg.IndexByteString(line, '=')
+		if !global || eq < 0 {
+			continue
+		}
+		// Parameter names ignore case and spaces.
+		var key []byte
+		for i := 0; i < eq; i++ {
+			if c := line[i]; c != ' ' && c != '\t' {
+				key = append(key, lowerASCII(c))
+			}
+		}
+		if string(key) != "winsserver" {
+			continue
+		}
+		servers = nil
+		for _, s := range splitAtBytes(line[eq+1:], " \t,") {
+			// A server may be tagged, as in "eth0:192.0.2.1".
+			if i := bytealg.IndexByteString(s, ':'); i >= 0 {
+				s = s[i+1:]
+			}
+			if parseIPv4(s) != nil {
+				servers = append(servers, s)
+			}
+		}
+	}
+	return servers
+}
+
+// netbiosEncodeName returns the first-level encoding of the NetBIOS
+// name, in upper case and of type suffix, as a domain name label:
+// each nibble of the name padded with spaces is a letter from 'A'.
+func netbiosEncodeName(name string, suffix byte) []byte {
+	var n [netbiosNameLen]byte
+	for i := range n {
+		n[i] = ' '
+	}
+	for i := 0; i < len(name) && i < netbiosNameLen-1; i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		n[i] = c
+	}
+	n[netbiosNameLen-1] = suffix
+	b := make([]byte, 0, 2*netbiosNameLen+2)
+	b = append(b, 2*netbiosNameLen)
+	for _, c := range n {
+		b = append(b, 'A'+c>>4, 'A'+c&0xf)
+	}
+	return append(b, 0)
+}
+
+// winsLookupIP looks up the IPv4 addresses of name for network, asking
+// the WINS servers named in the Samba configuration, or else the local
+// networks by broadcast, as Samba does.
+func winsLookupIP(ctx context.Context, network, name string) ([]IPAddr, error) {
+	notFound := &DNSError{Err: errNoSuchHost.Error(), Name: name, IsNotFound: true}
+	if ipVersion(network) == '6' {
+		return nil, notFound
+	}
+	if stringsHasSuffix(name, ".") {
+		name = name[:len(name)-1]
+	}
+	c, err := ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var dsts []*UDPAddr
+	for _, s := range winsServers(smbConfPath) {
+		dsts = append(dsts, &UDPAddr{IP: parseIPv4(s), Port: netbiosNSPort})
+	}
+	bcast := len(dsts) == 0
+	if bcast {
+		dsts = netbiosBroadcastAddrs()
+	}
+	for _, dst := range dsts {
+		if addrs, err := winsQuery(ctx, c, dst, name, bcast); err == nil && len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, notFound
+}
+
+// netbiosBroadcastAddrs returns the broadcast addresses of the IPv4
+// networks of the interfaces that are up.
+func netbiosBroadcastAddrs() []*UDPAddr {
+	ifts, err := Interfaces()
+	if err != nil {
+		return nil
+	}
+	var dsts []*UDPAddr
+	for _, ifi := range ifts {
+		if ifi.Flags&FlagUp == 0 || ifi.Flags&FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipn, ok := a.(*IPNet)
+			if !ok || ipn.IP.To4() == nil || len(ipn.Mask) != IPv4len {
+				continue
+			}
+			ip := make(IP, IPv4len)
+			for i, b := range ipn.IP.To4() {
+				ip[i] = b | ^ipn.Mask[i]
+			}
+			dsts = append(dsts, &UDPAddr{IP: ip, Port: netbiosNSPort})
+		}
+	}
+	return dsts
+}
+
+// winsQuery sends a NetBIOS name query for name on c to dst, and returns
+// the addresses in the first positive response to arrive before
+// winsTimeout elapses.
+func winsQuery(ctx context.Context, c PacketConn, dst Addr, name string, bcast bool) ([]IPAddr, error) {
+	id := uint16(randInt())
+	flags := uint16(netbiosFlagRD)
+	if bcast {
+		flags |= netbiosFlagB
+	}
+	q := []byte{byte(id >> 8), byte(id), byte(flags >> 8), byte(flags), 0, 1, 0, 0, 0, 0, 0, 0}
+	q = append(q, netbiosEncodeName(name, 0x00)...)
+	q = append(q, 0, netbiosTypeNB, 0, 1) // NB, IN
+	if _, err := c.WriteTo(q, dst); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(winsTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetReadDeadline(deadline)
+	b := make([]byte, 576) // see RFC 1002, section 4.2.1
+	for {
+		n, _, err := c.ReadFrom(b)
+		if err != nil {
+			return nil, err
+		}
+		if addrs, ok := netbiosParseResponse(b[:n], id); ok {
+			return addrs, nil
+		}
+	}
+}
+
+// netbiosParseResponse returns the addresses in a positive name query
+// response to the query id.
+func netbiosParseResponse(b []byte, id uint16) ([]IPAddr, bool) {
+	if len(b) < 12 || uint16(b[0])<<8|uint16(b[1]) != id {
+		return nil, false
+	}
+	flags := uint16(b[2])<<8 | uint16(b[3])
+	if flags&netbiosResponse == 0 || flags&0xf != 0 || uint16(b[6])<<8|uint16(b[7]) == 0 {
+		return nil, false
+	}
+	off := 12
+	for qd := int(b[4])<<8 | int(b[5]); qd > 0; qd-- {
+		if off = netbiosSkipName(b, off); off < 0 || off+4 > len(b) {
+			return nil, false
+		}
+		off += 4
+	}
+	if off = netbiosSkipName(b, off); off < 0 || off+10 > len(b) {
+		return nil, false
+	}
+	typ := int(b[off])<<8 | int(b[off+1])
+	rdlen := int(b[off+8])<<8 | int(b[off+9])
+	off += 10
+	if typ != netbiosTypeNB || off+rdlen > len(b) {
+		return nil, false
+	}
+	var addrs []IPAddr
+	// Each address follows the NB flags of the name.
+	for rd := b[off : off+rdlen]; len(rd) >= 6; rd = rd[6:] {
+		addrs = append(addrs, IPAddr{IP: IPv4(rd[2], rd[3], rd[4], rd[5])})
+	}
+	return addrs, len(addrs) > 0
+}
+
+// netbiosSkipName returns the offset in b past the name at off, or -1.
+func netbiosSkipName(b []byte, off int) int {
+	for off < len(b) {
+		l := int(b[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xc0 == 0xc0:
+			// A compression pointer ends the name.
+			if off+2 > len(b) {
+				return -1
+			}
+			return off + 2
+		case l&0xc0 != 0:
+			return -1
+		}
+		off += 1 + l
+	}
+	return -1
+}
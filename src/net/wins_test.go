@@ -0,0 +1,89 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestNetBIOSEncodeName(t *testing.T) {
+	// See RFC 1001, section 14.1.
+	got := netbiosEncodeName("Fred", 0x20)
+	want := "\x20EGFCEFEECACACACACACACACACACACACA\x00"
+	if string(got) != want {
+		t.Errorf("netbiosEncodeName = %q; want %q", got, want)
+	}
+}
+
+func TestWINSServers(t *testing.T) {
+	got := winsServers("testdata/smb.conf")
+	want := []string{"192.0.2.1", "192.0.2.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("winsServers = %v; want %v", got, want)
+	}
+	if got := winsServers("testdata/nonexistent"); got != nil {
+		t.Errorf("winsServers of a missing file = %v", got)
+	}
+}
+
+func TestWINSQuery(t *testing.T) {
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 not supported")
+	}
+	srv, err := ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		b := make([]byte, 576)
+		n, from, err := srv.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		q := b[:n]
+		// A stray response to another query comes first.
+		resp := append([]byte{q[0] ^ 0xff, q[1], 0x85, 0, 0, 0, 0, 1, 0, 0, 0, 0}, q[12:12+34]...)
+		resp = append(resp, 0, 0x20, 0, 1, 0, 0, 0, 60, 0, 6, 0, 0, 10, 0, 0, 9)
+		srv.WriteTo(resp, from)
+		resp = append([]byte{q[0], q[1], 0x85, 0, 0, 0, 0, 1, 0, 0, 0, 0}, q[12:12+34]...)
+		resp = append(resp, 0, 0x20, 0, 1, 0, 0, 0, 60, 0, 12, 0, 0, 192, 0, 2, 7, 0x60, 0, 192, 0, 2, 8)
+		srv.WriteTo(resp, from)
+	}()
+	c, err := ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	addrs, err := winsQuery(context.Background(), c, srv.LocalAddr(), "fileserver", false)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IPAddr{{IP: IPv4(192, 0, 2, 7)}, {IP: IPv4(192, 0, 2, 8)}}
+	if !reflect.DeepEqual(addrs, want) {
+		t.Errorf("winsQuery = %v; want %v", addrs, want)
+	}
+}
+
+func TestIsNetBIOSName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"fileserver":        true,
+		"fileserver.":       true,
+		"":                  false,
+		"a.example":         false,
+		"averyveryverylong": false,
+	} {
+		if got := isNetBIOSName(name); got != want {
+			t.Errorf("isNetBIOSName(%q) = %v; want %v", name, got, want)
+		}
+	}
+}